@@ -78,8 +78,13 @@ func runForwarder(configPath string) {
 	util.Event(lifecycleLogger, slog.LevelInfo, "lifecycle.runtime_started")
 
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	sig := <-sigCh
+	for sig == syscall.SIGHUP {
+		// Reload reports its own outcome; a failed reload keeps the runtime.
+		_, _ = supervisor.Reload("signal")
+		sig = <-sigCh
+	}
 	util.Event(lifecycleLogger, slog.LevelInfo, "lifecycle.shutdown_requested", "signal", sig.String())
 	supervisor.Stop()
 	util.Event(lifecycleLogger, slog.LevelInfo, "lifecycle.shutdown_complete")
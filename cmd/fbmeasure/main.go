@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/NodePath81/fbforward/internal/util"
 	"github.com/NodePath81/fbforward/internal/version"
@@ -29,6 +30,7 @@ func main() {
 	listen := flag.String("listen", "127.0.0.1:9876", "TCP and UDP listen address")
 	logLevel := flag.String("log-level", "info", "Log level (debug, info, warn, error)")
 	logFormat := flag.String("log-format", "text", "Log format (text or json)")
+	keyFile := flag.String("key-file", "", "Shared key file; when set only authenticated frames are answered")
 	showVersion := flag.Bool("version", false, "Print version")
 	flag.Parse()
 
@@ -41,24 +43,59 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	server, err := fbmeasure.NewServer(fbmeasure.ServerConfig{ListenAddress: *listen})
+	var key []byte
+	if *keyFile != "" {
+		loaded, err := fbmeasure.LoadKeyFile(*keyFile)
+		if err != nil {
+			util.Event(logger, slog.LevelError, "fbmeasure.start_failed", "error", err)
+			os.Exit(1)
+		}
+		key = loaded
+	}
+	server, err := fbmeasure.NewServer(fbmeasure.ServerConfig{ListenAddress: *listen, Key: key})
 	if err != nil {
 		util.Event(logger, slog.LevelError, "fbmeasure.start_failed", "error", err)
 		os.Exit(1)
 	}
 	defer server.Close()
-	util.Event(logger, slog.LevelInfo, "fbmeasure.ready", "listen.addr", server.Addr().String(), "version", version.Version)
+	util.Event(logger, slog.LevelInfo, "fbmeasure.ready", "listen.addr", server.Addr().String(), "auth", key != nil, "version", version.Version)
+	if key != nil {
+		go logDrops(ctx, logger, server)
+	}
 	if err := server.Serve(ctx); err != nil {
 		util.Event(logger, slog.LevelError, "fbmeasure.serve_failed", "error", err)
 		os.Exit(1)
 	}
 }
 
+// logDrops reports the frames dropped for failing authentication once a
+// minute while the counts grow.
+func logDrops(ctx context.Context, logger *slog.Logger, server *fbmeasure.Server) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	var last fbmeasure.ServerStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := server.Stats()
+			if stats == last {
+				continue
+			}
+			util.Event(logger, slog.LevelWarn, "fbmeasure.frames_dropped",
+				"frames.unauthenticated", stats.Unauthenticated-last.Unauthenticated,
+				"frames.replayed", stats.Replayed-last.Replayed)
+			last = stats
+		}
+	}
+}
+
 func printHelp() {
 	fmt.Print(`fbmeasure - fixed small-packet RTT echo server
 
 Usage:
-  fbmeasure --listen <addr:port> [--log-level info] [--log-format text]
+  fbmeasure --listen <addr:port> [--key-file <path>] [--log-level info] [--log-format text]
   fbmeasure --version
 `)
 }
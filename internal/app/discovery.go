@@ -0,0 +1,309 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/resolver"
+	"github.com/NodePath81/fbforward/internal/upstream"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// srvMemberTag names the upstream created for one SRV record of group.
+func srvMemberTag(group string, record resolver.SRV) string {
+	return group + "/" + net.JoinHostPort(record.Target, strconv.Itoa(record.Port))
+}
+
+// resolveSRVUpstream turns the SRV records of item into member upstreams. A
+// target that does not resolve is skipped; the group fails only when no
+// target resolves. Members keep the upstream's priority; record priority and
+// weight are applied at selection time.
+func resolveSRVUpstream(ctx context.Context, item config.UpstreamConfig, res *resolver.Resolver) ([]*upstream.Upstream, time.Duration, error) {
+	records, ttl, err := res.LookupSRV(ctx, item.Destination.SRV)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(records) == 0 {
+		return nil, ttl, fmt.Errorf("srv %s: no records", item.Destination.SRV)
+	}
+	key, err := loadMeasureKey(item)
+	if err != nil {
+		return nil, ttl, err
+	}
+	members := make([]*upstream.Upstream, 0, len(records))
+	var errs []error
+	for _, record := range records {
+		ips, err := res.ResolveHost(ctx, record.Target)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		measureHost := item.Measurement.Host
+		if measureHost == "" {
+			measureHost = record.Target
+		}
+		member := &upstream.Upstream{
+			Tag:           srvMemberTag(item.Tag, record),
+			Host:          record.Target,
+			Port:          record.Port,
+			MeasureHost:   measureHost,
+			MeasurePort:   item.Measurement.Port,
+			ProbeType:     item.Measurement.Type,
+			HTTPProbe:     item.Measurement.HTTP,
+			MeasureKey:    key,
+			Priority:      item.Priority,
+			ProxyProtocol: item.ProxyProtocol,
+			IPs:           ips,
+			SRV: &upstream.SRVMember{
+				Group:    item.Tag,
+				Name:     item.Destination.SRV,
+				Target:   record.Target,
+				Priority: record.Priority,
+				Weight:   record.Weight,
+			},
+		}
+		member.SetActiveIP(ips[0])
+		members = append(members, member)
+	}
+	if len(members) == 0 {
+		return nil, ttl, fmt.Errorf("srv %s: no target resolved: %w", item.Destination.SRV, errors.Join(errs...))
+	}
+	return members, ttl, nil
+}
+
+// srvRefreshDelay clamps a record TTL to the configured refresh bounds.
+func srvRefreshDelay(ttl time.Duration, cfg config.DNSSRVConfig) time.Duration {
+	delay := ttl
+	if delay < cfg.MinRefresh.Duration() {
+		delay = cfg.MinRefresh.Duration()
+	}
+	if delay > cfg.MaxRefresh.Duration() {
+		delay = cfg.MaxRefresh.Duration()
+	}
+	return delay
+}
+
+// srvGroups maps each SRV upstream tag to its current member tags.
+func srvGroups(upstreams []*upstream.Upstream) map[string][]*upstream.Upstream {
+	groups := make(map[string][]*upstream.Upstream)
+	for _, up := range upstreams {
+		if up.SRV != nil {
+			groups[up.SRV.Group] = append(groups[up.SRV.Group], up)
+		}
+	}
+	return groups
+}
+
+// expandRoutes replaces SRV upstream tags in routes with their current
+// members. A member's weight is its record weight (at least 1), times the
+// route weight configured for the SRV upstream on weighted routes, so
+// weighted, round-robin and consistent-hash selection split a group by its
+// records.
+func expandRoutes(routes []config.RouteConfig, upstreams []*upstream.Upstream) []config.RouteConfig {
+	groups := srvGroups(upstreams)
+	if len(groups) == 0 {
+		return routes
+	}
+	expand := func(tags []string) []string {
+		out := make([]string, 0, len(tags))
+		for _, tag := range tags {
+			members, ok := groups[tag]
+			if !ok {
+				out = append(out, tag)
+				continue
+			}
+			for _, member := range members {
+				out = append(out, member.Tag)
+			}
+		}
+		return out
+	}
+	expanded := make([]config.RouteConfig, 0, len(routes))
+	for _, route := range routes {
+		if route.Strategy != upstream.StrategyStatic {
+			weights := make(map[string]int, len(route.Upstreams))
+			for tag, weight := range route.Weights {
+				weights[tag] = weight
+			}
+			for _, tag := range route.Upstreams {
+				members, ok := groups[tag]
+				if !ok {
+					continue
+				}
+				scale, ok := weights[tag]
+				if !ok {
+					scale = 1
+				}
+				delete(weights, tag)
+				for _, member := range members {
+					weights[member.Tag] = scale * max(member.SRV.Weight, 1)
+				}
+			}
+			if len(weights) > 0 {
+				route.Weights = weights
+			}
+		}
+		route.Upstreams = expand(route.Upstreams)
+		if len(route.SelectionRules) > 0 {
+			rules := make([]config.RouteSelectionRule, len(route.SelectionRules))
+			for i, rule := range route.SelectionRules {
+				rule.Upstreams = expand(rule.Upstreams)
+				rules[i] = rule
+			}
+			route.SelectionRules = rules
+		}
+		expanded = append(expanded, route)
+	}
+	return expanded
+}
+
+// setDiscovery publishes the refresh state of newly resolved SRV groups and
+// forgets groups that are no longer configured.
+func (r *Runtime) setDiscovery(discovered map[string]upstream.DiscoveryStatus) {
+	keep := make(map[string]struct{}, len(discovered))
+	for group, status := range discovered {
+		keep[group] = struct{}{}
+		r.manager.SetDiscoveryStatus(group, status)
+	}
+	r.manager.RetainDiscoveryStatus(keep)
+}
+
+// applyRoutes hands the configured routes, with SRV upstreams expanded to
+// their current members, to the route selector.
+func (r *Runtime) applyRoutes() {
+	if picker, ok := r.picker.(*upstreamPicker); ok && picker.routes != nil {
+		picker.routes.Replace(expandRoutes(r.cfg.Routes, r.upstreams))
+	}
+}
+
+// startSRVDiscovery re-resolves every SRV upstream when its records expire.
+func (r *Runtime) startSRVDiscovery() {
+	if r.srvCancel != nil {
+		r.srvCancel()
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.srvCancel = cancel
+	srvCfg := r.cfg.DNS.SRV
+	for _, item := range r.cfg.Upstreams {
+		if item.Destination.SRV == "" {
+			continue
+		}
+		item := item
+		delay := srvCfg.MinRefresh.Duration()
+		if status, ok := r.manager.DiscoveryStatus(item.Tag); ok {
+			delay = time.Until(status.NextRefreshAt)
+		}
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+					timer.Reset(r.refreshSRV(ctx, item, srvCfg))
+				}
+			}
+		}()
+	}
+}
+
+// refreshSRV resolves one SRV upstream and, when its records changed,
+// replaces the group's members in the manager, routes, metrics and probe
+// schedule. Retained members keep their health. A failed lookup keeps the
+// current members and retries after the minimum refresh interval.
+func (r *Runtime) refreshSRV(ctx context.Context, item config.UpstreamConfig, srvCfg config.DNSSRVConfig) time.Duration {
+	dnsLogger := util.ComponentLogger(r.logger, util.CompDNS)
+	members, ttl, err := resolveSRVUpstream(ctx, item, r.resolver)
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	if ctx.Err() != nil {
+		return srvCfg.MinRefresh.Duration()
+	}
+	now := time.Now()
+	status, _ := r.manager.DiscoveryStatus(item.Tag)
+	status.SRV = item.Destination.SRV
+	if err != nil {
+		util.Event(dnsLogger, slog.LevelWarn, "dns.srv_resolve_failed",
+			"upstream", item.Tag,
+			"dns.srv", item.Destination.SRV,
+			"error", err,
+		)
+		status.LastError = err.Error()
+		status.NextRefreshAt = now.Add(srvCfg.MinRefresh.Duration())
+		r.manager.SetDiscoveryStatus(item.Tag, status)
+		return srvCfg.MinRefresh.Duration()
+	}
+	delay := srvRefreshDelay(ttl, srvCfg)
+	status.TTLSeconds = ttl.Seconds()
+	status.RefreshedAt, status.NextRefreshAt = now, now.Add(delay)
+	status.LastError = ""
+
+	current := srvGroups(r.upstreams)[item.Tag]
+	if sameSRVMembers(current, members) {
+		for _, member := range members {
+			r.manager.UpdateResolved(member.Tag, member.IPs)
+		}
+		r.manager.SetDiscoveryStatus(item.Tag, status)
+		return delay
+	}
+	next := make([]*upstream.Upstream, 0, len(r.upstreams)-len(current)+len(members))
+	placed := false
+	for _, up := range r.upstreams {
+		if up.SRV != nil && up.SRV.Group == item.Tag {
+			if !placed {
+				next = append(next, members...)
+				placed = true
+			}
+			continue
+		}
+		next = append(next, up)
+	}
+	if !placed {
+		next = append(next, members...)
+	}
+	added, removed := r.manager.Reconcile(next)
+	r.upstreams = next
+	tags := make([]string, 0, len(next))
+	for _, up := range next {
+		tags = append(tags, up.Tag)
+	}
+	r.metrics.SetUpstreams(tags)
+	r.applyRoutes()
+	r.stopMeasurement()
+	r.startMeasurement()
+	r.startDNSRefresh()
+	util.Event(dnsLogger, slog.LevelInfo, "dns.srv_changed",
+		"upstream", item.Tag,
+		"dns.srv", item.Destination.SRV,
+		"upstreams.added", added,
+		"upstreams.removed", removed,
+	)
+	status.ChangedAt = &now
+	status.Added, status.Removed = added, removed
+	r.manager.SetDiscoveryStatus(item.Tag, status)
+	return delay
+}
+
+// sameSRVMembers reports whether two member sets have the same tags and
+// record attributes. Address changes alone do not replace members.
+func sameSRVMembers(current, next []*upstream.Upstream) bool {
+	if len(current) != len(next) {
+		return false
+	}
+	for i := range current {
+		if current[i].Tag != next[i].Tag || !reflect.DeepEqual(*current[i].SRV, *next[i].SRV) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/upstream"
+)
+
+func TestExpandRoutesReplacesSRVGroupWithMembers(t *testing.T) {
+	upstreams := []*upstream.Upstream{
+		{Tag: "local"},
+		{Tag: "app/a.example.test:9001", SRV: &upstream.SRVMember{Group: "app", Weight: 30}},
+		{Tag: "app/b.example.test:9002", SRV: &upstream.SRVMember{Group: "app", Weight: 0}},
+	}
+	routes := []config.RouteConfig{
+		{
+			Name:      "weighted",
+			Strategy:  upstream.StrategyWeighted,
+			Upstreams: []string{"local", "app"},
+			Weights:   map[string]int{"local": 10, "app": 2},
+		},
+		{
+			Name:      "adaptive",
+			Strategy:  upstream.StrategyAdaptive,
+			Upstreams: []string{"app"},
+			SelectionRules: []config.RouteSelectionRule{{
+				Name:      "lan",
+				CIDRs:     []string{"10.0.0.0/8"},
+				Upstreams: []string{"app", "local"},
+			}},
+		},
+	}
+
+	got := expandRoutes(routes, upstreams)
+	members := []string{"app/a.example.test:9001", "app/b.example.test:9002"}
+	if want := append([]string{"local"}, members...); !reflect.DeepEqual(got[0].Upstreams, want) {
+		t.Fatalf("weighted upstreams = %v, want %v", got[0].Upstreams, want)
+	}
+	wantWeights := map[string]int{"local": 10, "app/a.example.test:9001": 60, "app/b.example.test:9002": 2}
+	if !reflect.DeepEqual(got[0].Weights, wantWeights) {
+		t.Fatalf("weights = %v, want %v", got[0].Weights, wantWeights)
+	}
+	if want := map[string]int{"app/a.example.test:9001": 30, "app/b.example.test:9002": 1}; !reflect.DeepEqual(got[1].Weights, want) {
+		t.Fatalf("adaptive weights = %v, want %v", got[1].Weights, want)
+	}
+	if !reflect.DeepEqual(got[1].Upstreams, members) {
+		t.Fatalf("adaptive upstreams = %v, want %v", got[1].Upstreams, members)
+	}
+	if want := append(append([]string{}, members...), "local"); !reflect.DeepEqual(got[1].SelectionRules[0].Upstreams, want) {
+		t.Fatalf("rule upstreams = %v, want %v", got[1].SelectionRules[0].Upstreams, want)
+	}
+	if routes[0].Weights["app"] != 2 || routes[1].SelectionRules[0].Upstreams[0] != "app" {
+		t.Fatalf("expandRoutes modified the configured routes: %+v", routes)
+	}
+}
+
+func TestSRVRefreshDelayClampsTTL(t *testing.T) {
+	cfg := config.DNSSRVConfig{
+		MinRefresh: config.Duration(5 * time.Second),
+		MaxRefresh: config.Duration(time.Minute),
+	}
+	for _, tc := range []struct {
+		ttl, want time.Duration
+	}{
+		{0, 5 * time.Second},
+		{30 * time.Second, 30 * time.Second},
+		{time.Hour, time.Minute},
+	} {
+		if got := srvRefreshDelay(tc.ttl, cfg); got != tc.want {
+			t.Fatalf("srvRefreshDelay(%s) = %s, want %s", tc.ttl, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/notify"
+	"github.com/NodePath81/fbforward/internal/upstream"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// drainPollInterval is how often a drain counts the Flows still open.
+var drainPollInterval = time.Second
+
+// DrainUpstream stops assigning new Flows to tag, an upstream or SRV upstream
+// group, and watches its open Flows until they end. After a positive
+// deadline the remaining Flows are closed. The upstream stays out of
+// selection until UndrainUpstream.
+func (r *Runtime) DrainUpstream(tag string, deadline time.Duration) (upstream.DrainStatus, error) {
+	tag = strings.TrimSpace(tag)
+	var at time.Time
+	if deadline > 0 {
+		at = time.Now().Add(deadline)
+	}
+	status, err := r.manager.StartDrain(tag, at)
+	if err != nil {
+		return upstream.DrainStatus{}, err
+	}
+	util.Event(util.ComponentLogger(r.logger, util.CompUpstream), slog.LevelInfo, "upstream.drain_started",
+		"upstream", tag,
+		"drain.deadline", deadline,
+		"flows.active", r.drainFlows(tag),
+	)
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.drainMu.Lock()
+	if r.drainCancel == nil {
+		r.drainCancel = make(map[string]context.CancelFunc)
+	}
+	if previous := r.drainCancel[tag]; previous != nil {
+		previous()
+	}
+	r.drainCancel[tag] = cancel
+	r.drainMu.Unlock()
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.watchDrain(ctx, tag, at)
+	}()
+	return status, nil
+}
+
+// UndrainUpstream returns tag to selection and stops watching its Flows.
+func (r *Runtime) UndrainUpstream(tag string) error {
+	tag = strings.TrimSpace(tag)
+	r.drainMu.Lock()
+	if cancel := r.drainCancel[tag]; cancel != nil {
+		cancel()
+		delete(r.drainCancel, tag)
+	}
+	r.drainMu.Unlock()
+	if !r.manager.StopDrain(tag) {
+		return fmt.Errorf("upstream %q: %w", tag, upstream.ErrNotDraining)
+	}
+	util.Event(util.ComponentLogger(r.logger, util.CompUpstream), slog.LevelInfo, "upstream.drain_stopped", "upstream", tag)
+	return nil
+}
+
+// Drains lists the current drains.
+func (r *Runtime) Drains() []upstream.DrainStatus {
+	return r.manager.Drains()
+}
+
+// watchDrain records when the last Flow of tag ends and closes the Flows
+// still open at the deadline. It stops once drained, when the drain is
+// cancelled, or when the upstream is removed by a reload.
+func (r *Runtime) watchDrain(ctx context.Context, tag string, deadline time.Time) {
+	logger := util.ComponentLogger(r.logger, util.CompUpstream)
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	closed := false
+	for {
+		if _, ok := r.manager.Drain(tag); !ok {
+			return
+		}
+		now := time.Now()
+		if r.drainFlows(tag) == 0 {
+			r.manager.MarkDrained(tag, now)
+			util.Event(logger, slog.LevelInfo, "upstream.drain_completed", "upstream", tag, "drain.closed", closed)
+			if r.notifier != nil {
+				r.notifier.Emit("upstream.drained", notify.SeverityInfo, map[string]any{
+					"upstream.tag": tag,
+					"drain.closed": closed,
+				})
+			}
+			return
+		}
+		if !closed && !deadline.IsZero() && !now.Before(deadline) {
+			closed = true
+			remaining := r.closeDrainFlows(tag)
+			r.manager.MarkDrainClosed(tag, now)
+			util.Event(logger, slog.LevelWarn, "upstream.drain_deadline_reached", "upstream", tag, "flows.closed", remaining)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainFlows counts the open Flows of tag or of its SRV members.
+func (r *Runtime) drainFlows(tag string) int {
+	count := 0
+	for member, active := range r.flowRegistry.ActiveByUpstream("") {
+		if drainMember(tag, member) {
+			count += active
+		}
+	}
+	return count
+}
+
+// closeDrainFlows closes the open Flows of tag and of its SRV members and
+// returns how many were open.
+func (r *Runtime) closeDrainFlows(tag string) int {
+	count := 0
+	for member, active := range r.flowRegistry.ActiveByUpstream("") {
+		if drainMember(tag, member) {
+			count += active
+			r.flowRegistry.CloseByUpstream(member)
+		}
+	}
+	return count
+}
+
+func drainMember(tag, member string) bool {
+	return member == tag || strings.HasPrefix(member, tag+"/")
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/flow"
+	"github.com/NodePath81/fbforward/internal/upstream"
+)
+
+func TestDrainUpstreamClosesRemainingFlowsAtDeadline(t *testing.T) {
+	previous := drainPollInterval
+	drainPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { drainPollInterval = previous })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rt := &Runtime{
+		ctx:          ctx,
+		manager:      upstream.NewUpstreamManager([]*upstream.Upstream{{Tag: "app/a:80", SRV: &upstream.SRVMember{Group: "app"}}, {Tag: "other"}}, nil),
+		flowRegistry: flow.NewRegistry(),
+	}
+	t.Cleanup(func() { cancel(); rt.wg.Wait() })
+	closed := make(chan struct{})
+	for _, tag := range []string{"app/a:80", "other"} {
+		id, err := flow.NewID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		onClose := func() {}
+		if tag != "other" {
+			onClose = func() { rt.flowRegistry.Unregister(id); close(closed) }
+		}
+		rt.flowRegistry.Register(flow.Meta{ID: id, Upstream: tag}, onClose)
+	}
+
+	if _, err := rt.DrainUpstream("app", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if !rt.manager.Draining("app/a:80") {
+		t.Fatal("expected the SRV member to drain with its group")
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the deadline to close the member Flow")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status, _ := rt.manager.Drain("app")
+		if status.DrainedAt != nil {
+			if status.ClosedAt == nil {
+				t.Fatalf("expected the drain to record the forced close: %+v", status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("drain did not complete: %+v", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := rt.flowRegistry.ActiveByUpstream("")["other"]; got != 1 {
+		t.Fatalf("expected the unrelated Flow to stay open, got %d", got)
+	}
+	if err := rt.UndrainUpstream("app"); err != nil || rt.manager.Draining("app/a:80") {
+		t.Fatalf("expected undrain to return the member to selection, err=%v", err)
+	}
+}
@@ -2,12 +2,15 @@ package app
 
 import (
 	"fmt"
+	"net"
 	"net/netip"
+	"strconv"
 	"time"
 
 	"github.com/NodePath81/fbforward/internal/config"
 	"github.com/NodePath81/fbforward/internal/flow"
 	"github.com/NodePath81/fbforward/internal/forwarding"
+	"github.com/NodePath81/fbforward/internal/geoip"
 	"github.com/NodePath81/fbforward/internal/metrics"
 	"github.com/NodePath81/fbforward/internal/policy"
 	"github.com/NodePath81/fbforward/internal/upstream"
@@ -24,31 +27,119 @@ func (p *upstreamPicker) Pick(meta flow.Meta) (forwarding.Upstream, error) {
 		return forwarding.Upstream{}, fmt.Errorf("upstream picker is unavailable")
 	}
 	var selected *upstream.Upstream
+	var status upstream.RouteStatus
 	var err error
 	if p.routes != nil && p.routes.HasRoutes() {
-		selected, _, err = p.routes.Pick(meta.Route)
+		selected, status, err = p.routes.PickFor(meta.Route, meta.ClientAddr.Addr())
 	} else {
 		selected, err = p.manager.SelectAdaptiveFrom(nil)
 	}
 	if err != nil {
 		return forwarding.Upstream{}, err
 	}
+	result, err := p.resolved(meta, selected, status)
+	if err == nil && p.metrics != nil {
+		p.metrics.SetRouteSelected(meta.Route, selected.Tag)
+	}
+	return result, err
+}
+
+// PickHedged is Pick for TCP Flows. On routes that hedge connects it also
+// returns the next adaptive candidate; a hedge without a usable address is
+// dropped rather than failing the Flow.
+func (p *upstreamPicker) PickHedged(meta flow.Meta) (forwarding.Upstream, forwarding.Upstream, time.Duration, error) {
+	if p == nil || p.routes == nil || !p.routes.HasRoutes() {
+		primary, err := p.Pick(meta)
+		return primary, forwarding.Upstream{}, 0, err
+	}
+	if p.manager == nil {
+		return forwarding.Upstream{}, forwarding.Upstream{}, 0, fmt.Errorf("upstream picker is unavailable")
+	}
+	selected, hedge, status, err := p.routes.PickHedged(meta.Route, meta.ClientAddr.Addr())
+	if err != nil {
+		return forwarding.Upstream{}, forwarding.Upstream{}, 0, err
+	}
+	primary, err := p.resolved(meta, selected, status)
+	if err != nil {
+		return forwarding.Upstream{}, forwarding.Upstream{}, 0, err
+	}
+	if p.metrics != nil {
+		p.metrics.SetRouteSelected(meta.Route, selected.Tag)
+	}
+	if hedge == nil {
+		return primary, forwarding.Upstream{}, 0, nil
+	}
+	second, err := p.resolved(meta, hedge, status)
+	if err != nil {
+		return primary, forwarding.Upstream{}, 0, nil
+	}
+	delay, _ := p.routes.HedgeDelay(meta.Route)
+	return primary, second, delay, nil
+}
+
+// resolved converts a selected upstream into the forwarding value.
+func (p *upstreamPicker) resolved(meta flow.Meta, selected *upstream.Upstream, status upstream.RouteStatus) (forwarding.Upstream, error) {
 	if selected == nil {
 		return forwarding.Upstream{}, fmt.Errorf("upstream picker returned nil upstream")
 	}
+	addrs, err := p.dialAddrs(selected)
+	if err != nil {
+		return forwarding.Upstream{}, err
+	}
+	result := p.forwardingUpstream(meta, selected, addrs)
+	result.SelectionRule = status.SelectionRule
+	return result, nil
+}
+
+// dialAddrs returns every usable address of selected in dial order. The
+// active IP is required so an upstream that never resolved stays unusable.
+func (p *upstreamPicker) dialAddrs(selected *upstream.Upstream) ([]netip.Addr, error) {
 	ip := selected.ActiveIP()
 	if ip == nil {
-		return forwarding.Upstream{}, fmt.Errorf("upstream %q has no active IP", selected.Tag)
+		return nil, fmt.Errorf("upstream %q has no active IP", selected.Tag)
 	}
-	addr, ok := netip.AddrFromSlice(ip)
-	if !ok {
-		return forwarding.Upstream{}, fmt.Errorf("upstream %q has invalid active IP %q", selected.Tag, ip.String())
+	if _, ok := netip.AddrFromSlice(ip); !ok {
+		return nil, fmt.Errorf("upstream %q has invalid active IP %q", selected.Tag, ip.String())
 	}
-	addr = addr.Unmap()
-	if p.metrics != nil {
-		p.metrics.SetRouteSelected(meta.Route, selected.Tag)
+	ips := p.manager.DialAddresses(selected.Tag)
+	if len(ips) == 0 {
+		ips = []net.IP{ip}
+	}
+	addrs := make([]netip.Addr, 0, len(ips))
+	for _, ip := range ips {
+		if addr, ok := netip.AddrFromSlice(ip); ok {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	return addrs, nil
+}
+
+func (p *upstreamPicker) forwardingUpstream(meta flow.Meta, selected *upstream.Upstream, addrs []netip.Addr) forwarding.Upstream {
+	result := forwarding.Upstream{Tag: selected.Tag, Addr: addrs[0], Addrs: addrs, Port: selected.Port, ProxyProtocol: selected.ProxyProtocol}
+	if p.routes != nil {
+		result.Port = p.routes.DestinationPort(meta.Route, selected, listenerPort(meta.Listener))
+		result.ProxyProtocol = p.routes.ProxyProtocol(meta.Route, selected)
 	}
-	return forwarding.Upstream{Tag: selected.Tag, Addr: addr}, nil
+	return result
+}
+
+// geoClientLookup adapts the GeoIP manager to route selection rules.
+type geoClientLookup struct {
+	manager *geoip.Manager
+}
+
+func (g geoClientLookup) LookupClient(addr netip.Addr) (string, int) {
+	result := g.manager.Lookup(addr.AsSlice())
+	return result.Country, result.ASN
+}
+
+func listenerPort(listener string) int {
+	if _, port, err := net.SplitHostPort(listener); err == nil {
+		if value, err := strconv.Atoi(port); err == nil {
+			return value
+		}
+	}
+	return 0
 }
 
 func newUpstreamPicker(manager *upstream.UpstreamManager, routes []config.RouteConfig) *upstreamPicker {
@@ -69,6 +160,20 @@ func (p *upstreamPicker) ClearRouteOverride(route string) error {
 	return p.routes.ClearOverride(route)
 }
 
+func (p *upstreamPicker) RouteAffinity(route string) ([]upstream.AffinityEntry, error) {
+	if p == nil || p.routes == nil {
+		return nil, fmt.Errorf("route selector is unavailable")
+	}
+	return p.routes.Affinity(route)
+}
+
+func (p *upstreamPicker) ClearRouteAffinity(route, client string) (int, error) {
+	if p == nil || p.routes == nil {
+		return 0, fmt.Errorf("route selector is unavailable")
+	}
+	return p.routes.ClearAffinity(route, client)
+}
+
 func (p *upstreamPicker) RouteStatus() []upstream.RouteStatus {
 	if p == nil || p.routes == nil {
 		return nil
@@ -84,18 +189,14 @@ func (p *upstreamPicker) PickOverride(meta flow.Meta, tag string) (forwarding.Up
 	if selected == nil {
 		return forwarding.Upstream{}, fmt.Errorf("upstream %q not found", tag)
 	}
-	ip := selected.ActiveIP()
-	if ip == nil {
-		return forwarding.Upstream{}, fmt.Errorf("upstream %q has no active IP", tag)
-	}
-	addr, ok := netip.AddrFromSlice(ip)
-	if !ok {
-		return forwarding.Upstream{}, fmt.Errorf("upstream %q has invalid active IP %q", tag, ip.String())
+	addrs, err := p.dialAddrs(selected)
+	if err != nil {
+		return forwarding.Upstream{}, err
 	}
 	if p.metrics != nil {
 		p.metrics.SetRouteSelected(meta.Route, selected.Tag)
 	}
-	return forwarding.Upstream{Tag: selected.Tag, Addr: addr.Unmap()}, nil
+	return p.forwardingUpstream(meta, selected, addrs), nil
 }
 
 func (p *upstreamPicker) MarkDialFailure(selected forwarding.Upstream, cooldown time.Duration) {
@@ -110,6 +211,24 @@ func (p *upstreamPicker) ClearDialFailure(selected forwarding.Upstream) {
 	}
 }
 
+func (p *upstreamPicker) RecordFlowOutcome(tag, signal string) {
+	if p != nil && p.manager != nil {
+		p.manager.RecordFlowOutcome(tag, signal)
+	}
+}
+
+func (p *upstreamPicker) MarkAddressFailure(selected forwarding.Upstream, addr netip.Addr, cooldown time.Duration, cause error) {
+	if p != nil && p.manager != nil {
+		p.manager.MarkAddressFailure(selected.Tag, net.IP(addr.AsSlice()), cooldown, cause)
+	}
+}
+
+func (p *upstreamPicker) ClearAddressFailure(selected forwarding.Upstream, addr netip.Addr) {
+	if p != nil && p.manager != nil {
+		p.manager.ClearAddressFailure(selected.Tag, net.IP(addr.AsSlice()))
+	}
+}
+
 type firewallPolicy struct {
 	provider       *policy.Provider
 	onlineProvider *policy.OnlineProvider
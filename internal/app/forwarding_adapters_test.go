@@ -94,6 +94,68 @@ func TestUpstreamPickerOverrideRecordsRouteSelection(t *testing.T) {
 	}
 }
 
+func TestUpstreamPickerResolvesDestinationPort(t *testing.T) {
+	makeUpstream := func(tag, ip string, port int) *upstream.Upstream {
+		up := &upstream.Upstream{Tag: tag, Port: port}
+		up.SetActiveIP(net.ParseIP(ip))
+		return up
+	}
+	manager := upstream.NewUpstreamManager([]*upstream.Upstream{
+		makeUpstream("plain", "203.0.113.10", 0),
+		makeUpstream("fixed", "203.0.113.11", 9443),
+	}, nil)
+	picker := newUpstreamPicker(manager, []config.RouteConfig{
+		{Name: "mapped", Strategy: "static", Upstreams: []string{"fixed"}, Ports: map[int]int{443: 8443}},
+		{Name: "fixed", Strategy: "static", Upstreams: []string{"fixed"}, PortOffset: 1000},
+		{Name: "offset", Strategy: "static", Upstreams: []string{"plain"}, PortOffset: 8000},
+		{Name: "plain", Strategy: "static", Upstreams: []string{"plain"}},
+	})
+	for _, test := range []struct {
+		route    string
+		listener string
+		want     int
+	}{
+		{"mapped", "0.0.0.0:443", 8443},
+		{"mapped", "0.0.0.0:80", 9443},
+		{"fixed", "0.0.0.0:443", 9443},
+		{"offset", "[::]:443", 8443},
+		{"plain", "0.0.0.0:443", 0},
+	} {
+		got, err := picker.Pick(flow.Meta{Route: test.route, Listener: test.listener})
+		if err != nil {
+			t.Fatalf("%s Pick error: %v", test.route, err)
+		}
+		if got.Port != test.want {
+			t.Fatalf("%s via %s port=%d, want %d", test.route, test.listener, got.Port, test.want)
+		}
+	}
+}
+
+func TestUpstreamPickerUpstreamProxyProtocolWinsOverRoute(t *testing.T) {
+	makeUpstream := func(tag, ip, proxy string) *upstream.Upstream {
+		up := &upstream.Upstream{Tag: tag, ProxyProtocol: proxy}
+		up.SetActiveIP(net.ParseIP(ip))
+		return up
+	}
+	manager := upstream.NewUpstreamManager([]*upstream.Upstream{
+		makeUpstream("haproxy", "203.0.113.10", "v1"),
+		makeUpstream("nginx", "203.0.113.11", ""),
+	}, nil)
+	picker := newUpstreamPicker(manager, []config.RouteConfig{
+		{Name: "pinned", Strategy: "static", Upstreams: []string{"haproxy"}, ProxyProtocol: "v2"},
+		{Name: "default", Strategy: "static", Upstreams: []string{"nginx"}, ProxyProtocol: "v2"},
+	})
+	for route, want := range map[string]string{"pinned": "v1", "default": "v2"} {
+		got, err := picker.Pick(flow.Meta{Route: route})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ProxyProtocol != want {
+			t.Fatalf("%s proxy protocol = %q, want %q", route, got.ProxyProtocol, want)
+		}
+	}
+}
+
 var _ forwarding.AdmissionPolicy = (*firewallPolicy)(nil)
 var _ forwarding.UpstreamPicker = (*upstreamPicker)(nil)
 var _ forwarding.DialFeedback = (*upstreamPicker)(nil)
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/audit"
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/control"
+	"github.com/NodePath81/fbforward/internal/notify"
+	"github.com/NodePath81/fbforward/internal/upstream"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// maintenancePollInterval is how often maintenance windows are evaluated.
+var maintenancePollInterval = time.Second
+
+// maintenanceWindow is a configured or stored window of one upstream.
+type maintenanceWindow struct {
+	id       string
+	upstream string
+	source   string
+	window   config.MaintenanceWindowConfig
+	stored   *audit.MaintenanceWindow
+	// end is the end of the current occurrence while the window is active.
+	end time.Time
+}
+
+// maintenanceState is what the last evaluation found active. owned lists the
+// upstreams whose drain was started by a window rather than by an operator,
+// and cutoffs the close_after cutoff their drain was given.
+type maintenanceState struct {
+	stored  []audit.MaintenanceWindow
+	windows map[string]maintenanceWindow
+	tags    map[string]struct{}
+	owned   map[string]struct{}
+	cutoffs map[string]time.Time
+}
+
+// startMaintenance loads the stored windows and evaluates every window once
+// per maintenancePollInterval.
+func (r *Runtime) startMaintenance() {
+	if r.auditStore != nil {
+		stored, err := r.auditStore.ListMaintenanceWindows()
+		if err != nil {
+			util.Event(util.ComponentLogger(r.logger, util.CompUpstream), slog.LevelWarn, "upstream.maintenance_load_failed", "error", err)
+		}
+		r.maintenanceMu.Lock()
+		r.maintenance.stored = stored
+		r.maintenanceMu.Unlock()
+	}
+	r.evaluateMaintenance(time.Now())
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(maintenancePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case now := <-ticker.C:
+				r.evaluateMaintenance(now)
+			}
+		}
+	}()
+}
+
+// maintenanceWindows lists the windows of the configuration file followed by
+// the stored ones. Configured windows are identified by upstream and index.
+func (r *Runtime) maintenanceWindows() []maintenanceWindow {
+	r.maintenanceMu.Lock()
+	defer r.maintenanceMu.Unlock()
+	return r.maintenanceWindowsLocked()
+}
+
+func (r *Runtime) maintenanceWindowsLocked() []maintenanceWindow {
+	r.reloadMu.Lock()
+	upstreams := r.cfg.Upstreams
+	r.reloadMu.Unlock()
+	var out []maintenanceWindow
+	for _, up := range upstreams {
+		for i, window := range up.Maintenance {
+			out = append(out, maintenanceWindow{id: fmt.Sprintf("config:%s:%d", up.Tag, i), upstream: up.Tag, source: "config", window: window})
+		}
+	}
+	for _, stored := range r.maintenance.stored {
+		out = append(out, maintenanceWindow{id: stored.WindowID, upstream: stored.Upstream, source: "api", window: stored.Window, stored: &stored})
+	}
+	return out
+}
+
+// evaluateMaintenance starts and ends windows at now. An upstream drains
+// while any of its windows is active; its earliest close_after cutoff closes
+// the remaining Flows, and a later overlapping window with an earlier cutoff
+// moves the cutoff forward. A drain started by an operator is left alone, both
+// when a window starts and when it ends. Unusable alerts for the upstream are
+// suppressed for the duration.
+func (r *Runtime) evaluateMaintenance(now time.Time) {
+	logger := util.ComponentLogger(r.logger, util.CompUpstream)
+	r.maintenanceMu.Lock()
+	defer r.maintenanceMu.Unlock()
+	active := make(map[string]maintenanceWindow)
+	tags := make(map[string]struct{})
+	cutoffs := make(map[string]time.Time)
+	windows := r.maintenanceWindowsLocked()
+	for _, item := range windows {
+		start, end, ok := item.window.ActiveAt(now)
+		if !ok {
+			continue
+		}
+		item.end = end
+		active[item.id] = item
+		tags[item.upstream] = struct{}{}
+		if item.window.CloseAfter > 0 {
+			cutoff := start.Add(item.window.CloseAfter.Duration())
+			if current, ok := cutoffs[item.upstream]; !ok || cutoff.Before(current) {
+				cutoffs[item.upstream] = cutoff
+			}
+		}
+	}
+
+	state := &r.maintenance
+	if state.owned == nil {
+		state.owned = make(map[string]struct{})
+		state.cutoffs = make(map[string]time.Time)
+	}
+	for id, item := range active {
+		if _, ok := state.windows[id]; !ok {
+			util.Event(logger, slog.LevelInfo, "upstream.maintenance_started", "upstream", item.upstream, "maintenance.window", id, "maintenance.ends_at", item.end)
+			r.emitMaintenance("upstream.maintenance_started", item)
+		}
+	}
+	for id, item := range state.windows {
+		if _, ok := active[id]; !ok {
+			util.Event(logger, slog.LevelInfo, "upstream.maintenance_ended", "upstream", item.upstream, "maintenance.window", id)
+			item.end = time.Time{}
+			r.emitMaintenance("upstream.maintenance_ended", item)
+		}
+	}
+	for tag := range tags {
+		cutoff, hasCutoff := cutoffs[tag]
+		if _, ok := state.tags[tag]; ok {
+			// An owned drain takes the earliest cutoff of the windows now
+			// active, including one that started after the drain.
+			applied, hasApplied := state.cutoffs[tag]
+			if _, owned := state.owned[tag]; !owned || !hasCutoff || hasApplied && !cutoff.Before(applied) {
+				continue
+			}
+		} else {
+			if r.notifyPolicy != nil {
+				r.notifyPolicy.SetSuppressed(tag, true)
+			}
+			if r.manager.Draining(tag) {
+				continue
+			}
+		}
+		var deadline time.Duration
+		if hasCutoff {
+			deadline = max(cutoff.Sub(now), time.Nanosecond)
+		}
+		if _, err := r.DrainUpstream(tag, deadline); err != nil {
+			util.Event(logger, slog.LevelWarn, "upstream.maintenance_drain_failed", "upstream", tag, "error", err)
+			continue
+		}
+		state.owned[tag] = struct{}{}
+		if hasCutoff {
+			state.cutoffs[tag] = cutoff
+		}
+	}
+	for tag := range state.tags {
+		if _, ok := tags[tag]; ok {
+			continue
+		}
+		if r.notifyPolicy != nil {
+			r.notifyPolicy.SetSuppressed(tag, false)
+		}
+		if _, ok := state.owned[tag]; ok {
+			delete(state.owned, tag)
+			delete(state.cutoffs, tag)
+			_ = r.UndrainUpstream(tag)
+		}
+	}
+	state.windows, state.tags = active, tags
+}
+
+func (r *Runtime) emitMaintenance(event string, item maintenanceWindow) {
+	if r.notifier == nil {
+		return
+	}
+	attributes := map[string]any{
+		"upstream.tag":       item.upstream,
+		"maintenance.window": item.id,
+	}
+	if item.window.Name != "" {
+		attributes["maintenance.name"] = item.window.Name
+	}
+	if !item.end.IsZero() {
+		attributes["maintenance.ends_at"] = item.end.UTC().Format(time.RFC3339)
+	}
+	r.notifier.Emit(event, notify.SeverityInfo, attributes)
+}
+
+// MaintenanceWindows lists every window with its current state.
+func (r *Runtime) MaintenanceWindows() []control.MaintenanceWindowStatus {
+	now := time.Now()
+	windows := r.maintenanceWindows()
+	out := make([]control.MaintenanceWindowStatus, 0, len(windows))
+	for _, item := range windows {
+		out = append(out, item.status(now))
+	}
+	return out
+}
+
+// CreateMaintenanceWindow validates window and stores it for upstream tag.
+func (r *Runtime) CreateMaintenanceWindow(tag string, window config.MaintenanceWindowConfig, createdBy string) (control.MaintenanceWindowStatus, error) {
+	if r.auditStore == nil {
+		return control.MaintenanceWindowStatus{}, control.ErrMaintenanceStoreUnavailable
+	}
+	r.reloadMu.Lock()
+	known := slices.ContainsFunc(r.cfg.Upstreams, func(up config.UpstreamConfig) bool { return up.Tag == tag })
+	r.reloadMu.Unlock()
+	if !known {
+		return control.MaintenanceWindowStatus{}, fmt.Errorf("upstream %q: %w", tag, upstream.ErrUnknownUpstream)
+	}
+	if err := window.Validate(); err != nil {
+		return control.MaintenanceWindowStatus{}, err
+	}
+	stored, err := r.auditStore.CreateMaintenanceWindow(audit.MaintenanceWindow{Upstream: tag, Window: window, CreatedBy: createdBy})
+	if err != nil {
+		return control.MaintenanceWindowStatus{}, err
+	}
+	r.maintenanceMu.Lock()
+	r.maintenance.stored = append(r.maintenance.stored, stored)
+	r.maintenanceMu.Unlock()
+	now := time.Now()
+	r.evaluateMaintenance(now)
+	return maintenanceWindow{id: stored.WindowID, upstream: tag, source: "api", window: stored.Window, stored: &stored}.status(now), nil
+}
+
+// DeleteMaintenanceWindow removes a stored window. A window that is active
+// ends immediately.
+func (r *Runtime) DeleteMaintenanceWindow(id string) error {
+	if strings.HasPrefix(id, "config:") {
+		return control.ErrConfiguredMaintenanceWindow
+	}
+	if r.auditStore == nil {
+		return control.ErrMaintenanceStoreUnavailable
+	}
+	if err := r.auditStore.DeleteMaintenanceWindow(id); err != nil {
+		return err
+	}
+	r.maintenanceMu.Lock()
+	r.maintenance.stored = slices.DeleteFunc(r.maintenance.stored, func(w audit.MaintenanceWindow) bool { return w.WindowID == id })
+	r.maintenanceMu.Unlock()
+	r.evaluateMaintenance(time.Now())
+	return nil
+}
+
+func (w maintenanceWindow) status(now time.Time) control.MaintenanceWindowStatus {
+	status := control.NewMaintenanceWindowStatus(w.id, w.upstream, w.source, w.window, now)
+	if w.stored != nil {
+		createdAt := w.stored.CreatedAt
+		status.CreatedBy, status.CreatedAt = w.stored.CreatedBy, &createdAt
+	}
+	return status
+}
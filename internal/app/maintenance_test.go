@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/flow"
+	"github.com/NodePath81/fbforward/internal/upstream"
+)
+
+func TestMaintenanceWindowDrainsUpstreamAndLeavesOperatorDrains(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Date(2026, 11, 1, 2, 0, 0, 0, time.UTC)
+	window := config.MaintenanceWindowConfig{Start: start.Format(time.RFC3339), End: start.Add(time.Hour).Format(time.RFC3339), CloseAfter: config.Duration(10 * time.Minute)}
+	rt := &Runtime{
+		ctx:          ctx,
+		manager:      upstream.NewUpstreamManager([]*upstream.Upstream{{Tag: "a"}, {Tag: "b"}}, nil),
+		flowRegistry: flow.NewRegistry(),
+		cfg: config.Config{Upstreams: []config.UpstreamConfig{
+			{Tag: "a", Maintenance: []config.MaintenanceWindowConfig{window}},
+			{Tag: "b", Maintenance: []config.MaintenanceWindowConfig{window}},
+		}},
+	}
+	t.Cleanup(func() { cancel(); rt.wg.Wait() })
+	if _, err := rt.DrainUpstream("b", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	rt.evaluateMaintenance(start.Add(-time.Minute))
+	if rt.manager.Draining("a") {
+		t.Fatal("expected no drain before the window")
+	}
+	rt.evaluateMaintenance(start.Add(time.Minute))
+	status, ok := rt.manager.Drain("a")
+	if !ok || status.Deadline == nil {
+		t.Fatalf("expected the window to drain a with a close_after deadline, got %+v ok=%v", status, ok)
+	}
+	statuses := rt.MaintenanceWindows()
+	if len(statuses) != 2 || statuses[0].ID != "config:a:0" || statuses[0].Source != "config" {
+		t.Fatalf("unexpected window list %+v", statuses)
+	}
+
+	rt.evaluateMaintenance(start.Add(time.Hour))
+	if rt.manager.Draining("a") {
+		t.Fatal("expected the window's drain to end with the window")
+	}
+	if !rt.manager.Draining("b") {
+		t.Fatal("expected the operator's drain to outlast the window")
+	}
+	if _, err := rt.CreateMaintenanceWindow("a", window, "test"); err == nil {
+		t.Fatal("expected stored windows to need the SQLite store")
+	}
+}
+
+func TestMaintenanceOverlappingWindowMovesCloseAfterCutoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Date(2026, 11, 1, 2, 0, 0, 0, time.UTC)
+	long := config.MaintenanceWindowConfig{Start: start.Format(time.RFC3339), End: start.Add(time.Hour).Format(time.RFC3339), CloseAfter: config.Duration(30 * time.Minute)}
+	short := config.MaintenanceWindowConfig{Start: start.Add(10 * time.Minute).Format(time.RFC3339), End: start.Add(time.Hour).Format(time.RFC3339), CloseAfter: config.Duration(5 * time.Minute)}
+	rt := &Runtime{
+		ctx:          ctx,
+		manager:      upstream.NewUpstreamManager([]*upstream.Upstream{{Tag: "a"}}, nil),
+		flowRegistry: flow.NewRegistry(),
+		cfg:          config.Config{Upstreams: []config.UpstreamConfig{{Tag: "a", Maintenance: []config.MaintenanceWindowConfig{long, short}}}},
+	}
+	t.Cleanup(func() { cancel(); rt.wg.Wait() })
+
+	rt.evaluateMaintenance(start.Add(time.Minute))
+	status, ok := rt.manager.Drain("a")
+	if !ok || status.Deadline == nil || time.Until(*status.Deadline) < 20*time.Minute {
+		t.Fatalf("expected the first window's cutoff, got %+v ok=%v", status, ok)
+	}
+	rt.evaluateMaintenance(start.Add(11 * time.Minute))
+	status, _ = rt.manager.Drain("a")
+	if status.Deadline == nil || time.Until(*status.Deadline) > 5*time.Minute {
+		t.Fatalf("expected the overlapping window's earlier cutoff, got %+v", status)
+	}
+	// A later evaluation keeps the earlier cutoff.
+	deadline := *status.Deadline
+	rt.evaluateMaintenance(start.Add(12 * time.Minute))
+	if status, _ = rt.manager.Drain("a"); status.Deadline == nil || !status.Deadline.Equal(deadline) {
+		t.Fatalf("cutoff moved again: %+v", status)
+	}
+}
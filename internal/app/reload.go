@@ -0,0 +1,236 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// reloadableSections lists the top-level YAML paths that Reload applies in
+// place. Every other changed path is reported as requiring a restart and
+// keeps its running value.
+var reloadableSections = []string{"listeners", "routes", "forwarding.listeners", "upstreams", "health", "measurement"}
+
+// Reload applies next to the running runtime without dropping Flows on
+// unchanged listeners. Upstreams are resolved before anything changes, so a
+// DNS failure leaves the runtime untouched.
+func (r *Runtime) Reload(next config.Config) (config.ReloadReport, error) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	if r.ctx.Err() != nil {
+		return config.ReloadReport{}, errors.New("runtime is stopping")
+	}
+	return r.reloadLocked(next)
+}
+
+// EditTopology applies change to the running configuration and reloads the
+// result. The returned configuration is the validated edit.
+func (r *Runtime) EditTopology(change config.TopologyChange) (config.Config, config.ReloadReport, error) {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	if r.ctx.Err() != nil {
+		return config.Config{}, config.ReloadReport{}, errors.New("runtime is stopping")
+	}
+	next, err := r.cfg.ApplyTopology(change)
+	if err != nil {
+		return config.Config{}, config.ReloadReport{}, err
+	}
+	report, err := r.reloadLocked(next)
+	return next, report, err
+}
+
+func (r *Runtime) reloadLocked(next config.Config) (config.ReloadReport, error) {
+	current := r.cfg
+	report := classifyReload(config.ChangedFields("", current, next))
+	applied := current
+	applied.Listeners = next.Listeners
+	applied.Routes = next.Routes
+	applied.Upstreams = next.Upstreams
+	applied.Health = next.Health
+	applied.Measurement = next.Measurement
+	applied.Warnings = next.Warnings
+
+	upstreamsChanged := !reflect.DeepEqual(current.Upstreams, next.Upstreams)
+	if upstreamsChanged {
+		upstreams, discovered, err := resolveUpstreams(r.ctx, next, r.resolver)
+		if err != nil {
+			return config.ReloadReport{}, err
+		}
+		added, removed := r.manager.Reconcile(upstreams)
+		r.upstreams = upstreams
+		r.setDiscovery(discovered)
+		tags := make([]string, 0, len(upstreams))
+		for _, up := range upstreams {
+			tags = append(tags, up.Tag)
+		}
+		r.metrics.SetUpstreams(tags)
+		util.Event(util.ComponentLogger(r.logger, util.CompLifecycle), slog.LevelInfo, "lifecycle.reload_upstreams",
+			"upstreams.added", added,
+			"upstreams.removed", removed,
+		)
+	}
+	if !reflect.DeepEqual(current.Health, next.Health) {
+		r.manager.SetHealthConfig(next.Health)
+	}
+	r.cfg = applied
+	if upstreamsChanged || !reflect.DeepEqual(current.Routes, next.Routes) {
+		r.applyRoutes()
+	}
+	if upstreamsChanged || !reflect.DeepEqual(current.Routes, next.Routes) || !reflect.DeepEqual(current.Measurement, next.Measurement) {
+		r.stopMeasurement()
+		r.startMeasurement()
+	}
+	if upstreamsChanged {
+		r.startDNSRefresh()
+		r.startSRVDiscovery()
+	}
+	listenerErr := r.reconcileListeners(next.Forwarding.Listeners)
+	running := make([]config.ListenerConfig, 0, len(r.listeners))
+	for _, ln := range r.listeners {
+		running = append(running, ln.cfg)
+	}
+	r.cfg.Forwarding.Listeners = running
+	if r.control != nil {
+		r.control.SetRuntimeConfig(r.cfg)
+	}
+	return report, listenerErr
+}
+
+// reconcileListeners closes removed listeners and starts added ones. A
+// listener whose route or options changed is replaced; TCP streams it already
+// accepted keep running, while UDP mappings end with the shared socket.
+func (r *Runtime) reconcileListeners(wanted []config.ListenerConfig) error {
+	byKey := make(map[string]config.ListenerConfig, len(wanted))
+	for _, ln := range wanted {
+		byKey[listenerKey(ln)] = ln
+	}
+	kept := make([]runtimeListener, 0, len(wanted))
+	present := make(map[string]struct{}, len(r.listeners))
+	for _, ln := range r.listeners {
+		key := listenerKey(ln.cfg)
+		if cfg, ok := byKey[key]; ok && reflect.DeepEqual(cfg, ln.cfg) {
+			kept = append(kept, ln)
+			present[key] = struct{}{}
+			continue
+		}
+		_ = ln.listener.Close()
+	}
+	var errs []error
+	for _, ln := range wanted {
+		if _, ok := present[listenerKey(ln)]; ok {
+			continue
+		}
+		started, err := r.startListener(ln)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listener %s: %w", listenerKey(ln), err))
+			continue
+		}
+		kept = append(kept, runtimeListener{cfg: ln, listener: started})
+	}
+	r.listeners = kept
+	return errors.Join(errs...)
+}
+
+func listenerKey(ln config.ListenerConfig) string {
+	return ln.Protocol + "/" + util.NetJoin(ln.BindAddr, ln.BindPort)
+}
+
+func classifyReload(changed []string) config.ReloadReport {
+	report := config.ReloadReport{Applied: []string{}, RestartRequired: []string{}}
+	listenersChanged := false
+	for _, path := range changed {
+		if path == "listeners" {
+			listenersChanged = true
+		}
+	}
+	for _, path := range changed {
+		switch {
+		case path == "forwarding.listeners" && listenersChanged:
+			// The normalized form of top-level listeners; reported once.
+		case reloadable(path):
+			report.Applied = append(report.Applied, path)
+		default:
+			report.RestartRequired = append(report.RestartRequired, path)
+		}
+	}
+	return report
+}
+
+func reloadable(path string) bool {
+	for _, section := range reloadableSections {
+		if path == section || strings.HasPrefix(path, section+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload re-reads the configuration file and applies it to the running
+// runtime in place. source names the trigger for logs.
+func (s *Supervisor) Reload(source string) (config.ReloadReport, error) {
+	lifecycleLogger := util.ComponentLogger(s.logger, util.CompLifecycle)
+	util.Event(lifecycleLogger, slog.LevelInfo, "lifecycle.reload_triggered", "reload.source", source)
+	cfg, err := config.LoadConfig(s.configPath)
+	if err != nil {
+		util.Event(lifecycleLogger, slog.LevelError, "lifecycle.reload_failed", "error", err)
+		return config.ReloadReport{}, err
+	}
+	s.mu.Lock()
+	current := s.runtime
+	s.mu.Unlock()
+	if current == nil {
+		err := errors.New("runtime is not running")
+		util.Event(lifecycleLogger, slog.LevelError, "lifecycle.reload_failed", "error", err)
+		return config.ReloadReport{}, err
+	}
+	for _, warning := range cfg.Warnings {
+		util.Event(lifecycleLogger, slog.LevelWarn, "lifecycle.config_warning", "warning", warning)
+	}
+	report, err := current.Reload(cfg)
+	if err != nil {
+		util.Event(lifecycleLogger, slog.LevelError, "lifecycle.reload_failed", "error", err)
+		return report, err
+	}
+	util.Event(lifecycleLogger, slog.LevelInfo, "lifecycle.reload_completed",
+		"reload.applied", report.Applied,
+		"reload.restart_required", report.RestartRequired,
+	)
+	return report, nil
+}
+
+// EditTopology applies a topology change to the running runtime and, when
+// persist is set, writes the edited sections back to the configuration file.
+// A change that was applied but could not be written is reported as an error
+// alongside its report.
+func (s *Supervisor) EditTopology(change config.TopologyChange, persist bool) (config.ReloadReport, error) {
+	lifecycleLogger := util.ComponentLogger(s.logger, util.CompLifecycle)
+	s.mu.Lock()
+	current := s.runtime
+	s.mu.Unlock()
+	if current == nil {
+		return config.ReloadReport{}, errors.New("runtime is not running")
+	}
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+	next, report, err := current.EditTopology(change)
+	if err != nil {
+		return report, err
+	}
+	util.Event(lifecycleLogger, slog.LevelInfo, "lifecycle.topology_edited",
+		"reload.applied", report.Applied,
+		"config.persist", persist,
+	)
+	if !persist {
+		return report, nil
+	}
+	if err := config.WriteTopology(s.configPath, next); err != nil {
+		util.Event(lifecycleLogger, slog.LevelError, "lifecycle.topology_persist_failed", "error", err)
+		return report, fmt.Errorf("%w: %w", config.ErrTopologyNotPersisted, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,192 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+)
+
+func TestRuntimeReloadKeepsUnchangedListenerFlows(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	backendPort := backend.Addr().(*net.TCPAddr).Port
+	kept, removed, added, controlPort := freePort(t), freePort(t), freePort(t), freePort(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(listeners string, controlPort int) config.Config {
+		t.Helper()
+		raw := fmt.Sprintf(`listeners:
+%s
+routes:
+  - name: echo
+    strategy: static
+    upstreams: [local]
+upstreams:
+  - tag: local
+    destination: {host: 127.0.0.1, port: %d}
+control:
+  bind_addr: 127.0.0.1
+  bind_port: %d
+  auth_token: 0123456789abcdef
+`, listeners, backendPort, controlPort)
+		if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := config.LoadConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+	listener := func(name string, port int) string {
+		return fmt.Sprintf("  - {name: %s, bind: 127.0.0.1:%d, protocol: tcp, route: echo}", name, port)
+	}
+	cfg := write(listener("kept", kept)+"\n"+listener("removed", removed), controlPort)
+	rt, err := NewRuntime(cfg, nil, func() error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rt.Stop()
+	if err := rt.Start(); err != nil {
+		t.Fatal(err)
+	}
+	keptListener := rt.listeners[0].listener
+
+	client, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", kept))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	reader := bufio.NewReader(client)
+	echo := func(line string) {
+		t.Helper()
+		_ = client.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := client.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		got, err := reader.ReadString('\n')
+		if err != nil || strings.TrimSpace(got) != line {
+			t.Fatalf("echo = %q err=%v", got, err)
+		}
+	}
+	echo("before")
+
+	next := write(listener("kept", kept)+"\n"+listener("added", added), freePort(t))
+	report, err := rt.Reload(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(report.Applied, ",") != "listeners" || strings.Join(report.RestartRequired, ",") != "control.bind_port" {
+		t.Fatalf("unexpected reload report: %+v", report)
+	}
+	if rt.cfg.Control.BindPort != controlPort {
+		t.Fatalf("restart-only control port was applied: %d", rt.cfg.Control.BindPort)
+	}
+	if len(rt.listeners) != 2 || rt.listeners[0].listener != keptListener {
+		t.Fatalf("unchanged listener was replaced: %+v", rt.listeners)
+	}
+	echo("after")
+	if conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", added)); err != nil {
+		t.Fatalf("added listener is not accepting: %v", err)
+	} else {
+		_ = conn.Close()
+	}
+	if ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", removed)); err != nil {
+		t.Fatalf("removed listener still holds its port: %v", err)
+	} else {
+		_ = ln.Close()
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestSupervisorEditTopologyAppliesAndPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	raw := fmt.Sprintf(`# fbforward test configuration
+forwarding:
+  listeners:
+    - {bind_addr: 127.0.0.1, bind_port: %d, protocol: tcp}
+upstreams:
+  - tag: local
+    destination: {host: 127.0.0.1}
+control:
+  bind_addr: 127.0.0.1
+  bind_port: %d
+  auth_token: 0123456789abcdef # keep this comment
+`, freePort(t), freePort(t))
+	if err := os.WriteFile(path, []byte(raw), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	supervisor := NewSupervisor(path, nil)
+	if err := supervisor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer supervisor.Stop()
+	route := supervisor.runtime.cfg.Routes[0].Name
+
+	if _, err := supervisor.EditTopology(config.CreateUpstream(config.UpstreamConfig{
+		Tag:         "second",
+		Destination: config.DestinationConfig{Host: "127.0.0.2"},
+	}), false); err != nil {
+		t.Fatal(err)
+	}
+	if supervisor.runtime.manager.Get("second") == nil {
+		t.Fatal("created upstream was not added to the manager")
+	}
+	report, err := supervisor.EditTopology(config.SetRouteUpstreams(route, []string{"local", "second"}, nil, "local"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(report.Applied, "routes") {
+		t.Fatalf("expected routes to be applied, got %+v", report)
+	}
+	if _, err := supervisor.EditTopology(config.DeleteUpstream("second"), false); err == nil || !strings.Contains(err.Error(), "used by route") {
+		t.Fatalf("expected referenced upstream deletion to fail, got %v", err)
+	}
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "keep this comment") || strings.Contains(string(written), "bind_addr: 127.0.0.1, bind_port") {
+		t.Fatalf("unexpected rewritten config:\n%s", written)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Upstreams) != 2 || strings.Join(cfg.Routes[0].Upstreams, ",") != "local,second" || cfg.Routes[0].DefaultUpstream != "local" {
+		t.Fatalf("persisted topology mismatch: routes=%+v upstreams=%+v", cfg.Routes, cfg.Upstreams)
+	}
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net"
 	"sync"
@@ -21,10 +22,15 @@ import (
 	"github.com/NodePath81/fbforward/internal/resolver"
 	"github.com/NodePath81/fbforward/internal/upstream"
 	"github.com/NodePath81/fbforward/internal/util"
+	"github.com/NodePath81/fbforward/pkg/fbmeasure"
 )
 
 const dnsRefreshInterval = 30 * time.Second
 
+// failoverPollInterval is how often failover routes are evaluated without a
+// health change, so failback delays and probe counts progress without traffic.
+var failoverPollInterval = time.Second
+
 type Runtime struct {
 	cfg                config.Config
 	ctx                context.Context
@@ -47,10 +53,20 @@ type Runtime struct {
 	firewall           *policy.Provider
 	onlinePolicy       *policy.OnlineProvider
 	upstreams          []*upstream.Upstream
-	listeners          []closer
+	listeners          []runtimeListener
 	collector          *measure.Collector
+	measureCancel      context.CancelFunc
+	measureDone        chan struct{}
+	dnsCancel          context.CancelFunc
+	srvCancel          context.CancelFunc
+	drainMu            sync.Mutex
+	drainCancel        map[string]context.CancelFunc
+	maintenanceMu      sync.Mutex
+	maintenance        maintenanceState
+	reloadMu           sync.Mutex
 	notifier           *notify.Client
 	notifyPolicy       *notify.Policy
+	failoverWake       chan struct{}
 	wg                 sync.WaitGroup
 	stopOnce           sync.Once
 }
@@ -59,6 +75,13 @@ type closer interface {
 	Close() error
 }
 
+// runtimeListener remembers the configuration a listener was started with so
+// a reload can tell unchanged listeners from replaced ones.
+type runtimeListener struct {
+	cfg      config.ListenerConfig
+	listener closer
+}
+
 type auditContextSink struct {
 	pipeline *audit.Pipeline
 }
@@ -72,7 +95,7 @@ func (s auditContextSink) Publish(value flowcontext.Context) {
 func NewRuntime(cfg config.Config, logger util.Logger, restartFn func() error) (*Runtime, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	resolver := resolver.NewResolver(cfg.DNS)
-	upstreams, err := resolveUpstreams(ctx, cfg, resolver)
+	upstreams, discovered, err := resolveUpstreams(ctx, cfg, resolver)
 	if err != nil {
 		cancel()
 		return nil, err
@@ -106,11 +129,14 @@ func NewRuntime(cfg config.Config, logger util.Logger, restartFn func() error) (
 		status:       status,
 		flowRegistry: flowRegistry,
 		flowContext:  flowContextRegistry,
-		picker:       newUpstreamPicker(manager, cfg.Routes),
+		picker:       newUpstreamPicker(manager, expandRoutes(cfg.Routes, upstreams)),
 		upstreams:    upstreams,
+		failoverWake: make(chan struct{}, 1),
 	}
+	rt.setDiscovery(discovered)
 	if picker, ok := rt.picker.(*upstreamPicker); ok {
 		picker.metrics = metricSet
+		picker.routes.SetFlowCounter(flowRegistry)
 	}
 	if cfg.GeoIP.Enabled {
 		geoMgr, err := geoip.NewManager(cfg.GeoIP, logger)
@@ -119,6 +145,9 @@ func NewRuntime(cfg config.Config, logger util.Logger, restartFn func() error) (
 			return nil, err
 		}
 		rt.geoipMgr = geoMgr
+		if picker, ok := rt.picker.(*upstreamPicker); ok {
+			picker.routes.SetClientLookup(geoClientLookup{manager: geoMgr})
+		}
 	}
 	fw, err := policy.NewProvider(cfg.Firewall, rt.geoipMgr, metricSet, logger)
 	if err != nil {
@@ -136,7 +165,7 @@ func NewRuntime(cfg config.Config, logger util.Logger, restartFn func() error) (
 			return nil, err
 		}
 		rt.auditStore = store
-		rt.auditStore.StartRetention(ctx, cfg.IPLog.Retention.Duration(), cfg.IPLog.PruneInterval.Duration())
+		rt.auditStore.StartRetention(ctx, cfg.IPLog.Retention.Duration(), cfg.IPLog.MeasurementRetention.Duration(), cfg.IPLog.PruneInterval.Duration())
 		rt.auditPipeline = audit.NewPipeline(cfg.IPLog, rt.geoipMgr, store, metricSet, logger)
 		flowObservers = append(flowObservers, rt.auditPipeline)
 		flowContextRegistry.SetSnapshotSink(auditContextSink{pipeline: rt.auditPipeline})
@@ -197,7 +226,17 @@ func NewRuntime(cfg config.Config, logger util.Logger, restartFn func() error) (
 		if rt.notifyPolicy != nil {
 			rt.notifyPolicy.HandleUsabilityChange(change.Tag, change.Usable, change.Reason)
 		}
+		rt.auditPipeline.RecordHealthTransition(audit.HealthTransition{Upstream: change.Tag, From: change.From, To: change.Reason, Usable: change.Usable})
+		// The callback runs under the manager lock; failover routes are
+		// evaluated by startFailover.
+		select {
+		case rt.failoverWake <- struct{}{}:
+		default:
+		}
 	})
+	if picker, ok := rt.picker.(*upstreamPicker); ok {
+		picker.routes.SetSwitchHandler(rt.recordRouteSwitch)
+	}
 
 	manager.SetAuto()
 
@@ -214,6 +253,8 @@ func NewRuntime(cfg config.Config, logger util.Logger, restartFn func() error) (
 	ctrl.SetFirewallProvider(rt.firewall)
 	ctrl.SetOnlinePolicyProvider(rt.onlinePolicy)
 	ctrl.SetFlowContextService(rt.flowContextService)
+	ctrl.SetDrainController(rt)
+	ctrl.SetMaintenanceController(rt)
 	if picker, ok := rt.picker.(*upstreamPicker); ok {
 		ctrl.SetRouteStateReader(picker)
 	}
@@ -223,6 +264,48 @@ func NewRuntime(cfg config.Config, logger util.Logger, restartFn func() error) (
 	return rt, nil
 }
 
+// recordRouteSwitch reports a failover or failback of a failover route to the
+// webhook and the audit history.
+func (r *Runtime) recordRouteSwitch(route string, change upstream.RouteSwitch) {
+	if r.notifier != nil {
+		severity := notify.SeverityInfo
+		if change.Reason == upstream.SwitchFailover {
+			severity = notify.SeverityWarn
+		}
+		r.notifier.Emit("route."+change.Reason, severity, map[string]any{
+			"route.name":    route,
+			"upstream.from": change.From,
+			"upstream.to":   change.To,
+		})
+	}
+	r.auditPipeline.RecordRouteFailover(audit.RouteFailover{Route: route, From: change.From, To: change.To, Reason: change.Reason, OccurredAt: change.At})
+}
+
+// startFailover evaluates failover routes on every usability change and once
+// per failoverPollInterval, so a failover is reported when it happens rather
+// than when the next Flow arrives.
+func (r *Runtime) startFailover() {
+	picker, ok := r.picker.(*upstreamPicker)
+	if !ok {
+		return
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(failoverPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-r.failoverWake:
+			case <-ticker.C:
+			}
+			picker.routes.EvaluateFailover()
+		}
+	}()
+}
+
 func (r *Runtime) Start() error {
 	if err := r.control.Start(r.ctx); err != nil {
 		return err
@@ -239,6 +322,9 @@ func (r *Runtime) Start() error {
 
 	r.startMeasurement()
 	r.startDNSRefresh()
+	r.startSRVDiscovery()
+	r.startMaintenance()
+	r.startFailover()
 
 	if err := r.startListeners(); err != nil {
 		r.Stop()
@@ -270,8 +356,11 @@ func (r *Runtime) stop() {
 	if r.flowRegistry != nil {
 		r.flowRegistry.CloseAll()
 	}
-	for _, ln := range r.listeners {
-		_ = ln.Close()
+	r.reloadMu.Lock()
+	listeners := r.listeners
+	r.reloadMu.Unlock()
+	for _, ln := range listeners {
+		_ = ln.listener.Close()
 	}
 	// Drain forwarding handlers before shutting down the observers and stores
 	// they may still be using during their final close transition.
@@ -330,32 +419,76 @@ func (r *Runtime) startMeasurement() {
 	}
 
 	measureLogger := util.ComponentLogger(r.logger, util.CompMeasure)
-	scheduler := measure.NewScheduler(measure.SchedulerConfig{
-		MinInterval:      r.cfg.Measurement.Schedule.Interval.Min.Duration(),
-		MaxInterval:      r.cfg.Measurement.Schedule.Interval.Max.Duration(),
-		InterUpstreamGap: r.cfg.Measurement.Schedule.UpstreamGap.Duration(),
-		Protocols:        protocols,
-	}, measurementUpstreams, nil)
+	schedulerCfg := measure.SchedulerConfig{
+		MinInterval:       r.cfg.Measurement.Schedule.Interval.Min.Duration(),
+		MaxInterval:       r.cfg.Measurement.Schedule.Interval.Max.Duration(),
+		InterUpstreamGap:  r.cfg.Measurement.Schedule.UpstreamGap.Duration(),
+		Protocols:         protocols,
+		UpstreamProtocols: r.routeProbeProtocols(protocols),
+	}
+	if r.cfg.Measurement.Throughput.Enabled {
+		schedulerCfg.ThroughputInterval = r.cfg.Measurement.Throughput.Interval.Duration()
+	}
+	if adaptive := r.cfg.Measurement.Schedule.Adaptive; adaptive.Enabled {
+		schedulerCfg.Adaptive = measure.AdaptiveCadence{
+			FastInterval: adaptive.FastInterval.Duration(),
+			StableAfter:  adaptive.StableAfter,
+			MaxInterval:  adaptive.MaxInterval.Duration(),
+		}
+		schedulerCfg.Health = r.manager.Health
+	}
+	scheduler := measure.NewScheduler(schedulerCfg, measurementUpstreams, nil)
 	if r.control != nil {
 		r.control.SetScheduler(scheduler)
 	}
 
 	r.collector = measure.NewCollector(r.cfg.Measurement, r.manager, r.metrics, scheduler, measureLogger)
+	if pipeline := r.auditPipeline; pipeline != nil {
+		r.collector.OnTestComplete = func(tag, protocol string, startTime time.Time, duration time.Duration, success bool, result *measure.TestResultMetrics, errMsg string) {
+			record := audit.MeasurementRecord{Upstream: tag, Protocol: protocol, RecordedAt: startTime, Duration: duration, Success: success, Error: errMsg}
+			if success && result != nil {
+				record.RTTMs = result.RTTMs
+			}
+			pipeline.RecordMeasurement(record)
+		}
+	}
 	if r.control != nil {
 		r.control.SetCollector(r.collector)
 	}
 
+	ctx, cancel := context.WithCancel(r.ctx)
+	done := make(chan struct{})
+	r.measureCancel, r.measureDone = cancel, done
+	collector := r.collector
 	r.wg.Add(1)
 	go func() {
 		defer r.wg.Done()
-		r.collector.RunLoop(r.ctx)
+		defer close(done)
+		collector.RunLoop(ctx)
 	}()
 }
 
+// stopMeasurement stops the collector loop and waits for an in-flight probe
+// so a reload never runs two schedulers against the same upstreams. An
+// in-flight throughput transfer is cancelled rather than waited out.
+func (r *Runtime) stopMeasurement() {
+	if r.measureCancel == nil {
+		return
+	}
+	r.measureCancel()
+	<-r.measureDone
+	r.measureCancel, r.measureDone, r.collector = nil, nil, nil
+	if r.control != nil {
+		r.control.SetScheduler(nil)
+		r.control.SetCollector(nil)
+	}
+}
+
 func (r *Runtime) measurementUpstreams() []*upstream.Upstream {
 	needed := make(map[string]struct{})
-	for _, route := range r.cfg.Routes {
-		if route.Strategy != "adaptive" {
+	for _, route := range expandRoutes(r.cfg.Routes, r.upstreams) {
+		// Static routes never consult health; every other strategy does.
+		if route.Strategy == upstream.StrategyStatic {
 			continue
 		}
 		for _, tag := range route.Upstreams {
@@ -374,33 +507,96 @@ func (r *Runtime) measurementUpstreams() []*upstream.Upstream {
 	return result
 }
 
+// routeProbeProtocols returns the probe protocols of upstreams whose routes
+// override them: the union over the upstream's measured routes, each route
+// contributing its own protocols or else the global ones. Upstreams probed
+// with the global protocols are omitted.
+func (r *Runtime) routeProbeProtocols(global []string) map[string][]string {
+	wanted := make(map[string]map[string]bool)
+	overridden := make(map[string]bool)
+	for _, route := range expandRoutes(r.cfg.Routes, r.upstreams) {
+		if route.Strategy == upstream.StrategyStatic {
+			continue
+		}
+		protocols := global
+		if len(route.Health.Protocols) > 0 {
+			protocols = route.Health.Protocols
+		}
+		for _, tag := range route.Upstreams {
+			if wanted[tag] == nil {
+				wanted[tag] = make(map[string]bool)
+			}
+			for _, protocol := range protocols {
+				wanted[tag][protocol] = true
+			}
+			overridden[tag] = overridden[tag] || len(route.Health.Protocols) > 0
+		}
+	}
+	result := make(map[string][]string)
+	for tag, set := range wanted {
+		if !overridden[tag] {
+			continue
+		}
+		protocols := make([]string, 0, 2)
+		for _, protocol := range []string{"tcp", "udp"} {
+			if set[protocol] {
+				protocols = append(protocols, protocol)
+			}
+		}
+		result[tag] = protocols
+	}
+	return result
+}
+
 func (r *Runtime) startListeners() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
 	r.listeners = nil
 	for _, ln := range r.cfg.Forwarding.Listeners {
-		switch ln.Protocol {
-		case "tcp":
-			tcpListener := forwarding.NewTCPListener(ln, r.cfg.Forwarding.Limits, r.cfg.Forwarding.IdleTimeout.TCP.Duration(), r.picker, r.policy, r.flowObserver, r.flowRegistry, r.flowContext, r.logger)
-			if err := tcpListener.Start(r.ctx, &r.wg); err != nil {
-				return err
-			}
-			r.listeners = append(r.listeners, tcpListener)
-		case "udp":
-			udpListener := forwarding.NewUDPListener(ln, r.cfg.Forwarding.Limits, r.cfg.Forwarding.IdleTimeout.UDP.Duration(), r.picker, r.policy, r.flowObserver, r.flowRegistry, r.flowContext, r.logger)
-			udpListener.SetRateLimitDropRecorder(r.metrics)
-			if err := udpListener.Start(r.ctx, &r.wg); err != nil {
-				return err
-			}
-			r.listeners = append(r.listeners, udpListener)
+		started, err := r.startListener(ln)
+		if err != nil {
+			return err
 		}
+		r.listeners = append(r.listeners, runtimeListener{cfg: ln, listener: started})
 	}
 	return nil
 }
 
+func (r *Runtime) startListener(ln config.ListenerConfig) (closer, error) {
+	switch ln.Protocol {
+	case "tcp":
+		tcpListener := forwarding.NewTCPListener(ln, r.cfg.Forwarding.Limits, r.cfg.Forwarding.IdleTimeout.TCP.Duration(), r.picker, r.policy, r.flowObserver, r.flowRegistry, r.flowContext, r.logger)
+		tcpListener.SetDialFailover(r.cfg.Forwarding.Failover)
+		tcpListener.SetHedgeRecorder(r.metrics)
+		if err := tcpListener.Start(r.ctx, &r.wg); err != nil {
+			return nil, err
+		}
+		return tcpListener, nil
+	case "udp":
+		udpListener := forwarding.NewUDPListener(ln, r.cfg.Forwarding.Limits, r.cfg.Forwarding.IdleTimeout.UDP.Duration(), r.picker, r.policy, r.flowObserver, r.flowRegistry, r.flowContext, r.logger)
+		udpListener.SetRateLimitDropRecorder(r.metrics)
+		udpListener.SetDialFailover(r.cfg.Forwarding.Failover)
+		if err := udpListener.Start(r.ctx, &r.wg); err != nil {
+			return nil, err
+		}
+		return udpListener, nil
+	}
+	return nil, fmt.Errorf("listener %s:%d has unsupported protocol %q", ln.BindAddr, ln.BindPort, ln.Protocol)
+}
+
 func (r *Runtime) wait() {
 	r.wg.Wait()
 }
 
+// startDNSRefresh starts one refresh loop per hostname upstream. A reload that
+// changes upstreams cancels the previous generation and starts a new one so
+// loops never refresh an upstream object the manager no longer owns.
 func (r *Runtime) startDNSRefresh() {
+	if r.dnsCancel != nil {
+		r.dnsCancel()
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.dnsCancel = cancel
 	dnsLogger := util.ComponentLogger(r.logger, util.CompDNS)
 	for _, upstream := range r.upstreams {
 		if net.ParseIP(upstream.Host) != nil {
@@ -414,10 +610,10 @@ func (r *Runtime) startDNSRefresh() {
 			defer ticker.Stop()
 			for {
 				select {
-				case <-r.ctx.Done():
+				case <-ctx.Done():
 					return
 				case <-ticker.C:
-					ips, err := r.resolver.ResolveHost(r.ctx, up.Host)
+					ips, err := r.resolver.ResolveHost(ctx, up.Host)
 					if err != nil {
 						util.Event(dnsLogger, slog.LevelWarn, "dns.resolve_failed",
 							"upstream", up.Tag,
@@ -450,23 +646,63 @@ func (r *Runtime) startDNSRefresh() {
 	}
 }
 
-func resolveUpstreams(ctx context.Context, cfg config.Config, res *resolver.Resolver) ([]*upstream.Upstream, error) {
+// loadMeasureKey reads the fbmeasure key of item, or returns nil when none is
+// configured.
+func loadMeasureKey(item config.UpstreamConfig) ([]byte, error) {
+	if item.Measurement.KeyFile == "" {
+		return nil, nil
+	}
+	key, err := fbmeasure.LoadKeyFile(item.Measurement.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("upstream %s: %w", item.Tag, err)
+	}
+	return key, nil
+}
+
+// resolveUpstreams resolves every configured upstream. An SRV upstream
+// expands to one member per record; discovered holds its refresh state.
+func resolveUpstreams(ctx context.Context, cfg config.Config, res *resolver.Resolver) ([]*upstream.Upstream, map[string]upstream.DiscoveryStatus, error) {
 	upstreams := make([]*upstream.Upstream, 0, len(cfg.Upstreams))
+	discovered := make(map[string]upstream.DiscoveryStatus)
 	for _, item := range cfg.Upstreams {
+		if item.Destination.SRV != "" {
+			members, ttl, err := resolveSRVUpstream(ctx, item, res)
+			if err != nil {
+				return nil, nil, err
+			}
+			now := time.Now()
+			discovered[item.Tag] = upstream.DiscoveryStatus{
+				SRV:           item.Destination.SRV,
+				TTLSeconds:    ttl.Seconds(),
+				RefreshedAt:   now,
+				NextRefreshAt: now.Add(srvRefreshDelay(ttl, cfg.DNS.SRV)),
+			}
+			upstreams = append(upstreams, members...)
+			continue
+		}
 		ips, err := res.ResolveHost(ctx, item.Destination.Host)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		key, err := loadMeasureKey(item)
+		if err != nil {
+			return nil, nil, err
 		}
 		up := &upstream.Upstream{
-			Tag:         item.Tag,
-			Host:        item.Destination.Host,
-			MeasureHost: item.Measurement.Host,
-			MeasurePort: item.Measurement.Port,
-			Priority:    item.Priority,
-			IPs:         ips,
+			Tag:           item.Tag,
+			Host:          item.Destination.Host,
+			Port:          item.Destination.Port,
+			MeasureHost:   item.Measurement.Host,
+			MeasurePort:   item.Measurement.Port,
+			ProbeType:     item.Measurement.Type,
+			HTTPProbe:     item.Measurement.HTTP,
+			MeasureKey:    key,
+			Priority:      item.Priority,
+			ProxyProtocol: item.ProxyProtocol,
+			IPs:           ips,
 		}
 		up.SetActiveIP(ips[0])
 		upstreams = append(upstreams, up)
 	}
-	return upstreams, nil
+	return upstreams, discovered, nil
 }
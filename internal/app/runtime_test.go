@@ -2,6 +2,7 @@ package app
 
 import (
 	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -101,3 +102,18 @@ func TestMeasurementUpstreamsOnlyIncludesAdaptiveRoutes(t *testing.T) {
 		t.Fatalf("static-only routes should not start measurement, got %d upstreams", len(got))
 	}
 }
+
+func TestRouteProbeProtocolsUnionsRouteOverrides(t *testing.T) {
+	r := &Runtime{
+		cfg: config.Config{Routes: []config.RouteConfig{
+			{Name: "voice", Strategy: "adaptive", Upstreams: []string{"primary", "backup"}, Health: config.RouteHealthConfig{Protocols: []string{"udp"}}},
+			{Name: "bulk", Strategy: "adaptive", Upstreams: []string{"backup", "spare"}},
+		}},
+		upstreams: []*upstream.Upstream{{Tag: "primary"}, {Tag: "backup"}, {Tag: "spare"}},
+	}
+	got := r.routeProbeProtocols([]string{"tcp"})
+	want := map[string][]string{"primary": {"udp"}, "backup": {"tcp", "udp"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("routeProbeProtocols = %v, want %v", got, want)
+	}
+}
@@ -13,6 +13,8 @@ type Supervisor struct {
 	logger     util.Logger
 	mu         sync.Mutex
 	runtime    *Runtime
+	// persistMu orders topology edits with their configuration file writes.
+	persistMu sync.Mutex
 }
 
 func NewSupervisor(configPath string, logger util.Logger) *Supervisor {
@@ -39,6 +41,8 @@ func (s *Supervisor) startConfig(cfg config.Config) error {
 	if err != nil {
 		return err
 	}
+	runtime.control.SetReloadFunc(func() (config.ReloadReport, error) { return s.Reload("rpc") })
+	runtime.control.SetTopologyFunc(s.EditTopology)
 	util.Event(lifecycleLogger, slog.LevelInfo, "lifecycle.config_summary",
 		"upstream_count", len(cfg.Upstreams),
 		"listener_count", len(cfg.Forwarding.Listeners),
@@ -2,6 +2,7 @@ package audit
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"github.com/google/uuid"
 	"strings"
@@ -18,7 +19,7 @@ func (s *Store) InsertFlows(records []FlowRecord) error {
 	if err != nil {
 		return err
 	}
-	stmt, err := tx.Prepare(`INSERT INTO flows(flow_id, protocol, client_ip, client_port, client_ip_bytes, client_ip_family, listener, route, upstream, started_at, ended_at, last_activity_at, bytes_up, bytes_down, close_reason, fingerprint, policy_version, rule_id, asn, as_org, country) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(flow_id) DO UPDATE SET protocol=excluded.protocol, client_ip=excluded.client_ip, client_port=excluded.client_port, client_ip_bytes=excluded.client_ip_bytes, client_ip_family=excluded.client_ip_family, listener=excluded.listener, route=excluded.route, upstream=excluded.upstream, started_at=excluded.started_at, ended_at=excluded.ended_at, last_activity_at=excluded.last_activity_at, bytes_up=excluded.bytes_up, bytes_down=excluded.bytes_down, close_reason=excluded.close_reason, fingerprint=excluded.fingerprint, policy_version=excluded.policy_version, rule_id=excluded.rule_id, asn=excluded.asn, as_org=excluded.as_org, country=excluded.country`)
+	stmt, err := tx.Prepare(`INSERT INTO flows(flow_id, protocol, client_ip, client_port, client_ip_bytes, client_ip_family, listener, route, upstream, upstream_addr, peer_addr, selection_rule, dial_attempts, started_at, ended_at, last_activity_at, bytes_up, bytes_down, close_reason, fingerprint, policy_version, rule_id, asn, as_org, country) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(flow_id) DO UPDATE SET protocol=excluded.protocol, client_ip=excluded.client_ip, client_port=excluded.client_port, client_ip_bytes=excluded.client_ip_bytes, client_ip_family=excluded.client_ip_family, listener=excluded.listener, route=excluded.route, upstream=excluded.upstream, upstream_addr=excluded.upstream_addr, peer_addr=excluded.peer_addr, selection_rule=excluded.selection_rule, dial_attempts=excluded.dial_attempts, started_at=excluded.started_at, ended_at=excluded.ended_at, last_activity_at=excluded.last_activity_at, bytes_up=excluded.bytes_up, bytes_down=excluded.bytes_down, close_reason=excluded.close_reason, fingerprint=excluded.fingerprint, policy_version=excluded.policy_version, rule_id=excluded.rule_id, asn=excluded.asn, as_org=excluded.as_org, country=excluded.country`)
 	if err != nil {
 		_ = tx.Rollback()
 		return err
@@ -44,7 +45,7 @@ func (s *Store) InsertFlows(records []FlowRecord) error {
 			return err
 		}
 		if _, err := stmt.Exec(record.FlowID, record.Protocol, record.ClientIP, record.ClientPort, blob, family,
-			record.Listener, record.Route, record.Upstream, unixMilli(started), unixMilli(ended), unixMilli(last),
+			record.Listener, record.Route, record.Upstream, record.UpstreamAddr, record.PeerAddr, record.SelectionRule, encodeDialAttempts(record.DialAttempts), unixMilli(started), unixMilli(ended), unixMilli(last),
 			record.BytesUp, record.BytesDown, record.CloseReason, record.Fingerprint, record.PolicyVersion, record.RuleID,
 			nullInt(record.ASN), nullIfEmpty(record.ASOrg), nullIfEmpty(record.Country)); err != nil {
 			_ = tx.Rollback()
@@ -83,7 +84,7 @@ func (s *Store) InsertRejections(records []RejectionRow) error {
 	if err != nil {
 		return err
 	}
-	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO rejection_events(event_id, protocol, client_ip, client_port, client_ip_bytes, client_ip_family, listener, port, reason, matched_rule_type, matched_rule_value, policy_version, rule_id, recorded_at, asn, as_org, country) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO rejection_events(event_id, protocol, client_ip, client_port, client_ip_bytes, client_ip_family, listener, port, peer_addr, reason, matched_rule_type, matched_rule_value, dial_attempts, policy_version, rule_id, recorded_at, asn, as_org, country) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		_ = tx.Rollback()
 		return err
@@ -95,7 +96,7 @@ func (s *Store) InsertRejections(records []RejectionRow) error {
 		}
 		blob, family := optionalIPBytes(record.ClientIP)
 		if _, err := stmt.Exec(record.EventID, record.Protocol, record.ClientIP, record.ClientPort, blob, family,
-			record.Listener, record.Port, record.Reason, record.MatchedRuleType, record.MatchedRuleValue,
+			record.Listener, record.Port, record.PeerAddr, record.Reason, record.MatchedRuleType, record.MatchedRuleValue, encodeDialAttempts(record.DialAttempts),
 			record.PolicyVersion, record.RuleID, unixMilli(defaultTime(record.RecordedAt)), nullInt(record.ASN),
 			nullIfEmpty(record.ASOrg), nullIfEmpty(record.Country)); err != nil {
 			_ = tx.Rollback()
@@ -178,3 +179,27 @@ func normalizeFlowTimes(record FlowRecord) (time.Time, time.Time, time.Time) {
 	last := defaultTime(record.LastActivity)
 	return started, ended, last
 }
+
+// encodeDialAttempts stores attempts as a JSON array; no attempts store as
+// an empty string to match rows written before failover was recorded.
+func encodeDialAttempts(attempts []DialAttempt) string {
+	if len(attempts) == 0 {
+		return ""
+	}
+	raw, err := json.Marshal(attempts)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+func decodeDialAttempts(raw string) []DialAttempt {
+	if raw == "" {
+		return nil
+	}
+	var attempts []DialAttempt
+	if err := json.Unmarshal([]byte(raw), &attempts); err != nil {
+		return nil
+	}
+	return attempts
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/google/uuid"
+)
+
+var ErrMaintenanceWindowNotFound = errors.New("maintenance window not found")
+
+// CreateMaintenanceWindow stores window and returns it with its assigned id.
+func (s *Store) CreateMaintenanceWindow(window MaintenanceWindow) (MaintenanceWindow, error) {
+	if s == nil {
+		return MaintenanceWindow{}, errors.New("audit store is nil")
+	}
+	if strings.TrimSpace(window.Upstream) == "" {
+		return MaintenanceWindow{}, errors.New("maintenance window upstream is required")
+	}
+	if window.WindowID == "" {
+		window.WindowID = uuid.NewString()
+	}
+	if window.CreatedAt.IsZero() {
+		window.CreatedAt = time.Now().UTC()
+	}
+	w := window.Window
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.writeDB.Exec(`INSERT INTO maintenance_windows(window_id, upstream, name, start_at, end_at, weekdays, at, duration_ms, timezone, close_after_ms, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		window.WindowID, window.Upstream, w.Name, w.Start, w.End, strings.Join(w.Weekdays, ","), w.At, w.Duration.Duration().Milliseconds(), w.Timezone, w.CloseAfter.Duration().Milliseconds(), window.CreatedBy, unixMilli(window.CreatedAt))
+	if err != nil {
+		return MaintenanceWindow{}, err
+	}
+	return window, nil
+}
+
+// ListMaintenanceWindows returns the stored windows ordered by upstream and
+// creation time.
+func (s *Store) ListMaintenanceWindows() ([]MaintenanceWindow, error) {
+	if s == nil {
+		return nil, errors.New("audit store is nil")
+	}
+	rows, err := s.readDB.Query(`SELECT window_id, upstream, name, start_at, end_at, weekdays, at, duration_ms, timezone, close_after_ms, created_by, created_at FROM maintenance_windows ORDER BY upstream ASC, created_at ASC, window_id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]MaintenanceWindow, 0)
+	for rows.Next() {
+		var window MaintenanceWindow
+		var weekdays string
+		var durationMs, closeAfterMs, createdAt int64
+		w := &window.Window
+		if err := rows.Scan(&window.WindowID, &window.Upstream, &w.Name, &w.Start, &w.End, &weekdays, &w.At, &durationMs, &w.Timezone, &closeAfterMs, &window.CreatedBy, &createdAt); err != nil {
+			return nil, err
+		}
+		if weekdays != "" {
+			w.Weekdays = strings.Split(weekdays, ",")
+		}
+		w.Duration = config.Duration(time.Duration(durationMs) * time.Millisecond)
+		w.CloseAfter = config.Duration(time.Duration(closeAfterMs) * time.Millisecond)
+		window.CreatedAt = timeFromMillis(createdAt)
+		result = append(result, window)
+	}
+	return result, rows.Err()
+}
+
+// DeleteMaintenanceWindow removes a stored window.
+func (s *Store) DeleteMaintenanceWindow(windowID string) error {
+	if s == nil {
+		return errors.New("audit store is nil")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result, err := s.writeDB.Exec(`DELETE FROM maintenance_windows WHERE window_id = ?`, windowID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrMaintenanceWindowNotFound
+	}
+	return nil
+}
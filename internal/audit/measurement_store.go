@@ -0,0 +1,336 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultMeasurementBucket = 5 * time.Minute
+	DefaultMeasurementRange  = 24 * time.Hour
+	// MaxMeasurementBuckets bounds the buckets one query may span per
+	// upstream and protocol.
+	MaxMeasurementBuckets = 10000
+)
+
+// InsertMeasurements stores probe results.
+func (s *Store) InsertMeasurements(records []MeasurementRecord) error {
+	if s == nil || len(records) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO measurements(upstream, protocol, recorded_at, duration_ms, success, rtt_ms, error) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, record := range records {
+		var rtt any
+		if record.Success {
+			rtt = record.RTTMs
+		}
+		if _, err := stmt.Exec(record.Upstream, record.Protocol, unixMilli(record.RecordedAt), record.Duration.Milliseconds(), boolInt(record.Success), rtt, record.Error); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// InsertHealthTransitions stores upstream health state changes.
+func (s *Store) InsertHealthTransitions(transitions []HealthTransition) error {
+	if s == nil || len(transitions) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO health_transitions(upstream, from_state, to_state, usable, occurred_at) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, transition := range transitions {
+		if _, err := stmt.Exec(transition.Upstream, transition.From, transition.To, boolInt(transition.Usable), unixMilli(transition.OccurredAt)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// InsertRouteFailovers stores failover route switches.
+func (s *Store) InsertRouteFailovers(failovers []RouteFailover) error {
+	if s == nil || len(failovers) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO route_failovers(route, from_upstream, to_upstream, reason, occurred_at) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, failover := range failovers {
+		if _, err := stmt.Exec(failover.Route, failover.From, failover.To, failover.Reason, unixMilli(failover.OccurredAt)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PruneMeasurements removes probe results, health transitions and route
+// failovers older than olderThan. They have their own retention, independent
+// of Prune.
+func (s *Store) PruneMeasurements(olderThan time.Time) (int64, error) {
+	if s == nil {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx, err := s.writeDB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := unixMilli(olderThan)
+	var deleted int64
+	for _, query := range []string{`DELETE FROM measurements WHERE recorded_at < ?`, `DELETE FROM health_transitions WHERE occurred_at < ?`, `DELETE FROM route_failovers WHERE occurred_at < ?`} {
+		result, err := tx.Exec(query, cutoff)
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		deleted += count
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// QueryMeasurements aggregates probe results into buckets aligned to
+// multiples of the bucket width since the Unix epoch, and lists the health
+// transitions and route failovers of the same range. The range defaults to the last day and the
+// bucket to five minutes. Buckets are ordered by start time, then upstream
+// and protocol.
+func (s *Store) QueryMeasurements(params MeasurementQueryParams) (MeasurementQueryResult, error) {
+	if s == nil {
+		return MeasurementQueryResult{}, errors.New("audit store is nil")
+	}
+	end := time.Now().UTC().Unix()
+	if params.EndTime != nil {
+		end = *params.EndTime
+	}
+	start := end - int64(DefaultMeasurementRange/time.Second)
+	if params.StartTime != nil {
+		start = *params.StartTime
+	}
+	if start > end {
+		return MeasurementQueryResult{}, errors.New("start_time must be earlier than or equal to end_time")
+	}
+	protocol := strings.ToLower(strings.TrimSpace(params.Protocol))
+	if protocol != "" && protocol != "tcp" && protocol != "udp" {
+		return MeasurementQueryResult{}, errors.New("protocol must be tcp or udp")
+	}
+	bucket := params.Bucket
+	if bucket == 0 {
+		bucket = DefaultMeasurementBucket
+	}
+	if bucket < time.Second || bucket%time.Second != 0 {
+		return MeasurementQueryResult{}, errors.New("bucket must be a whole number of seconds")
+	}
+	width := int64(bucket / time.Second)
+	if (end-start)/width+1 > MaxMeasurementBuckets {
+		return MeasurementQueryResult{}, fmt.Errorf("range spans more than %d buckets", MaxMeasurementBuckets)
+	}
+	descending, err := measurementSortOrder(params.SortOrder)
+	if err != nil {
+		return MeasurementQueryResult{}, err
+	}
+	if params.Limit < 0 || params.Limit > MaxMeasurementBuckets {
+		return MeasurementQueryResult{}, fmt.Errorf("limit must be between 0 (no limit) and %d", MaxMeasurementBuckets)
+	}
+	if params.Offset < 0 {
+		return MeasurementQueryResult{}, errors.New("offset must be >= 0")
+	}
+
+	where := []string{"recorded_at >= ?", "recorded_at <= ?"}
+	args := []any{start * 1000, end * 1000}
+	upstream := strings.TrimSpace(params.Upstream)
+	if upstream != "" {
+		where = append(where, "upstream = ?")
+		args = append(args, upstream)
+	}
+	if protocol != "" {
+		where = append(where, "protocol = ?")
+		args = append(args, protocol)
+	}
+	rows, err := s.readDB.Query(`SELECT upstream, protocol, recorded_at, success, COALESCE(rtt_ms, 0), error FROM measurements WHERE `+strings.Join(where, " AND ")+` ORDER BY upstream, protocol, recorded_at, id`, args...)
+	if err != nil {
+		return MeasurementQueryResult{}, err
+	}
+	defer rows.Close()
+	buckets := make([]MeasurementBucket, 0)
+	var rtts []float64
+	closeBucket := func() {
+		if len(buckets) > 0 {
+			summarizeRTTs(&buckets[len(buckets)-1], rtts)
+		}
+		rtts = rtts[:0]
+	}
+	for rows.Next() {
+		var tag, proto, errMsg string
+		var recorded int64
+		var success int
+		var rtt float64
+		if err := rows.Scan(&tag, &proto, &recorded, &success, &rtt, &errMsg); err != nil {
+			return MeasurementQueryResult{}, err
+		}
+		bucketStart := recorded / 1000 / width * width
+		if n := len(buckets); n == 0 || buckets[n-1].Upstream != tag || buckets[n-1].Protocol != proto || buckets[n-1].Start != bucketStart {
+			closeBucket()
+			buckets = append(buckets, MeasurementBucket{Upstream: tag, Protocol: proto, Start: bucketStart})
+		}
+		current := &buckets[len(buckets)-1]
+		current.Count++
+		if success == 0 {
+			current.Failures++
+			current.LastError = errMsg
+			continue
+		}
+		rtts = append(rtts, rtt)
+	}
+	if err := rows.Err(); err != nil {
+		return MeasurementQueryResult{}, err
+	}
+	closeBucket()
+	sort.SliceStable(buckets, func(i, j int) bool {
+		a, b := buckets[i], buckets[j]
+		if a.Start != b.Start {
+			return a.Start < b.Start != descending
+		}
+		if a.Upstream != b.Upstream {
+			return a.Upstream < b.Upstream
+		}
+		return a.Protocol < b.Protocol
+	})
+	buckets = buckets[min(params.Offset, len(buckets)):]
+	if params.Limit > 0 && len(buckets) > params.Limit {
+		buckets = buckets[:params.Limit]
+	}
+	transitions, err := s.queryHealthTransitions(start, end, upstream)
+	if err != nil {
+		return MeasurementQueryResult{}, err
+	}
+	failovers, err := s.queryRouteFailovers(start, end, upstream)
+	if err != nil {
+		return MeasurementQueryResult{}, err
+	}
+	return MeasurementQueryResult{Bucket: bucket.String(), StartTime: start, EndTime: end, Buckets: buckets, Transitions: transitions, Failovers: failovers}, nil
+}
+
+func (s *Store) queryHealthTransitions(start, end int64, upstream string) ([]HealthTransitionRecord, error) {
+	where := []string{"occurred_at >= ?", "occurred_at <= ?"}
+	args := []any{start * 1000, end * 1000}
+	if upstream != "" {
+		where = append(where, "upstream = ?")
+		args = append(args, upstream)
+	}
+	args = append(args, MaxMeasurementBuckets)
+	rows, err := s.readDB.Query(`SELECT upstream, from_state, to_state, usable, occurred_at FROM health_transitions WHERE `+strings.Join(where, " AND ")+` ORDER BY occurred_at, id LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]HealthTransitionRecord, 0)
+	for rows.Next() {
+		var record HealthTransitionRecord
+		var usable int
+		if err := rows.Scan(&record.Upstream, &record.From, &record.To, &usable, &record.OccurredAt); err != nil {
+			return nil, err
+		}
+		record.Usable = usable != 0
+		record.OccurredAt /= 1000
+		result = append(result, record)
+	}
+	return result, rows.Err()
+}
+
+// queryRouteFailovers lists the route failovers of the range; an upstream
+// filter matches the upstream switched from or to.
+func (s *Store) queryRouteFailovers(start, end int64, upstream string) ([]RouteFailoverRecord, error) {
+	where := []string{"occurred_at >= ?", "occurred_at <= ?"}
+	args := []any{start * 1000, end * 1000}
+	if upstream != "" {
+		where = append(where, "(from_upstream = ? OR to_upstream = ?)")
+		args = append(args, upstream, upstream)
+	}
+	args = append(args, MaxMeasurementBuckets)
+	rows, err := s.readDB.Query(`SELECT route, from_upstream, to_upstream, reason, occurred_at FROM route_failovers WHERE `+strings.Join(where, " AND ")+` ORDER BY occurred_at, id LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]RouteFailoverRecord, 0)
+	for rows.Next() {
+		var record RouteFailoverRecord
+		if err := rows.Scan(&record.Route, &record.From, &record.To, &record.Reason, &record.OccurredAt); err != nil {
+			return nil, err
+		}
+		record.OccurredAt /= 1000
+		result = append(result, record)
+	}
+	return result, rows.Err()
+}
+
+// summarizeRTTs fills in the RTT statistics of bucket; the 95th percentile
+// uses the nearest-rank method.
+func summarizeRTTs(bucket *MeasurementBucket, rtts []float64) {
+	if len(rtts) == 0 {
+		return
+	}
+	sort.Float64s(rtts)
+	sum := 0.0
+	for _, rtt := range rtts {
+		sum += rtt
+	}
+	bucket.RTTMinMs = rtts[0]
+	bucket.RTTAvgMs = sum / float64(len(rtts))
+	bucket.RTTP95Ms = rtts[int(math.Ceil(0.95*float64(len(rtts))))-1]
+}
+
+func measurementSortOrder(order string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(order)) {
+	case "", "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	default:
+		return false, errors.New("invalid sort_order: must be asc or desc")
+	}
+}
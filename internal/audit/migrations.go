@@ -8,7 +8,7 @@ import (
 	"time"
 )
 
-const currentSchemaVersion = 5
+const currentSchemaVersion = 12
 
 var schemaV2Statements = []string{
 	`CREATE TABLE IF NOT EXISTS schema_migrations (
@@ -205,8 +205,43 @@ func migrateDBWithHook(db *sql.DB, hook migrationHook) error {
 			return rollback(err)
 		}
 	}
+	if version < 6 {
+		if err := migrateSchemaV6(tx); err != nil {
+			return rollback(err)
+		}
+	}
+	if version < 7 {
+		if err := migrateSchemaV7(tx); err != nil {
+			return rollback(err)
+		}
+	}
+	if version < 8 {
+		if err := migrateSchemaV8(tx); err != nil {
+			return rollback(err)
+		}
+	}
+	if version < 9 {
+		if err := migrateSchemaV9(tx); err != nil {
+			return rollback(err)
+		}
+	}
+	if version < 10 {
+		if err := migrateSchemaV10(tx); err != nil {
+			return rollback(err)
+		}
+	}
+	if version < 11 {
+		if err := migrateSchemaV11(tx); err != nil {
+			return rollback(err)
+		}
+	}
+	if version < 12 {
+		if err := migrateSchemaV12(tx); err != nil {
+			return rollback(err)
+		}
+	}
 	now := time.Now().UTC().UnixMilli()
-	if _, err := tx.Exec(`INSERT OR REPLACE INTO schema_migrations(version, name, applied_at) VALUES (?, ?, ?)`, currentSchemaVersion, "audit schema v5", now); err != nil {
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO schema_migrations(version, name, applied_at) VALUES (?, ?, ?)`, currentSchemaVersion, fmt.Sprintf("audit schema v%d", currentSchemaVersion), now); err != nil {
 		return rollback(fmt.Errorf("record sqlite migration: %w", err))
 	}
 	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, currentSchemaVersion)); err != nil {
@@ -218,6 +253,166 @@ func migrateDBWithHook(db *sql.DB, hook migrationHook) error {
 	return nil
 }
 
+// migrateSchemaV12 stores the failovers and failbacks of failover routes
+// alongside the health transitions that cause them.
+func migrateSchemaV12(tx *sql.Tx) error {
+	for _, statement := range []string{
+		`CREATE TABLE IF NOT EXISTS route_failovers (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        route TEXT NOT NULL,
+        from_upstream TEXT NOT NULL DEFAULT '',
+        to_upstream TEXT NOT NULL,
+        reason TEXT NOT NULL,
+        occurred_at INTEGER NOT NULL
+    )`,
+		`CREATE INDEX IF NOT EXISTS idx_route_failovers_time ON route_failovers(occurred_at)`,
+	} {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("create route failover schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// migrateSchemaV11 stores upstream probe results and health state
+// transitions. RTT is kept in fractional milliseconds; a failed probe has
+// none.
+func migrateSchemaV11(tx *sql.Tx) error {
+	for _, statement := range []string{
+		`CREATE TABLE IF NOT EXISTS measurements (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        upstream TEXT NOT NULL,
+        protocol TEXT NOT NULL,
+        recorded_at INTEGER NOT NULL,
+        duration_ms INTEGER NOT NULL DEFAULT 0,
+        success INTEGER NOT NULL,
+        rtt_ms REAL,
+        error TEXT NOT NULL DEFAULT ''
+    )`,
+		`CREATE TABLE IF NOT EXISTS health_transitions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        upstream TEXT NOT NULL,
+        from_state TEXT NOT NULL DEFAULT '',
+        to_state TEXT NOT NULL,
+        usable INTEGER NOT NULL,
+        occurred_at INTEGER NOT NULL
+    )`,
+		`CREATE INDEX IF NOT EXISTS idx_measurements_time ON measurements(recorded_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_measurements_upstream_time ON measurements(upstream, recorded_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_health_transitions_upstream_time ON health_transitions(upstream, occurred_at)`,
+	} {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("create measurement schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// migrateSchemaV10 stores upstream maintenance windows created through the
+// control API.
+func migrateSchemaV10(tx *sql.Tx) error {
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS maintenance_windows (
+        window_id TEXT PRIMARY KEY,
+        upstream TEXT NOT NULL,
+        name TEXT NOT NULL DEFAULT '',
+        start_at TEXT NOT NULL DEFAULT '',
+        end_at TEXT NOT NULL DEFAULT '',
+        weekdays TEXT NOT NULL DEFAULT '',
+        at TEXT NOT NULL DEFAULT '',
+        duration_ms INTEGER NOT NULL DEFAULT 0,
+        timezone TEXT NOT NULL DEFAULT '',
+        close_after_ms INTEGER NOT NULL DEFAULT 0,
+        created_by TEXT NOT NULL DEFAULT '',
+        created_at INTEGER NOT NULL
+    )`); err != nil {
+		return fmt.Errorf("create maintenance_windows: %w", err)
+	}
+	return nil
+}
+
+// migrateSchemaV9 records the upstream dial attempts made while admitting a
+// Flow, stored as a JSON array so failover history stays on one row.
+func migrateSchemaV9(tx *sql.Tx) error {
+	for _, table := range []string{"flows", "rejection_events"} {
+		present, err := tableExists(tx, table)
+		if err != nil {
+			return err
+		}
+		if !present {
+			continue
+		}
+		exists, err := columnExists(tx, table, "dial_attempts")
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN dial_attempts TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("add %s.dial_attempts: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// migrateSchemaV8 records the route selection rule that matched a Flow's
+// client.
+func migrateSchemaV8(tx *sql.Tx) error {
+	present, err := tableExists(tx, "flows")
+	if err != nil || !present {
+		return err
+	}
+	exists, err := columnExists(tx, "flows", "selection_rule")
+	if err != nil || exists {
+		return err
+	}
+	if _, err := tx.Exec(`ALTER TABLE flows ADD COLUMN selection_rule TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("add flows.selection_rule: %w", err)
+	}
+	return nil
+}
+
+// migrateSchemaV7 records the immediate TCP peer when a trusted load balancer
+// supplied the client address through a PROXY header.
+func migrateSchemaV7(tx *sql.Tx) error {
+	for _, table := range []string{"flows", "rejection_events"} {
+		present, err := tableExists(tx, table)
+		if err != nil {
+			return err
+		}
+		if !present {
+			continue
+		}
+		exists, err := columnExists(tx, table, "peer_addr")
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN peer_addr TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("add %s.peer_addr: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// migrateSchemaV6 records the dialed upstream endpoint, whose port may differ
+// from the listener port once routes map ports.
+func migrateSchemaV6(tx *sql.Tx) error {
+	exists, err := columnExists(tx, "flows", "upstream_addr")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if _, err := tx.Exec(`ALTER TABLE flows ADD COLUMN upstream_addr TEXT NOT NULL DEFAULT ''`); err != nil {
+		return fmt.Errorf("add flows.upstream_addr: %w", err)
+	}
+	return nil
+}
+
 func migrateSchemaV5(tx *sql.Tx) error {
 	if _, err := tx.Exec(`DROP INDEX IF EXISTS idx_flow_checkpoints_flow_time`); err != nil {
 		return fmt.Errorf("drop flow checkpoint index: %w", err)
@@ -1,6 +1,10 @@
 package audit
 
-import "time"
+import (
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+)
 
 const (
 	DefaultQueryLimit = 200
@@ -23,6 +27,10 @@ type FlowRecord struct {
 	Listener      string
 	Route         string
 	Upstream      string
+	UpstreamAddr  string
+	PeerAddr      string
+	SelectionRule string
+	DialAttempts  []DialAttempt
 	StartedAt     time.Time
 	EndedAt       time.Time
 	LastActivity  time.Time
@@ -79,9 +87,11 @@ type RejectionRow struct {
 	ClientPort       int
 	Listener         string
 	Port             int
+	PeerAddr         string
 	Reason           string
 	MatchedRuleType  string
 	MatchedRuleValue string
+	DialAttempts     []DialAttempt
 	PolicyVersion    string
 	RuleID           string
 	RecordedAt       time.Time
@@ -90,6 +100,14 @@ type RejectionRow struct {
 	Country          string
 }
 
+// DialAttempt is one upstream connect attempt made while admitting a Flow.
+// An empty Error marks the attempt that connected.
+type DialAttempt struct {
+	Upstream string `json:"upstream"`
+	Addr     string `json:"addr"`
+	Error    string `json:"error,omitempty"`
+}
+
 type FlowTagEvent struct {
 	EventID   string     `json:"event_id"`
 	FlowID    string     `json:"flow_id"`
@@ -162,6 +180,106 @@ type OnlineRule struct {
 	UpdatedAt   time.Time
 }
 
+// MeasurementRecord is one probe result of an upstream. RTTMs is zero for a
+// failed probe.
+type MeasurementRecord struct {
+	Upstream   string
+	Protocol   string
+	RecordedAt time.Time
+	Duration   time.Duration
+	Success    bool
+	RTTMs      float64
+	Error      string
+}
+
+// HealthTransition is a change of an upstream's health state. States are
+// the health states, or passive_<signal> while passive health holds the
+// upstream down.
+type HealthTransition struct {
+	Upstream   string
+	From       string
+	To         string
+	Usable     bool
+	OccurredAt time.Time
+}
+
+// HealthTransitionRecord is a HealthTransition as returned by queries, with
+// OccurredAt in Unix seconds.
+type HealthTransitionRecord struct {
+	Upstream   string `json:"upstream"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Usable     bool   `json:"usable"`
+	OccurredAt int64  `json:"occurred_at"`
+}
+
+// RouteFailover is a change of a failover route's active upstream. Reason is
+// failover or failback.
+type RouteFailover struct {
+	Route      string
+	From       string
+	To         string
+	Reason     string
+	OccurredAt time.Time
+}
+
+// RouteFailoverRecord is a RouteFailover as returned by queries, with
+// OccurredAt in Unix seconds.
+type RouteFailoverRecord struct {
+	Route      string `json:"route"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Reason     string `json:"reason"`
+	OccurredAt int64  `json:"occurred_at"`
+}
+
+// MeasurementQueryParams selects probe results by Unix-second time range,
+// upstream and protocol, aggregated into buckets of Bucket.
+type MeasurementQueryParams struct {
+	StartTime *int64
+	EndTime   *int64
+	Upstream  string
+	Protocol  string
+	Bucket    time.Duration
+	SortOrder string
+	Limit     int
+	Offset    int
+}
+
+// MeasurementBucket aggregates the probes of one upstream and protocol that
+// started within [Start, Start+bucket). RTT statistics cover the successful
+// probes only and are zero when there are none.
+type MeasurementBucket struct {
+	Upstream  string  `json:"upstream"`
+	Protocol  string  `json:"protocol"`
+	Start     int64   `json:"start"`
+	Count     int     `json:"count"`
+	Failures  int     `json:"failures"`
+	RTTMinMs  float64 `json:"rtt_min_ms"`
+	RTTAvgMs  float64 `json:"rtt_avg_ms"`
+	RTTP95Ms  float64 `json:"rtt_p95_ms"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+type MeasurementQueryResult struct {
+	Bucket      string                   `json:"bucket"`
+	StartTime   int64                    `json:"start_time"`
+	EndTime     int64                    `json:"end_time"`
+	Buckets     []MeasurementBucket      `json:"buckets"`
+	Transitions []HealthTransitionRecord `json:"transitions"`
+	Failovers   []RouteFailoverRecord    `json:"failovers"`
+}
+
+// MaintenanceWindow is an upstream maintenance window created through the
+// control API.
+type MaintenanceWindow struct {
+	WindowID  string
+	Upstream  string
+	Window    config.MaintenanceWindowConfig
+	CreatedBy string
+	CreatedAt time.Time
+}
+
 type OnlineRuleEvent struct {
 	EventID     string
 	RuleID      string
@@ -190,39 +308,45 @@ type PolicyEvent struct {
 // Compatibility query types. Their JSON shape intentionally matches the
 // existing /rpc responses consumed by management clients.
 type Record struct {
-	ID          int64  `json:"id"`
-	FlowID      string `json:"flow_id,omitempty"`
-	IP          string `json:"ip"`
-	ASN         int    `json:"asn"`
-	ASOrg       string `json:"as_org"`
-	Country     string `json:"country"`
-	Protocol    string `json:"protocol"`
-	Upstream    string `json:"upstream"`
-	Listener    string `json:"listener,omitempty"`
-	Route       string `json:"route,omitempty"`
-	Port        int    `json:"port"`
-	BytesUp     uint64 `json:"bytes_up"`
-	BytesDown   uint64 `json:"bytes_down"`
-	DurationMs  int64  `json:"duration_ms"`
-	StartedAt   int64  `json:"started_at,omitempty"`
-	EndedAt     int64  `json:"ended_at,omitempty"`
-	CloseReason string `json:"close_reason,omitempty"`
-	RecordedAt  int64  `json:"recorded_at"`
+	ID            int64         `json:"id"`
+	FlowID        string        `json:"flow_id,omitempty"`
+	IP            string        `json:"ip"`
+	ASN           int           `json:"asn"`
+	ASOrg         string        `json:"as_org"`
+	Country       string        `json:"country"`
+	Protocol      string        `json:"protocol"`
+	Upstream      string        `json:"upstream"`
+	UpstreamAddr  string        `json:"upstream_addr,omitempty"`
+	PeerAddr      string        `json:"peer_addr,omitempty"`
+	Listener      string        `json:"listener,omitempty"`
+	Route         string        `json:"route,omitempty"`
+	SelectionRule string        `json:"selection_rule,omitempty"`
+	DialAttempts  []DialAttempt `json:"dial_attempts,omitempty"`
+	Port          int           `json:"port"`
+	BytesUp       uint64        `json:"bytes_up"`
+	BytesDown     uint64        `json:"bytes_down"`
+	DurationMs    int64         `json:"duration_ms"`
+	StartedAt     int64         `json:"started_at,omitempty"`
+	EndedAt       int64         `json:"ended_at,omitempty"`
+	CloseReason   string        `json:"close_reason,omitempty"`
+	RecordedAt    int64         `json:"recorded_at"`
 }
 
 type RejectionRecordResult struct {
-	ID               int64  `json:"id"`
-	EventID          string `json:"event_id,omitempty"`
-	IP               string `json:"ip"`
-	ASN              int    `json:"asn"`
-	ASOrg            string `json:"as_org"`
-	Country          string `json:"country"`
-	Protocol         string `json:"protocol"`
-	Port             int    `json:"port"`
-	Reason           string `json:"reason"`
-	MatchedRuleType  string `json:"matched_rule_type"`
-	MatchedRuleValue string `json:"matched_rule_value"`
-	RecordedAt       int64  `json:"recorded_at"`
+	ID               int64         `json:"id"`
+	EventID          string        `json:"event_id,omitempty"`
+	IP               string        `json:"ip"`
+	ASN              int           `json:"asn"`
+	ASOrg            string        `json:"as_org"`
+	Country          string        `json:"country"`
+	Protocol         string        `json:"protocol"`
+	Port             int           `json:"port"`
+	PeerAddr         string        `json:"peer_addr,omitempty"`
+	Reason           string        `json:"reason"`
+	MatchedRuleType  string        `json:"matched_rule_type"`
+	MatchedRuleValue string        `json:"matched_rule_value"`
+	DialAttempts     []DialAttempt `json:"dial_attempts,omitempty"`
+	RecordedAt       int64         `json:"recorded_at"`
 }
 
 // RejectionRecord is kept as the old public name.
@@ -325,11 +449,12 @@ type LogEventQueryResult struct {
 }
 
 type StoreStats struct {
-	FlowRecordCount      int   `json:"flow_record_count"`
-	RejectionRecordCount int   `json:"rejection_record_count"`
-	TotalRecordCount     int   `json:"total_record_count"`
-	OldestRecordAt       int64 `json:"oldest_record_at"`
-	NewestRecordAt       int64 `json:"newest_record_at"`
+	FlowRecordCount        int   `json:"flow_record_count"`
+	RejectionRecordCount   int   `json:"rejection_record_count"`
+	MeasurementRecordCount int   `json:"measurement_record_count"`
+	TotalRecordCount       int   `json:"total_record_count"`
+	OldestRecordAt         int64 `json:"oldest_record_at"`
+	NewestRecordAt         int64 `json:"newest_record_at"`
 }
 
 type TopTalker struct {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log/slog"
 	"net"
+	"net/netip"
 	"strconv"
 	"sync"
 	"time"
@@ -27,6 +28,9 @@ type pipelineItem struct {
 	flow       *FlowRecord
 	checkpoint *FlowCheckpoint
 	rejection  *RejectionRow
+	measure    *MeasurementRecord
+	transition *HealthTransition
+	failover   *RouteFailover
 }
 
 func (i pipelineItem) recordCount() uint64 {
@@ -43,6 +47,15 @@ func (i pipelineItem) recordCount() uint64 {
 	if i.rejection != nil {
 		count++
 	}
+	if i.measure != nil {
+		count++
+	}
+	if i.transition != nil {
+		count++
+	}
+	if i.failover != nil {
+		count++
+	}
 	return count
 }
 
@@ -183,7 +196,7 @@ func (p *Pipeline) Close(summary flow.Summary) {
 	if last.IsZero() {
 		last = started
 	}
-	record := FlowRecord{FlowID: summary.ID.String(), Protocol: summary.Protocol, ClientIP: summary.ClientAddr.Addr().String(), ClientPort: int(summary.ClientAddr.Port()), Listener: summary.Listener, Route: summary.Route, Upstream: summary.Upstream, StartedAt: started, EndedAt: ended, LastActivity: last, BytesUp: summary.BytesUp, BytesDown: summary.BytesDown, CloseReason: summary.CloseReason}
+	record := FlowRecord{FlowID: summary.ID.String(), Protocol: summary.Protocol, ClientIP: summary.ClientAddr.Addr().String(), ClientPort: int(summary.ClientAddr.Port()), Listener: summary.Listener, Route: summary.Route, Upstream: summary.Upstream, UpstreamAddr: addrPortString(summary.UpstreamAddr), PeerAddr: addrPortString(summary.PeerAddr), SelectionRule: summary.SelectionRule, DialAttempts: dialAttempts(summary.DialAttempts), StartedAt: started, EndedAt: ended, LastActivity: last, BytesUp: summary.BytesUp, BytesDown: summary.BytesDown, CloseReason: summary.CloseReason}
 	checkpoint := FlowCheckpoint{FlowID: record.FlowID, RecordedAt: ended, LastActivity: last, BytesUp: summary.BytesUp, BytesDown: summary.BytesDown, SegmentsUp: current.lastCounters.SegmentsUp, SegmentsDown: current.lastCounters.SegmentsDown}
 	p.enqueue(pipelineItem{entity: &FlowEntity{
 		FlowID: record.FlowID, Protocol: record.Protocol, ClientIP: record.ClientIP, ClientPort: record.ClientPort,
@@ -196,7 +209,7 @@ func (p *Pipeline) Reject(rejection flow.Rejection) {
 	if p == nil || !p.logRejections {
 		return
 	}
-	event := RejectionRow{EventID: uuidLike(), Protocol: rejection.Protocol, ClientIP: rejection.ClientAddr.Addr().String(), ClientPort: int(rejection.ClientAddr.Port()), Listener: rejection.Listener, Port: listenerPort(rejection.Listener), Reason: rejection.Reason, MatchedRuleType: rejection.MatchedRuleType, MatchedRuleValue: rejection.MatchedRuleValue, RecordedAt: defaultTime(rejection.RecordedAt)}
+	event := RejectionRow{EventID: uuidLike(), Protocol: rejection.Protocol, ClientIP: rejection.ClientAddr.Addr().String(), ClientPort: int(rejection.ClientAddr.Port()), Listener: rejection.Listener, Port: listenerPort(rejection.Listener), PeerAddr: addrPortString(rejection.PeerAddr), Reason: rejection.Reason, MatchedRuleType: rejection.MatchedRuleType, MatchedRuleValue: rejection.MatchedRuleValue, DialAttempts: dialAttempts(rejection.DialAttempts), RecordedAt: defaultTime(rejection.RecordedAt)}
 	key := event.ClientIP + "|" + event.Protocol + "|" + event.Reason + "|" + event.MatchedRuleType + "|" + event.MatchedRuleValue
 	if !p.allowRejection(key, event.RecordedAt) {
 		return
@@ -204,6 +217,35 @@ func (p *Pipeline) Reject(rejection flow.Rejection) {
 	p.enqueue(pipelineItem{rejection: &event})
 }
 
+// RecordMeasurement queues a probe result for the measurement history.
+func (p *Pipeline) RecordMeasurement(record MeasurementRecord) {
+	if p == nil {
+		return
+	}
+	record.RecordedAt = defaultTime(record.RecordedAt)
+	p.enqueue(pipelineItem{measure: &record})
+}
+
+// RecordHealthTransition queues an upstream health state change for the
+// measurement history.
+func (p *Pipeline) RecordHealthTransition(transition HealthTransition) {
+	if p == nil {
+		return
+	}
+	transition.OccurredAt = defaultTime(transition.OccurredAt)
+	p.enqueue(pipelineItem{transition: &transition})
+}
+
+// RecordRouteFailover queues a failover route switch for the measurement
+// history.
+func (p *Pipeline) RecordRouteFailover(failover RouteFailover) {
+	if p == nil {
+		return
+	}
+	failover.OccurredAt = defaultTime(failover.OccurredAt)
+	p.enqueue(pipelineItem{failover: &failover})
+}
+
 func (p *Pipeline) allowRejection(key string, now time.Time) bool {
 	p.rejectMu.Lock()
 	defer p.rejectMu.Unlock()
@@ -294,6 +336,9 @@ func (p *Pipeline) runWriteWorker() {
 	flows := make([]FlowRecord, 0, p.batchSize)
 	checkpoints := make([]FlowCheckpoint, 0, p.batchSize)
 	rejections := make([]RejectionRow, 0, p.batchSize)
+	measurements := make([]MeasurementRecord, 0, p.batchSize)
+	transitions := make([]HealthTransition, 0, p.batchSize)
+	failovers := make([]RouteFailover, 0, p.batchSize)
 	ticker := time.NewTicker(p.flushInterval)
 	defer ticker.Stop()
 	recordResult := func(event string, count int, err error) {
@@ -314,12 +359,15 @@ func (p *Pipeline) runWriteWorker() {
 	flush := func() {
 		if p.store == nil {
 			if p.metrics != nil {
-				p.metrics.AddAuditDropped(uint64(len(entities) + len(flows) + len(checkpoints) + len(rejections)))
+				p.metrics.AddAuditDropped(uint64(len(entities) + len(flows) + len(checkpoints) + len(rejections) + len(measurements) + len(transitions) + len(failovers)))
 			}
 			entities = entities[:0]
 			flows = flows[:0]
 			checkpoints = checkpoints[:0]
 			rejections = rejections[:0]
+			measurements = measurements[:0]
+			transitions = transitions[:0]
+			failovers = failovers[:0]
 			return
 		}
 		if len(entities) > 0 {
@@ -338,6 +386,18 @@ func (p *Pipeline) runWriteWorker() {
 			recordResult("audit.rejection_write_failed", len(rejections), p.store.InsertRejections(rejections))
 			rejections = rejections[:0]
 		}
+		if len(measurements) > 0 {
+			recordResult("audit.measurement_write_failed", len(measurements), p.store.InsertMeasurements(measurements))
+			measurements = measurements[:0]
+		}
+		if len(transitions) > 0 {
+			recordResult("audit.health_transition_write_failed", len(transitions), p.store.InsertHealthTransitions(transitions))
+			transitions = transitions[:0]
+		}
+		if len(failovers) > 0 {
+			recordResult("audit.route_failover_write_failed", len(failovers), p.store.InsertRouteFailovers(failovers))
+			failovers = failovers[:0]
+		}
 	}
 	for {
 		select {
@@ -358,7 +418,16 @@ func (p *Pipeline) runWriteWorker() {
 			if item.rejection != nil {
 				rejections = append(rejections, *item.rejection)
 			}
-			if len(entities)+len(flows)+len(checkpoints)+len(rejections) >= p.batchSize {
+			if item.measure != nil {
+				measurements = append(measurements, *item.measure)
+			}
+			if item.transition != nil {
+				transitions = append(transitions, *item.transition)
+			}
+			if item.failover != nil {
+				failovers = append(failovers, *item.failover)
+			}
+			if len(entities)+len(flows)+len(checkpoints)+len(rejections)+len(measurements)+len(transitions)+len(failovers) >= p.batchSize {
 				flush()
 			}
 		case <-ticker.C:
@@ -384,4 +453,22 @@ func listenerPort(listener string) int {
 	return 0
 }
 
+func addrPortString(addr netip.AddrPort) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	return addr.String()
+}
+
+func dialAttempts(attempts []flow.DialAttempt) []DialAttempt {
+	if len(attempts) == 0 {
+		return nil
+	}
+	out := make([]DialAttempt, 0, len(attempts))
+	for _, attempt := range attempts {
+		out = append(out, DialAttempt{Upstream: attempt.Upstream, Addr: addrPortString(attempt.Addr), Error: attempt.Error})
+	}
+	return out
+}
+
 func uuidLike() string { return uuid.NewString() }
@@ -56,7 +56,7 @@ func TestPipelineWritesFlowAndCheckpoint(t *testing.T) {
 	if got := waitForCheckpointCount(t, store, id.String(), 1); got != 1 {
 		t.Fatalf("active checkpoint count = %d, want 1", got)
 	}
-	pipeline.Close(flow.Summary{Meta: flow.Meta{ID: id, Protocol: flow.ProtocolTCP, ClientAddr: netip.MustParseAddrPort("192.0.2.10:1234"), Listener: ":9000", Upstream: "primary", StartedAt: started}, EndedAt: started.Add(time.Second), LastActivity: started.Add(500 * time.Millisecond), BytesUp: 10, BytesDown: 20, CloseReason: "eof"})
+	pipeline.Close(flow.Summary{Meta: flow.Meta{ID: id, Protocol: flow.ProtocolTCP, ClientAddr: netip.MustParseAddrPort("192.0.2.10:1234"), Listener: ":9000", Upstream: "primary", UpstreamAddr: netip.MustParseAddrPort("203.0.113.10:8443"), PeerAddr: netip.MustParseAddrPort("10.0.0.5:40000"), SelectionRule: "cn-to-hk", DialAttempts: []flow.DialAttempt{{Upstream: "backup", Addr: netip.MustParseAddrPort("203.0.113.20:8443"), Error: "connection refused"}, {Upstream: "primary", Addr: netip.MustParseAddrPort("203.0.113.10:8443")}}, StartedAt: started}, EndedAt: started.Add(time.Second), LastActivity: started.Add(500 * time.Millisecond), BytesUp: 10, BytesDown: 20, CloseReason: "eof"})
 	if err := pipeline.Shutdown(context.Background()); err != nil {
 		t.Fatal(err)
 	}
@@ -64,6 +64,18 @@ func TestPipelineWritesFlowAndCheckpoint(t *testing.T) {
 	if err != nil || result.Total != 1 || result.Records[0].FlowID != id.String() {
 		t.Fatalf("flow result = %+v err=%v", result, err)
 	}
+	if got := result.Records[0].UpstreamAddr; got != "203.0.113.10:8443" {
+		t.Fatalf("flow upstream_addr = %q, want mapped destination", got)
+	}
+	if got := result.Records[0].PeerAddr; got != "10.0.0.5:40000" {
+		t.Fatalf("flow peer_addr = %q, want proxy peer", got)
+	}
+	if got := result.Records[0].SelectionRule; got != "cn-to-hk" {
+		t.Fatalf("flow selection_rule = %q, want matched rule", got)
+	}
+	if got := result.Records[0].DialAttempts; len(got) != 2 || got[0] != (DialAttempt{Upstream: "backup", Addr: "203.0.113.20:8443", Error: "connection refused"}) || got[1].Error != "" {
+		t.Fatalf("flow dial_attempts = %+v, want failed backup then primary", got)
+	}
 	var checkpoints int
 	if err := store.readDB.QueryRow(`SELECT COUNT(*) FROM flow_checkpoints WHERE flow_id = ?`, id.String()).Scan(&checkpoints); err != nil {
 		t.Fatal(err)
@@ -199,6 +211,33 @@ func TestPipelineFlushesPendingBatchOnShutdown(t *testing.T) {
 	}
 }
 
+func TestPipelineWritesMeasurementsAndHealthTransitions(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "measurements.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	pipeline := NewPipeline(config.IPLogConfig{GeoQueueSize: 4, WriteQueueSize: 4, BatchSize: 10, FlushInterval: config.Duration(time.Hour)}, nil, store, nil, nil)
+	pipeline.Start()
+	pipeline.RecordMeasurement(MeasurementRecord{Upstream: "primary", Protocol: "udp", Duration: time.Second, Success: true, RTTMs: 12.5})
+	pipeline.RecordHealthTransition(HealthTransition{Upstream: "primary", From: "healthy", To: "unhealthy"})
+	pipeline.RecordRouteFailover(RouteFailover{Route: "web", From: "primary", To: "backup", Reason: "failover"})
+	if err := pipeline.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var rtt float64
+	if err := store.readDB.QueryRow(`SELECT rtt_ms FROM measurements WHERE upstream = ? AND protocol = ?`, "primary", "udp").Scan(&rtt); err != nil || rtt != 12.5 {
+		t.Fatalf("measurement rtt = %v, %v", rtt, err)
+	}
+	var to string
+	if err := store.readDB.QueryRow(`SELECT to_state FROM health_transitions WHERE upstream = ? AND occurred_at > 0`, "primary").Scan(&to); err != nil || to != "unhealthy" {
+		t.Fatalf("health transition = %q, %v", to, err)
+	}
+	if err := store.readDB.QueryRow(`SELECT to_upstream FROM route_failovers WHERE route = ? AND occurred_at > 0`, "web").Scan(&to); err != nil || to != "backup" {
+		t.Fatalf("route failover = %q, %v", to, err)
+	}
+}
+
 func TestPipelineCountsQueueDropAsReceivedAndDropped(t *testing.T) {
 	metricSet := metrics.NewMetrics(nil)
 	pipeline := NewPipeline(config.IPLogConfig{GeoQueueSize: 1, WriteQueueSize: 1}, nil, nil, metricSet, nil)
@@ -233,8 +272,8 @@ func TestPipelineEnrichesRejectionBeforeWrite(t *testing.T) {
 	pipeline := NewPipeline(config.IPLogConfig{Enabled: true, LogRejections: &logRejections, GeoQueueSize: 2, WriteQueueSize: 2, BatchSize: 1}, pipelineLookup{}, store, nil, nil)
 	pipeline.Start()
 	pipeline.Reject(flow.Rejection{
-		Protocol: "udp", ClientAddr: netip.MustParseAddrPort("192.0.2.1:1234"), Listener: ":9000",
-		Reason: "firewall_deny", RecordedAt: time.Now().UTC(),
+		Protocol: "tcp", ClientAddr: netip.MustParseAddrPort("192.0.2.1:1234"), PeerAddr: netip.MustParseAddrPort("10.0.0.5:40000"), Listener: ":9000",
+		Reason: "dial_failed", DialAttempts: []flow.DialAttempt{{Upstream: "primary", Addr: netip.MustParseAddrPort("203.0.113.10:443"), Error: "i/o timeout"}}, RecordedAt: time.Now().UTC(),
 	})
 	if err := pipeline.Shutdown(context.Background()); err != nil {
 		t.Fatal(err)
@@ -247,6 +286,12 @@ func TestPipelineEnrichesRejectionBeforeWrite(t *testing.T) {
 	if record.ASN != 13335 || record.ASOrg != "Cloudflare" || record.Country != "US" {
 		t.Fatalf("rejection was not GeoIP enriched: %+v", record)
 	}
+	if record.PeerAddr != "10.0.0.5:40000" {
+		t.Fatalf("rejection peer_addr = %q, want proxy peer", record.PeerAddr)
+	}
+	if len(record.DialAttempts) != 1 || record.DialAttempts[0].Upstream != "primary" || record.DialAttempts[0].Error != "i/o timeout" {
+		t.Fatalf("rejection dial_attempts = %+v", record.DialAttempts)
+	}
 }
 
 func TestPipelineBoundsRejectionDeduplication(t *testing.T) {
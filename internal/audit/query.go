@@ -153,8 +153,9 @@ func scanFlowRecords(rows *sql.Rows) ([]Record, error) {
 		var record Record
 		var asn sql.NullInt64
 		var asOrg, country, flowID, listener, route, closeReason sql.NullString
+		var dialAttempts string
 		var started, ended int64
-		if err := rows.Scan(&record.ID, &flowID, &record.IP, &asn, &asOrg, &country, &record.Protocol, &record.Upstream, &listener, &route, &record.Port, &record.BytesUp, &record.BytesDown, &record.DurationMs, &started, &ended, &closeReason); err != nil {
+		if err := rows.Scan(&record.ID, &flowID, &record.IP, &asn, &asOrg, &country, &record.Protocol, &record.Upstream, &record.UpstreamAddr, &record.PeerAddr, &record.SelectionRule, &dialAttempts, &listener, &route, &record.Port, &record.BytesUp, &record.BytesDown, &record.DurationMs, &started, &ended, &closeReason); err != nil {
 			return nil, err
 		}
 		record.FlowID = flowID.String
@@ -164,6 +165,7 @@ func scanFlowRecords(rows *sql.Rows) ([]Record, error) {
 		record.Listener = listener.String
 		record.Route = route.String
 		record.CloseReason = closeReason.String
+		record.DialAttempts = decodeDialAttempts(dialAttempts)
 		record.StartedAt = started
 		record.EndedAt = ended
 		record.RecordedAt = ended / 1000
@@ -178,8 +180,9 @@ func scanRejectionRecords(rows *sql.Rows) ([]RejectionRecord, error) {
 		var record RejectionRecord
 		var asn sql.NullInt64
 		var asOrg, country, eventID, ruleType, ruleValue sql.NullString
+		var dialAttempts string
 		var recorded int64
-		if err := rows.Scan(&record.ID, &eventID, &record.IP, &asn, &asOrg, &country, &record.Protocol, &record.Port, &record.Reason, &ruleType, &ruleValue, &recorded); err != nil {
+		if err := rows.Scan(&record.ID, &eventID, &record.IP, &asn, &asOrg, &country, &record.Protocol, &record.Port, &record.PeerAddr, &record.Reason, &ruleType, &ruleValue, &dialAttempts, &recorded); err != nil {
 			return nil, err
 		}
 		record.EventID = eventID.String
@@ -188,6 +191,7 @@ func scanRejectionRecords(rows *sql.Rows) ([]RejectionRecord, error) {
 		record.Country = country.String
 		record.MatchedRuleType = ruleType.String
 		record.MatchedRuleValue = ruleValue.String
+		record.DialAttempts = decodeDialAttempts(dialAttempts)
 		record.RecordedAt = recorded / 1000
 		result = append(result, record)
 	}
@@ -271,7 +275,7 @@ func (s *Store) Query(params QueryParams) (QueryResult, error) {
 	if err := s.readDB.QueryRow(`SELECT COUNT(*) FROM flows`+where, args...).Scan(&total); err != nil {
 		return QueryResult{}, err
 	}
-	query := `SELECT id, flow_id, client_ip, asn, as_org, country, protocol, upstream, listener, route, ` + listenerPortSQL + `, bytes_up, bytes_down, (ended_at-started_at), started_at, ended_at, close_reason FROM flows` + where + ` ORDER BY ` + flowSortColumns[p.SortBy] + ` ` + p.SortOrder + `, id ` + p.SortOrder + ` LIMIT ? OFFSET ?`
+	query := `SELECT id, flow_id, client_ip, asn, as_org, country, protocol, upstream, upstream_addr, peer_addr, selection_rule, dial_attempts, listener, route, ` + listenerPortSQL + `, bytes_up, bytes_down, (ended_at-started_at), started_at, ended_at, close_reason FROM flows` + where + ` ORDER BY ` + flowSortColumns[p.SortBy] + ` ` + p.SortOrder + `, id ` + p.SortOrder + ` LIMIT ? OFFSET ?`
 	rows, err := s.readDB.Query(query, append(args, p.Limit, p.Offset)...)
 	if err != nil {
 		return QueryResult{}, err
@@ -294,7 +298,7 @@ func (s *Store) QueryRejections(params RejectionQueryParams) (RejectionQueryResu
 	if err := s.readDB.QueryRow(`SELECT COUNT(*) FROM rejection_events`+where, args...).Scan(&total); err != nil {
 		return RejectionQueryResult{}, err
 	}
-	query := `SELECT id, event_id, client_ip, asn, as_org, country, protocol, port, reason, matched_rule_type, matched_rule_value, recorded_at FROM rejection_events` + where + ` ORDER BY ` + rejectionSortColumns[p.SortBy] + ` ` + p.SortOrder + `, id ` + p.SortOrder + ` LIMIT ? OFFSET ?`
+	query := `SELECT id, event_id, client_ip, asn, as_org, country, protocol, port, peer_addr, reason, matched_rule_type, matched_rule_value, dial_attempts, recorded_at FROM rejection_events` + where + ` ORDER BY ` + rejectionSortColumns[p.SortBy] + ` ` + p.SortOrder + `, id ` + p.SortOrder + ` LIMIT ? OFFSET ?`
 	rows, err := s.readDB.Query(query, append(args, p.Limit, p.Offset)...)
 	if err != nil {
 		return RejectionQueryResult{}, err
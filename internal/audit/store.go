@@ -127,6 +127,9 @@ func (s *Store) Stats() (StoreStats, error) {
 	if err := s.readDB.QueryRow(`SELECT COUNT(*), COALESCE(MIN(recorded_at), 0), COALESCE(MAX(recorded_at), 0) FROM rejection_events`).Scan(&stats.RejectionRecordCount, &rejectionOldest, &rejectionNewest); err != nil {
 		return StoreStats{}, err
 	}
+	if err := s.readDB.QueryRow(`SELECT COUNT(*) FROM measurements`).Scan(&stats.MeasurementRecordCount); err != nil {
+		return StoreStats{}, err
+	}
 	stats.TotalRecordCount = stats.FlowRecordCount + stats.RejectionRecordCount
 	stats.OldestRecordAt = minPositive(stats.OldestRecordAt, rejectionOldest)
 	stats.NewestRecordAt = maxPositive(stats.NewestRecordAt, rejectionNewest)
@@ -146,14 +149,26 @@ func (s *Store) Close() error {
 	return errors.Join(errs...)
 }
 
-func (s *Store) StartRetention(ctx context.Context, retention, pruneEvery time.Duration) {
-	if s == nil || retention <= 0 {
+// StartRetention prunes Flow and rejection records older than retention and
+// measurement history older than measurementRetention every pruneEvery. A
+// zero retention keeps the records it covers.
+func (s *Store) StartRetention(ctx context.Context, retention, measurementRetention, pruneEvery time.Duration) {
+	if s == nil || (retention <= 0 && measurementRetention <= 0) {
 		return
 	}
 	if pruneEvery <= 0 {
 		pruneEvery = time.Hour
 	}
-	_, _ = s.Prune(time.Now().Add(-retention))
+	prune := func() {
+		now := time.Now()
+		if retention > 0 {
+			_, _ = s.Prune(now.Add(-retention))
+		}
+		if measurementRetention > 0 {
+			_, _ = s.PruneMeasurements(now.Add(-measurementRetention))
+		}
+	}
+	prune()
 	ticker := time.NewTicker(pruneEvery)
 	go func() {
 		defer ticker.Stop()
@@ -162,7 +177,7 @@ func (s *Store) StartRetention(ctx context.Context, retention, pruneEvery time.D
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				_, _ = s.Prune(time.Now().Add(-retention))
+				prune()
 			}
 		}
 	}()
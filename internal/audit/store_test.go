@@ -5,10 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/NodePath81/fbforward/internal/config"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -35,7 +37,7 @@ func TestEmptyStoreInitializesSchemaV5(t *testing.T) {
 	if err := store.readDB.QueryRow(`SELECT "table" FROM pragma_foreign_key_list('flow_checkpoints') WHERE "table" = 'flow_entities'`).Scan(&foreignTable); err != nil {
 		t.Fatalf("flow_checkpoints foreign key = %v", err)
 	}
-	for _, table := range []string{"flows", "flow_entities", "flow_checkpoints", "rejection_events", "flow_tag_events", "flow_tags", "client_tags", "online_rules", "online_rule_events", "policy_events", "schema_migrations", "ip_log", "rejection_log"} {
+	for _, table := range []string{"flows", "flow_entities", "flow_checkpoints", "rejection_events", "flow_tag_events", "flow_tags", "client_tags", "online_rules", "online_rule_events", "policy_events", "maintenance_windows", "schema_migrations", "ip_log", "rejection_log"} {
 		var count int
 		if err := store.readDB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?`, table).Scan(&count); err != nil {
 			t.Fatal(err)
@@ -213,6 +215,28 @@ func TestOnlineRuleStoreLifecycleAndAudit(t *testing.T) {
 	}
 }
 
+func TestMaintenanceWindowStoreRoundTrip(t *testing.T) {
+	store := newTestStore(t)
+	window := config.MaintenanceWindowConfig{Name: "patch", Weekdays: []string{"sun", "wed"}, At: "02:30", Duration: config.Duration(time.Hour), Timezone: "UTC", CloseAfter: config.Duration(10 * time.Minute)}
+	created, err := store.CreateMaintenanceWindow(MaintenanceWindow{Upstream: "primary", Window: window, CreatedBy: "control:test"})
+	if err != nil || created.WindowID == "" {
+		t.Fatalf("created=%+v err=%v", created, err)
+	}
+	windows, err := store.ListMaintenanceWindows()
+	if err != nil || len(windows) != 1 {
+		t.Fatalf("windows=%+v err=%v", windows, err)
+	}
+	if got := windows[0]; got.WindowID != created.WindowID || got.Upstream != "primary" || !reflect.DeepEqual(got.Window, window) || got.CreatedBy != "control:test" {
+		t.Fatalf("stored window = %+v", got)
+	}
+	if err := store.DeleteMaintenanceWindow(created.WindowID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteMaintenanceWindow(created.WindowID); !errors.Is(err, ErrMaintenanceWindowNotFound) {
+		t.Fatalf("second delete = %v", err)
+	}
+}
+
 func TestLegacyDatabaseMigratesIdempotently(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "legacy.sqlite")
 	db, err := sql.Open("sqlite3", path)
@@ -567,3 +591,83 @@ func TestBackupRestore(t *testing.T) {
 	}
 	_ = store.Close()
 }
+
+func TestMeasurementQueryBucketsAndPrune(t *testing.T) {
+	store := newTestStore(t)
+	base := time.Unix(1_700_000_100, 0).UTC()
+	var records []MeasurementRecord
+	for i, rtt := range []float64{10, 20, 30, 40} {
+		records = append(records, MeasurementRecord{Upstream: "primary", Protocol: "tcp", RecordedAt: base.Add(time.Duration(i) * time.Second), Duration: time.Second, Success: true, RTTMs: rtt})
+	}
+	records = append(records,
+		MeasurementRecord{Upstream: "primary", Protocol: "tcp", RecordedAt: base.Add(5 * time.Second), Duration: time.Second, Error: "timeout"},
+		MeasurementRecord{Upstream: "primary", Protocol: "tcp", RecordedAt: base.Add(time.Minute), Duration: time.Second, Success: true, RTTMs: 5},
+		MeasurementRecord{Upstream: "backup", Protocol: "udp", RecordedAt: base, Duration: time.Second, Success: true, RTTMs: 50},
+	)
+	if err := store.InsertMeasurements(records); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertHealthTransitions([]HealthTransition{{Upstream: "primary", From: "healthy", To: "degraded", Usable: true, OccurredAt: base.Add(10 * time.Second)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.InsertRouteFailovers([]RouteFailover{
+		{Route: "web", From: "primary", To: "backup", Reason: "failover", OccurredAt: base.Add(20 * time.Second)},
+		{Route: "api", From: "east", To: "west", Reason: "failback", OccurredAt: base.Add(20 * time.Second)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	start, end := base.Unix()-100, base.Unix()+100
+	result, err := store.QueryMeasurements(MeasurementQueryParams{StartTime: &start, EndTime: &end, Upstream: "primary", Bucket: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Buckets) != 2 || result.Bucket != "1m0s" {
+		t.Fatalf("buckets = %#v", result)
+	}
+	first := result.Buckets[0]
+	if first.Start != base.Unix()/60*60 || first.Count != 5 || first.Failures != 1 || first.LastError != "timeout" {
+		t.Fatalf("first bucket = %#v", first)
+	}
+	if first.RTTMinMs != 10 || first.RTTAvgMs != 25 || first.RTTP95Ms != 40 {
+		t.Fatalf("first bucket rtt = %#v", first)
+	}
+	if result.Buckets[1].Count != 1 || result.Buckets[1].RTTP95Ms != 5 {
+		t.Fatalf("second bucket = %#v", result.Buckets[1])
+	}
+	if len(result.Transitions) != 1 || result.Transitions[0].To != "degraded" || result.Transitions[0].OccurredAt != base.Unix()+10 {
+		t.Fatalf("transitions = %#v", result.Transitions)
+	}
+	if len(result.Failovers) != 1 || result.Failovers[0].Route != "web" || result.Failovers[0].To != "backup" || result.Failovers[0].OccurredAt != base.Unix()+20 {
+		t.Fatalf("failovers = %#v", result.Failovers)
+	}
+
+	result, err = store.QueryMeasurements(MeasurementQueryParams{StartTime: &start, EndTime: &end, Protocol: "udp", SortOrder: "desc", Limit: 1})
+	if err != nil || len(result.Buckets) != 1 || result.Buckets[0].Upstream != "backup" {
+		t.Fatalf("udp query = %#v, %v", result, err)
+	}
+
+	for _, params := range []MeasurementQueryParams{
+		{StartTime: &end, EndTime: &start},
+		{Protocol: "icmp"},
+		{Bucket: 1500 * time.Millisecond},
+		{Bucket: time.Second},
+		{SortOrder: "sideways"},
+		{Offset: -1},
+	} {
+		if _, err := store.QueryMeasurements(params); err == nil {
+			t.Errorf("QueryMeasurements(%#v) unexpectedly succeeded", params)
+		}
+	}
+	if _, err := store.QueryMeasurements(MeasurementQueryParams{Limit: -1}); err == nil || !strings.Contains(err.Error(), "between 0 (no limit) and") {
+		t.Errorf("negative limit error = %v", err)
+	}
+
+	deleted, err := store.PruneMeasurements(base.Add(30 * time.Second))
+	if err != nil || deleted != 9 {
+		t.Fatalf("PruneMeasurements = %d, %v", deleted, err)
+	}
+	stats, err := store.Stats()
+	if err != nil || stats.MeasurementRecordCount != 1 {
+		t.Fatalf("stats = %#v, %v", stats, err)
+	}
+}
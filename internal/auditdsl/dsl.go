@@ -26,6 +26,8 @@ const (
 	SourceTopClients Source = "top clients"
 	SourceTopASNs    Source = "top asns"
 	SourceTopTags    Source = "top tags"
+	// SourceMeasurements aggregates stored probe results into time buckets.
+	SourceMeasurements Source = "measurements"
 )
 
 type Query struct {
@@ -44,21 +46,23 @@ var commonFilters = map[string]bool{
 }
 
 var sourceFilters = map[Source]map[string]bool{
-	SourceFlows:      {"protocol": true, "cidr": true, "ip": true, "asn": true, "country": true, "upstream": true, "tag": true, "since": true, "until": true},
-	SourceRejections: {"protocol": true, "cidr": true, "ip": true, "asn": true, "country": true, "reason": true, "since": true, "until": true},
-	SourceEvents:     commonFilters,
-	SourceTopClients: {"protocol": true, "upstream": true, "tag": true, "since": true, "until": true},
-	SourceTopASNs:    {"protocol": true, "upstream": true, "tag": true, "since": true, "until": true},
-	SourceTopTags:    {"protocol": true, "upstream": true, "since": true, "until": true},
+	SourceFlows:        {"protocol": true, "cidr": true, "ip": true, "asn": true, "country": true, "upstream": true, "tag": true, "since": true, "until": true},
+	SourceRejections:   {"protocol": true, "cidr": true, "ip": true, "asn": true, "country": true, "reason": true, "since": true, "until": true},
+	SourceEvents:       commonFilters,
+	SourceTopClients:   {"protocol": true, "upstream": true, "tag": true, "since": true, "until": true},
+	SourceTopASNs:      {"protocol": true, "upstream": true, "tag": true, "since": true, "until": true},
+	SourceTopTags:      {"protocol": true, "upstream": true, "since": true, "until": true},
+	SourceMeasurements: {"protocol": true, "upstream": true, "bucket": true, "since": true, "until": true},
 }
 
 var sortFields = map[Source]map[string]bool{
-	SourceFlows:      {"recorded_at": true, "bytes_up": true, "bytes_down": true, "bytes_total": true, "duration_ms": true, "ip": true, "asn": true, "country": true, "protocol": true, "upstream": true},
-	SourceRejections: {"recorded_at": true, "ip": true, "asn": true, "country": true, "protocol": true, "port": true, "reason": true},
-	SourceEvents:     {"recorded_at": true, "ip": true, "asn": true, "country": true, "protocol": true, "port": true, "entry_type": true},
-	SourceTopClients: {"bytes_total": true, "bytes_up": true, "bytes_down": true, "flow_count": true, "client_ip": true},
-	SourceTopASNs:    {"bytes_total": true, "bytes_up": true, "bytes_down": true, "flow_count": true, "asn": true},
-	SourceTopTags:    {"bytes_total": true, "bytes_up": true, "bytes_down": true, "flow_count": true, "tag": true},
+	SourceFlows:        {"recorded_at": true, "bytes_up": true, "bytes_down": true, "bytes_total": true, "duration_ms": true, "ip": true, "asn": true, "country": true, "protocol": true, "upstream": true},
+	SourceRejections:   {"recorded_at": true, "ip": true, "asn": true, "country": true, "protocol": true, "port": true, "reason": true},
+	SourceEvents:       {"recorded_at": true, "ip": true, "asn": true, "country": true, "protocol": true, "port": true, "entry_type": true},
+	SourceTopClients:   {"bytes_total": true, "bytes_up": true, "bytes_down": true, "flow_count": true, "client_ip": true},
+	SourceTopASNs:      {"bytes_total": true, "bytes_up": true, "bytes_down": true, "flow_count": true, "asn": true},
+	SourceTopTags:      {"bytes_total": true, "bytes_up": true, "bytes_down": true, "flow_count": true, "tag": true},
+	SourceMeasurements: {"recorded_at": true},
 }
 
 type token struct {
@@ -152,6 +156,8 @@ func Parse(input string) (Query, error) {
 		q.Source = SourceRejections
 	case string(SourceEvents):
 		q.Source = SourceEvents
+	case string(SourceMeasurements):
+		q.Source = SourceMeasurements
 	case "top":
 		if len(tokens) < 2 || (tokens[1].value != "clients" && tokens[1].value != "asns" && tokens[1].value != "tags") {
 			return Query{}, syntaxError(tokens[i].pos, "top must be followed by clients, asns, or tags")
@@ -259,6 +265,11 @@ func Parse(input string) (Query, error) {
 				return Query{}, syntaxError(pos, "protocol must be tcp or udp")
 			}
 			q.Filters[key] = value
+		case "bucket":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < time.Second || d%time.Second != 0 {
+				return Query{}, syntaxError(pos, "bucket must be a duration of whole seconds")
+			}
 		case "asn":
 			n, err := strconv.Atoi(value)
 			if err != nil || n < 0 {
@@ -331,3 +342,10 @@ func (q Query) Time(key string, now time.Time) (*int64, error) {
 	}
 	return &value, nil
 }
+
+// Bucket returns the measurements bucket filter, or zero when it is unset.
+// Parse has already validated it.
+func (q Query) Bucket() time.Duration {
+	bucket, _ := time.ParseDuration(q.Filters["bucket"])
+	return bucket
+}
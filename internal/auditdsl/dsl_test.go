@@ -29,6 +29,7 @@ func TestParseSourcesAndValidation(t *testing.T) {
 		{"top clients tag=app:test", SourceTopClients},
 		{"top asns protocol=udp", SourceTopASNs},
 		{"top tags protocol=tcp", SourceTopTags},
+		{"measurements upstream=primary bucket=1m | sort recorded_at desc", SourceMeasurements},
 	}
 	for _, test := range tests {
 		query, err := Parse(test.input)
@@ -47,6 +48,9 @@ func TestParseSourcesAndValidation(t *testing.T) {
 		"flows | limit 200 | limit 200",
 		"top",
 		"flows tag=x | raw_sql=bad",
+		"measurements bucket=1500ms",
+		"measurements bucket=soon",
+		"measurements tag=x",
 	} {
 		if _, err := Parse(input); err == nil {
 			t.Errorf("Parse(%q) unexpectedly succeeded", input)
@@ -105,3 +109,14 @@ func TestParseNormalizesProtocolAndCountry(t *testing.T) {
 		t.Fatalf("filters = %#v", query.Filters)
 	}
 }
+
+func TestQueryBucket(t *testing.T) {
+	query, err := Parse("measurements bucket=15m")
+	if err != nil || query.Bucket() != 15*time.Minute {
+		t.Fatalf("Parse bucket = %v, %v", query.Bucket(), err)
+	}
+	query, err = Parse("measurements")
+	if err != nil || query.Bucket() != 0 {
+		t.Fatalf("default bucket = %v, %v", query.Bucket(), err)
+	}
+}
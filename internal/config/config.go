@@ -3,8 +3,11 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -17,20 +20,50 @@ const (
 	defaultMeasurementScheduleMinInterval = 15 * time.Minute
 	defaultMeasurementScheduleMaxInterval = 45 * time.Minute
 	defaultMeasurementScheduleUpstreamGap = 5 * time.Second
+	defaultAdaptiveFastInterval           = 15 * time.Second
+	defaultAdaptiveStableAfter            = 10
 
 	defaultMeasurementProbeTimeout = 2 * time.Second
 	defaultMeasurementTCPEnabled   = true
 	defaultMeasurementUDPEnabled   = true
+	// maxHysteresisDwell bounds how long a better challenger can be held off.
+	maxHysteresisDwell    = 10 * time.Minute
+	defaultFailbackProbes = 1
+	// minBurstProbeTimeout covers an fbmeasure burst and its echo drain.
+	minBurstProbeTimeout = 500 * time.Millisecond
+	// burstEchoDrain is how long fbmeasure awaits echoes after a burst.
+	burstEchoDrain       = 250 * time.Millisecond
+	defaultBurstFrames   = 20
+	maxBurstFrames       = 100
+	defaultBurstInterval = 10 * time.Millisecond
+	// minBurstInterval keeps a burst within the 500 frames per second an
+	// fbmeasure server admits from one source.
+	minBurstInterval = 2 * time.Millisecond
+	maxBurstInterval = 100 * time.Millisecond
+
+	defaultThroughputInterval = 6 * time.Hour
+	minThroughputInterval     = 10 * time.Minute
+	defaultThroughputBytes    = 4 << 20
+	minThroughputBytes        = 64 << 10
+	maxThroughputBytes        = 16 << 20
 
 	defaultHealthAlpha    = 0.25
 	defaultHealthFailure  = 3
 	defaultHealthRecovery = 2
 	defaultHealthStale    = 60 * time.Second
 
+	defaultPassiveWindow   = time.Minute
+	defaultPassiveFailures = 5
+	defaultPassiveRatio    = 0.5
+	maxPassiveWindow       = time.Hour
+
 	defaultForwardingMaxTCPConnections = 50
 	defaultForwardingMaxUDPMappings    = 500
 	defaultForwardingTCPIdle           = 60 * time.Second
 	defaultForwardingUDPIdle           = 30 * time.Second
+	defaultFailoverMaxAttempts         = 3
+	defaultFailoverBudget              = 10 * time.Second
+	maxFailoverAttempts                = 16
 
 	defaultControlAddr           = "127.0.0.1"
 	defaultControlPort           = 8080
@@ -45,7 +78,15 @@ const (
 	defaultIPLogBatchSize        = 100
 	defaultIPLogFlushInterval    = 5 * time.Second
 	defaultIPLogPruneInterval    = 1 * time.Hour
-	defaultFlowContextMaxTTL     = 24 * time.Hour
+	// defaultMeasurementRetention keeps a month of probe history.
+	defaultMeasurementRetention = 30 * 24 * time.Hour
+	defaultFlowContextMaxTTL    = 24 * time.Hour
+	defaultAffinityTTL          = 10 * time.Minute
+	defaultAffinityIPv4Prefix   = 32
+	defaultAffinityIPv6Prefix   = 64
+	maxHedgeDelay               = 5 * time.Second
+	defaultSRVMinRefresh        = 5 * time.Second
+	defaultSRVMaxRefresh        = 5 * time.Minute
 
 	defaultMeasurePort = 9876
 	maxListeners       = 45
@@ -86,6 +127,12 @@ func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
 	}
 }
 
+// MarshalYAML writes a duration string so written configuration files load
+// back with the same value.
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
 func (d Duration) Duration() time.Duration {
 	return time.Duration(d)
 }
@@ -121,6 +168,15 @@ type ForwardingConfig struct {
 	Listeners   []ListenerConfig       `yaml:"listeners"`
 	Limits      ForwardingLimitsConfig `yaml:"limits"`
 	IdleTimeout IdleTimeoutConfig      `yaml:"idle_timeout"`
+	Failover    DialFailoverConfig     `yaml:"failover"`
+}
+
+// DialFailoverConfig bounds dial-time failover. MaxAttempts counts distinct
+// upstreams tried for one new Flow, so 1 disables failover; Budget caps the
+// total connect time across them.
+type DialFailoverConfig struct {
+	MaxAttempts int      `yaml:"max_attempts"`
+	Budget      Duration `yaml:"budget"`
 }
 
 type ForwardingLimitsConfig struct {
@@ -134,60 +190,275 @@ type IdleTimeoutConfig struct {
 }
 
 type ListenerConfig struct {
-	Name     string `yaml:"name,omitempty"`
-	BindAddr string `yaml:"bind_addr"`
-	BindPort int    `yaml:"bind_port"`
-	Protocol string `yaml:"protocol"`
-	Route    string `yaml:"route,omitempty"`
+	Name          string              `yaml:"name,omitempty"`
+	BindAddr      string              `yaml:"bind_addr"`
+	BindPort      int                 `yaml:"bind_port"`
+	Protocol      string              `yaml:"protocol"`
+	Route         string              `yaml:"route,omitempty"`
+	ProxyProtocol ListenerProxyConfig `yaml:"proxy_protocol,omitempty"`
+}
+
+// ListenerProxyConfig enables inbound PROXY protocol parsing. A header is
+// required from peers inside TrustedCIDRs and never parsed from other peers,
+// which are served as direct clients.
+type ListenerProxyConfig struct {
+	TrustedCIDRs []string `yaml:"trusted_cidrs,omitempty"`
+}
+
+// Enabled reports whether the listener expects PROXY headers from any peer.
+func (c ListenerProxyConfig) Enabled() bool {
+	return len(c.TrustedCIDRs) > 0
+}
+
+// Prefixes returns the trusted networks. Entries are validated at load time,
+// so malformed values can only come from hand-built configs and are skipped.
+func (c ListenerProxyConfig) Prefixes() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(c.TrustedCIDRs))
+	for _, raw := range c.TrustedCIDRs {
+		if prefix, err := netip.ParsePrefix(strings.TrimSpace(raw)); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+		}
+	}
+	return prefixes
 }
 
 // ListenerSpec is the explicit listener form used by the current topology
 // configuration. It is converted to ListenerConfig after parsing so the
 // forwarding data plane continues to use a normalized address and port.
 type ListenerSpec struct {
-	Name     string `yaml:"name"`
-	Bind     string `yaml:"bind"`
-	Protocol string `yaml:"protocol"`
-	Route    string `yaml:"route"`
+	Name          string              `yaml:"name"`
+	Bind          string              `yaml:"bind"`
+	Protocol      string              `yaml:"protocol"`
+	Route         string              `yaml:"route"`
+	ProxyProtocol ListenerProxyConfig `yaml:"proxy_protocol,omitempty"`
 }
 
 type RouteConfig struct {
-	Name            string   `yaml:"name"`
-	Strategy        string   `yaml:"strategy"`
-	Upstreams       []string `yaml:"upstreams"`
-	DefaultUpstream string   `yaml:"default_upstream,omitempty"`
+	Name            string                `yaml:"name"`
+	Strategy        string                `yaml:"strategy"`
+	Upstreams       []string              `yaml:"upstreams"`
+	DefaultUpstream string                `yaml:"default_upstream,omitempty"`
+	Weights         map[string]int        `yaml:"weights,omitempty"`
+	Affinity        RouteAffinityConfig   `yaml:"affinity,omitempty"`
+	Hedge           RouteHedgeConfig      `yaml:"hedge,omitempty"`
+	Prefer          string                `yaml:"prefer,omitempty"`
+	Score           RouteScoreConfig      `yaml:"score,omitempty"`
+	Hysteresis      RouteHysteresisConfig `yaml:"hysteresis,omitempty"`
+	Health          RouteHealthConfig     `yaml:"health,omitempty"`
+	Failback        RouteFailbackConfig   `yaml:"failback,omitempty"`
+	SelectionRules  []RouteSelectionRule  `yaml:"selection_rules,omitempty"`
+	PortOffset      int                   `yaml:"port_offset,omitempty"`
+	Ports           map[int]int           `yaml:"ports,omitempty"`
+	ProxyProtocol   string                `yaml:"proxy_protocol,omitempty"`
+}
+
+// Adaptive route preferences of RouteConfig.Prefer. The delay preferences
+// rank by the measured one-way delay in that direction and fall back to RTT
+// while either candidate lacks one.
+const (
+	PreferRTT           = "rtt"
+	PreferUploadDelay   = "upload_delay"
+	PreferDownloadDelay = "download_delay"
+)
+
+// RouteScoreConfig weights the composite score of an adaptive route. Each
+// component is normalized to [0,1] across the candidates, higher is better,
+// and the score is their weighted mean. A route with a positive weight ranks
+// candidates of the same health state by score instead of the fixed order.
+type RouteScoreConfig struct {
+	RTT      float64 `yaml:"rtt,omitempty"`
+	Loss     float64 `yaml:"loss,omitempty"`
+	Priority float64 `yaml:"priority,omitempty"`
+	Load     float64 `yaml:"load,omitempty"`
+}
+
+// Enabled reports whether any weight is set.
+func (c RouteScoreConfig) Enabled() bool {
+	return c != RouteScoreConfig{}
+}
+
+// RouteHysteresisConfig keeps an adaptive route on its preferred upstream
+// until a challenger of the same health state is better by Margin, relative
+// to the preferred one, for at least Dwell.
+type RouteHysteresisConfig struct {
+	Margin float64  `yaml:"margin,omitempty"`
+	Dwell  Duration `yaml:"dwell,omitempty"`
+}
+
+// Enabled reports whether a margin or dwell is set.
+func (c RouteHysteresisConfig) Enabled() bool {
+	return c != RouteHysteresisConfig{}
+}
+
+// RouteFailbackConfig controls when a failover route returns to an earlier
+// upstream in its configured order: that upstream must be healthy with Probes
+// consecutive successful probes, and stay so for Delay.
+type RouteFailbackConfig struct {
+	Delay  Duration `yaml:"delay,omitempty"`
+	Probes int      `yaml:"probes,omitempty"`
+}
+
+// RouteHealthConfig overrides how the route evaluates the health of its
+// members. Zero fields inherit the global health settings. Protocols limits
+// the probe protocols whose results count for the route, and those protocols
+// are probed for its members even when measurement disables them.
+type RouteHealthConfig struct {
+	FailureThreshold  int      `yaml:"failure_threshold,omitempty"`
+	RecoveryThreshold int      `yaml:"recovery_threshold,omitempty"`
+	StaleThreshold    Duration `yaml:"stale_threshold,omitempty"`
+	RTTEWMAAlpha      float64  `yaml:"rtt_ewma_alpha,omitempty"`
+	Protocols         []string `yaml:"protocols,omitempty"`
+}
+
+// Enabled reports whether any override is set.
+func (c RouteHealthConfig) Enabled() bool {
+	return c.FailureThreshold != 0 || c.RecoveryThreshold != 0 || c.StaleThreshold != 0 || c.RTTEWMAAlpha != 0 || len(c.Protocols) > 0
+}
+
+// Apply returns global with the overrides of c.
+func (c RouteHealthConfig) Apply(global HealthConfig) HealthConfig {
+	if c.FailureThreshold > 0 {
+		global.FailureThreshold = c.FailureThreshold
+	}
+	if c.RecoveryThreshold > 0 {
+		global.RecoveryThreshold = c.RecoveryThreshold
+	}
+	if c.StaleThreshold > 0 {
+		global.StaleThreshold = c.StaleThreshold
+	}
+	if c.RTTEWMAAlpha > 0 {
+		global.RTTEWMAAlpha = c.RTTEWMAAlpha
+	}
+	return global
+}
+
+// RouteAffinityConfig keeps a client on one upstream across Flows. Clients
+// are keyed by address prefix, so TCP and UDP Flows and reconnects from the
+// same host share one entry. An empty Mode disables affinity.
+type RouteAffinityConfig struct {
+	Mode       string   `yaml:"mode,omitempty"`
+	TTL        Duration `yaml:"ttl,omitempty"`
+	IPv4Prefix int      `yaml:"ipv4_prefix,omitempty"`
+	IPv6Prefix int      `yaml:"ipv6_prefix,omitempty"`
+}
+
+// RouteHedgeConfig races TCP connects to the two best adaptive candidates.
+// The second dial starts after Delay, or at once when Delay is zero; the
+// first upstream to connect carries the Flow and the other is closed.
+type RouteHedgeConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Delay   Duration `yaml:"delay,omitempty"`
+}
+
+// RouteSelectionRule narrows a route to a preferred subset of its upstreams
+// for matching clients. A client matches when any listed country, ASN, or
+// CIDR matches; the first matching rule of a route wins.
+type RouteSelectionRule struct {
+	Name      string   `yaml:"name"`
+	Countries []string `yaml:"countries,omitempty"`
+	ASNs      []int    `yaml:"asns,omitempty"`
+	CIDRs     []string `yaml:"cidrs,omitempty"`
+	Upstreams []string `yaml:"upstreams"`
+}
+
+// Enabled reports whether the route pins clients.
+func (c RouteAffinityConfig) Enabled() bool {
+	return c.Mode != ""
 }
 
 type UpstreamConfig struct {
-	Tag         string                    `yaml:"tag"`
-	Destination DestinationConfig         `yaml:"destination"`
-	Measurement UpstreamMeasurementConfig `yaml:"measurement"`
-	Priority    float64                   `yaml:"priority"`
+	Tag           string                    `yaml:"tag"`
+	Destination   DestinationConfig         `yaml:"destination"`
+	Measurement   UpstreamMeasurementConfig `yaml:"measurement"`
+	Priority      float64                   `yaml:"priority"`
+	ProxyProtocol string                    `yaml:"proxy_protocol,omitempty"`
+	Maintenance   []MaintenanceWindowConfig `yaml:"maintenance,omitempty"`
 }
 
+// DestinationConfig describes where Flows are forwarded. A zero Port keeps the
+// listener port, optionally translated by the route's ports or port_offset.
+// SRV replaces Host and Port: each record of the SRV name becomes one member
+// upstream with the record's target, port, priority and weight.
 type DestinationConfig struct {
-	Host string `yaml:"host"`
+	Host string `yaml:"host,omitempty"`
+	Port int    `yaml:"port,omitempty"`
+	SRV  string `yaml:"srv,omitempty"`
 }
 
+// UpstreamMeasurementConfig selects how an upstream is probed. Type fbmeasure
+// talks to an fbmeasure server at Host:Port. tcp_connect times a TCP handshake
+// and http sends a GET; both target Host (the destination host by default) at
+// Port, falling back to the destination port. Native probes run in the tcp
+// measurement slot. KeyFile holds the shared key of an fbmeasure server
+// started with --key-file.
 type UpstreamMeasurementConfig struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Host    string          `yaml:"host"`
+	Port    int             `yaml:"port"`
+	Type    string          `yaml:"type,omitempty"`
+	HTTP    HTTPProbeConfig `yaml:"http,omitempty"`
+	KeyFile string          `yaml:"key_file,omitempty"`
+}
+
+// HTTPProbeConfig is the request and expected response of an http probe. An
+// empty ExpectBody accepts any body.
+type HTTPProbeConfig struct {
+	Path         string `yaml:"path,omitempty"`
+	TLS          bool   `yaml:"tls,omitempty"`
+	ExpectStatus int    `yaml:"expect_status,omitempty"`
+	ExpectBody   string `yaml:"expect_body,omitempty"`
 }
 
+// Probe types of UpstreamMeasurementConfig.Type.
+const (
+	ProbeFBMeasure  = "fbmeasure"
+	ProbeTCPConnect = "tcp_connect"
+	ProbeHTTP       = "http"
+)
+
 type DNSConfig struct {
-	Servers  []string `yaml:"servers"`
-	Strategy string   `yaml:"strategy"`
+	Servers  []string     `yaml:"servers"`
+	Strategy string       `yaml:"strategy"`
+	SRV      DNSSRVConfig `yaml:"srv"`
+}
+
+// DNSSRVConfig clamps how often SRV upstreams are re-resolved. The next
+// refresh follows the smallest record TTL within these bounds.
+type DNSSRVConfig struct {
+	MinRefresh Duration `yaml:"min_refresh"`
+	MaxRefresh Duration `yaml:"max_refresh"`
 }
 
 type MeasurementConfig struct {
-	Schedule     MeasurementScheduleConfig  `yaml:"schedule"`
-	ProbeTimeout Duration                   `yaml:"probe_timeout"`
-	Protocols    MeasurementProtocolsConfig `yaml:"protocols"`
+	Schedule     MeasurementScheduleConfig   `yaml:"schedule"`
+	ProbeTimeout Duration                    `yaml:"probe_timeout"`
+	Protocols    MeasurementProtocolsConfig  `yaml:"protocols"`
+	Throughput   MeasurementThroughputConfig `yaml:"throughput,omitempty"`
+}
+
+// MeasurementThroughputConfig schedules an fbmeasure bulk transfer of Bytes
+// in each direction every Interval.
+type MeasurementThroughputConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Interval Duration `yaml:"interval,omitempty"`
+	Bytes    int64    `yaml:"bytes,omitempty"`
 }
 
 type MeasurementScheduleConfig struct {
 	Interval    MeasurementIntervalConfig `yaml:"interval"`
 	UpstreamGap Duration                  `yaml:"upstream_gap"`
+	Adaptive    AdaptiveScheduleConfig    `yaml:"adaptive,omitempty"`
+}
+
+// AdaptiveScheduleConfig adapts each upstream's probe interval to its health.
+// Upstreams that are down, unknown, stale, or in a failure or recovery streak
+// are probed every FastInterval. Healthy upstreams back off from the regular
+// interval, doubling it after every StableAfter consecutive successes up to
+// MaxInterval.
+type AdaptiveScheduleConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	FastInterval Duration `yaml:"fast_interval,omitempty"`
+	StableAfter  int      `yaml:"stable_after,omitempty"`
+	MaxInterval  Duration `yaml:"max_interval,omitempty"`
 }
 
 type MeasurementIntervalConfig struct {
@@ -200,17 +471,60 @@ type MeasurementProtocolsConfig struct {
 	UDP MeasurementProtocolConfig `yaml:"udp"`
 }
 
+// MeasurementProtocolConfig enables one probe protocol. Burst replaces the
+// single UDP probe with an fbmeasure burst that also measures loss and jitter;
+// it needs an fbmeasure server that supports bursts and is UDP-only.
+// BurstFrames and BurstInterval size and pace the burst. OneWay asks the
+// fbmeasure server for timestamps to split the RTT into upload and download
+// delay; it needs a server that supports timestamps.
 type MeasurementProtocolConfig struct {
-	Enabled *bool `yaml:"enabled"`
+	Enabled       *bool    `yaml:"enabled"`
+	Burst         bool     `yaml:"burst,omitempty"`
+	BurstFrames   int      `yaml:"burst_frames,omitempty"`
+	BurstInterval Duration `yaml:"burst_interval,omitempty"`
+	OneWay        bool     `yaml:"one_way,omitempty"`
 }
 
+// HealthConfig tunes probe health. LossThreshold, when positive, ranks
+// upstreams whose measured UDP burst loss exceeds it after those below it;
+// MinThroughputMbps does the same for upstreams whose measured upload or
+// download throughput is below it. ThroughputMaxAge, derived from the
+// throughput interval, is how long a throughput result is held against an
+// upstream; zero when throughput is not measured.
 type HealthConfig struct {
-	RTTEWMAAlpha      float64  `yaml:"rtt_ewma_alpha"`
-	FailureThreshold  int      `yaml:"failure_threshold"`
-	RecoveryThreshold int      `yaml:"recovery_threshold"`
-	StaleThreshold    Duration `yaml:"stale_threshold"`
+	RTTEWMAAlpha      float64             `yaml:"rtt_ewma_alpha"`
+	FailureThreshold  int                 `yaml:"failure_threshold"`
+	RecoveryThreshold int                 `yaml:"recovery_threshold"`
+	StaleThreshold    Duration            `yaml:"stale_threshold"`
+	LossThreshold     float64             `yaml:"loss_threshold,omitempty"`
+	MinThroughputMbps float64             `yaml:"min_throughput_mbps,omitempty"`
+	Passive           PassiveHealthConfig `yaml:"passive"`
+	ThroughputMaxAge  Duration            `yaml:"-"`
+}
+
+// PassiveHealthConfig marks upstreams down from data-plane outcomes. Every
+// ended Flow and every failed dial is one outcome. An upstream is down while
+// at least FailureThreshold outcomes within Window failed with one of Signals
+// and they make up at least FailureRatio of its outcomes in the Window.
+type PassiveHealthConfig struct {
+	Enabled          bool     `yaml:"enabled"`
+	Window           Duration `yaml:"window"`
+	FailureThreshold int      `yaml:"failure_threshold"`
+	FailureRatio     float64  `yaml:"failure_ratio"`
+	Signals          []string `yaml:"signals"`
 }
 
+// Passive health signals.
+const (
+	PassiveDialError     = "dial_error"
+	PassiveUpstreamClose = "upstream_close"
+	PassiveZeroResponse  = "zero_response"
+	PassiveReadError     = "read_error"
+)
+
+// PassiveSignals lists every passive health signal.
+var PassiveSignals = [...]string{PassiveDialError, PassiveUpstreamClose, PassiveZeroResponse, PassiveReadError}
+
 type ControlConfig struct {
 	BindAddr  string               `yaml:"bind_addr"`
 	BindPort  int                  `yaml:"bind_port"`
@@ -242,15 +556,18 @@ type GeoIPConfig struct {
 }
 
 type IPLogConfig struct {
-	Enabled        bool     `yaml:"enabled"`
-	LogRejections  *bool    `yaml:"log_rejections"`
-	DBPath         string   `yaml:"db_path"`
-	Retention      Duration `yaml:"retention"`
-	GeoQueueSize   int      `yaml:"geo_queue_size"`
-	WriteQueueSize int      `yaml:"write_queue_size"`
-	BatchSize      int      `yaml:"batch_size"`
-	FlushInterval  Duration `yaml:"flush_interval"`
-	PruneInterval  Duration `yaml:"prune_interval"`
+	Enabled       bool     `yaml:"enabled"`
+	LogRejections *bool    `yaml:"log_rejections"`
+	DBPath        string   `yaml:"db_path"`
+	Retention     Duration `yaml:"retention"`
+	// MeasurementRetention bounds the stored probe results and health
+	// transitions, independently of Retention.
+	MeasurementRetention Duration `yaml:"measurement_retention"`
+	GeoQueueSize         int      `yaml:"geo_queue_size"`
+	WriteQueueSize       int      `yaml:"write_queue_size"`
+	BatchSize            int      `yaml:"batch_size"`
+	FlushInterval        Duration `yaml:"flush_interval"`
+	PruneInterval        Duration `yaml:"prune_interval"`
 }
 
 type FlowContextConfig struct {
@@ -429,6 +746,12 @@ func (c *Config) setDefaults() {
 	if c.Forwarding.IdleTimeout.UDP == 0 {
 		c.Forwarding.IdleTimeout.UDP = Duration(defaultForwardingUDPIdle)
 	}
+	if c.Forwarding.Failover.MaxAttempts == 0 {
+		c.Forwarding.Failover.MaxAttempts = defaultFailoverMaxAttempts
+	}
+	if c.Forwarding.Failover.Budget == 0 {
+		c.Forwarding.Failover.Budget = Duration(defaultFailoverBudget)
+	}
 
 	if c.Measurement.Schedule.Interval.Min == 0 {
 		c.Measurement.Schedule.Interval.Min = Duration(defaultMeasurementScheduleMinInterval)
@@ -439,6 +762,17 @@ func (c *Config) setDefaults() {
 	if c.Measurement.Schedule.UpstreamGap == 0 {
 		c.Measurement.Schedule.UpstreamGap = Duration(defaultMeasurementScheduleUpstreamGap)
 	}
+	if adaptive := &c.Measurement.Schedule.Adaptive; adaptive.Enabled {
+		if adaptive.FastInterval == 0 {
+			adaptive.FastInterval = Duration(min(defaultAdaptiveFastInterval, c.Measurement.Schedule.Interval.Min.Duration()))
+		}
+		if adaptive.StableAfter == 0 {
+			adaptive.StableAfter = defaultAdaptiveStableAfter
+		}
+		if adaptive.MaxInterval == 0 {
+			adaptive.MaxInterval = 2 * c.Measurement.Schedule.Interval.Max
+		}
+	}
 
 	if c.Measurement.ProbeTimeout == 0 {
 		c.Measurement.ProbeTimeout = Duration(defaultMeasurementProbeTimeout)
@@ -446,6 +780,17 @@ func (c *Config) setDefaults() {
 
 	setProtocolDefaults(&c.Measurement.Protocols.TCP, true)
 	setProtocolDefaults(&c.Measurement.Protocols.UDP, false)
+	c.Health.ThroughputMaxAge = 0
+	if throughput := &c.Measurement.Throughput; throughput.Enabled {
+		if throughput.Interval == 0 {
+			throughput.Interval = Duration(defaultThroughputInterval)
+		}
+		if throughput.Bytes == 0 {
+			throughput.Bytes = defaultThroughputBytes
+		}
+		// A result survives one failed measurement before it expires.
+		c.Health.ThroughputMaxAge = 2 * throughput.Interval
+	}
 
 	if c.Health.RTTEWMAAlpha == 0 {
 		c.Health.RTTEWMAAlpha = defaultHealthAlpha
@@ -459,6 +804,20 @@ func (c *Config) setDefaults() {
 	if c.Health.StaleThreshold == 0 {
 		c.Health.StaleThreshold = Duration(defaultHealthStale)
 	}
+	if passive := &c.Health.Passive; passive.Enabled {
+		if passive.Window == 0 {
+			passive.Window = Duration(defaultPassiveWindow)
+		}
+		if passive.FailureThreshold == 0 {
+			passive.FailureThreshold = defaultPassiveFailures
+		}
+		if passive.FailureRatio == 0 {
+			passive.FailureRatio = defaultPassiveRatio
+		}
+		if len(passive.Signals) == 0 {
+			passive.Signals = append([]string(nil), PassiveSignals[:]...)
+		}
+	}
 
 	if c.Control.BindAddr == "" {
 		c.Control.BindAddr = defaultControlAddr
@@ -500,6 +859,9 @@ func (c *Config) setDefaults() {
 	if c.IPLog.PruneInterval == 0 {
 		c.IPLog.PruneInterval = Duration(defaultIPLogPruneInterval)
 	}
+	if c.IPLog.MeasurementRetention == 0 {
+		c.IPLog.MeasurementRetention = Duration(defaultMeasurementRetention)
+	}
 	if c.FlowContext.MaxTTL == 0 {
 		c.FlowContext.MaxTTL = Duration(defaultFlowContextMaxTTL)
 	}
@@ -511,14 +873,35 @@ func (c *Config) setDefaults() {
 		c.Firewall.Default = "allow"
 	}
 
+	if c.DNS.SRV.MinRefresh == 0 {
+		c.DNS.SRV.MinRefresh = Duration(defaultSRVMinRefresh)
+	}
+	if c.DNS.SRV.MaxRefresh == 0 {
+		c.DNS.SRV.MaxRefresh = Duration(defaultSRVMaxRefresh)
+	}
+
 	for i := range c.Upstreams {
 		up := &c.Upstreams[i]
-		if up.Measurement.Host == "" {
+		// SRV members default to probing their own record target.
+		if up.Measurement.Host == "" && up.Destination.SRV == "" {
 			up.Measurement.Host = up.Destination.Host
 		}
-		if up.Measurement.Port == 0 {
+		up.Measurement.Type = strings.ToLower(strings.TrimSpace(up.Measurement.Type))
+		if up.Measurement.Type == "" {
+			up.Measurement.Type = ProbeFBMeasure
+		}
+		// Native probes fall back to the destination port instead.
+		if up.Measurement.Port == 0 && up.Measurement.Type == ProbeFBMeasure {
 			up.Measurement.Port = defaultMeasurePort
 		}
+		if up.Measurement.Type == ProbeHTTP {
+			if up.Measurement.HTTP.Path == "" {
+				up.Measurement.HTTP.Path = "/"
+			}
+			if up.Measurement.HTTP.ExpectStatus == 0 {
+				up.Measurement.HTTP.ExpectStatus = http.StatusOK
+			}
+		}
 	}
 
 }
@@ -531,6 +914,324 @@ func setProtocolDefaults(cfg *MeasurementProtocolConfig, isTCP bool) {
 		}
 		cfg.Enabled = &val
 	}
+	if cfg.Burst {
+		if cfg.BurstFrames == 0 {
+			cfg.BurstFrames = defaultBurstFrames
+		}
+		if cfg.BurstInterval == 0 {
+			cfg.BurstInterval = Duration(defaultBurstInterval)
+		}
+	}
+}
+
+func (p *PassiveHealthConfig) validate() error {
+	if !p.Enabled {
+		return nil
+	}
+	if p.Window.Duration() < time.Second || p.Window.Duration() > maxPassiveWindow {
+		return fmt.Errorf("health.passive.window must be between 1s and %s", maxPassiveWindow)
+	}
+	if p.FailureThreshold <= 0 {
+		return errors.New("health.passive.failure_threshold must be > 0")
+	}
+	if p.FailureRatio <= 0 || p.FailureRatio > 1 {
+		return errors.New("health.passive.failure_ratio must be in (0,1]")
+	}
+	for i, signal := range p.Signals {
+		p.Signals[i] = strings.ToLower(strings.TrimSpace(signal))
+		if !slices.Contains(PassiveSignals[:], p.Signals[i]) {
+			return fmt.Errorf("health.passive.signals: unknown signal %q", signal)
+		}
+	}
+	return nil
+}
+
+// validateUpstreamMeasurement checks the probe of up. A tcp_connect probe
+// needs a port: its own, the destination's, or the SRV record's. An http probe
+// without one uses the scheme's port.
+func validateUpstreamMeasurement(up *UpstreamConfig) error {
+	m := &up.Measurement
+	m.Type = strings.ToLower(strings.TrimSpace(m.Type))
+	if m.Type == "" {
+		m.Type = ProbeFBMeasure
+	}
+	switch m.Type {
+	case ProbeFBMeasure, ProbeTCPConnect, ProbeHTTP:
+	default:
+		return fmt.Errorf("upstreams[%s].measurement.type must be fbmeasure, tcp_connect or http", up.Tag)
+	}
+	if m.Type == ProbeFBMeasure && m.Port == 0 || m.Port < 0 || m.Port > 65535 {
+		return fmt.Errorf("upstreams[%s].measurement.port must be in 1..65535", up.Tag)
+	}
+	if m.Type == ProbeTCPConnect && m.Port == 0 && up.Destination.Port == 0 && up.Destination.SRV == "" {
+		return fmt.Errorf("upstreams[%s].measurement.type %s needs measurement.port or destination.port", up.Tag, m.Type)
+	}
+	m.KeyFile = strings.TrimSpace(m.KeyFile)
+	if m.KeyFile != "" && m.Type != ProbeFBMeasure {
+		return fmt.Errorf("upstreams[%s].measurement.key_file requires type fbmeasure", up.Tag)
+	}
+	if m.Type != ProbeHTTP {
+		if m.HTTP != (HTTPProbeConfig{}) {
+			return fmt.Errorf("upstreams[%s].measurement.http requires type http", up.Tag)
+		}
+		return nil
+	}
+	if !strings.HasPrefix(m.HTTP.Path, "/") {
+		return fmt.Errorf("upstreams[%s].measurement.http.path must start with /", up.Tag)
+	}
+	if m.HTTP.ExpectStatus < 100 || m.HTTP.ExpectStatus > 599 {
+		return fmt.Errorf("upstreams[%s].measurement.http.expect_status must be in 100..599", up.Tag)
+	}
+	return nil
+}
+
+// validateRouteHedge accepts hedging only where a second candidate is ranked
+// by the same adaptive order and no affinity pin would be broken by a hedge
+// that wins. A delay of 5s or more never races because the first dial gives
+// up by then.
+func validateRouteHedge(route *RouteConfig) error {
+	hedge := route.Hedge
+	if !hedge.Enabled {
+		if hedge.Delay != 0 {
+			return fmt.Errorf("routes[%s].hedge.delay requires hedge.enabled", route.Name)
+		}
+		return nil
+	}
+	if route.Strategy != "adaptive" {
+		return fmt.Errorf("routes[%s].hedge is only valid for adaptive strategy", route.Name)
+	}
+	if route.Affinity.Enabled() {
+		return fmt.Errorf("routes[%s].hedge cannot be combined with affinity", route.Name)
+	}
+	if hedge.Delay < 0 || hedge.Delay.Duration() >= maxHedgeDelay {
+		return fmt.Errorf("routes[%s].hedge.delay must be >= 0 and < %s", route.Name, maxHedgeDelay)
+	}
+	return nil
+}
+
+// normalizeRoutePrefer checks the adaptive preference of route. A delay
+// preference without one-way measurement ranks by RTT, which is reported as
+// a warning.
+func (c *Config) normalizeRoutePrefer(route *RouteConfig) error {
+	route.Prefer = strings.ToLower(strings.TrimSpace(route.Prefer))
+	switch route.Prefer {
+	case "", PreferRTT:
+		return nil
+	case PreferUploadDelay, PreferDownloadDelay:
+	default:
+		return fmt.Errorf("routes[%s].prefer must be rtt, upload_delay or download_delay", route.Name)
+	}
+	if route.Strategy != "adaptive" {
+		return fmt.Errorf("routes[%s].prefer is only valid for adaptive strategy", route.Name)
+	}
+	if !c.Measurement.Protocols.TCP.OneWay && !c.Measurement.Protocols.UDP.OneWay {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("routes[%s].prefer %s ranks by RTT until measurement.protocols.tcp or udp enables one_way", route.Name, route.Prefer))
+	}
+	return nil
+}
+
+// validateRouteScore checks the composite score and hysteresis of route.
+// Both rank adaptive candidates; consistent-hash affinity places clients
+// without ranking, so it cannot be combined with them.
+func validateRouteScore(route *RouteConfig) error {
+	score, hysteresis := route.Score, route.Hysteresis
+	if !score.Enabled() && !hysteresis.Enabled() {
+		return nil
+	}
+	if route.Strategy != "adaptive" {
+		return fmt.Errorf("routes[%s].score and hysteresis are only valid for adaptive strategy", route.Name)
+	}
+	if route.Affinity.Mode == "consistent_hash" {
+		return fmt.Errorf("routes[%s].score and hysteresis cannot be combined with consistent_hash affinity", route.Name)
+	}
+	if score.Enabled() {
+		if score.RTT < 0 || score.Loss < 0 || score.Priority < 0 || score.Load < 0 {
+			return fmt.Errorf("routes[%s].score weights must be >= 0", route.Name)
+		}
+		if route.Prefer != "" && route.Prefer != PreferRTT {
+			return fmt.Errorf("routes[%s].score cannot be combined with prefer %s", route.Name, route.Prefer)
+		}
+	}
+	if hysteresis.Margin < 0 || hysteresis.Margin > 1 {
+		return fmt.Errorf("routes[%s].hysteresis.margin must be in 0..1", route.Name)
+	}
+	if hysteresis.Dwell < 0 || hysteresis.Dwell.Duration() > maxHysteresisDwell {
+		return fmt.Errorf("routes[%s].hysteresis.dwell must be in 0..%s", route.Name, maxHysteresisDwell)
+	}
+	return nil
+}
+
+// validateRouteHealth normalizes the health overrides of route. Static routes
+// never consult health, and upstreams with a tcp_connect or http probe can
+// only be probed over TCP.
+func (c *Config) validateRouteHealth(route *RouteConfig) error {
+	health := &route.Health
+	if !health.Enabled() {
+		return nil
+	}
+	if route.Strategy == "static" {
+		return fmt.Errorf("routes[%s].health is not valid for static strategy", route.Name)
+	}
+	if health.FailureThreshold < 0 || health.RecoveryThreshold < 0 {
+		return fmt.Errorf("routes[%s].health thresholds must be >= 0", route.Name)
+	}
+	if health.StaleThreshold < 0 {
+		return fmt.Errorf("routes[%s].health.stale_threshold must be >= 0", route.Name)
+	}
+	if health.RTTEWMAAlpha < 0 || health.RTTEWMAAlpha > 1 {
+		return fmt.Errorf("routes[%s].health.rtt_ewma_alpha must be in 0..1", route.Name)
+	}
+	protocols := make([]string, 0, len(health.Protocols))
+	for _, protocol := range health.Protocols {
+		protocol = strings.ToLower(strings.TrimSpace(protocol))
+		if protocol != "tcp" && protocol != "udp" {
+			return fmt.Errorf("routes[%s].health.protocols must be tcp or udp", route.Name)
+		}
+		if !slices.Contains(protocols, protocol) {
+			protocols = append(protocols, protocol)
+		}
+	}
+	health.Protocols = protocols
+	if len(protocols) == 0 || slices.Contains(protocols, "tcp") {
+		return nil
+	}
+	for _, up := range c.Upstreams {
+		if slices.Contains(route.Upstreams, up.Tag) && (up.Measurement.Type == ProbeTCPConnect || up.Measurement.Type == ProbeHTTP) {
+			return fmt.Errorf("routes[%s].health.protocols must include tcp for upstream %s with a %s probe", route.Name, up.Tag, up.Measurement.Type)
+		}
+	}
+	return nil
+}
+
+// normalizeRouteFailback checks the failback settings of route. A failover
+// route fails back after one successful probe unless configured otherwise.
+func normalizeRouteFailback(route *RouteConfig) error {
+	failback := &route.Failback
+	if route.Strategy != "failover" {
+		if *failback != (RouteFailbackConfig{}) {
+			return fmt.Errorf("routes[%s].failback is only valid for failover strategy", route.Name)
+		}
+		return nil
+	}
+	if failback.Delay < 0 {
+		return fmt.Errorf("routes[%s].failback.delay must be >= 0", route.Name)
+	}
+	if failback.Probes < 0 {
+		return fmt.Errorf("routes[%s].failback.probes must be >= 0", route.Name)
+	}
+	if failback.Probes == 0 {
+		failback.Probes = defaultFailbackProbes
+	}
+	return nil
+}
+
+func normalizeRouteAffinity(route *RouteConfig) error {
+	affinity := &route.Affinity
+	affinity.Mode = strings.ToLower(strings.TrimSpace(affinity.Mode))
+	switch affinity.Mode {
+	case "":
+		if *affinity != (RouteAffinityConfig{}) {
+			return fmt.Errorf("routes[%s].affinity.mode is required when affinity is configured", route.Name)
+		}
+		return nil
+	case "sticky", "consistent_hash":
+	default:
+		return fmt.Errorf("routes[%s].affinity.mode must be sticky or consistent_hash", route.Name)
+	}
+	if route.Strategy != "adaptive" && route.Strategy != "weighted" {
+		return fmt.Errorf("routes[%s].affinity is only valid for adaptive and weighted strategies", route.Name)
+	}
+	if affinity.TTL == 0 {
+		affinity.TTL = Duration(defaultAffinityTTL)
+	}
+	if affinity.IPv4Prefix == 0 {
+		affinity.IPv4Prefix = defaultAffinityIPv4Prefix
+	}
+	if affinity.IPv6Prefix == 0 {
+		affinity.IPv6Prefix = defaultAffinityIPv6Prefix
+	}
+	if affinity.TTL < 0 {
+		return fmt.Errorf("routes[%s].affinity.ttl must be > 0", route.Name)
+	}
+	if affinity.IPv4Prefix < 1 || affinity.IPv4Prefix > 32 {
+		return fmt.Errorf("routes[%s].affinity.ipv4_prefix must be in 1..32", route.Name)
+	}
+	if affinity.IPv6Prefix < 1 || affinity.IPv6Prefix > 128 {
+		return fmt.Errorf("routes[%s].affinity.ipv6_prefix must be in 1..128", route.Name)
+	}
+	return nil
+}
+
+func normalizeSelectionRules(route *RouteConfig, members map[string]struct{}) error {
+	names := make(map[string]struct{}, len(route.SelectionRules))
+	for i := range route.SelectionRules {
+		rule := &route.SelectionRules[i]
+		rule.Name = strings.TrimSpace(rule.Name)
+		if rule.Name == "" {
+			return fmt.Errorf("routes[%s].selection_rules[%d].name must not be empty", route.Name, i)
+		}
+		if _, ok := names[rule.Name]; ok {
+			return fmt.Errorf("routes[%s] has duplicate selection rule %s", route.Name, rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+		if len(rule.Countries) == 0 && len(rule.ASNs) == 0 && len(rule.CIDRs) == 0 {
+			return fmt.Errorf("routes[%s].selection_rules[%s] must match countries, asns, or cidrs", route.Name, rule.Name)
+		}
+		for j, country := range rule.Countries {
+			country = strings.ToUpper(strings.TrimSpace(country))
+			if len(country) != 2 {
+				return fmt.Errorf("routes[%s].selection_rules[%s].countries must be ISO 3166-1 alpha-2 codes", route.Name, rule.Name)
+			}
+			rule.Countries[j] = country
+		}
+		for _, asn := range rule.ASNs {
+			if asn <= 0 {
+				return fmt.Errorf("routes[%s].selection_rules[%s].asns must be > 0", route.Name, rule.Name)
+			}
+		}
+		for j, cidr := range rule.CIDRs {
+			prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+			if err != nil {
+				return fmt.Errorf("routes[%s].selection_rules[%s].cidrs has invalid CIDR %q", route.Name, rule.Name, cidr)
+			}
+			rule.CIDRs[j] = prefix.Masked().String()
+		}
+		if len(rule.Upstreams) == 0 {
+			return fmt.Errorf("routes[%s].selection_rules[%s].upstreams must not be empty", route.Name, rule.Name)
+		}
+		seen := make(map[string]struct{}, len(rule.Upstreams))
+		for j, tag := range rule.Upstreams {
+			tag = strings.TrimSpace(tag)
+			rule.Upstreams[j] = tag
+			if _, ok := members[tag]; !ok {
+				return fmt.Errorf("routes[%s].selection_rules[%s] references upstream %s that is not in route upstreams", route.Name, rule.Name, tag)
+			}
+			if _, ok := seen[tag]; ok {
+				return fmt.Errorf("routes[%s].selection_rules[%s] lists upstream %s twice", route.Name, rule.Name, tag)
+			}
+			seen[tag] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func routeNeedsGeoIP(route RouteConfig) bool {
+	for _, rule := range route.SelectionRules {
+		if len(rule.Countries) > 0 || len(rule.ASNs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isSRVTag(srvTags map[string]struct{}, tag string) bool {
+	_, ok := srvTags[strings.TrimSpace(tag)]
+	return ok
+}
+
+// validProxyProtocol accepts an empty value, which disables header emission.
+func validProxyProtocol(value string) bool {
+	return value == "" || value == "v1" || value == "v2"
 }
 
 func (c *Config) validate() error {
@@ -554,6 +1255,12 @@ func (c *Config) validate() error {
 	if c.Forwarding.IdleTimeout.TCP.Duration() <= 0 || c.Forwarding.IdleTimeout.UDP.Duration() <= 0 {
 		return errors.New("forwarding.idle_timeout.tcp and udp must be > 0")
 	}
+	if c.Forwarding.Failover.MaxAttempts < 1 || c.Forwarding.Failover.MaxAttempts > maxFailoverAttempts {
+		return fmt.Errorf("forwarding.failover.max_attempts must be in 1..%d", maxFailoverAttempts)
+	}
+	if c.Forwarding.Failover.Budget.Duration() <= 0 {
+		return errors.New("forwarding.failover.budget must be > 0")
+	}
 
 	seenTags := make(map[string]struct{}, len(c.Upstreams))
 	for i := range c.Upstreams {
@@ -567,15 +1274,35 @@ func (c *Config) validate() error {
 		}
 		seenTags[up.Tag] = struct{}{}
 		up.Destination.Host = strings.TrimSpace(up.Destination.Host)
-		if up.Destination.Host == "" {
+		up.Destination.SRV = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(up.Destination.SRV), "."))
+		if up.Destination.SRV != "" {
+			if up.Destination.Host != "" || up.Destination.Port != 0 {
+				return fmt.Errorf("upstreams[%s].destination.srv cannot be combined with host or port", up.Tag)
+			}
+			if strings.ContainsAny(up.Destination.SRV, " /:") {
+				return fmt.Errorf("upstreams[%s].destination.srv must be a DNS name", up.Tag)
+			}
+		} else if up.Destination.Host == "" {
 			return fmt.Errorf("upstreams[%s].destination.host must not be empty", up.Tag)
 		}
-		if up.Measurement.Port <= 0 || up.Measurement.Port > 65535 {
-			return fmt.Errorf("upstreams[%s].measurement.port must be in 1..65535", up.Tag)
+		if up.Destination.Port < 0 || up.Destination.Port > 65535 {
+			return fmt.Errorf("upstreams[%s].destination.port must be in 1..65535", up.Tag)
+		}
+		if err := validateUpstreamMeasurement(up); err != nil {
+			return err
 		}
 		if up.Priority < 0 {
 			return fmt.Errorf("upstreams[%s].priority must be >= 0", up.Tag)
 		}
+		up.ProxyProtocol = strings.ToLower(strings.TrimSpace(up.ProxyProtocol))
+		if !validProxyProtocol(up.ProxyProtocol) {
+			return fmt.Errorf("upstreams[%s].proxy_protocol must be v1 or v2", up.Tag)
+		}
+		for j := range up.Maintenance {
+			if err := up.Maintenance[j].Validate(); err != nil {
+				return fmt.Errorf("upstreams[%s].maintenance[%d]: %w", up.Tag, j, err)
+			}
+		}
 	}
 
 	seenListeners := make(map[string]struct{}, len(c.Forwarding.Listeners))
@@ -611,12 +1338,25 @@ func (c *Config) validate() error {
 		if ln.Protocol != "tcp" && ln.Protocol != "udp" {
 			return fmt.Errorf("listener %s:%d protocol must be tcp or udp", ln.BindAddr, ln.BindPort)
 		}
+		if ln.ProxyProtocol.Enabled() && ln.Protocol != "tcp" {
+			return fmt.Errorf("listener %s:%d proxy_protocol is only supported for tcp", ln.BindAddr, ln.BindPort)
+		}
+		for j, raw := range ln.ProxyProtocol.TrustedCIDRs {
+			ln.ProxyProtocol.TrustedCIDRs[j] = strings.TrimSpace(raw)
+			if _, err := netip.ParsePrefix(ln.ProxyProtocol.TrustedCIDRs[j]); err != nil {
+				return fmt.Errorf("listener %s:%d proxy_protocol.trusted_cidrs contains invalid CIDR %q", ln.BindAddr, ln.BindPort, raw)
+			}
+		}
 	}
 
 	seenRoutes := make(map[string]struct{}, len(c.Routes))
 	upstreamTags := make(map[string]struct{}, len(c.Upstreams))
+	srvTags := make(map[string]struct{})
 	for _, upstream := range c.Upstreams {
 		upstreamTags[upstream.Tag] = struct{}{}
+		if upstream.Destination.SRV != "" {
+			srvTags[upstream.Tag] = struct{}{}
+		}
 	}
 	for i := range c.Routes {
 		route := &c.Routes[i]
@@ -634,15 +1374,44 @@ func (c *Config) validate() error {
 			if len(route.Upstreams) == 0 {
 				return fmt.Errorf("routes[%s].upstreams must contain at least one upstream for static strategy", route.Name)
 			}
-		case "adaptive":
-			if len(route.Upstreams) < 2 {
-				return fmt.Errorf("routes[%s].upstreams must contain at least two upstreams for adaptive strategy", route.Name)
+		case "adaptive", "failover", "weighted", "least_connections", "round_robin":
+			// A single SRV upstream expands to its discovered members.
+			if len(route.Upstreams) < 2 && !(len(route.Upstreams) == 1 && isSRVTag(srvTags, route.Upstreams[0])) {
+				return fmt.Errorf("routes[%s].upstreams must contain at least two upstreams for %s strategy", route.Name, route.Strategy)
 			}
 			if strings.TrimSpace(route.DefaultUpstream) != "" {
 				return fmt.Errorf("routes[%s].default_upstream is only valid for static strategy", route.Name)
 			}
 		default:
-			return fmt.Errorf("routes[%s].strategy must be static or adaptive", route.Name)
+			return fmt.Errorf("routes[%s].strategy must be static, adaptive, failover, weighted, least_connections or round_robin", route.Name)
+		}
+		if len(route.Weights) > 0 && route.Strategy != "weighted" {
+			return fmt.Errorf("routes[%s].weights is only valid for weighted strategy", route.Name)
+		}
+		if err := normalizeRouteAffinity(route); err != nil {
+			return err
+		}
+		if err := validateRouteHedge(route); err != nil {
+			return err
+		}
+		if err := c.normalizeRoutePrefer(route); err != nil {
+			return err
+		}
+		if err := validateRouteScore(route); err != nil {
+			return err
+		}
+		if err := c.validateRouteHealth(route); err != nil {
+			return err
+		}
+		if err := normalizeRouteFailback(route); err != nil {
+			return err
+		}
+		if len(route.SelectionRules) > 0 && route.Strategy == "static" {
+			return fmt.Errorf("routes[%s].selection_rules is not valid for static strategy", route.Name)
+		}
+		route.ProxyProtocol = strings.ToLower(strings.TrimSpace(route.ProxyProtocol))
+		if !validProxyProtocol(route.ProxyProtocol) {
+			return fmt.Errorf("routes[%s].proxy_protocol must be v1 or v2", route.Name)
 		}
 		seenRouteUpstreams := make(map[string]struct{}, len(route.Upstreams))
 		for j, tag := range route.Upstreams {
@@ -658,6 +1427,23 @@ func (c *Config) validate() error {
 			if _, ok := upstreamTags[tag]; !ok {
 				return fmt.Errorf("routes[%s].upstreams references unknown upstream %s", route.Name, tag)
 			}
+			if isSRVTag(srvTags, tag) && route.Strategy == "static" {
+				return fmt.Errorf("routes[%s] static strategy cannot use SRV upstream %s", route.Name, tag)
+			}
+		}
+		if err := normalizeSelectionRules(route, seenRouteUpstreams); err != nil {
+			return err
+		}
+		if routeNeedsGeoIP(*route) && !c.GeoIP.Enabled {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("routes[%s].selection_rules match countries or ASNs but geoip is disabled; those matchers never match", route.Name))
+		}
+		for tag, weight := range route.Weights {
+			if _, ok := seenRouteUpstreams[tag]; !ok {
+				return fmt.Errorf("routes[%s].weights references upstream %s that is not in route upstreams", route.Name, tag)
+			}
+			if weight <= 0 {
+				return fmt.Errorf("routes[%s].weights[%s] must be > 0", route.Name, tag)
+			}
 		}
 		if route.Strategy == "static" {
 			route.DefaultUpstream = strings.TrimSpace(route.DefaultUpstream)
@@ -671,11 +1457,27 @@ func (c *Config) validate() error {
 			}
 		}
 	}
+	routePorts := make(map[string]RouteConfig, len(c.Routes))
+	for _, route := range c.Routes {
+		for listenPort, upstreamPort := range route.Ports {
+			if listenPort <= 0 || listenPort > 65535 || upstreamPort <= 0 || upstreamPort > 65535 {
+				return fmt.Errorf("routes[%s].ports entries must map 1..65535 to 1..65535", route.Name)
+			}
+		}
+		routePorts[route.Name] = route
+	}
 	for i := range c.Forwarding.Listeners {
 		listener := &c.Forwarding.Listeners[i]
 		if _, ok := seenRoutes[listener.Route]; !ok {
 			return fmt.Errorf("listener %s references unknown route %s", listener.Name, listener.Route)
 		}
+		route := routePorts[listener.Route]
+		if _, mapped := route.Ports[listener.BindPort]; mapped || route.PortOffset == 0 {
+			continue
+		}
+		if port := listener.BindPort + route.PortOffset; port <= 0 || port > 65535 {
+			return fmt.Errorf("routes[%s].port_offset moves listener port %d outside 1..65535", route.Name, listener.BindPort)
+		}
 	}
 
 	c.Control.AuthToken = strings.TrimSpace(c.Control.AuthToken)
@@ -758,6 +1560,17 @@ func (c *Config) validate() error {
 	if c.Measurement.Schedule.UpstreamGap.Duration() < 0 {
 		return errors.New("measurement.schedule.upstream_gap must be >= 0")
 	}
+	if adaptive := c.Measurement.Schedule.Adaptive; adaptive.Enabled {
+		if adaptive.FastInterval.Duration() <= 0 || adaptive.FastInterval > c.Measurement.Schedule.Interval.Min {
+			return errors.New("measurement.schedule.adaptive.fast_interval must be > 0 and <= interval.min")
+		}
+		if adaptive.StableAfter < 1 {
+			return errors.New("measurement.schedule.adaptive.stable_after must be >= 1")
+		}
+		if adaptive.MaxInterval < c.Measurement.Schedule.Interval.Max {
+			return errors.New("measurement.schedule.adaptive.max_interval must be >= interval.max")
+		}
+	}
 
 	tcpEnabled := util.BoolValue(c.Measurement.Protocols.TCP.Enabled, defaultMeasurementTCPEnabled)
 	udpEnabled := util.BoolValue(c.Measurement.Protocols.UDP.Enabled, defaultMeasurementUDPEnabled)
@@ -767,6 +1580,31 @@ func (c *Config) validate() error {
 	if c.Measurement.ProbeTimeout.Duration() < 100*time.Millisecond || c.Measurement.ProbeTimeout.Duration() > 10*time.Second {
 		return errors.New("measurement.probe_timeout must be between 100ms and 10s")
 	}
+	if tcp := c.Measurement.Protocols.TCP; tcp.Burst || tcp.BurstFrames != 0 || tcp.BurstInterval != 0 {
+		return errors.New("measurement.protocols.tcp.burst is not supported; bursts are UDP-only")
+	}
+	if udp := c.Measurement.Protocols.UDP; udp.Burst {
+		if udp.BurstFrames < 1 || udp.BurstFrames > maxBurstFrames {
+			return fmt.Errorf("measurement.protocols.udp.burst_frames must be between 1 and %d", maxBurstFrames)
+		}
+		if udp.BurstInterval.Duration() < minBurstInterval || udp.BurstInterval.Duration() > maxBurstInterval {
+			return fmt.Errorf("measurement.protocols.udp.burst_interval must be between %s and %s", minBurstInterval, maxBurstInterval)
+		}
+		span := time.Duration(udp.BurstFrames-1)*udp.BurstInterval.Duration() + burstEchoDrain
+		if need := max(minBurstProbeTimeout, span); c.Measurement.ProbeTimeout.Duration() < need {
+			return fmt.Errorf("measurement.protocols.udp.burst needs measurement.probe_timeout of at least %s", need)
+		}
+	} else if udp.BurstFrames != 0 || udp.BurstInterval != 0 {
+		return errors.New("measurement.protocols.udp.burst_frames and burst_interval require burst")
+	}
+	if throughput := c.Measurement.Throughput; throughput.Enabled {
+		if throughput.Interval.Duration() < minThroughputInterval {
+			return fmt.Errorf("measurement.throughput.interval must be at least %s", minThroughputInterval)
+		}
+		if throughput.Bytes < minThroughputBytes || throughput.Bytes > maxThroughputBytes {
+			return fmt.Errorf("measurement.throughput.bytes must be between %d and %d", minThroughputBytes, maxThroughputBytes)
+		}
+	}
 
 	if c.Health.RTTEWMAAlpha <= 0 || c.Health.RTTEWMAAlpha > 1 {
 		return errors.New("health.rtt_ewma_alpha must be in (0,1]")
@@ -780,7 +1618,22 @@ func (c *Config) validate() error {
 	if c.Health.StaleThreshold.Duration() <= 0 {
 		return errors.New("health.stale_threshold must be > 0")
 	}
+	if c.Health.LossThreshold < 0 || c.Health.LossThreshold >= 1 {
+		return errors.New("health.loss_threshold must be in [0,1)")
+	}
+	if c.Health.MinThroughputMbps < 0 {
+		return errors.New("health.min_throughput_mbps must be >= 0")
+	}
+	if err := c.Health.Passive.validate(); err != nil {
+		return err
+	}
 
+	if c.DNS.SRV.MinRefresh.Duration() <= 0 {
+		return errors.New("dns.srv.min_refresh must be > 0")
+	}
+	if c.DNS.SRV.MaxRefresh < c.DNS.SRV.MinRefresh {
+		return errors.New("dns.srv.max_refresh must be >= dns.srv.min_refresh")
+	}
 	c.DNS.Strategy = strings.ToLower(strings.TrimSpace(c.DNS.Strategy))
 	if c.DNS.Strategy != "" {
 		switch c.DNS.Strategy {
@@ -826,7 +1679,10 @@ func (c *Config) validate() error {
 		if c.IPLog.Retention.Duration() < 0 {
 			return errors.New("ip_log.retention must be >= 0")
 		}
-		if c.IPLog.Retention.Duration() > 0 && c.IPLog.PruneInterval.Duration() <= 0 {
+		if c.IPLog.MeasurementRetention.Duration() < 0 {
+			return errors.New("ip_log.measurement_retention must be > 0")
+		}
+		if (c.IPLog.Retention.Duration() > 0 || c.IPLog.MeasurementRetention.Duration() > 0) && c.IPLog.PruneInterval.Duration() <= 0 {
 			return errors.New("ip_log.prune_interval must be > 0 when retention is enabled")
 		}
 	}
@@ -180,6 +180,152 @@ func TestFlowContextConfigValidation(t *testing.T) {
 	}
 }
 
+func TestDialFailoverDefaultsAndValidation(t *testing.T) {
+	cfg := testConfig()
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Forwarding.Failover; got.MaxAttempts != 3 || got.Budget.Duration() != 10*time.Second {
+		t.Fatalf("unexpected failover defaults: %+v", got)
+	}
+	tests := []struct {
+		name string
+		mut  func(*DialFailoverConfig)
+		want string
+	}{
+		{"disabled", func(cfg *DialFailoverConfig) { cfg.MaxAttempts = 1 }, ""},
+		{"too many attempts", func(cfg *DialFailoverConfig) { cfg.MaxAttempts = 17 }, "forwarding.failover.max_attempts"},
+		{"negative attempts", func(cfg *DialFailoverConfig) { cfg.MaxAttempts = -1 }, "forwarding.failover.max_attempts"},
+		{"negative budget", func(cfg *DialFailoverConfig) { cfg.Budget = Duration(-time.Second) }, "forwarding.failover.budget"},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg := testConfig()
+			testCase.mut(&cfg.Forwarding.Failover)
+			cfg.setDefaults()
+			err := cfg.validate()
+			if testCase.want == "" {
+				if err != nil {
+					t.Fatalf("expected failover config to validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), testCase.want) {
+				t.Fatalf("expected %q, got %v", testCase.want, err)
+			}
+		})
+	}
+}
+
+func TestPassiveHealthDefaultsAndValidation(t *testing.T) {
+	cfg := testConfig()
+	cfg.Health.Passive.Enabled = true
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Health.Passive; got.Window.Duration() != time.Minute || got.FailureThreshold != 5 || got.FailureRatio != 0.5 || len(got.Signals) != len(PassiveSignals) {
+		t.Fatalf("unexpected passive defaults: %+v", got)
+	}
+	tests := []struct {
+		name string
+		mut  func(*PassiveHealthConfig)
+		want string
+	}{
+		{"disabled ignores values", func(cfg *PassiveHealthConfig) { cfg.Enabled = false; cfg.FailureRatio = 2 }, ""},
+		{"signal case", func(cfg *PassiveHealthConfig) { cfg.Signals = []string{" Dial_Error "} }, ""},
+		{"short window", func(cfg *PassiveHealthConfig) { cfg.Window = Duration(500 * time.Millisecond) }, "health.passive.window"},
+		{"long window", func(cfg *PassiveHealthConfig) { cfg.Window = Duration(2 * time.Hour) }, "health.passive.window"},
+		{"negative threshold", func(cfg *PassiveHealthConfig) { cfg.FailureThreshold = -1 }, "health.passive.failure_threshold"},
+		{"ratio above one", func(cfg *PassiveHealthConfig) { cfg.FailureRatio = 1.5 }, "health.passive.failure_ratio"},
+		{"unknown signal", func(cfg *PassiveHealthConfig) { cfg.Signals = []string{"timeout"} }, "health.passive.signals"},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Health.Passive.Enabled = true
+			testCase.mut(&cfg.Health.Passive)
+			cfg.setDefaults()
+			err := cfg.validate()
+			if testCase.want == "" {
+				if err != nil {
+					t.Fatalf("expected passive health config to validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), testCase.want) {
+				t.Fatalf("expected %q, got %v", testCase.want, err)
+			}
+		})
+	}
+}
+
+func TestMeasurementQualityValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		mut  func(*Config)
+		want string
+	}{
+		{"udp burst", func(cfg *Config) { cfg.Measurement.Protocols.UDP.Burst = true; cfg.Health.LossThreshold = 0.05 }, ""},
+		{"tcp burst", func(cfg *Config) { cfg.Measurement.Protocols.TCP.Burst = true }, "measurement.protocols.tcp.burst"},
+		{"short timeout", func(cfg *Config) {
+			cfg.Measurement.Protocols.UDP.Burst = true
+			cfg.Measurement.ProbeTimeout = Duration(200 * time.Millisecond)
+		}, "measurement.protocols.udp.burst"},
+		{"burst size", func(cfg *Config) {
+			cfg.Measurement.Protocols.UDP = MeasurementProtocolConfig{Burst: true, BurstFrames: 50, BurstInterval: Duration(5 * time.Millisecond)}
+		}, ""},
+		{"oversized burst", func(cfg *Config) {
+			cfg.Measurement.Protocols.UDP = MeasurementProtocolConfig{Burst: true, BurstFrames: 500}
+		}, "measurement.protocols.udp.burst_frames"},
+		{"fast burst", func(cfg *Config) {
+			cfg.Measurement.Protocols.UDP = MeasurementProtocolConfig{Burst: true, BurstInterval: Duration(time.Millisecond)}
+		}, "measurement.protocols.udp.burst_interval"},
+		{"long burst", func(cfg *Config) {
+			cfg.Measurement.Protocols.UDP = MeasurementProtocolConfig{Burst: true, BurstFrames: 100, BurstInterval: Duration(50 * time.Millisecond)}
+		}, "probe_timeout of at least 5.2s"},
+		{"burst size without burst", func(cfg *Config) { cfg.Measurement.Protocols.UDP.BurstFrames = 10 }, "require burst"},
+		{"negative loss threshold", func(cfg *Config) { cfg.Health.LossThreshold = -0.1 }, "health.loss_threshold"},
+		{"full loss threshold", func(cfg *Config) { cfg.Health.LossThreshold = 1 }, "health.loss_threshold"},
+		{"throughput", func(cfg *Config) { cfg.Measurement.Throughput.Enabled = true; cfg.Health.MinThroughputMbps = 20 }, ""},
+		{"throughput interval", func(cfg *Config) {
+			cfg.Measurement.Throughput = MeasurementThroughputConfig{Enabled: true, Interval: Duration(time.Minute)}
+		}, "measurement.throughput.interval"},
+		{"throughput bytes", func(cfg *Config) {
+			cfg.Measurement.Throughput = MeasurementThroughputConfig{Enabled: true, Bytes: 64 << 20}
+		}, "measurement.throughput.bytes"},
+		{"negative throughput minimum", func(cfg *Config) { cfg.Health.MinThroughputMbps = -1 }, "health.min_throughput_mbps"},
+		{"adaptive schedule", func(cfg *Config) { cfg.Measurement.Schedule.Adaptive.Enabled = true }, ""},
+		{"adaptive fast interval", func(cfg *Config) {
+			cfg.Measurement.Schedule.Adaptive = AdaptiveScheduleConfig{Enabled: true, FastInterval: Duration(time.Hour)}
+		}, "measurement.schedule.adaptive.fast_interval"},
+		{"adaptive stable after", func(cfg *Config) {
+			cfg.Measurement.Schedule.Adaptive = AdaptiveScheduleConfig{Enabled: true, StableAfter: -1}
+		}, "measurement.schedule.adaptive.stable_after"},
+		{"adaptive max interval", func(cfg *Config) {
+			cfg.Measurement.Schedule.Adaptive = AdaptiveScheduleConfig{Enabled: true, MaxInterval: Duration(time.Minute)}
+		}, "measurement.schedule.adaptive.max_interval"},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg := testConfig()
+			testCase.mut(&cfg)
+			cfg.setDefaults()
+			err := cfg.validate()
+			if testCase.want == "" {
+				if err != nil {
+					t.Fatalf("expected config to validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), testCase.want) {
+				t.Fatalf("expected %q, got %v", testCase.want, err)
+			}
+		})
+	}
+}
+
 func TestListenerRouteDefaultsAndExplicitValue(t *testing.T) {
 	cfg := testConfig()
 	cfg.setDefaults()
@@ -294,3 +440,67 @@ func testConfig() Config {
 		},
 	}
 }
+
+func TestChangedFieldsReportsYAMLPaths(t *testing.T) {
+	current := Config{Hostname: "a", Control: ControlConfig{BindPort: 8080}, Upstreams: []UpstreamConfig{{Tag: "primary"}}}
+	next := current
+	next.Control.BindPort = 9090
+	next.Notify.Endpoint = "https://notify.example"
+	next.Upstreams = []UpstreamConfig{{Tag: "backup"}}
+	next.Warnings = []string{"ignored"}
+	got := ChangedFields("", current, next)
+	want := []string{"control.bind_port", "upstreams", "webhook.endpoint"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("changed fields = %v, want %v", got, want)
+	}
+	if got := ChangedFields("", current, current); len(got) != 0 {
+		t.Fatalf("identical configs reported changes: %v", got)
+	}
+}
+
+func TestMaintenanceWindowValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		window MaintenanceWindowConfig
+		want   string
+	}{
+		{"empty", MaintenanceWindowConfig{}, "needs start and end"},
+		{"reversed", MaintenanceWindowConfig{Start: "2026-01-02T00:00:00Z", End: "2026-01-01T00:00:00Z"}, "end must be after start"},
+		{"mixed", MaintenanceWindowConfig{Start: "2026-01-01T00:00:00Z", At: "02:00", Duration: Duration(time.Hour)}, "cannot be combined"},
+		{"bad at", MaintenanceWindowConfig{At: "2am", Duration: Duration(time.Hour)}, "HH:MM"},
+		{"long", MaintenanceWindowConfig{At: "02:00", Duration: Duration(8 * 24 * time.Hour)}, "duration"},
+		{"weekday", MaintenanceWindowConfig{At: "02:00", Duration: Duration(time.Hour), Weekdays: []string{"someday"}}, "unknown weekday"},
+		{"close after", MaintenanceWindowConfig{At: "02:00", Duration: Duration(time.Hour), CloseAfter: Duration(time.Hour)}, "close_after"},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := testCase.window.Validate()
+			if err == nil || !strings.Contains(err.Error(), testCase.want) {
+				t.Fatalf("Validate() error = %v, want %q", err, testCase.want)
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowRecurringOccurrences(t *testing.T) {
+	window := MaintenanceWindowConfig{Weekdays: []string{"Sunday"}, At: "23:30", Duration: Duration(time.Hour)}
+	if err := window.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if strings.Join(window.Weekdays, ",") != "sun" {
+		t.Fatalf("weekdays = %v, want [sun]", window.Weekdays)
+	}
+	// 2026-01-04 is a Sunday; the window runs into Monday.
+	inside := time.Date(2026, 1, 5, 0, 15, 0, 0, time.UTC)
+	start, end, ok := window.ActiveAt(inside)
+	if !ok || !start.Equal(time.Date(2026, 1, 4, 23, 30, 0, 0, time.UTC)) || !end.Equal(time.Date(2026, 1, 5, 0, 30, 0, 0, time.UTC)) {
+		t.Fatalf("ActiveAt(%v) = %v, %v, %v", inside, start, end, ok)
+	}
+	if _, _, ok := window.ActiveAt(inside.Add(time.Hour)); ok {
+		t.Fatal("window active after its end")
+	}
+	next, ok := window.NextStart(inside)
+	if !ok || !next.Equal(time.Date(2026, 1, 11, 23, 30, 0, 0, time.UTC)) {
+		t.Fatalf("NextStart(%v) = %v, %v", inside, next, ok)
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindowConfig is a one-off or weekly maintenance window of an
+// upstream. A one-off window sets Start and End as RFC 3339 times. A
+// recurring window starts at At (HH:MM in Timezone, UTC by default) on each
+// of Weekdays, or every day when Weekdays is empty, and lasts Duration.
+// During a window the upstream drains; CloseAfter, when set, closes the
+// Flows still open that long after the window started.
+type MaintenanceWindowConfig struct {
+	Name       string   `yaml:"name,omitempty"`
+	Start      string   `yaml:"start,omitempty"`
+	End        string   `yaml:"end,omitempty"`
+	Weekdays   []string `yaml:"weekdays,omitempty"`
+	At         string   `yaml:"at,omitempty"`
+	Duration   Duration `yaml:"duration,omitempty"`
+	Timezone   string   `yaml:"timezone,omitempty"`
+	CloseAfter Duration `yaml:"close_after,omitempty"`
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Recurring reports whether the window repeats.
+func (w MaintenanceWindowConfig) Recurring() bool {
+	return w.At != ""
+}
+
+// Validate normalizes the window and checks that it describes exactly one
+// of the two forms.
+func (w *MaintenanceWindowConfig) Validate() error {
+	w.Name = strings.TrimSpace(w.Name)
+	w.Start, w.End = strings.TrimSpace(w.Start), strings.TrimSpace(w.End)
+	w.At, w.Timezone = strings.TrimSpace(w.At), strings.TrimSpace(w.Timezone)
+	if w.CloseAfter < 0 {
+		return errors.New("close_after must be >= 0")
+	}
+	if !w.Recurring() {
+		if w.Start == "" || w.End == "" {
+			return errors.New("needs start and end, or at and duration")
+		}
+		if len(w.Weekdays) > 0 || w.Duration != 0 || w.Timezone != "" {
+			return errors.New("weekdays, duration and timezone apply only with at")
+		}
+		start, err := time.Parse(time.RFC3339, w.Start)
+		if err != nil {
+			return fmt.Errorf("start: %w", err)
+		}
+		end, err := time.Parse(time.RFC3339, w.End)
+		if err != nil {
+			return fmt.Errorf("end: %w", err)
+		}
+		if !end.After(start) {
+			return errors.New("end must be after start")
+		}
+		if w.CloseAfter.Duration() >= end.Sub(start) {
+			return errors.New("close_after must be shorter than the window")
+		}
+		return nil
+	}
+	if w.Start != "" || w.End != "" {
+		return errors.New("start and end cannot be combined with at")
+	}
+	if _, err := time.Parse("15:04", w.At); err != nil {
+		return errors.New("at must be HH:MM")
+	}
+	if w.Duration <= 0 || w.Duration.Duration() > 7*24*time.Hour {
+		return errors.New("duration must be in (0, 168h]")
+	}
+	if w.CloseAfter.Duration() >= w.Duration.Duration() {
+		return errors.New("close_after must be shorter than the window")
+	}
+	if _, err := w.location(); err != nil {
+		return fmt.Errorf("timezone: %w", err)
+	}
+	weekdays := make([]string, 0, len(w.Weekdays))
+	for _, name := range w.Weekdays {
+		day := strings.ToLower(strings.TrimSpace(name))
+		if len(day) > 3 {
+			day = day[:3]
+		}
+		if !slices.Contains(weekdayNames, day) {
+			return fmt.Errorf("unknown weekday %s", name)
+		}
+		weekdays = append(weekdays, day)
+	}
+	if len(weekdays) > 0 {
+		w.Weekdays = weekdays
+	}
+	return nil
+}
+
+// ActiveAt returns the occurrence of the window that contains now. The
+// window must be valid.
+func (w MaintenanceWindowConfig) ActiveAt(now time.Time) (start, end time.Time, ok bool) {
+	if !w.Recurring() {
+		start, _ = time.Parse(time.RFC3339, w.Start)
+		end, _ = time.Parse(time.RFC3339, w.End)
+		return start, end, !now.Before(start) && now.Before(end)
+	}
+	// An occurrence that contains now started at most Duration ago.
+	days := int(w.Duration.Duration()/(24*time.Hour)) + 1
+	for back := 0; back <= days; back++ {
+		start = w.occurrence(now, -back)
+		end = start.Add(w.Duration.Duration())
+		if w.onWeekday(start) && !now.Before(start) && now.Before(end) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// NextStart returns the first start of the window after now, if any.
+func (w MaintenanceWindowConfig) NextStart(now time.Time) (time.Time, bool) {
+	if !w.Recurring() {
+		start, _ := time.Parse(time.RFC3339, w.Start)
+		return start, start.After(now)
+	}
+	for ahead := 0; ahead <= 7; ahead++ {
+		if start := w.occurrence(now, ahead); start.After(now) && w.onWeekday(start) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// occurrence returns the start time on the day offset days from now, in the
+// window's timezone.
+func (w MaintenanceWindowConfig) occurrence(now time.Time, offset int) time.Time {
+	loc, _ := w.location()
+	at, _ := time.Parse("15:04", w.At)
+	day := now.In(loc).AddDate(0, 0, offset)
+	return time.Date(day.Year(), day.Month(), day.Day(), at.Hour(), at.Minute(), 0, 0, loc)
+}
+
+func (w MaintenanceWindowConfig) onWeekday(start time.Time) bool {
+	return len(w.Weekdays) == 0 || slices.Contains(w.Weekdays, weekdayNames[start.Weekday()])
+}
+
+func (w MaintenanceWindowConfig) location() (*time.Location, error) {
+	if w.Timezone == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(w.Timezone)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ReloadReport describes how a configuration reload was applied. Paths use
+// the YAML key names so operators can match them against the file.
+type ReloadReport struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Changed reports whether the reload found any difference.
+func (r ReloadReport) Changed() bool {
+	return len(r.Applied) > 0 || len(r.RestartRequired) > 0
+}
+
+// ChangedFields returns the YAML paths whose values differ between current
+// and next. Structs are compared field by field; slices, maps, and scalars
+// are reported as a whole at their own path.
+func ChangedFields(prefix string, current, next any) []string {
+	var out []string
+	diffValue(prefix, reflect.ValueOf(current), reflect.ValueOf(next), &out)
+	sort.Strings(out)
+	return out
+}
+
+func diffValue(path string, current, next reflect.Value, out *[]string) {
+	for current.Kind() == reflect.Pointer && next.Kind() == reflect.Pointer && !current.IsNil() && !next.IsNil() {
+		current, next = current.Elem(), next.Elem()
+	}
+	if current.Kind() != reflect.Struct || current.Type() != next.Type() {
+		if !reflect.DeepEqual(current.Interface(), next.Interface()) {
+			*out = append(*out, path)
+		}
+		return
+	}
+	typ := current.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := yamlName(field)
+		if name == "-" {
+			continue
+		}
+		child := name
+		if path != "" {
+			child = path + "." + name
+		}
+		diffValue(child, current.Field(i), next.Field(i), out)
+	}
+}
+
+func yamlName(field reflect.StructField) string {
+	tag := field.Tag.Get("yaml")
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
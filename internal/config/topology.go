@@ -61,7 +61,7 @@ func (c *Config) normalizeTopology() error {
 			}
 			c.Listeners[i] = ListenerSpec{
 				Name: listener.Name, Bind: net.JoinHostPort(listener.BindAddr, strconv.Itoa(listener.BindPort)),
-				Protocol: listener.Protocol, Route: listener.Route,
+				Protocol: listener.Protocol, Route: listener.Route, ProxyProtocol: listener.ProxyProtocol,
 			}
 			listeners = append(listeners, listener)
 		}
@@ -88,7 +88,7 @@ func (c *Config) normalizeTopology() error {
 			c.Forwarding.Listeners[len(c.Listeners)] = listener
 			c.Listeners = append(c.Listeners, ListenerSpec{
 				Name: name, Bind: net.JoinHostPort(listener.BindAddr, strconv.Itoa(listener.BindPort)),
-				Protocol: listener.Protocol, Route: route,
+				Protocol: listener.Protocol, Route: route, ProxyProtocol: listener.ProxyProtocol,
 			})
 		}
 		if len(c.Routes) == 0 {
@@ -140,7 +140,8 @@ func normalizeListenerSpec(spec ListenerSpec, index int) (ListenerConfig, error)
 	}
 	return ListenerConfig{
 		Name: name, BindAddr: host, BindPort: port,
-		Protocol: strings.ToLower(strings.TrimSpace(spec.Protocol)),
-		Route:    strings.TrimSpace(spec.Route),
+		Protocol:      strings.ToLower(strings.TrimSpace(spec.Protocol)),
+		Route:         strings.TrimSpace(spec.Route),
+		ProxyProtocol: spec.ProxyProtocol,
 	}, nil
 }
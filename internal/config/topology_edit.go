@@ -0,0 +1,313 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TopologyChange edits the listeners, routes, or upstreams of a configuration
+// copy. The result is validated by ApplyTopology like a loaded file.
+type TopologyChange func(*Config) error
+
+// ErrTopologyNotFound is returned when a change names a missing upstream,
+// route, or listener.
+var ErrTopologyNotFound = errors.New("not found")
+
+// ErrTopologyNotPersisted wraps a write-back failure of a topology change that
+// is already running.
+var ErrTopologyNotPersisted = errors.New("topology applied but not written to the configuration file")
+
+// ApplyTopology returns a copy of c with change applied, defaulted, and
+// validated. The copy always uses the top-level listeners and routes form,
+// so a legacy forwarding.listeners configuration is converted.
+func (c Config) ApplyTopology(change TopologyChange) (Config, error) {
+	next := c
+	next.Listeners = make([]ListenerSpec, len(c.Listeners))
+	for i, spec := range c.Listeners {
+		spec.ProxyProtocol.TrustedCIDRs = slices.Clone(spec.ProxyProtocol.TrustedCIDRs)
+		next.Listeners[i] = spec
+	}
+	next.Routes = make([]RouteConfig, len(c.Routes))
+	for i, route := range c.Routes {
+		next.Routes[i] = cloneRoute(route)
+	}
+	next.Upstreams = slices.Clone(c.Upstreams)
+	if err := change(&next); err != nil {
+		return Config{}, err
+	}
+	next.Forwarding.Listeners = nil
+	next.topologyMode = "modern"
+	next.topologyNormalized = false
+	next.setDefaults()
+	if err := next.validate(); err != nil {
+		return Config{}, err
+	}
+	return next, nil
+}
+
+func cloneRoute(route RouteConfig) RouteConfig {
+	route.Upstreams = slices.Clone(route.Upstreams)
+	route.Weights = maps.Clone(route.Weights)
+	route.Ports = maps.Clone(route.Ports)
+	if route.SelectionRules != nil {
+		rules := make([]RouteSelectionRule, len(route.SelectionRules))
+		for i, rule := range route.SelectionRules {
+			rule.Countries = slices.Clone(rule.Countries)
+			rule.ASNs = slices.Clone(rule.ASNs)
+			rule.CIDRs = slices.Clone(rule.CIDRs)
+			rule.Upstreams = slices.Clone(rule.Upstreams)
+			rules[i] = rule
+		}
+		route.SelectionRules = rules
+	}
+	return route
+}
+
+// CreateUpstream adds a new upstream definition. Routes must reference it
+// separately, for example with SetRouteUpstreams.
+func CreateUpstream(up UpstreamConfig) TopologyChange {
+	return func(c *Config) error {
+		up.Tag = strings.TrimSpace(up.Tag)
+		if upstreamIndex(c, up.Tag) >= 0 {
+			return fmt.Errorf("upstream %s already exists", up.Tag)
+		}
+		c.Upstreams = append(c.Upstreams, up)
+		return nil
+	}
+}
+
+// PatchUpstream edits an existing upstream in place, so settings that patch
+// does not touch, such as maintenance windows, are kept. Measurement values
+// that only hold their default are cleared first and derived again from the
+// patched upstream. The tag cannot be changed.
+func PatchUpstream(tag string, patch func(*UpstreamConfig) error) TopologyChange {
+	return func(c *Config) error {
+		tag = strings.TrimSpace(tag)
+		i := upstreamIndex(c, tag)
+		if i < 0 {
+			return fmt.Errorf("upstream %s %w", tag, ErrTopologyNotFound)
+		}
+		up := c.Upstreams[i]
+		up.Maintenance = slices.Clone(up.Maintenance)
+		up.clearMeasurementDefaults()
+		if err := patch(&up); err != nil {
+			return err
+		}
+		if up.Tag = strings.TrimSpace(up.Tag); up.Tag != "" && up.Tag != tag {
+			return fmt.Errorf("upstream %s cannot be renamed to %s", tag, up.Tag)
+		}
+		up.Tag = tag
+		c.Upstreams[i] = up
+		return nil
+	}
+}
+
+// clearMeasurementDefaults undoes what setDefaults derives for the measurement
+// of up, so a patch that changes the destination or probe type does not keep
+// a default of the old one.
+func (up *UpstreamConfig) clearMeasurementDefaults() {
+	m := &up.Measurement
+	if up.Destination.SRV == "" && m.Host == up.Destination.Host {
+		m.Host = ""
+	}
+	if m.Type == ProbeFBMeasure {
+		m.Type = ""
+		if m.Port == defaultMeasurePort {
+			m.Port = 0
+		}
+	}
+	if m.Type == ProbeHTTP {
+		if m.HTTP.Path == "/" {
+			m.HTTP.Path = ""
+		}
+		if m.HTTP.ExpectStatus == http.StatusOK {
+			m.HTTP.ExpectStatus = 0
+		}
+	}
+}
+
+// DeleteUpstream removes an upstream that no route references.
+func DeleteUpstream(tag string) TopologyChange {
+	return func(c *Config) error {
+		tag = strings.TrimSpace(tag)
+		i := upstreamIndex(c, tag)
+		if i < 0 {
+			return fmt.Errorf("upstream %s %w", tag, ErrTopologyNotFound)
+		}
+		for _, route := range c.Routes {
+			if slices.Contains(route.Upstreams, tag) {
+				return fmt.Errorf("upstream %s is used by route %s", tag, route.Name)
+			}
+		}
+		c.Upstreams = slices.Delete(c.Upstreams, i, i+1)
+		return nil
+	}
+}
+
+// SetRouteUpstreams replaces the members of a route. Weights and the static
+// default upstream are replaced with them; selection rules and affinity are
+// kept and validated against the new members.
+func SetRouteUpstreams(name string, upstreams []string, weights map[string]int, defaultUpstream string) TopologyChange {
+	return func(c *Config) error {
+		name = strings.TrimSpace(name)
+		for i := range c.Routes {
+			if c.Routes[i].Name != name {
+				continue
+			}
+			c.Routes[i].Upstreams = slices.Clone(upstreams)
+			c.Routes[i].Weights = maps.Clone(weights)
+			c.Routes[i].DefaultUpstream = defaultUpstream
+			return nil
+		}
+		return fmt.Errorf("route %s %w", name, ErrTopologyNotFound)
+	}
+}
+
+// CreateListener adds a listener bound to an existing route.
+func CreateListener(spec ListenerSpec) TopologyChange {
+	return func(c *Config) error {
+		spec.Name = strings.TrimSpace(spec.Name)
+		if listenerIndex(c, spec.Name) >= 0 {
+			return fmt.Errorf("listener %s already exists", spec.Name)
+		}
+		c.Listeners = append(c.Listeners, spec)
+		return nil
+	}
+}
+
+// DeleteListener removes a listener. At least one listener must remain.
+func DeleteListener(name string) TopologyChange {
+	return func(c *Config) error {
+		name = strings.TrimSpace(name)
+		i := listenerIndex(c, name)
+		if i < 0 {
+			return fmt.Errorf("listener %s %w", name, ErrTopologyNotFound)
+		}
+		if len(c.Listeners) == 1 {
+			return fmt.Errorf("listener %s is the last listener", name)
+		}
+		c.Listeners = slices.Delete(c.Listeners, i, i+1)
+		return nil
+	}
+}
+
+func upstreamIndex(c *Config, tag string) int {
+	return slices.IndexFunc(c.Upstreams, func(up UpstreamConfig) bool { return up.Tag == tag })
+}
+
+func listenerIndex(c *Config, name string) int {
+	return slices.IndexFunc(c.Listeners, func(spec ListenerSpec) bool { return spec.Name == name })
+}
+
+// WriteTopology replaces the listeners, routes, and upstreams sections of the
+// configuration file at path with those of cfg. Other sections and their
+// comments are kept, and forwarding.listeners is dropped in favour of the
+// top-level form. The result must load before it atomically replaces the file.
+func WriteTopology(path string, cfg Config) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("configuration root must be a mapping")
+	}
+	for _, section := range []struct {
+		key   string
+		value any
+	}{
+		{"listeners", cfg.Listeners},
+		{"routes", cfg.Routes},
+		{"upstreams", cfg.Upstreams},
+	} {
+		var value yaml.Node
+		if err := value.Encode(section.value); err != nil {
+			return err
+		}
+		setMappingValue(root, section.key, &value)
+	}
+	if forwarding := mappingValue(root, "forwarding"); forwarding != nil && forwarding.Kind == yaml.MappingNode {
+		deleteMappingKey(forwarding, "listeners")
+	}
+
+	var out strings.Builder
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(out.String()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if _, err := LoadConfig(tmp.Name()); err != nil {
+		return fmt.Errorf("rewritten configuration does not load: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func deleteMappingKey(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = slices.Delete(node.Content, i, i+2)
+			return
+		}
+	}
+}
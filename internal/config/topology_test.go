@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -63,6 +64,43 @@ func TestStaticRouteDefaultAndMultiUpstreamValidation(t *testing.T) {
 		{name: "multiple requires default", route: RouteConfig{Name: "web", Strategy: "static", Upstreams: []string{"a", "b"}}, want: "must explicitly set default_upstream"},
 		{name: "default must be a member", route: RouteConfig{Name: "web", Strategy: "static", Upstreams: []string{"a", "b"}, DefaultUpstream: "missing"}, want: "is not in route upstreams"},
 		{name: "adaptive rejects default", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, DefaultUpstream: "a"}, want: "only valid for static"},
+		{name: "round robin needs two", route: RouteConfig{Name: "web", Strategy: "round_robin", Upstreams: []string{"a"}}, want: "at least two upstreams for round_robin"},
+		{name: "weights need weighted", route: RouteConfig{Name: "web", Strategy: "least_connections", Upstreams: []string{"a", "b"}, Weights: map[string]int{"a": 2}}, want: "weights is only valid for weighted"},
+		{name: "weights must be members", route: RouteConfig{Name: "web", Strategy: "weighted", Upstreams: []string{"a", "b"}, Weights: map[string]int{"c": 2}}, want: "weights references upstream c"},
+		{name: "weights must be positive", route: RouteConfig{Name: "web", Strategy: "weighted", Upstreams: []string{"a", "b"}, Weights: map[string]int{"a": 0}}, want: "weights[a] must be > 0"},
+		{name: "affinity mode", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Affinity: RouteAffinityConfig{Mode: "random"}}, want: "affinity.mode must be sticky or consistent_hash"},
+		{name: "affinity needs mode", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Affinity: RouteAffinityConfig{TTL: Duration(time.Minute)}}, want: "affinity.mode is required"},
+		{name: "affinity strategy", route: RouteConfig{Name: "web", Strategy: "round_robin", Upstreams: []string{"a", "b"}, Affinity: RouteAffinityConfig{Mode: "sticky"}}, want: "only valid for adaptive and weighted"},
+		{name: "affinity prefix", route: RouteConfig{Name: "web", Strategy: "weighted", Upstreams: []string{"a", "b"}, Affinity: RouteAffinityConfig{Mode: "sticky", IPv4Prefix: 33}}, want: "ipv4_prefix must be in 1..32"},
+		{name: "rule needs matcher", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, SelectionRules: []RouteSelectionRule{{Name: "cn", Upstreams: []string{"a"}}}}, want: "must match countries, asns, or cidrs"},
+		{name: "rule upstream membership", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, SelectionRules: []RouteSelectionRule{{Name: "cn", Countries: []string{"CN"}, Upstreams: []string{"c"}}}}, want: "references upstream c that is not in route upstreams"},
+		{name: "rule country code", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, SelectionRules: []RouteSelectionRule{{Name: "cn", Countries: []string{"China"}, Upstreams: []string{"a"}}}}, want: "alpha-2"},
+		{name: "rule cidr", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, SelectionRules: []RouteSelectionRule{{Name: "lan", CIDRs: []string{"10.0.0.0/33"}, Upstreams: []string{"a"}}}}, want: "invalid CIDR"},
+		{name: "rule on static", route: RouteConfig{Name: "web", Strategy: "static", Upstreams: []string{"a"}, SelectionRules: []RouteSelectionRule{{Name: "lan", CIDRs: []string{"10.0.0.0/8"}, Upstreams: []string{"a"}}}}, want: "not valid for static strategy"},
+		{name: "hedge delay needs enabled", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Hedge: RouteHedgeConfig{Delay: Duration(time.Millisecond)}}, want: "hedge.delay requires hedge.enabled"},
+		{name: "hedge strategy", route: RouteConfig{Name: "web", Strategy: "weighted", Upstreams: []string{"a", "b"}, Hedge: RouteHedgeConfig{Enabled: true}}, want: "hedge is only valid for adaptive"},
+		{name: "hedge affinity", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Affinity: RouteAffinityConfig{Mode: "sticky"}, Hedge: RouteHedgeConfig{Enabled: true}}, want: "hedge cannot be combined with affinity"},
+		{name: "hedge delay range", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Hedge: RouteHedgeConfig{Enabled: true, Delay: Duration(5 * time.Second)}}, want: "hedge.delay must be >= 0 and < 5s"},
+		{name: "prefer value", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Prefer: "loss"}, want: "prefer must be rtt, upload_delay or download_delay"},
+		{name: "prefer strategy", route: RouteConfig{Name: "web", Strategy: "weighted", Upstreams: []string{"a", "b"}, Prefer: "upload_delay"}, want: "prefer is only valid for adaptive"},
+		{name: "score strategy", route: RouteConfig{Name: "web", Strategy: "weighted", Upstreams: []string{"a", "b"}, Score: RouteScoreConfig{RTT: 1}}, want: "score and hysteresis are only valid for adaptive"},
+		{name: "hysteresis strategy", route: RouteConfig{Name: "web", Strategy: "round_robin", Upstreams: []string{"a", "b"}, Hysteresis: RouteHysteresisConfig{Margin: 0.1}}, want: "score and hysteresis are only valid for adaptive"},
+		{name: "score consistent hash", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Affinity: RouteAffinityConfig{Mode: "consistent_hash"}, Score: RouteScoreConfig{RTT: 1}}, want: "cannot be combined with consistent_hash"},
+		{name: "score weight", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Score: RouteScoreConfig{RTT: 1, Load: -1}}, want: "score weights must be >= 0"},
+		{name: "score prefer", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Prefer: "upload_delay", Score: RouteScoreConfig{RTT: 1}}, want: "score cannot be combined with prefer upload_delay"},
+		{name: "hysteresis margin", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Hysteresis: RouteHysteresisConfig{Margin: 1.5}}, want: "hysteresis.margin must be in 0..1"},
+		{name: "hysteresis dwell", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Hysteresis: RouteHysteresisConfig{Dwell: Duration(time.Hour)}}, want: "hysteresis.dwell must be in 0..10m0s"},
+		{name: "health static", route: RouteConfig{Name: "web", Strategy: "static", Upstreams: []string{"a"}, Health: RouteHealthConfig{FailureThreshold: 1}}, want: "health is not valid for static strategy"},
+		{name: "health threshold", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Health: RouteHealthConfig{RecoveryThreshold: -1}}, want: "health thresholds must be >= 0"},
+		{name: "health stale", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Health: RouteHealthConfig{StaleThreshold: Duration(-time.Second)}}, want: "health.stale_threshold must be >= 0"},
+		{name: "health alpha", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Health: RouteHealthConfig{RTTEWMAAlpha: 1.5}}, want: "health.rtt_ewma_alpha must be in 0..1"},
+		{name: "health protocol", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Health: RouteHealthConfig{Protocols: []string{"icmp"}}}, want: "health.protocols must be tcp or udp"},
+		{name: "failover single", route: RouteConfig{Name: "web", Strategy: "failover", Upstreams: []string{"a"}}, want: "at least two upstreams for failover strategy"},
+		{name: "failback adaptive", route: RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Failback: RouteFailbackConfig{Probes: 2}}, want: "failback is only valid for failover strategy"},
+		{name: "failback delay", route: RouteConfig{Name: "web", Strategy: "failover", Upstreams: []string{"a", "b"}, Failback: RouteFailbackConfig{Delay: Duration(-time.Second)}}, want: "failback.delay must be >= 0"},
+		{name: "failback probes", route: RouteConfig{Name: "web", Strategy: "failover", Upstreams: []string{"a", "b"}, Failback: RouteFailbackConfig{Probes: -1}}, want: "failback.probes must be >= 0"},
+		{name: "failover prefer", route: RouteConfig{Name: "web", Strategy: "failover", Upstreams: []string{"a", "b"}, Prefer: "upload_delay"}, want: "prefer is only valid for adaptive strategy"},
+		{name: "unknown strategy", route: RouteConfig{Name: "web", Strategy: "random", Upstreams: []string{"a", "b"}}, want: "strategy must be static, adaptive"},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			cfg := base(test.route)
@@ -71,6 +109,85 @@ func TestStaticRouteDefaultAndMultiUpstreamValidation(t *testing.T) {
 			}
 		})
 	}
+
+	cfg := base(RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Prefer: " Upload_Delay "})
+	if err := cfg.validate(); err != nil || cfg.Routes[0].Prefer != PreferUploadDelay || len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], "one_way") {
+		t.Fatalf("prefer = %q, warnings %v, %v", cfg.Routes[0].Prefer, cfg.Warnings, err)
+	}
+	cfg = base(RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Prefer: "download_delay"})
+	cfg.Measurement.Protocols.UDP.OneWay = true
+	if err := cfg.validate(); err != nil || len(cfg.Warnings) != 0 {
+		t.Fatalf("prefer with one_way: warnings %v, %v", cfg.Warnings, err)
+	}
+	cfg = base(RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Affinity: RouteAffinityConfig{Mode: "sticky"},
+		Score: RouteScoreConfig{RTT: 1, Load: 0.5}, Hysteresis: RouteHysteresisConfig{Margin: 0.1, Dwell: Duration(30 * time.Second)}})
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("score with hysteresis: %v", err)
+	}
+	cfg = base(RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"},
+		Health: RouteHealthConfig{FailureThreshold: 1, StaleThreshold: Duration(10 * time.Second), Protocols: []string{" UDP ", "udp"}}})
+	if err := cfg.validate(); err != nil || !reflect.DeepEqual(cfg.Routes[0].Health.Protocols, []string{"udp"}) {
+		t.Fatalf("health protocols = %v, %v", cfg.Routes[0].Health.Protocols, err)
+	}
+	cfg = base(RouteConfig{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Health: RouteHealthConfig{Protocols: []string{"udp"}}})
+	cfg.Upstreams[1].Measurement = UpstreamMeasurementConfig{Type: ProbeTCPConnect, Port: 443}
+	cfg.setDefaults()
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "must include tcp for upstream b") {
+		t.Fatalf("udp-only health with tcp_connect probe: %v", err)
+	}
+	cfg = base(RouteConfig{Name: "web", Strategy: " Failover ", Upstreams: []string{"a", "b"}, Failback: RouteFailbackConfig{Delay: Duration(time.Minute)}})
+	if err := cfg.validate(); err != nil || cfg.Routes[0].Strategy != "failover" || cfg.Routes[0].Failback.Probes != defaultFailbackProbes {
+		t.Fatalf("failback = %+v, %v", cfg.Routes[0].Failback, err)
+	}
+}
+
+func TestRouteAffinityDefaults(t *testing.T) {
+	cfg := Config{
+		Listeners: []ListenerSpec{{Name: "web", Bind: ":443", Protocol: "tcp", Route: "web"}},
+		Routes:    []RouteConfig{{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, Affinity: RouteAffinityConfig{Mode: " Sticky "}}},
+		Upstreams: []UpstreamConfig{
+			{Tag: "a", Destination: DestinationConfig{Host: "127.0.0.1"}, Measurement: UpstreamMeasurementConfig{Port: 9876}},
+			{Tag: "b", Destination: DestinationConfig{Host: "127.0.0.2"}, Measurement: UpstreamMeasurementConfig{Port: 9876}},
+		},
+	}
+	cfg.Forwarding.Limits = ForwardingLimitsConfig{MaxTCPConnections: 1, MaxUDPMappings: 1}
+	cfg.Forwarding.IdleTimeout = IdleTimeoutConfig{TCP: Duration(time.Second), UDP: Duration(time.Second)}
+	cfg.Control.AuthToken = "0123456789abcdef"
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := RouteAffinityConfig{Mode: "sticky", TTL: Duration(10 * time.Minute), IPv4Prefix: 32, IPv6Prefix: 64}
+	if got := cfg.Routes[0].Affinity; got != want {
+		t.Fatalf("unexpected affinity defaults: %+v", got)
+	}
+}
+
+func TestSelectionRulesNormalizeAndWarnWithoutGeoIP(t *testing.T) {
+	cfg := Config{
+		Listeners: []ListenerSpec{{Name: "web", Bind: ":443", Protocol: "tcp", Route: "web"}},
+		Routes: []RouteConfig{{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}, SelectionRules: []RouteSelectionRule{
+			{Name: " cn-to-hk ", Countries: []string{" cn "}, CIDRs: []string{"10.1.2.3/8"}, Upstreams: []string{" a "}},
+		}}},
+		Upstreams: []UpstreamConfig{
+			{Tag: "a", Destination: DestinationConfig{Host: "127.0.0.1"}, Measurement: UpstreamMeasurementConfig{Port: 9876}},
+			{Tag: "b", Destination: DestinationConfig{Host: "127.0.0.2"}, Measurement: UpstreamMeasurementConfig{Port: 9876}},
+		},
+	}
+	cfg.Forwarding.Limits = ForwardingLimitsConfig{MaxTCPConnections: 1, MaxUDPMappings: 1}
+	cfg.Forwarding.IdleTimeout = IdleTimeoutConfig{TCP: Duration(time.Second), UDP: Duration(time.Second)}
+	cfg.Control.AuthToken = "0123456789abcdef"
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	rule := cfg.Routes[0].SelectionRules[0]
+	if rule.Name != "cn-to-hk" || rule.Countries[0] != "CN" || rule.CIDRs[0] != "10.0.0.0/8" || rule.Upstreams[0] != "a" {
+		t.Fatalf("selection rule was not normalized: %+v", rule)
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], "geoip is disabled") {
+		t.Fatalf("expected geoip warning, got %#v", cfg.Warnings)
+	}
 }
 
 func TestModernTopologyValidationRules(t *testing.T) {
@@ -191,3 +308,307 @@ routes:
 		t.Fatalf("expected strict unknown-field error, got %v", err)
 	}
 }
+
+func TestRoutePortMappingValidation(t *testing.T) {
+	base := func(route RouteConfig, destinationPort int) Config {
+		cfg := Config{
+			Listeners: []ListenerSpec{{Name: "web", Bind: ":443", Protocol: "tcp", Route: "web"}},
+			Routes:    []RouteConfig{route},
+			Upstreams: []UpstreamConfig{{Tag: "local", Destination: DestinationConfig{Host: "127.0.0.1", Port: destinationPort}, Measurement: UpstreamMeasurementConfig{Port: 9876}}},
+		}
+		cfg.Forwarding.Limits = ForwardingLimitsConfig{MaxTCPConnections: 1, MaxUDPMappings: 1}
+		cfg.Forwarding.IdleTimeout = IdleTimeoutConfig{TCP: Duration(time.Second), UDP: Duration(time.Second)}
+		cfg.Control.AuthToken = "0123456789abcdef"
+		cfg.setDefaults()
+		return cfg
+	}
+	valid := base(RouteConfig{Name: "web", Strategy: "static", Upstreams: []string{"local"}, Ports: map[int]int{443: 8443}, PortOffset: 1000}, 9443)
+	if err := valid.validate(); err != nil {
+		t.Fatalf("expected port mapping to validate: %v", err)
+	}
+	tests := []struct {
+		name string
+		cfg  Config
+		want string
+	}{
+		{"destination port", base(RouteConfig{Name: "web", Strategy: "static", Upstreams: []string{"local"}}, 70000), "destination.port must be in 1..65535"},
+		{"mapped port", base(RouteConfig{Name: "web", Strategy: "static", Upstreams: []string{"local"}, Ports: map[int]int{443: 0}}, 0), "ports entries must map"},
+		{"offset range", base(RouteConfig{Name: "web", Strategy: "static", Upstreams: []string{"local"}, PortOffset: 65535}, 0), "port_offset moves listener port 443"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.cfg.validate(); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("expected %q, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestProxyProtocolValidation(t *testing.T) {
+	cfg := Config{
+		Listeners: []ListenerSpec{{Name: "web", Bind: ":443", Protocol: "tcp", Route: "web"}},
+		Routes:    []RouteConfig{{Name: "web", Strategy: "static", Upstreams: []string{"local"}, ProxyProtocol: " V2 "}},
+		Upstreams: []UpstreamConfig{{Tag: "local", Destination: DestinationConfig{Host: "127.0.0.1"}, Measurement: UpstreamMeasurementConfig{Port: 9876}, ProxyProtocol: "v1"}},
+	}
+	cfg.Forwarding.Limits = ForwardingLimitsConfig{MaxTCPConnections: 1, MaxUDPMappings: 1}
+	cfg.Forwarding.IdleTimeout = IdleTimeoutConfig{TCP: Duration(time.Second), UDP: Duration(time.Second)}
+	cfg.Control.AuthToken = "0123456789abcdef"
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Routes[0].ProxyProtocol != "v2" {
+		t.Fatalf("route proxy_protocol was not normalized: %q", cfg.Routes[0].ProxyProtocol)
+	}
+	cfg.Upstreams[0].ProxyProtocol = "v3"
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "proxy_protocol must be v1 or v2") {
+		t.Fatalf("expected proxy_protocol error, got %v", err)
+	}
+}
+
+func TestListenerProxyProtocolValidation(t *testing.T) {
+	cfg := Config{
+		Listeners: []ListenerSpec{{Name: "web", Bind: ":443", Protocol: "tcp", Route: "web", ProxyProtocol: ListenerProxyConfig{TrustedCIDRs: []string{" 10.0.0.0/8 ", "2001:db8::/32"}}}},
+		Routes:    []RouteConfig{{Name: "web", Strategy: "static", Upstreams: []string{"local"}}},
+		Upstreams: []UpstreamConfig{{Tag: "local", Destination: DestinationConfig{Host: "127.0.0.1"}, Measurement: UpstreamMeasurementConfig{Port: 9876}}},
+	}
+	cfg.Forwarding.Limits = ForwardingLimitsConfig{MaxTCPConnections: 1, MaxUDPMappings: 1}
+	cfg.Forwarding.IdleTimeout = IdleTimeoutConfig{TCP: Duration(time.Second), UDP: Duration(time.Second)}
+	cfg.Control.AuthToken = "0123456789abcdef"
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Forwarding.Listeners[0].ProxyProtocol.Prefixes(); len(got) != 2 || got[0].String() != "10.0.0.0/8" {
+		t.Fatalf("trusted prefixes = %v", got)
+	}
+	cfg.Forwarding.Listeners[0].ProxyProtocol.TrustedCIDRs = []string{"10.0.0.1"}
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "invalid CIDR") {
+		t.Fatalf("expected invalid CIDR error, got %v", err)
+	}
+	cfg.Forwarding.Listeners[0].ProxyProtocol.TrustedCIDRs = []string{"10.0.0.0/8"}
+	cfg.Forwarding.Listeners[0].Protocol = "udp"
+	if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), "only supported for tcp") {
+		t.Fatalf("expected tcp-only error, got %v", err)
+	}
+}
+
+func TestSRVUpstreamValidation(t *testing.T) {
+	base := func(strategy string, srv DestinationConfig) Config {
+		cfg := Config{
+			Listeners: []ListenerSpec{{Name: "web", Bind: ":443", Protocol: "tcp", Route: "web"}},
+			Routes:    []RouteConfig{{Name: "web", Strategy: strategy, Upstreams: []string{"app"}}},
+			Upstreams: []UpstreamConfig{{Tag: "app", Destination: srv, Measurement: UpstreamMeasurementConfig{Port: 9876}}},
+		}
+		cfg.Forwarding.Limits = ForwardingLimitsConfig{MaxTCPConnections: 1, MaxUDPMappings: 1}
+		cfg.Forwarding.IdleTimeout = IdleTimeoutConfig{TCP: Duration(time.Second), UDP: Duration(time.Second)}
+		cfg.Control.AuthToken = "0123456789abcdef"
+		cfg.setDefaults()
+		return cfg
+	}
+	cfg := base("adaptive", DestinationConfig{SRV: " _App._tcp.Example.test. "})
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Upstreams[0].Destination.SRV; got != "_app._tcp.example.test" {
+		t.Fatalf("srv name was not normalized: %q", got)
+	}
+	if cfg.Upstreams[0].Measurement.Host != "" {
+		t.Fatalf("srv upstream should measure each target, got host %q", cfg.Upstreams[0].Measurement.Host)
+	}
+	if got := cfg.DNS.SRV; got.MinRefresh.Duration() != 5*time.Second || got.MaxRefresh.Duration() != 5*time.Minute {
+		t.Fatalf("unexpected srv refresh defaults: %+v", got)
+	}
+
+	for _, test := range []struct {
+		name     string
+		strategy string
+		dest     DestinationConfig
+		mut      func(*Config)
+		want     string
+	}{
+		{name: "host conflict", strategy: "adaptive", dest: DestinationConfig{SRV: "_app._tcp.example.test", Host: "127.0.0.1"}, want: "cannot be combined with host or port"},
+		{name: "port conflict", strategy: "adaptive", dest: DestinationConfig{SRV: "_app._tcp.example.test", Port: 80}, want: "cannot be combined with host or port"},
+		{name: "invalid name", strategy: "adaptive", dest: DestinationConfig{SRV: "_app._tcp.example.test:53"}, want: "must be a DNS name"},
+		{name: "static route", strategy: "static", dest: DestinationConfig{SRV: "_app._tcp.example.test"}, want: "static strategy cannot use SRV upstream app"},
+		{name: "refresh order", strategy: "adaptive", dest: DestinationConfig{SRV: "_app._tcp.example.test"}, mut: func(cfg *Config) {
+			cfg.DNS.SRV.MaxRefresh = Duration(time.Second)
+		}, want: "dns.srv.max_refresh must be >= dns.srv.min_refresh"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := base(test.strategy, test.dest)
+			if test.mut != nil {
+				test.mut(&cfg)
+			}
+			if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("expected %q, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestApplyTopologyValidatesEditsOnACopy(t *testing.T) {
+	cfg := Config{
+		Listeners: []ListenerSpec{{Name: "web", Bind: ":443", Protocol: "tcp", Route: "web"}},
+		Routes:    []RouteConfig{{Name: "web", Strategy: "adaptive", Upstreams: []string{"a", "b"}}},
+		Upstreams: []UpstreamConfig{
+			{Tag: "a", Destination: DestinationConfig{Host: "127.0.0.1"}},
+			{Tag: "b", Destination: DestinationConfig{Host: "127.0.0.2"}},
+		},
+	}
+	cfg.Forwarding.Limits = ForwardingLimitsConfig{MaxTCPConnections: 1, MaxUDPMappings: 1}
+	cfg.Forwarding.IdleTimeout = IdleTimeoutConfig{TCP: Duration(time.Second), UDP: Duration(time.Second)}
+	cfg.Control.AuthToken = "0123456789abcdef"
+	cfg.setDefaults()
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := cfg.ApplyTopology(CreateUpstream(UpstreamConfig{Tag: " c ", Destination: DestinationConfig{Host: "127.0.0.3"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err = next.ApplyTopology(SetRouteUpstreams("web", []string{"a", "c"}, nil, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err = next.ApplyTopology(CreateListener(ListenerSpec{Name: "dns", Bind: "127.0.0.1:53", Protocol: "UDP", Route: "web"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next.Upstreams) != 3 || next.Upstreams[2].Measurement.Port != defaultMeasurePort || strings.Join(next.Routes[0].Upstreams, ",") != "a,c" {
+		t.Fatalf("unexpected edited topology: routes=%+v upstreams=%+v", next.Routes, next.Upstreams)
+	}
+	if len(next.Forwarding.Listeners) != 2 || next.Forwarding.Listeners[1].Protocol != "udp" {
+		t.Fatalf("created listener was not normalized: %+v", next.Forwarding.Listeners)
+	}
+	if len(cfg.Upstreams) != 2 || strings.Join(cfg.Routes[0].Upstreams, ",") != "a,b" || len(cfg.Listeners) != 1 {
+		t.Fatalf("ApplyTopology modified the original configuration: %+v", cfg.Routes)
+	}
+
+	for _, test := range []struct {
+		name   string
+		change TopologyChange
+		want   string
+	}{
+		{name: "duplicate upstream", change: CreateUpstream(UpstreamConfig{Tag: "a", Destination: DestinationConfig{Host: "127.0.0.9"}}), want: "upstream a already exists"},
+		{name: "invalid upstream", change: CreateUpstream(UpstreamConfig{Tag: "d"}), want: "destination.host"},
+		{name: "rename", change: PatchUpstream("a", func(up *UpstreamConfig) error { up.Tag = "z"; return nil }), want: "cannot be renamed"},
+		{name: "missing upstream", change: PatchUpstream("z", func(*UpstreamConfig) error { return nil }), want: "upstream z not found"},
+		{name: "referenced upstream", change: DeleteUpstream("a"), want: "used by route web"},
+		{name: "unknown route member", change: SetRouteUpstreams("web", []string{"a", "z"}, nil, ""), want: "unknown upstream z"},
+		{name: "missing route", change: SetRouteUpstreams("api", []string{"a", "b"}, nil, ""), want: "route api not found"},
+		{name: "listener route", change: CreateListener(ListenerSpec{Name: "api", Bind: ":8443", Protocol: "tcp", Route: "api"}), want: "references unknown route api"},
+		{name: "last listener", change: DeleteListener("web"), want: "is the last listener"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := cfg.ApplyTopology(test.change); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("expected %q, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestWriteTopologyKeepsOtherSectionsAndConvertsLegacyListeners(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	raw := `forwarding:
+  listeners:
+    - {bind_addr: 127.0.0.1, bind_port: 9000, protocol: tcp}
+  limits:
+    max_tcp_connections: 7 # tuned
+upstreams:
+  - tag: local
+    destination: {host: 127.0.0.1}
+control:
+  auth_token: 0123456789abcdef
+`
+	if err := os.WriteFile(path, []byte(raw), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := cfg.ApplyTopology(CreateUpstream(UpstreamConfig{Tag: "backup", Destination: DestinationConfig{Host: "127.0.0.2"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next.Routes[0].Affinity = RouteAffinityConfig{Mode: "sticky", TTL: Duration(90 * time.Second)}
+	if err := WriteTopology(path, next); err == nil || !strings.Contains(err.Error(), "only valid for adaptive and weighted") {
+		t.Fatalf("expected an invalid rewrite to be refused, got %v", err)
+	}
+	next.Routes[0].Affinity = RouteAffinityConfig{}
+	if err := WriteTopology(path, next); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "# tuned") || strings.Contains(string(written), "bind_port") {
+		t.Fatalf("unexpected rewritten configuration:\n%s", written)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o640 {
+		t.Fatalf("file mode was not kept: %v %v", info, err)
+	}
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Upstreams) != 2 || loaded.Forwarding.Limits.MaxTCPConnections != 7 || len(loaded.Warnings) != 0 || loaded.Listeners[0].Bind != "127.0.0.1:9000" {
+		t.Fatalf("rewritten configuration did not load back: %+v", loaded)
+	}
+}
+
+func TestUpstreamProbeTypeValidation(t *testing.T) {
+	newConfig := func(up UpstreamConfig) Config {
+		cfg := Config{
+			Listeners: []ListenerSpec{{Name: "web", Bind: ":443", Protocol: "tcp", Route: "web"}},
+			Routes:    []RouteConfig{{Name: "web", Strategy: "static", Upstreams: []string{up.Tag}}},
+			Upstreams: []UpstreamConfig{up},
+		}
+		cfg.Forwarding.Limits = ForwardingLimitsConfig{MaxTCPConnections: 1, MaxUDPMappings: 1}
+		cfg.Forwarding.IdleTimeout = IdleTimeoutConfig{TCP: Duration(time.Second), UDP: Duration(time.Second)}
+		cfg.Control.AuthToken = "0123456789abcdef"
+		cfg.setDefaults()
+		return cfg
+	}
+
+	cfg := newConfig(UpstreamConfig{Tag: "web", Destination: DestinationConfig{Host: "example.com"}, Measurement: UpstreamMeasurementConfig{Type: " HTTP ", HTTP: HTTPProbeConfig{TLS: true}}})
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if m := cfg.Upstreams[0].Measurement; m.Type != ProbeHTTP || m.Port != 0 || m.HTTP.Path != "/" || m.HTTP.ExpectStatus != 200 {
+		t.Fatalf("http probe defaults = %+v", m)
+	}
+	cfg = newConfig(UpstreamConfig{Tag: "keyed", Destination: DestinationConfig{Host: "127.0.0.1"}, Measurement: UpstreamMeasurementConfig{KeyFile: " /etc/fbforward/measure.key "}})
+	if err := cfg.validate(); err != nil || cfg.Upstreams[0].Measurement.KeyFile != "/etc/fbforward/measure.key" {
+		t.Fatalf("key_file = %q, %v", cfg.Upstreams[0].Measurement.KeyFile, err)
+	}
+	cfg = newConfig(UpstreamConfig{Tag: "plain", Destination: DestinationConfig{Host: "127.0.0.1"}})
+	if err := cfg.validate(); err != nil || cfg.Upstreams[0].Measurement.Type != ProbeFBMeasure || cfg.Upstreams[0].Measurement.Port != defaultMeasurePort {
+		t.Fatalf("fbmeasure defaults = %+v, %v", cfg.Upstreams[0].Measurement, err)
+	}
+
+	tests := []struct {
+		name string
+		up   UpstreamConfig
+		want string
+	}{
+		{"unknown type", UpstreamConfig{Tag: "a", Destination: DestinationConfig{Host: "127.0.0.1"}, Measurement: UpstreamMeasurementConfig{Type: "icmp"}}, "measurement.type must be"},
+		{"tcp_connect without port", UpstreamConfig{Tag: "a", Destination: DestinationConfig{Host: "127.0.0.1"}, Measurement: UpstreamMeasurementConfig{Type: "tcp_connect"}}, "needs measurement.port or destination.port"},
+		{"http fields on tcp_connect", UpstreamConfig{Tag: "a", Destination: DestinationConfig{Host: "127.0.0.1", Port: 443}, Measurement: UpstreamMeasurementConfig{Type: "tcp_connect", HTTP: HTTPProbeConfig{Path: "/"}}}, "requires type http"},
+		{"relative path", UpstreamConfig{Tag: "a", Destination: DestinationConfig{Host: "127.0.0.1"}, Measurement: UpstreamMeasurementConfig{Type: "http", HTTP: HTTPProbeConfig{Path: "healthz"}}}, "path must start with /"},
+		{"bad status", UpstreamConfig{Tag: "a", Destination: DestinationConfig{Host: "127.0.0.1"}, Measurement: UpstreamMeasurementConfig{Type: "http", HTTP: HTTPProbeConfig{ExpectStatus: 42}}}, "expect_status"},
+		{"key file on http", UpstreamConfig{Tag: "a", Destination: DestinationConfig{Host: "127.0.0.1"}, Measurement: UpstreamMeasurementConfig{Type: "http", KeyFile: "/etc/fbforward/measure.key"}}, "key_file requires type fbmeasure"},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg := newConfig(testCase.up)
+			if err := cfg.validate(); err == nil || !strings.Contains(err.Error(), testCase.want) {
+				t.Fatalf("validate() error = %v, want %q", err, testCase.want)
+			}
+		})
+	}
+}
@@ -65,16 +65,18 @@ type queryLogEventsParams struct {
 }
 
 type ipLogStatusResponse struct {
-	DBPath               string `json:"db_path"`
-	FileSize             int64  `json:"file_size"`
-	RecordCount          int    `json:"record_count"`
-	FlowRecordCount      int    `json:"flow_record_count"`
-	RejectionRecordCount int    `json:"rejection_record_count"`
-	TotalRecordCount     int    `json:"total_record_count"`
-	OldestRecordAt       int64  `json:"oldest_record_at"`
-	NewestRecordAt       int64  `json:"newest_record_at"`
-	Retention            string `json:"retention"`
-	PruneInterval        string `json:"prune_interval"`
+	DBPath                 string `json:"db_path"`
+	FileSize               int64  `json:"file_size"`
+	RecordCount            int    `json:"record_count"`
+	FlowRecordCount        int    `json:"flow_record_count"`
+	RejectionRecordCount   int    `json:"rejection_record_count"`
+	MeasurementRecordCount int    `json:"measurement_record_count"`
+	TotalRecordCount       int    `json:"total_record_count"`
+	OldestRecordAt         int64  `json:"oldest_record_at"`
+	NewestRecordAt         int64  `json:"newest_record_at"`
+	Retention              string `json:"retention"`
+	MeasurementRetention   string `json:"measurement_retention"`
+	PruneInterval          string `json:"prune_interval"`
 }
 
 func (c *ControlServer) auditDB() *audit.Store {
@@ -199,16 +201,18 @@ func (c *ControlServer) getIPLogStatus(store *audit.Store) (ipLogStatusResponse,
 		return ipLogStatusResponse{}, err
 	}
 	return ipLogStatusResponse{
-		DBPath:               c.fullCfg.IPLog.DBPath,
-		FileSize:             dbFileSize(c.fullCfg.IPLog.DBPath),
-		RecordCount:          stats.TotalRecordCount,
-		FlowRecordCount:      stats.FlowRecordCount,
-		RejectionRecordCount: stats.RejectionRecordCount,
-		TotalRecordCount:     stats.TotalRecordCount,
-		OldestRecordAt:       stats.OldestRecordAt,
-		NewestRecordAt:       stats.NewestRecordAt,
-		Retention:            c.fullCfg.IPLog.Retention.Duration().String(),
-		PruneInterval:        c.fullCfg.IPLog.PruneInterval.Duration().String(),
+		DBPath:                 c.runtimeConfig().IPLog.DBPath,
+		FileSize:               dbFileSize(c.runtimeConfig().IPLog.DBPath),
+		RecordCount:            stats.TotalRecordCount,
+		FlowRecordCount:        stats.FlowRecordCount,
+		RejectionRecordCount:   stats.RejectionRecordCount,
+		MeasurementRecordCount: stats.MeasurementRecordCount,
+		TotalRecordCount:       stats.TotalRecordCount,
+		OldestRecordAt:         stats.OldestRecordAt,
+		NewestRecordAt:         stats.NewestRecordAt,
+		Retention:              c.runtimeConfig().IPLog.Retention.Duration().String(),
+		MeasurementRetention:   c.runtimeConfig().IPLog.MeasurementRetention.Duration().String(),
+		PruneInterval:          c.runtimeConfig().IPLog.PruneInterval.Duration().String(),
 	}, nil
 }
 
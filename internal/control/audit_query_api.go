@@ -55,6 +55,43 @@ func (c *ControlServer) rpcGetTopASNs(_ *rpcContext, raw json.RawMessage) (any,
 	return rpcOK(result)
 }
 
+type queryMeasurementsParams struct {
+	StartTime *int64 `json:"start_time,omitempty"`
+	EndTime   *int64 `json:"end_time,omitempty"`
+	Upstream  string `json:"upstream,omitempty"`
+	Protocol  string `json:"protocol,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	SortOrder string `json:"sort_order,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+	Offset    int    `json:"offset,omitempty"`
+}
+
+func (c *ControlServer) rpcQueryMeasurements(_ *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	store := c.auditDB()
+	if store == nil {
+		return rpcError(http.StatusServiceUnavailable, "ip log store not available")
+	}
+	var params queryMeasurementsParams
+	if fault := decodeOptionalParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	var bucket time.Duration
+	if params.Bucket != "" {
+		var err error
+		if bucket, err = time.ParseDuration(params.Bucket); err != nil || bucket <= 0 {
+			return rpcError(http.StatusBadRequest, "bucket must be a positive duration")
+		}
+	}
+	result, err := store.QueryMeasurements(audit.MeasurementQueryParams{
+		StartTime: params.StartTime, EndTime: params.EndTime, Upstream: params.Upstream, Protocol: params.Protocol,
+		Bucket: bucket, SortOrder: params.SortOrder, Limit: params.Limit, Offset: params.Offset,
+	})
+	if err != nil {
+		return rpcError(http.StatusBadRequest, err.Error())
+	}
+	return rpcOK(result)
+}
+
 func decodeAuditQuery(raw json.RawMessage) (queryAuditParams, *rpcFault) {
 	if len(raw) == 0 || string(raw) == "null" {
 		return queryAuditParams{}, &rpcFault{Status: http.StatusBadRequest, Message: "invalid params"}
@@ -82,6 +119,20 @@ func (c *ControlServer) rpcQueryAudit(_ *rpcContext, raw json.RawMessage) (any,
 		return rpcError(http.StatusBadRequest, err.Error())
 	}
 	now := time.Now().UTC()
+	if query.Source == auditdsl.SourceMeasurements {
+		start, end, err := auditQueryTimes(query, now)
+		if err != nil {
+			return rpcError(http.StatusBadRequest, err.Error())
+		}
+		result, err := store.QueryMeasurements(audit.MeasurementQueryParams{
+			StartTime: start, EndTime: end, Upstream: query.Filters["upstream"], Protocol: query.Filters["protocol"],
+			Bucket: query.Bucket(), SortOrder: query.SortOrder, Limit: query.Limit, Offset: query.Offset,
+		})
+		if err != nil {
+			return rpcError(http.StatusBadRequest, err.Error())
+		}
+		return rpcOK(auditQueryResponse{Query: params.Query, Source: string(query.Source), Result: result})
+	}
 	if query.Source == auditdsl.SourceTopClients || query.Source == auditdsl.SourceTopASNs || query.Source == auditdsl.SourceTopTags {
 		start, end, err := auditQueryTimes(query, now)
 		if err != nil {
@@ -150,3 +150,57 @@ func TestQueryAuditFlowRecordsIncludeCurrentTags(t *testing.T) {
 		t.Fatalf("audit tags = %#v", records)
 	}
 }
+
+func TestQueryMeasurementsAndMeasurementsSource(t *testing.T) {
+	server := newTestControlServer(t)
+	store := newTestAuditStore(t, server)
+	now := time.Now().UTC().Truncate(time.Minute)
+	if err := store.InsertMeasurements([]audit.MeasurementRecord{
+		{Upstream: "primary", Protocol: "tcp", RecordedAt: now, Duration: time.Second, Success: true, RTTMs: 10},
+		{Upstream: "primary", Protocol: "tcp", RecordedAt: now.Add(time.Second), Duration: time.Second, Success: true, RTTMs: 30},
+		{Upstream: "backup", Protocol: "udp", RecordedAt: now, Duration: time.Second, Error: "timeout"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	rec := callTestRPC(t, server, "0123456789abcdef", "QueryMeasurements", map[string]any{
+		"upstream": "primary", "bucket": "1m",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("QueryMeasurements status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var response rpcResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	buckets := response.Result.(map[string]any)["buckets"].([]any)
+	if len(buckets) != 1 || buckets[0].(map[string]any)["rtt_avg_ms"].(float64) != 20 {
+		t.Fatalf("unexpected buckets: %#v", buckets)
+	}
+
+	rec = callTestRPC(t, server, "0123456789abcdef", "QueryAudit", map[string]any{
+		"query": "measurements protocol=udp bucket=5m",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("QueryAudit status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	result := response.Result.(map[string]any)["result"].(map[string]any)
+	buckets = result["buckets"].([]any)
+	if len(buckets) != 1 || int(buckets[0].(map[string]any)["failures"].(float64)) != 1 {
+		t.Fatalf("unexpected measurements source result: %#v", result)
+	}
+
+	for _, params := range []map[string]any{
+		{"bucket": "-1m"},
+		{"bucket": "1500ms"},
+		{"protocol": "icmp"},
+		{"sort_order": "sideways"},
+	} {
+		rec := callTestRPC(t, server, "0123456789abcdef", "QueryMeasurements", params)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("QueryMeasurements(%v) status=%d body=%s", params, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/upstream"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// drainController starts and stops maintenance drains on the running
+// runtime.
+type drainController interface {
+	DrainUpstream(tag string, deadline time.Duration) (upstream.DrainStatus, error)
+	UndrainUpstream(tag string) error
+	Drains() []upstream.DrainStatus
+}
+
+type drainUpstreamParams struct {
+	Tag             string `json:"tag"`
+	DeadlineSeconds int64  `json:"deadline_seconds,omitempty"`
+}
+
+type undrainUpstreamParams struct {
+	Tag string `json:"tag"`
+}
+
+// drainProgress is a drain together with the Flows still forwarded to the
+// upstream or its SRV members.
+type drainProgress struct {
+	upstream.DrainStatus
+	TCPFlows  int    `json:"tcp_flows"`
+	UDPFlows  int    `json:"udp_flows"`
+	BytesUp   uint64 `json:"bytes_up"`
+	BytesDown uint64 `json:"bytes_down"`
+}
+
+func (c *ControlServer) rpcDrainUpstream(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params drainUpstreamParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	if c.drains == nil {
+		return rpcError(http.StatusServiceUnavailable, "upstream drain not available")
+	}
+	tag := strings.TrimSpace(params.Tag)
+	if tag == "" {
+		return rpcError(http.StatusBadRequest, "tag is required")
+	}
+	if params.DeadlineSeconds < 0 {
+		return rpcError(http.StatusBadRequest, "deadline_seconds must not be negative")
+	}
+	status, err := c.drains.DrainUpstream(tag, time.Duration(params.DeadlineSeconds)*time.Second)
+	if err != nil {
+		if errors.Is(err, upstream.ErrUnknownUpstream) {
+			return rpcError(http.StatusNotFound, err.Error())
+		}
+		return rpcError(http.StatusBadRequest, err.Error())
+	}
+	util.Event(c.logger, slogLevelInfo(), "control.rpc.drain_started", "request.id", ctx.Meta.id, "upstream", tag, "drain.deadline_seconds", params.DeadlineSeconds)
+	return rpcOK(c.progress(status))
+}
+
+func (c *ControlServer) rpcUndrainUpstream(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params undrainUpstreamParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	if c.drains == nil {
+		return rpcError(http.StatusServiceUnavailable, "upstream drain not available")
+	}
+	tag := strings.TrimSpace(params.Tag)
+	if err := c.drains.UndrainUpstream(tag); err != nil {
+		if errors.Is(err, upstream.ErrNotDraining) {
+			return rpcError(http.StatusNotFound, err.Error())
+		}
+		return rpcError(http.StatusBadRequest, err.Error())
+	}
+	util.Event(c.logger, slogLevelInfo(), "control.rpc.drain_stopped", "request.id", ctx.Meta.id, "upstream", tag)
+	return rpcOK(nil)
+}
+
+// drainProgress reports every drain with its remaining Flows and their bytes.
+func (c *ControlServer) drainProgress() []drainProgress {
+	if c.drains == nil {
+		return nil
+	}
+	drains := c.drains.Drains()
+	if len(drains) == 0 {
+		return nil
+	}
+	out := make([]drainProgress, 0, len(drains))
+	for _, status := range drains {
+		out = append(out, c.progress(status))
+	}
+	return out
+}
+
+func (c *ControlServer) progress(status upstream.DrainStatus) drainProgress {
+	progress := drainProgress{DrainStatus: status}
+	if c.status == nil {
+		return progress
+	}
+	tcp, udp := c.status.Snapshot()
+	for _, entry := range append(tcp, udp...) {
+		if entry.Upstream != status.Upstream && !strings.HasPrefix(entry.Upstream, status.Upstream+"/") {
+			continue
+		}
+		if entry.Kind == "udp" {
+			progress.UDPFlows++
+		} else {
+			progress.TCPFlows++
+		}
+		progress.BytesUp += entry.BytesUp
+		progress.BytesDown += entry.BytesDown
+	}
+	return progress
+}
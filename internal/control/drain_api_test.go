@@ -0,0 +1,69 @@
+package control
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/flow"
+	"github.com/NodePath81/fbforward/internal/upstream"
+)
+
+type managerDrains struct {
+	manager  *upstream.UpstreamManager
+	deadline time.Duration
+}
+
+func (d *managerDrains) DrainUpstream(tag string, deadline time.Duration) (upstream.DrainStatus, error) {
+	d.deadline = deadline
+	return d.manager.StartDrain(tag, time.Time{})
+}
+
+func (d *managerDrains) UndrainUpstream(tag string) error {
+	if !d.manager.StopDrain(tag) {
+		return upstream.ErrNotDraining
+	}
+	return nil
+}
+
+func (d *managerDrains) Drains() []upstream.DrainStatus { return d.manager.Drains() }
+
+func TestDrainUpstreamReportsRemainingFlowsInStatus(t *testing.T) {
+	server := newTestControlServer(t)
+	call := func(method string, params any) (int, string) {
+		rec := callTestRPC(t, server, "0123456789abcdef", method, params)
+		return rec.Code, rec.Body.String()
+	}
+	if code, body := call("DrainUpstream", map[string]any{"tag": "a"}); code != http.StatusServiceUnavailable {
+		t.Fatalf("DrainUpstream without a controller = %d %s", code, body)
+	}
+	drains := &managerDrains{manager: upstream.NewUpstreamManager([]*upstream.Upstream{{Tag: "a"}, {Tag: "b"}}, nil)}
+	server.SetDrainController(drains)
+	id, err := flow.NewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.status.Open(flow.Meta{ID: id, Protocol: flow.ProtocolUDP, ClientAddr: netip.MustParseAddrPort("192.0.2.10:40000"), Upstream: "a"})
+
+	if code, body := call("DrainUpstream", map[string]any{"tag": "missing"}); code != http.StatusNotFound {
+		t.Fatalf("DrainUpstream on a missing tag = %d %s", code, body)
+	}
+	if code, body := call("DrainUpstream", map[string]any{"tag": "a", "deadline_seconds": -1}); code != http.StatusBadRequest {
+		t.Fatalf("DrainUpstream with a negative deadline = %d %s", code, body)
+	}
+	code, body := call("DrainUpstream", map[string]any{"tag": "a", "deadline_seconds": 30})
+	if code != http.StatusOK || !strings.Contains(body, `"upstream":"a"`) || !strings.Contains(body, `"udp_flows":1`) || drains.deadline != 30*time.Second {
+		t.Fatalf("DrainUpstream = %d %s deadline=%s", code, body, drains.deadline)
+	}
+	if code, body := call("GetStatus", nil); code != http.StatusOK || !strings.Contains(body, `"drains":[{"upstream":"a"`) || !strings.Contains(body, `"tcp_flows":0,"udp_flows":1`) {
+		t.Fatalf("GetStatus = %d %s", code, body)
+	}
+	if code, body := call("UndrainUpstream", map[string]any{"tag": "a"}); code != http.StatusOK {
+		t.Fatalf("UndrainUpstream = %d %s", code, body)
+	}
+	if code, body := call("UndrainUpstream", map[string]any{"tag": "a"}); code != http.StatusNotFound {
+		t.Fatalf("UndrainUpstream twice = %d %s", code, body)
+	}
+}
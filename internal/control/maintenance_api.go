@@ -0,0 +1,150 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/audit"
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/upstream"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// ErrMaintenanceStoreUnavailable is returned when a maintenance window is
+// created or deleted without the SQLite store.
+var ErrMaintenanceStoreUnavailable = errors.New("maintenance windows need ip_log to be enabled")
+
+// ErrConfiguredMaintenanceWindow is returned when a window from the
+// configuration file is deleted through the API.
+var ErrConfiguredMaintenanceWindow = errors.New("maintenance window is defined in the configuration file")
+
+// maintenanceController manages the maintenance windows of the running
+// runtime.
+type maintenanceController interface {
+	MaintenanceWindows() []MaintenanceWindowStatus
+	CreateMaintenanceWindow(upstream string, window config.MaintenanceWindowConfig, createdBy string) (MaintenanceWindowStatus, error)
+	DeleteMaintenanceWindow(id string) error
+}
+
+// MaintenanceWindowStatus is a maintenance window with its current state.
+// Source is "config" for windows from the configuration file and "api" for
+// windows stored in SQLite.
+type MaintenanceWindowStatus struct {
+	ID                string     `json:"id"`
+	Upstream          string     `json:"upstream"`
+	Source            string     `json:"source"`
+	Name              string     `json:"name,omitempty"`
+	Start             string     `json:"start,omitempty"`
+	End               string     `json:"end,omitempty"`
+	Weekdays          []string   `json:"weekdays,omitempty"`
+	At                string     `json:"at,omitempty"`
+	DurationSeconds   int64      `json:"duration_seconds,omitempty"`
+	Timezone          string     `json:"timezone,omitempty"`
+	CloseAfterSeconds int64      `json:"close_after_seconds,omitempty"`
+	Active            bool       `json:"active"`
+	ActiveUntil       *time.Time `json:"active_until,omitempty"`
+	NextStart         *time.Time `json:"next_start,omitempty"`
+	CreatedBy         string     `json:"created_by,omitempty"`
+	CreatedAt         *time.Time `json:"created_at,omitempty"`
+}
+
+// NewMaintenanceWindowStatus describes window as of now.
+func NewMaintenanceWindowStatus(id, tag, source string, window config.MaintenanceWindowConfig, now time.Time) MaintenanceWindowStatus {
+	status := MaintenanceWindowStatus{
+		ID: id, Upstream: tag, Source: source, Name: window.Name,
+		Start: window.Start, End: window.End, Weekdays: window.Weekdays, At: window.At,
+		DurationSeconds: int64(window.Duration.Duration() / time.Second), Timezone: window.Timezone,
+		CloseAfterSeconds: int64(window.CloseAfter.Duration() / time.Second),
+	}
+	if _, end, ok := window.ActiveAt(now); ok {
+		status.Active, status.ActiveUntil = true, &end
+	}
+	if next, ok := window.NextStart(now); ok {
+		status.NextStart = &next
+	}
+	return status
+}
+
+type createMaintenanceWindowParams struct {
+	Upstream          string   `json:"upstream"`
+	Name              string   `json:"name,omitempty"`
+	Start             string   `json:"start,omitempty"`
+	End               string   `json:"end,omitempty"`
+	Weekdays          []string `json:"weekdays,omitempty"`
+	At                string   `json:"at,omitempty"`
+	DurationSeconds   int64    `json:"duration_seconds,omitempty"`
+	Timezone          string   `json:"timezone,omitempty"`
+	CloseAfterSeconds int64    `json:"close_after_seconds,omitempty"`
+}
+
+type maintenanceWindowIDParams struct {
+	ID string `json:"id"`
+}
+
+func (c *ControlServer) rpcListMaintenanceWindows(_ *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	if fault := decodeOptionalParams(raw, &struct{}{}); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	if c.maintenance == nil {
+		return rpcError(http.StatusServiceUnavailable, "maintenance windows not available")
+	}
+	return rpcOK(map[string]any{"windows": c.maintenance.MaintenanceWindows()})
+}
+
+func (c *ControlServer) rpcCreateMaintenanceWindow(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params createMaintenanceWindowParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	if c.maintenance == nil {
+		return rpcError(http.StatusServiceUnavailable, "maintenance windows not available")
+	}
+	window := config.MaintenanceWindowConfig{
+		Name: params.Name, Start: params.Start, End: params.End, Weekdays: params.Weekdays, At: params.At,
+		Duration: config.Duration(time.Duration(params.DurationSeconds) * time.Second), Timezone: params.Timezone,
+		CloseAfter: config.Duration(time.Duration(params.CloseAfterSeconds) * time.Second),
+	}
+	createdBy := "control"
+	if ctx.Meta.clientIP != "" {
+		createdBy += ":" + ctx.Meta.clientIP
+	}
+	tag := strings.TrimSpace(params.Upstream)
+	status, err := c.maintenance.CreateMaintenanceWindow(tag, window, createdBy)
+	if err != nil {
+		util.Event(c.logger, slogLevelWarn(), "control.rpc.maintenance_window_created", "request.id", ctx.Meta.id, "upstream", tag, "result", "failed", "error", err)
+		return rpcError(maintenanceErrorStatus(err), err.Error())
+	}
+	util.Event(c.logger, slogLevelInfo(), "control.rpc.maintenance_window_created", "request.id", ctx.Meta.id, "upstream", tag, "maintenance.window", status.ID, "result", "success")
+	return rpcOK(status)
+}
+
+func (c *ControlServer) rpcDeleteMaintenanceWindow(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params maintenanceWindowIDParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	if c.maintenance == nil {
+		return rpcError(http.StatusServiceUnavailable, "maintenance windows not available")
+	}
+	id := strings.TrimSpace(params.ID)
+	if err := c.maintenance.DeleteMaintenanceWindow(id); err != nil {
+		return rpcError(maintenanceErrorStatus(err), err.Error())
+	}
+	util.Event(c.logger, slogLevelInfo(), "control.rpc.maintenance_window_deleted", "request.id", ctx.Meta.id, "maintenance.window", id)
+	return rpcOK(nil)
+}
+
+func maintenanceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrMaintenanceStoreUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, upstream.ErrUnknownUpstream), errors.Is(err, audit.ErrMaintenanceWindowNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConfiguredMaintenanceWindow):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,81 @@
+package control
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/audit"
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/upstream"
+)
+
+type fakeMaintenance struct {
+	windows   []MaintenanceWindowStatus
+	createdBy string
+}
+
+func (f *fakeMaintenance) MaintenanceWindows() []MaintenanceWindowStatus { return f.windows }
+
+func (f *fakeMaintenance) CreateMaintenanceWindow(tag string, window config.MaintenanceWindowConfig, createdBy string) (MaintenanceWindowStatus, error) {
+	if tag != "a" {
+		return MaintenanceWindowStatus{}, upstream.ErrUnknownUpstream
+	}
+	if err := window.Validate(); err != nil {
+		return MaintenanceWindowStatus{}, err
+	}
+	f.createdBy = createdBy
+	status := NewMaintenanceWindowStatus("w1", tag, "api", window, time.Now())
+	f.windows = append(f.windows, status)
+	return status, nil
+}
+
+func (f *fakeMaintenance) DeleteMaintenanceWindow(id string) error {
+	if strings.HasPrefix(id, "config:") {
+		return ErrConfiguredMaintenanceWindow
+	}
+	if len(f.windows) == 0 || f.windows[0].ID != id {
+		return audit.ErrMaintenanceWindowNotFound
+	}
+	f.windows = nil
+	return nil
+}
+
+func TestMaintenanceWindowRPCs(t *testing.T) {
+	server := newTestControlServer(t)
+	call := func(method string, params any) (int, string) {
+		rec := callTestRPC(t, server, "0123456789abcdef", method, params)
+		return rec.Code, rec.Body.String()
+	}
+	if code, body := call("ListMaintenanceWindows", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("ListMaintenanceWindows without a controller = %d %s", code, body)
+	}
+	maintenance := &fakeMaintenance{}
+	server.SetMaintenanceController(maintenance)
+
+	params := map[string]any{"upstream": "a", "weekdays": []string{"Sunday"}, "at": "02:00", "duration_seconds": 3600, "close_after_seconds": 1800}
+	code, body := call("CreateMaintenanceWindow", params)
+	if code != http.StatusOK || !strings.Contains(body, `"weekdays":["sun"]`) || !strings.Contains(body, `"close_after_seconds":1800`) || !strings.HasPrefix(maintenance.createdBy, "control") {
+		t.Fatalf("CreateMaintenanceWindow = %d %s created_by=%q", code, body, maintenance.createdBy)
+	}
+	params["upstream"] = "missing"
+	if code, body := call("CreateMaintenanceWindow", params); code != http.StatusNotFound {
+		t.Fatalf("CreateMaintenanceWindow on a missing upstream = %d %s", code, body)
+	}
+	if code, body := call("CreateMaintenanceWindow", map[string]any{"upstream": "a", "at": "02:00"}); code != http.StatusBadRequest {
+		t.Fatalf("CreateMaintenanceWindow without a duration = %d %s", code, body)
+	}
+	if code, body := call("ListMaintenanceWindows", nil); code != http.StatusOK || !strings.Contains(body, `"id":"w1"`) || !strings.Contains(body, `"next_start"`) {
+		t.Fatalf("ListMaintenanceWindows = %d %s", code, body)
+	}
+	if code, body := call("DeleteMaintenanceWindow", map[string]any{"id": "config:a:0"}); code != http.StatusConflict {
+		t.Fatalf("DeleteMaintenanceWindow on a configured window = %d %s", code, body)
+	}
+	if code, body := call("DeleteMaintenanceWindow", map[string]any{"id": "w1"}); code != http.StatusOK {
+		t.Fatalf("DeleteMaintenanceWindow = %d %s", code, body)
+	}
+	if code, body := call("DeleteMaintenanceWindow", map[string]any{"id": "w1"}); code != http.StatusNotFound {
+		t.Fatalf("DeleteMaintenanceWindow twice = %d %s", code, body)
+	}
+}
@@ -12,6 +12,8 @@ type routeStateReader interface {
 	RouteStatus() []upstream.RouteStatus
 	SetRouteOverride(route, tag string) error
 	ClearRouteOverride(route string) error
+	RouteAffinity(route string) ([]upstream.AffinityEntry, error)
+	ClearRouteAffinity(route, client string) (int, error)
 }
 
 type routeOverrideParams struct {
@@ -23,6 +25,11 @@ type routeNameParams struct {
 	Route string `json:"route"`
 }
 
+type routeAffinityParams struct {
+	Route  string `json:"route"`
+	Client string `json:"client,omitempty"`
+}
+
 func (c *ControlServer) rpcGetRouteStatus(_ *rpcContext, raw json.RawMessage) (any, *rpcFault) {
 	if fault := decodeOptionalParams(raw, &struct{}{}); fault != nil {
 		return rpcError(fault.Status, fault.Message)
@@ -65,3 +72,37 @@ func (c *ControlServer) rpcClearRouteOverride(_ *rpcContext, raw json.RawMessage
 	}
 	return rpcOK(nil)
 }
+
+func (c *ControlServer) rpcGetRouteAffinity(_ *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params routeNameParams
+	if fault := decodeOptionalParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	if c.routes == nil {
+		return rpcError(http.StatusServiceUnavailable, "route selector unavailable")
+	}
+	entries, err := c.routes.RouteAffinity(strings.TrimSpace(params.Route))
+	if err != nil {
+		return rpcError(http.StatusNotFound, err.Error())
+	}
+	return rpcOK(map[string]any{"entries": entries})
+}
+
+func (c *ControlServer) rpcClearRouteAffinity(_ *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params routeAffinityParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	if c.routes == nil {
+		return rpcError(http.StatusServiceUnavailable, "route selector unavailable")
+	}
+	cleared, err := c.routes.ClearRouteAffinity(strings.TrimSpace(params.Route), strings.TrimSpace(params.Client))
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		return rpcError(status, err.Error())
+	}
+	return rpcOK(map[string]any{"cleared": cleared})
+}
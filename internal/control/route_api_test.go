@@ -6,7 +6,9 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"testing"
+	"time"
 
 	"github.com/NodePath81/fbforward/internal/config"
 	"github.com/NodePath81/fbforward/internal/upstream"
@@ -95,6 +97,46 @@ func TestLegacySetUpstreamMapsToSingleRouteOverride(t *testing.T) {
 	}
 }
 
+func TestRouteAffinityRPCListsAndClearsPins(t *testing.T) {
+	a := &upstream.Upstream{Tag: "a"}
+	b := &upstream.Upstream{Tag: "b"}
+	a.SetActiveIP(net.ParseIP("192.0.2.1"))
+	b.SetActiveIP(net.ParseIP("192.0.2.2"))
+	manager := upstream.NewUpstreamManager([]*upstream.Upstream{a, b}, nil)
+	selector := upstream.NewRouteSelector(manager, []config.RouteConfig{{
+		Name: "game", Strategy: "adaptive", Upstreams: []string{"a", "b"},
+		Affinity: config.RouteAffinityConfig{Mode: "sticky", TTL: config.Duration(time.Minute), IPv4Prefix: 24, IPv6Prefix: 64},
+	}})
+	for _, client := range []string{"198.51.100.7", "203.0.113.9"} {
+		if _, _, err := selector.PickFor("game", netip.MustParseAddr(client)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	server := newTestControlServer(t)
+	server.SetRouteStateReader(routeReaderAdapter{selector})
+	call := func(method string, params any) *httptest.ResponseRecorder {
+		return callTestRPC(t, server, "0123456789abcdef", method, params)
+	}
+
+	list := call("GetRouteAffinity", map[string]any{"route": "game"})
+	if list.Code != http.StatusOK || !bytes.Contains(list.Body.Bytes(), []byte(`"client":"198.51.100.0/24"`)) {
+		t.Fatalf("unexpected affinity list: %d %s", list.Code, list.Body.String())
+	}
+	clear := call("ClearRouteAffinity", map[string]any{"route": "game", "client": "198.51.100.200"})
+	if clear.Code != http.StatusOK || !bytes.Contains(clear.Body.Bytes(), []byte(`"cleared":1`)) {
+		t.Fatalf("unexpected clear response: %d %s", clear.Code, clear.Body.String())
+	}
+	if entries, _ := selector.Affinity("game"); len(entries) != 1 || entries[0].Client != "203.0.113.0/24" {
+		t.Fatalf("clear removed the wrong pins: %+v", entries)
+	}
+	if rec := call("ClearRouteAffinity", map[string]any{"route": "missing"}); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown route to fail, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := call("ClearRouteAffinity", map[string]any{"route": "game", "client": "not-an-ip"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid client to fail, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
 type routeReaderAdapter struct{ selector *upstream.RouteSelector }
 
 func (r routeReaderAdapter) RouteStatus() []upstream.RouteStatus { return r.selector.Status() }
@@ -104,5 +146,11 @@ func (r routeReaderAdapter) SetRouteOverride(route, tag string) error {
 func (r routeReaderAdapter) ClearRouteOverride(route string) error {
 	return r.selector.ClearOverride(route)
 }
+func (r routeReaderAdapter) RouteAffinity(route string) ([]upstream.AffinityEntry, error) {
+	return r.selector.Affinity(route)
+}
+func (r routeReaderAdapter) ClearRouteAffinity(route, client string) (int, error) {
+	return r.selector.ClearAffinity(route, client)
+}
 
 var _ routeStateReader = routeReaderAdapter{}
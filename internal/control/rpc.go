@@ -69,38 +69,53 @@ func (r *rpcRegistry) Lookup(name string) (RPCHandler, bool) {
 
 func (c *ControlServer) registerRPCHandlers() {
 	registrations := map[string]RPCHandler{
-		"SetUpstream":            c.rpcSetUpstream,
-		"GetStatus":              c.rpcGetStatus,
-		"GetActiveFlows":         c.rpcGetActiveFlows,
-		"ListFlowContextTags":    c.rpcListFlowContextTags,
-		"ListFlowContextActions": c.rpcListFlowContextActions,
-		"GetRouteStatus":         c.rpcGetRouteStatus,
-		"SetRouteOverride":       c.rpcSetRouteOverride,
-		"ClearRouteOverride":     c.rpcClearRouteOverride,
-		"ListUpstreams":          c.rpcListUpstreams,
-		"RunMeasurement":         c.rpcRunMeasurement,
-		"Restart":                c.rpcRestart,
-		"SendTestNotification":   c.rpcSendTestNotification,
-		"GetMeasurementConfig":   c.rpcGetMeasurementConfig,
-		"GetRuntimeConfig":       c.rpcGetRuntimeConfig,
-		"GetScheduleStatus":      c.rpcGetScheduleStatus,
-		"GetGeoIPStatus":         c.rpcGetGeoIPStatus,
-		"ReloadGeoIP":            c.rpcReloadGeoIP,
-		"GetIPLogStatus":         c.rpcGetIPLogStatus,
-		"QueryIPLog":             c.rpcQueryIPLog,
-		"QueryRejectionLog":      c.rpcQueryRejectionLog,
-		"QueryLogEvents":         c.rpcQueryLogEvents,
-		"GetTopTalkers":          c.rpcGetTopTalkers,
-		"GetTopASNs":             c.rpcGetTopASNs,
-		"QueryAudit":             c.rpcQueryAudit,
-		"GetFirewallPolicy":      c.rpcGetFirewallPolicy,
-		"GetFirewallStatus":      c.rpcGetFirewallStatus,
-		"ValidateFirewallPolicy": c.rpcValidateFirewallPolicy,
-		"ReloadFirewallPolicy":   c.rpcReloadFirewallPolicy,
-		"CreateOnlineRule":       c.rpcCreateOnlineRule,
-		"ListOnlineRules":        c.rpcListOnlineRules,
-		"DeleteOnlineRule":       c.rpcDeleteOnlineRule,
-		"ExpireOnlineRule":       c.rpcExpireOnlineRule,
+		"SetUpstream":             c.rpcSetUpstream,
+		"GetStatus":               c.rpcGetStatus,
+		"GetActiveFlows":          c.rpcGetActiveFlows,
+		"ListFlowContextTags":     c.rpcListFlowContextTags,
+		"ListFlowContextActions":  c.rpcListFlowContextActions,
+		"GetRouteStatus":          c.rpcGetRouteStatus,
+		"SetRouteOverride":        c.rpcSetRouteOverride,
+		"ClearRouteOverride":      c.rpcClearRouteOverride,
+		"GetRouteAffinity":        c.rpcGetRouteAffinity,
+		"ClearRouteAffinity":      c.rpcClearRouteAffinity,
+		"ListUpstreams":           c.rpcListUpstreams,
+		"RunMeasurement":          c.rpcRunMeasurement,
+		"Restart":                 c.rpcRestart,
+		"ReloadConfig":            c.rpcReloadConfig,
+		"SendTestNotification":    c.rpcSendTestNotification,
+		"GetMeasurementConfig":    c.rpcGetMeasurementConfig,
+		"GetRuntimeConfig":        c.rpcGetRuntimeConfig,
+		"GetScheduleStatus":       c.rpcGetScheduleStatus,
+		"GetGeoIPStatus":          c.rpcGetGeoIPStatus,
+		"ReloadGeoIP":             c.rpcReloadGeoIP,
+		"GetIPLogStatus":          c.rpcGetIPLogStatus,
+		"QueryIPLog":              c.rpcQueryIPLog,
+		"QueryRejectionLog":       c.rpcQueryRejectionLog,
+		"QueryLogEvents":          c.rpcQueryLogEvents,
+		"GetTopTalkers":           c.rpcGetTopTalkers,
+		"GetTopASNs":              c.rpcGetTopASNs,
+		"QueryAudit":              c.rpcQueryAudit,
+		"QueryMeasurements":       c.rpcQueryMeasurements,
+		"GetFirewallPolicy":       c.rpcGetFirewallPolicy,
+		"GetFirewallStatus":       c.rpcGetFirewallStatus,
+		"ValidateFirewallPolicy":  c.rpcValidateFirewallPolicy,
+		"ReloadFirewallPolicy":    c.rpcReloadFirewallPolicy,
+		"CreateOnlineRule":        c.rpcCreateOnlineRule,
+		"ListOnlineRules":         c.rpcListOnlineRules,
+		"DeleteOnlineRule":        c.rpcDeleteOnlineRule,
+		"ExpireOnlineRule":        c.rpcExpireOnlineRule,
+		"CreateUpstream":          c.rpcCreateUpstream,
+		"UpdateUpstream":          c.rpcUpdateUpstream,
+		"DeleteUpstream":          c.rpcDeleteUpstream,
+		"DrainUpstream":           c.rpcDrainUpstream,
+		"UndrainUpstream":         c.rpcUndrainUpstream,
+		"ListMaintenanceWindows":  c.rpcListMaintenanceWindows,
+		"CreateMaintenanceWindow": c.rpcCreateMaintenanceWindow,
+		"DeleteMaintenanceWindow": c.rpcDeleteMaintenanceWindow,
+		"SetRouteUpstreams":       c.rpcSetRouteUpstreams,
+		"CreateListener":          c.rpcCreateListener,
+		"DeleteListener":          c.rpcDeleteListener,
 	}
 	for name, handler := range registrations {
 		if err := c.rpcs.Register(name, handler); err != nil {
@@ -25,6 +25,30 @@ func (c *ControlServer) rpcRestart(ctx *rpcContext, _ json.RawMessage) (any, *rp
 	return rpcOK(nil)
 }
 
+// rpcReloadConfig applies the configuration file in place. Unlike Restart it
+// runs synchronously so the caller receives the applied and pending fields.
+func (c *ControlServer) rpcReloadConfig(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	if fault := decodeOptionalParams(raw, &struct{}{}); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	c.cfgMu.RLock()
+	reloadFn := c.reloadFn
+	c.cfgMu.RUnlock()
+	if reloadFn == nil {
+		return rpcError(http.StatusServiceUnavailable, "config reload not available")
+	}
+	report, err := reloadFn()
+	if err != nil {
+		util.Event(c.logger, slogLevelWarn(), "control.rpc.reload_completed", "request.id", ctx.Meta.id, "rpc.method", "ReloadConfig", "result", "failed", "error", err)
+		return rpcError(http.StatusBadRequest, err.Error())
+	}
+	util.Event(c.logger, slogLevelInfo(), "control.rpc.reload_completed", "request.id", ctx.Meta.id, "rpc.method", "ReloadConfig", "result", "success",
+		"reload.applied", report.Applied,
+		"reload.restart_required", report.RestartRequired,
+	)
+	return rpcOK(report)
+}
+
 func flowContextIdentityView(identities []config.FlowContextIdentity) []map[string]any {
 	result := make([]map[string]any, 0, len(identities))
 	for _, identity := range identities {
@@ -105,7 +129,9 @@ func (c *ControlServer) rpcReloadGeoIP(ctx *rpcContext, raw json.RawMessage) (an
 	return rpcOK(manager.Status())
 }
 func (c *ControlServer) getMeasurementConfig() map[string]interface{} {
+	c.cfgMu.RLock()
 	cfg := c.measurement
+	c.cfgMu.RUnlock()
 	return map[string]interface{}{
 		"probe_timeout": cfg.ProbeTimeout.Duration().String(),
 		"schedule": map[string]interface{}{
@@ -114,20 +140,36 @@ func (c *ControlServer) getMeasurementConfig() map[string]interface{} {
 				"max": cfg.Schedule.Interval.Max.Duration().String(),
 			},
 			"upstream_gap": cfg.Schedule.UpstreamGap.Duration().String(),
+			"adaptive": map[string]interface{}{
+				"enabled":       cfg.Schedule.Adaptive.Enabled,
+				"fast_interval": cfg.Schedule.Adaptive.FastInterval.Duration().String(),
+				"stable_after":  cfg.Schedule.Adaptive.StableAfter,
+				"max_interval":  cfg.Schedule.Adaptive.MaxInterval.Duration().String(),
+			},
 		},
 		"protocols": map[string]interface{}{
 			"tcp": map[string]interface{}{
 				"enabled": util.BoolValue(cfg.Protocols.TCP.Enabled, true),
+				"one_way": cfg.Protocols.TCP.OneWay,
 			},
 			"udp": map[string]interface{}{
-				"enabled": util.BoolValue(cfg.Protocols.UDP.Enabled, true),
+				"enabled":        util.BoolValue(cfg.Protocols.UDP.Enabled, true),
+				"burst":          cfg.Protocols.UDP.Burst,
+				"burst_frames":   cfg.Protocols.UDP.BurstFrames,
+				"burst_interval": cfg.Protocols.UDP.BurstInterval.Duration().String(),
+				"one_way":        cfg.Protocols.UDP.OneWay,
 			},
 		},
+		"throughput": map[string]interface{}{
+			"enabled":  cfg.Throughput.Enabled,
+			"interval": cfg.Throughput.Interval.Duration().String(),
+			"bytes":    cfg.Throughput.Bytes,
+		},
 	}
 }
 
 func (c *ControlServer) getRuntimeConfig() map[string]interface{} {
-	cfg := c.fullCfg
+	cfg := c.runtimeConfig()
 
 	listeners := make([]map[string]interface{}, 0, len(cfg.Forwarding.Listeners))
 	for _, ln := range cfg.Forwarding.Listeners {
@@ -151,6 +193,10 @@ func (c *ControlServer) getRuntimeConfig() map[string]interface{} {
 	for _, route := range cfg.Routes {
 		routes = append(routes, map[string]interface{}{
 			"name": route.Name, "strategy": route.Strategy, "upstreams": append([]string(nil), route.Upstreams...), "default_upstream": route.DefaultUpstream,
+			"weights": route.Weights, "affinity": routeAffinityView(route.Affinity),
+			"hedge": routeHedgeView(route.Hedge), "prefer": route.Prefer,
+			"score": routeScoreView(route.Score), "hysteresis": routeHysteresisView(route.Hysteresis), "health": routeHealthView(route.Health), "failback": routeFailbackView(route.Failback),
+			"selection_rules": routeSelectionRulesView(route.SelectionRules), "port_offset": route.PortOffset, "ports": route.Ports, "proxy_protocol": route.ProxyProtocol,
 		})
 	}
 
@@ -160,12 +206,12 @@ func (c *ControlServer) getRuntimeConfig() map[string]interface{} {
 			"tag": up.Tag,
 			"destination": map[string]interface{}{
 				"host": up.Destination.Host,
+				"port": up.Destination.Port,
+				"srv":  up.Destination.SRV,
 			},
-			"measurement": map[string]interface{}{
-				"host": up.Measurement.Host,
-				"port": up.Measurement.Port,
-			},
-			"priority": up.Priority,
+			"measurement":    upstreamMeasurementView(up.Measurement),
+			"priority":       up.Priority,
+			"proxy_protocol": up.ProxyProtocol,
 		}
 		upstreams = append(upstreams, entry)
 	}
@@ -184,18 +230,35 @@ func (c *ControlServer) getRuntimeConfig() map[string]interface{} {
 				"tcp": cfg.Forwarding.IdleTimeout.TCP.Duration().String(),
 				"udp": cfg.Forwarding.IdleTimeout.UDP.Duration().String(),
 			},
+			"failover": map[string]interface{}{
+				"max_attempts": cfg.Forwarding.Failover.MaxAttempts,
+				"budget":       cfg.Forwarding.Failover.Budget.Duration().String(),
+			},
 		},
 		"upstreams": upstreams,
 		"dns": map[string]interface{}{
 			"servers":  cfg.DNS.Servers,
 			"strategy": cfg.DNS.Strategy,
+			"srv": map[string]interface{}{
+				"min_refresh": cfg.DNS.SRV.MinRefresh.Duration().String(),
+				"max_refresh": cfg.DNS.SRV.MaxRefresh.Duration().String(),
+			},
 		},
 		"measurement": c.getMeasurementConfig(),
 		"health": map[string]interface{}{
-			"rtt_ewma_alpha":     cfg.Health.RTTEWMAAlpha,
-			"failure_threshold":  cfg.Health.FailureThreshold,
-			"recovery_threshold": cfg.Health.RecoveryThreshold,
-			"stale_threshold":    cfg.Health.StaleThreshold.Duration().String(),
+			"rtt_ewma_alpha":      cfg.Health.RTTEWMAAlpha,
+			"failure_threshold":   cfg.Health.FailureThreshold,
+			"recovery_threshold":  cfg.Health.RecoveryThreshold,
+			"stale_threshold":     cfg.Health.StaleThreshold.Duration().String(),
+			"loss_threshold":      cfg.Health.LossThreshold,
+			"min_throughput_mbps": cfg.Health.MinThroughputMbps,
+			"passive": map[string]interface{}{
+				"enabled":           cfg.Health.Passive.Enabled,
+				"window":            cfg.Health.Passive.Window.Duration().String(),
+				"failure_threshold": cfg.Health.Passive.FailureThreshold,
+				"failure_ratio":     cfg.Health.Passive.FailureRatio,
+				"signals":           cfg.Health.Passive.Signals,
+			},
 		},
 		"control": map[string]interface{}{
 			"bind_addr": cfg.Control.BindAddr,
@@ -215,15 +278,16 @@ func (c *ControlServer) getRuntimeConfig() map[string]interface{} {
 			"country_db_path": cfg.GeoIP.CountryDBPath,
 		},
 		"ip_log": map[string]interface{}{
-			"enabled":          cfg.IPLog.Enabled,
-			"log_rejections":   util.BoolValue(cfg.IPLog.LogRejections, cfg.IPLog.Enabled),
-			"db_path":          cfg.IPLog.DBPath,
-			"retention":        cfg.IPLog.Retention.Duration().String(),
-			"geo_queue_size":   cfg.IPLog.GeoQueueSize,
-			"write_queue_size": cfg.IPLog.WriteQueueSize,
-			"batch_size":       cfg.IPLog.BatchSize,
-			"flush_interval":   cfg.IPLog.FlushInterval.Duration().String(),
-			"prune_interval":   cfg.IPLog.PruneInterval.Duration().String(),
+			"enabled":               cfg.IPLog.Enabled,
+			"log_rejections":        util.BoolValue(cfg.IPLog.LogRejections, cfg.IPLog.Enabled),
+			"db_path":               cfg.IPLog.DBPath,
+			"retention":             cfg.IPLog.Retention.Duration().String(),
+			"measurement_retention": cfg.IPLog.MeasurementRetention.Duration().String(),
+			"geo_queue_size":        cfg.IPLog.GeoQueueSize,
+			"write_queue_size":      cfg.IPLog.WriteQueueSize,
+			"batch_size":            cfg.IPLog.BatchSize,
+			"flush_interval":        cfg.IPLog.FlushInterval.Duration().String(),
+			"prune_interval":        cfg.IPLog.PruneInterval.Duration().String(),
 		},
 		"flow_context": map[string]interface{}{
 			"enabled":    cfg.FlowContext.Enabled,
@@ -238,6 +302,68 @@ func (c *ControlServer) getRuntimeConfig() map[string]interface{} {
 	}
 }
 
+func routeSelectionRulesView(rules []config.RouteSelectionRule) []map[string]interface{} {
+	if len(rules) == 0 {
+		return nil
+	}
+	out := make([]map[string]interface{}, 0, len(rules))
+	for _, rule := range rules {
+		out = append(out, map[string]interface{}{
+			"name": rule.Name, "countries": rule.Countries, "asns": rule.ASNs, "cidrs": rule.CIDRs,
+			"upstreams": append([]string(nil), rule.Upstreams...),
+		})
+	}
+	return out
+}
+
+func routeAffinityView(affinity config.RouteAffinityConfig) map[string]interface{} {
+	if !affinity.Enabled() {
+		return nil
+	}
+	return map[string]interface{}{
+		"mode": affinity.Mode, "ttl": affinity.TTL.Duration().String(),
+		"ipv4_prefix": affinity.IPv4Prefix, "ipv6_prefix": affinity.IPv6Prefix,
+	}
+}
+
+func routeHedgeView(hedge config.RouteHedgeConfig) map[string]interface{} {
+	if !hedge.Enabled {
+		return nil
+	}
+	return map[string]interface{}{"enabled": true, "delay": hedge.Delay.Duration().String()}
+}
+
+func routeScoreView(score config.RouteScoreConfig) map[string]interface{} {
+	if !score.Enabled() {
+		return nil
+	}
+	return map[string]interface{}{"rtt": score.RTT, "loss": score.Loss, "priority": score.Priority, "load": score.Load}
+}
+
+func routeHysteresisView(hysteresis config.RouteHysteresisConfig) map[string]interface{} {
+	if !hysteresis.Enabled() {
+		return nil
+	}
+	return map[string]interface{}{"margin": hysteresis.Margin, "dwell": hysteresis.Dwell.Duration().String()}
+}
+
+func routeHealthView(health config.RouteHealthConfig) map[string]interface{} {
+	if !health.Enabled() {
+		return nil
+	}
+	return map[string]interface{}{
+		"failure_threshold": health.FailureThreshold, "recovery_threshold": health.RecoveryThreshold,
+		"stale_threshold": health.StaleThreshold.Duration().String(), "rtt_ewma_alpha": health.RTTEWMAAlpha, "protocols": health.Protocols,
+	}
+}
+
+func routeFailbackView(failback config.RouteFailbackConfig) map[string]interface{} {
+	if failback == (config.RouteFailbackConfig{}) {
+		return nil
+	}
+	return map[string]interface{}{"delay": failback.Delay.Duration().String(), "probes": failback.Probes}
+}
+
 func (c *ControlServer) getScheduleStatus() map[string]interface{} {
 	c.schedulerMu.RLock()
 	scheduler := c.scheduler
@@ -247,16 +373,35 @@ func (c *ControlServer) getScheduleStatus() map[string]interface{} {
 			"queue_length":      0,
 			"next_scheduled":    nil,
 			"last_measurements": map[string]time.Time{},
+			"cadence":           map[string]interface{}{},
 		}
 	}
 	status := scheduler.Status()
+	cadence := make(map[string]interface{}, len(status.Cadence))
+	for key, item := range status.Cadence {
+		cadence[key] = map[string]interface{}{"cadence": item.Cadence, "interval": item.Interval.String()}
+	}
 	result := map[string]interface{}{
 		"queue_length":      status.QueueLength,
 		"next_scheduled":    nil,
 		"last_measurements": status.LastRun,
+		"cadence":           cadence,
 	}
 	if !status.NextScheduled.IsZero() {
 		result["next_scheduled"] = status.NextScheduled
 	}
 	return result
 }
+
+func upstreamMeasurementView(m config.UpstreamMeasurementConfig) map[string]interface{} {
+	view := map[string]interface{}{"host": m.Host, "port": m.Port, "type": m.Type}
+	if m.Type == config.ProbeHTTP {
+		view["http"] = map[string]interface{}{
+			"path": m.HTTP.Path, "tls": m.HTTP.TLS, "expect_status": m.HTTP.ExpectStatus, "expect_body": m.HTTP.ExpectBody,
+		}
+	}
+	if m.KeyFile != "" {
+		view["key_file"] = m.KeyFile
+	}
+	return view
+}
@@ -2,6 +2,7 @@ package control
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -51,3 +52,23 @@ func TestRuntimeConfigSanitizesNotifyConfig(t *testing.T) {
 		t.Fatalf("unexpected webhook bearer token in runtime config: %#v", notifyCfg)
 	}
 }
+
+func TestReloadConfigReturnsReport(t *testing.T) {
+	server := newTestControlServer(t)
+	rec := callTestRPC(t, server, "0123456789abcdef", "ReloadConfig", nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without reload function, got %d", rec.Code)
+	}
+	server.SetReloadFunc(func() (config.ReloadReport, error) {
+		return config.ReloadReport{Applied: []string{"routes"}, RestartRequired: []string{"control.bind_port"}}, nil
+	})
+	rec = callTestRPC(t, server, "0123456789abcdef", "ReloadConfig", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	for _, want := range []string{`"applied":["routes"]`, `"restart_required":["control.bind_port"]`} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Fatalf("reload response missing %s: %s", want, rec.Body.String())
+		}
+	}
+}
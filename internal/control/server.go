@@ -34,15 +34,20 @@ const (
 )
 
 type ControlServer struct {
+	cfgMu       sync.RWMutex
 	fullCfg     config.Config
 	cfg         config.ControlConfig
 	measurement config.MeasurementConfig
 	hostname    string
 	manager     upstream.UpstreamStateReader
 	routes      routeStateReader
+	drains      drainController
+	maintenance maintenanceController
 	metrics     *metrics.Metrics
 	status      *StatusStore
 	restartFn   func() error
+	reloadFn    func() (config.ReloadReport, error)
+	topologyFn  func(change config.TopologyChange, persist bool) (config.ReloadReport, error)
 	logger      util.Logger
 	server      *http.Server
 	limiter     *rateLimiter
@@ -160,6 +165,35 @@ func (c *ControlServer) Shutdown(ctx context.Context) error {
 	return c.server.Shutdown(ctx)
 }
 
+// SetRuntimeConfig publishes the configuration applied by a hot reload. The
+// control listener settings are not replaced; they require a restart.
+func (c *ControlServer) SetRuntimeConfig(cfg config.Config) {
+	c.cfgMu.Lock()
+	defer c.cfgMu.Unlock()
+	c.fullCfg = cfg
+	c.measurement = cfg.Measurement
+}
+
+func (c *ControlServer) runtimeConfig() config.Config {
+	c.cfgMu.RLock()
+	defer c.cfgMu.RUnlock()
+	return c.fullCfg
+}
+
+func (c *ControlServer) SetReloadFunc(reloadFn func() (config.ReloadReport, error)) {
+	c.cfgMu.Lock()
+	defer c.cfgMu.Unlock()
+	c.reloadFn = reloadFn
+}
+
+// SetTopologyFunc installs the hook that applies topology RPCs to the running
+// runtime and optionally to the configuration file.
+func (c *ControlServer) SetTopologyFunc(topologyFn func(change config.TopologyChange, persist bool) (config.ReloadReport, error)) {
+	c.cfgMu.Lock()
+	defer c.cfgMu.Unlock()
+	c.topologyFn = topologyFn
+}
+
 func (c *ControlServer) SetScheduler(scheduler *measure.Scheduler) {
 	c.schedulerMu.Lock()
 	defer c.schedulerMu.Unlock()
@@ -225,6 +259,14 @@ func (c *ControlServer) SetRouteStateReader(routes routeStateReader) {
 	c.routes = routes
 }
 
+func (c *ControlServer) SetDrainController(drains drainController) {
+	c.drains = drains
+}
+
+func (c *ControlServer) SetMaintenanceController(maintenance maintenanceController) {
+	c.maintenance = maintenance
+}
+
 type identityResponse struct {
 	Hostname string   `json:"hostname"`
 	IPs      []string `json:"ips"`
@@ -0,0 +1,292 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+type upstreamParams struct {
+	Tag         string `json:"tag"`
+	Destination struct {
+		Host string `json:"host,omitempty"`
+		Port int    `json:"port,omitempty"`
+		SRV  string `json:"srv,omitempty"`
+	} `json:"destination"`
+	Measurement struct {
+		Host    string          `json:"host,omitempty"`
+		Port    int             `json:"port,omitempty"`
+		Type    string          `json:"type,omitempty"`
+		HTTP    httpProbeParams `json:"http"`
+		KeyFile string          `json:"key_file,omitempty"`
+	} `json:"measurement"`
+	Priority      float64 `json:"priority,omitempty"`
+	ProxyProtocol string  `json:"proxy_protocol,omitempty"`
+}
+
+type httpProbeParams struct {
+	Path         string `json:"path,omitempty"`
+	TLS          bool   `json:"tls,omitempty"`
+	ExpectStatus int    `json:"expect_status,omitempty"`
+	ExpectBody   string `json:"expect_body,omitempty"`
+}
+
+func (p upstreamParams) config() config.UpstreamConfig {
+	var up config.UpstreamConfig
+	p.applyTo(&up)
+	return up
+}
+
+// applyTo copies the fields the RPC exposes onto up and leaves the rest.
+func (p upstreamParams) applyTo(up *config.UpstreamConfig) {
+	up.Tag = p.Tag
+	up.Destination = config.DestinationConfig{
+		Host: p.Destination.Host,
+		Port: p.Destination.Port,
+		SRV:  p.Destination.SRV,
+	}
+	up.Measurement.Host = p.Measurement.Host
+	up.Measurement.Port = p.Measurement.Port
+	up.Measurement.Type = p.Measurement.Type
+	up.Measurement.KeyFile = p.Measurement.KeyFile
+	up.Measurement.HTTP = config.HTTPProbeConfig{
+		Path:         p.Measurement.HTTP.Path,
+		TLS:          p.Measurement.HTTP.TLS,
+		ExpectStatus: p.Measurement.HTTP.ExpectStatus,
+		ExpectBody:   p.Measurement.HTTP.ExpectBody,
+	}
+	up.Priority = p.Priority
+	up.ProxyProtocol = p.ProxyProtocol
+}
+
+// upstreamParamsFrom returns the RPC fields of up, so an update only changes
+// the fields its request names.
+func upstreamParamsFrom(up config.UpstreamConfig) upstreamParams {
+	var p upstreamParams
+	p.Tag = up.Tag
+	p.Destination.Host = up.Destination.Host
+	p.Destination.Port = up.Destination.Port
+	p.Destination.SRV = up.Destination.SRV
+	p.Measurement.Host = up.Measurement.Host
+	p.Measurement.Port = up.Measurement.Port
+	p.Measurement.Type = up.Measurement.Type
+	p.Measurement.KeyFile = up.Measurement.KeyFile
+	p.Measurement.HTTP = httpProbeParams{
+		Path:         up.Measurement.HTTP.Path,
+		TLS:          up.Measurement.HTTP.TLS,
+		ExpectStatus: up.Measurement.HTTP.ExpectStatus,
+		ExpectBody:   up.Measurement.HTTP.ExpectBody,
+	}
+	p.Priority = up.Priority
+	p.ProxyProtocol = up.ProxyProtocol
+	return p
+}
+
+type createUpstreamParams struct {
+	Upstream upstreamParams `json:"upstream"`
+	Persist  bool           `json:"persist,omitempty"`
+}
+
+type updateUpstreamParams struct {
+	Tag      string          `json:"tag"`
+	Upstream json.RawMessage `json:"upstream"`
+	Persist  bool            `json:"persist,omitempty"`
+}
+
+type deleteUpstreamParams struct {
+	Tag     string `json:"tag"`
+	Force   bool   `json:"force,omitempty"`
+	Persist bool   `json:"persist,omitempty"`
+}
+
+type setRouteUpstreamsParams struct {
+	Route           string         `json:"route"`
+	Upstreams       []string       `json:"upstreams"`
+	Weights         map[string]int `json:"weights,omitempty"`
+	DefaultUpstream string         `json:"default_upstream,omitempty"`
+	Persist         bool           `json:"persist,omitempty"`
+}
+
+type createListenerParams struct {
+	Listener struct {
+		Name          string `json:"name"`
+		Bind          string `json:"bind"`
+		Protocol      string `json:"protocol"`
+		Route         string `json:"route"`
+		ProxyProtocol struct {
+			TrustedCIDRs []string `json:"trusted_cidrs,omitempty"`
+		} `json:"proxy_protocol"`
+	} `json:"listener"`
+	Persist bool `json:"persist,omitempty"`
+}
+
+type deleteListenerParams struct {
+	Name    string `json:"name"`
+	Persist bool   `json:"persist,omitempty"`
+}
+
+// topologyResult is returned by every topology RPC.
+type topologyResult struct {
+	config.ReloadReport
+	Persisted bool `json:"persisted"`
+}
+
+func (c *ControlServer) rpcCreateUpstream(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params createUpstreamParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	return c.editTopology(ctx, "CreateUpstream", config.CreateUpstream(params.Upstream.config()), params.Persist)
+}
+
+// rpcUpdateUpstream merges the request onto the running upstream: fields the
+// request omits keep their value, and settings the RPC does not expose, such
+// as maintenance windows, are never dropped. Changing the probe type drops
+// the http probe settings and the fbmeasure key file unless the new type
+// uses them.
+func (c *ControlServer) rpcUpdateUpstream(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params updateUpstreamParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	var check upstreamParams
+	if len(params.Upstream) > 0 && json.Unmarshal(params.Upstream, &check) != nil {
+		return rpcError(http.StatusBadRequest, "invalid params")
+	}
+	change := config.PatchUpstream(params.Tag, func(up *config.UpstreamConfig) error {
+		fields := upstreamParamsFrom(*up)
+		probe := probeType(fields.Measurement.Type)
+		if len(params.Upstream) > 0 {
+			if err := json.Unmarshal(params.Upstream, &fields); err != nil {
+				return err
+			}
+		}
+		// Settings of the previous probe type do not carry over to a new one.
+		if next := probeType(fields.Measurement.Type); next != probe {
+			if next != config.ProbeHTTP {
+				fields.Measurement.HTTP = httpProbeParams{}
+			}
+			if next != config.ProbeFBMeasure {
+				fields.Measurement.KeyFile = ""
+			}
+		}
+		fields.applyTo(up)
+		return nil
+	})
+	return c.editTopology(ctx, "UpdateUpstream", change, params.Persist)
+}
+
+// probeType returns the measurement type a request names, with the default
+// fbmeasure for an empty one.
+func probeType(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return config.ProbeFBMeasure
+	}
+	return value
+}
+
+// errUpstreamInUse refuses to delete an upstream that still carries Flows.
+var errUpstreamInUse = errors.New("set force to delete")
+
+// rpcDeleteUpstream refuses while Flows are still forwarded to the upstream
+// (or to a member of an SRV upstream) unless force is set. The Flows are
+// counted as part of the change, under the same lock as the reload that
+// removes the upstream. Forced deletion leaves those Flows running until they
+// end.
+func (c *ControlServer) rpcDeleteUpstream(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params deleteUpstreamParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	tag := strings.TrimSpace(params.Tag)
+	remove := config.DeleteUpstream(tag)
+	change := func(cfg *config.Config) error {
+		if active := c.activeFlowsOn(tag); active > 0 && !params.Force {
+			return fmt.Errorf("upstream %s has %d active flows; %w", tag, active, errUpstreamInUse)
+		}
+		return remove(cfg)
+	}
+	return c.editTopology(ctx, "DeleteUpstream", change, params.Persist)
+}
+
+func (c *ControlServer) rpcSetRouteUpstreams(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params setRouteUpstreamsParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	change := config.SetRouteUpstreams(params.Route, params.Upstreams, params.Weights, strings.TrimSpace(params.DefaultUpstream))
+	return c.editTopology(ctx, "SetRouteUpstreams", change, params.Persist)
+}
+
+func (c *ControlServer) rpcCreateListener(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params createListenerParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	spec := config.ListenerSpec{
+		Name:          params.Listener.Name,
+		Bind:          params.Listener.Bind,
+		Protocol:      params.Listener.Protocol,
+		Route:         params.Listener.Route,
+		ProxyProtocol: config.ListenerProxyConfig{TrustedCIDRs: params.Listener.ProxyProtocol.TrustedCIDRs},
+	}
+	return c.editTopology(ctx, "CreateListener", config.CreateListener(spec), params.Persist)
+}
+
+func (c *ControlServer) rpcDeleteListener(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
+	var params deleteListenerParams
+	if fault := decodeRequiredParams(raw, &params); fault != nil {
+		return rpcError(fault.Status, fault.Message)
+	}
+	return c.editTopology(ctx, "DeleteListener", config.DeleteListener(params.Name), params.Persist)
+}
+
+func (c *ControlServer) editTopology(ctx *rpcContext, method string, change config.TopologyChange, persist bool) (any, *rpcFault) {
+	c.cfgMu.RLock()
+	topologyFn := c.topologyFn
+	c.cfgMu.RUnlock()
+	if topologyFn == nil {
+		return rpcError(http.StatusServiceUnavailable, "topology changes not available")
+	}
+	report, err := topologyFn(change, persist)
+	if err != nil {
+		util.Event(c.logger, slogLevelWarn(), "control.rpc.topology_completed", "request.id", ctx.Meta.id, "rpc.method", method, "result", "failed", "error", err)
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, config.ErrTopologyNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, errUpstreamInUse):
+			status = http.StatusConflict
+		case errors.Is(err, config.ErrTopologyNotPersisted):
+			status = http.StatusInternalServerError
+		}
+		return rpcError(status, err.Error())
+	}
+	util.Event(c.logger, slogLevelInfo(), "control.rpc.topology_completed", "request.id", ctx.Meta.id, "rpc.method", method, "result", "success",
+		"reload.applied", report.Applied,
+		"config.persist", persist,
+	)
+	return rpcOK(topologyResult{ReloadReport: report, Persisted: persist})
+}
+
+// activeFlowsOn counts TCP and UDP Flows forwarded to tag or to one of its
+// SRV members.
+func (c *ControlServer) activeFlowsOn(tag string) int {
+	if c.status == nil {
+		return 0
+	}
+	tcp, udp := c.status.Snapshot()
+	count := 0
+	for _, entry := range append(tcp, udp...) {
+		if entry.Upstream == tag || strings.HasPrefix(entry.Upstream, tag+"/") {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,232 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/flow"
+)
+
+func TestTopologyRPCsApplyChangesThroughHook(t *testing.T) {
+	server := newTestControlServer(t)
+	base := config.Config{
+		Listeners: []config.ListenerSpec{{Name: "web", Bind: "127.0.0.1:443", Protocol: "tcp", Route: "web"}},
+		Routes:    []config.RouteConfig{{Name: "web", Strategy: "static", Upstreams: []string{"a"}}},
+		Upstreams: []config.UpstreamConfig{{Tag: "a", Destination: config.DestinationConfig{Host: "127.0.0.1"}}},
+		Control:   config.ControlConfig{AuthToken: "0123456789abcdef"},
+		Forwarding: config.ForwardingConfig{
+			Limits:      config.ForwardingLimitsConfig{MaxTCPConnections: 1, MaxUDPMappings: 1},
+			IdleTimeout: config.IdleTimeoutConfig{TCP: config.Duration(time.Second), UDP: config.Duration(time.Second)},
+		},
+	}
+	var applied config.Config
+	var persisted bool
+	server.SetTopologyFunc(func(change config.TopologyChange, persist bool) (config.ReloadReport, error) {
+		next, err := base.ApplyTopology(change)
+		if err != nil {
+			return config.ReloadReport{}, err
+		}
+		applied, persisted = next, persist
+		return config.ReloadReport{Applied: []string{"upstreams"}, RestartRequired: []string{}}, nil
+	})
+	call := func(method string, params any) (int, string) {
+		rec := callTestRPC(t, server, "0123456789abcdef", method, params)
+		return rec.Code, rec.Body.String()
+	}
+
+	code, body := call("CreateUpstream", map[string]any{
+		"upstream": map[string]any{
+			"tag":            "b",
+			"destination":    map[string]any{"host": "127.0.0.2", "port": 8443},
+			"proxy_protocol": "v2",
+		},
+		"persist": true,
+	})
+	if code != http.StatusOK || !strings.Contains(body, `"persisted":true`) || !strings.Contains(body, `"applied":["upstreams"]`) {
+		t.Fatalf("CreateUpstream = %d %s", code, body)
+	}
+	if up := applied.Upstreams[1]; !persisted || up.Tag != "b" || up.Destination.Port != 8443 || up.ProxyProtocol != "v2" {
+		t.Fatalf("unexpected created upstream: %+v", up)
+	}
+	if code, body := call("UpdateUpstream", map[string]any{"tag": "missing", "upstream": map[string]any{"destination": map[string]any{"host": "127.0.0.3"}}}); code != http.StatusNotFound {
+		t.Fatalf("UpdateUpstream on a missing tag = %d %s", code, body)
+	}
+	if code, body := call("SetRouteUpstreams", map[string]any{"route": "web", "upstreams": []string{"a", "missing"}, "default_upstream": "a"}); code != http.StatusBadRequest || !strings.Contains(body, "unknown upstream missing") {
+		t.Fatalf("SetRouteUpstreams with an unknown member = %d %s", code, body)
+	}
+	if code, body := call("CreateListener", map[string]any{"listener": map[string]any{"name": "dns", "bind": "127.0.0.1:53", "protocol": "udp", "route": "web"}}); code != http.StatusOK || persisted {
+		t.Fatalf("CreateListener = %d %s persisted=%v", code, body, persisted)
+	}
+	if len(applied.Forwarding.Listeners) != 2 || applied.Forwarding.Listeners[1].BindPort != 53 {
+		t.Fatalf("unexpected created listener: %+v", applied.Forwarding.Listeners)
+	}
+}
+
+func TestDeleteUpstreamRefusesActiveFlowsUnlessForced(t *testing.T) {
+	server := newTestControlServer(t)
+	var calls int
+	base := runningTopology(t, config.UpstreamConfig{Tag: "other", Destination: config.DestinationConfig{Host: "127.0.0.1"}},
+		config.UpstreamConfig{Tag: "app", Destination: config.DestinationConfig{SRV: "_app._tcp.example.test"}})
+	server.SetTopologyFunc(func(change config.TopologyChange, _ bool) (config.ReloadReport, error) {
+		// The count must be taken while the change is applied.
+		if _, err := base.ApplyTopology(change); err != nil {
+			return config.ReloadReport{}, err
+		}
+		calls++
+		return config.ReloadReport{}, nil
+	})
+	id, err := flow.NewID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.status.Open(flow.Meta{
+		ID:         id,
+		Protocol:   flow.ProtocolTCP,
+		ClientAddr: netip.MustParseAddrPort("192.0.2.10:40000"),
+		Upstream:   "app/a.example.test:9001",
+	})
+
+	rec := callTestRPC(t, server, "0123456789abcdef", "DeleteUpstream", map[string]any{"tag": "app"})
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "1 active flows") || calls != 0 {
+		t.Fatalf("expected conflict while a member carries a Flow, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = callTestRPC(t, server, "0123456789abcdef", "DeleteUpstream", map[string]any{"tag": "app", "force": true})
+	if rec.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("expected forced delete to apply, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	server.SetTopologyFunc(func(config.TopologyChange, bool) (config.ReloadReport, error) {
+		return config.ReloadReport{}, errors.Join(config.ErrTopologyNotPersisted, errors.New("read-only file system"))
+	})
+	rec = callTestRPC(t, server, "0123456789abcdef", "DeleteUpstream", map[string]any{"tag": "other", "persist": true})
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a write-back failure to surface, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdateUpstreamMergesOntoRunningUpstream(t *testing.T) {
+	server := newTestControlServer(t)
+	window := config.MaintenanceWindowConfig{Weekdays: []string{"sun"}, At: "02:00", Duration: config.Duration(time.Hour)}
+	base := runningTopology(t, config.UpstreamConfig{
+		Tag: "a", Destination: config.DestinationConfig{Host: "127.0.0.1"}, Priority: 2,
+		Measurement: config.UpstreamMeasurementConfig{Port: 9876},
+		Maintenance: []config.MaintenanceWindowConfig{window},
+	})
+	applied := applyTopologyTo(server, base)
+
+	rec := callTestRPC(t, server, "0123456789abcdef", "UpdateUpstream", map[string]any{"tag": "a", "upstream": map[string]any{"destination": map[string]any{"host": "127.0.0.9"}}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("UpdateUpstream = %d %s", rec.Code, rec.Body.String())
+	}
+	up := applied.Upstreams[0]
+	if up.Destination.Host != "127.0.0.9" || up.Measurement.Host != "127.0.0.9" || up.Priority != 2 || up.Measurement.Port != 9876 || len(up.Maintenance) != 1 || up.Maintenance[0].At != "02:00" {
+		t.Fatalf("update dropped untouched settings: %+v", up)
+	}
+	if len(base.Upstreams[0].Maintenance) != 1 || base.Upstreams[0].Destination.Host != "127.0.0.1" {
+		t.Fatalf("update changed the running configuration: %+v", base.Upstreams[0])
+	}
+	rec = callTestRPC(t, server, "0123456789abcdef", "UpdateUpstream", map[string]any{"tag": "a", "upstream": map[string]any{"tag": "b"}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "cannot be renamed") {
+		t.Fatalf("rename = %d %s", rec.Code, rec.Body.String())
+	}
+	rec = callTestRPC(t, server, "0123456789abcdef", "UpdateUpstream", map[string]any{"tag": "a", "upstream": map[string]any{"priority": "high"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("malformed upstream = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// runningTopology returns a validated configuration with a static route over
+// the first of upstreams, as the runtime holds it.
+func runningTopology(t *testing.T, upstreams ...config.UpstreamConfig) config.Config {
+	t.Helper()
+	cfg := config.Config{
+		Listeners: []config.ListenerSpec{{Name: "web", Bind: "127.0.0.1:443", Protocol: "tcp", Route: "web"}},
+		Routes:    []config.RouteConfig{{Name: "web", Strategy: "static", Upstreams: []string{upstreams[0].Tag}}},
+		Upstreams: upstreams,
+		Control:   config.ControlConfig{AuthToken: "0123456789abcdef"},
+		Forwarding: config.ForwardingConfig{
+			Limits:      config.ForwardingLimitsConfig{MaxTCPConnections: 1, MaxUDPMappings: 1},
+			IdleTimeout: config.IdleTimeoutConfig{TCP: config.Duration(time.Second), UDP: config.Duration(time.Second)},
+		},
+	}
+	cfg, err := cfg.ApplyTopology(func(*config.Config) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// applyTopologyTo applies topology RPCs of server to base and records the
+// last result.
+func applyTopologyTo(server *ControlServer, base config.Config) *config.Config {
+	applied := &config.Config{}
+	server.SetTopologyFunc(func(change config.TopologyChange, persist bool) (config.ReloadReport, error) {
+		next, err := base.ApplyTopology(change)
+		if err != nil {
+			return config.ReloadReport{}, err
+		}
+		*applied = next
+		return config.ReloadReport{Applied: []string{"upstreams"}, RestartRequired: []string{}}, nil
+	})
+	return applied
+}
+
+func TestUpstreamRPCsSetProbeType(t *testing.T) {
+	server := newTestControlServer(t)
+	base := runningTopology(t, config.UpstreamConfig{
+		Tag: "a", Destination: config.DestinationConfig{Host: "127.0.0.1", Port: 8080},
+		Measurement: config.UpstreamMeasurementConfig{Type: config.ProbeHTTP, HTTP: config.HTTPProbeConfig{Path: "/healthz", TLS: true}},
+	})
+	applied := applyTopologyTo(server, base)
+
+	rec := callTestRPC(t, server, "0123456789abcdef", "UpdateUpstream", map[string]any{"tag": "a", "upstream": map[string]any{"priority": 3}})
+	if up := applied.Upstreams[0]; rec.Code != http.StatusOK || up.Measurement.Type != config.ProbeHTTP || up.Measurement.HTTP.Path != "/healthz" || !up.Measurement.HTTP.TLS || up.Measurement.Port != 0 {
+		t.Fatalf("update lost the http probe: %d %s %+v", rec.Code, rec.Body.String(), up.Measurement)
+	}
+	rec = callTestRPC(t, server, "0123456789abcdef", "UpdateUpstream", map[string]any{"tag": "a", "upstream": map[string]any{"measurement": map[string]any{"type": "fbmeasure"}}})
+	if up := applied.Upstreams[0]; rec.Code != http.StatusOK || up.Measurement.Type != config.ProbeFBMeasure || up.Measurement.Port != 9876 {
+		t.Fatalf("switch to fbmeasure: %d %s %+v", rec.Code, rec.Body.String(), up.Measurement)
+	}
+
+	rec = callTestRPC(t, server, "0123456789abcdef", "CreateUpstream", map[string]any{"upstream": map[string]any{
+		"tag": "b", "destination": map[string]any{"host": "127.0.0.2", "port": 443},
+		"measurement": map[string]any{"type": " TCP_Connect "},
+	}})
+	if up := applied.Upstreams[1]; rec.Code != http.StatusOK || up.Measurement.Type != config.ProbeTCPConnect || up.Measurement.Port != 0 {
+		t.Fatalf("create tcp_connect upstream: %d %s %+v", rec.Code, rec.Body.String(), up.Measurement)
+	}
+	rec = callTestRPC(t, server, "0123456789abcdef", "CreateUpstream", map[string]any{"upstream": map[string]any{
+		"tag": "c", "destination": map[string]any{"host": "127.0.0.3"},
+		"measurement": map[string]any{"type": "http", "http": map[string]any{"path": "healthz"}},
+	}})
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "path must start with /") {
+		t.Fatalf("invalid http probe = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestUpdateUpstreamKeepsMeasurementKeyFile(t *testing.T) {
+	server := newTestControlServer(t)
+	base := runningTopology(t, config.UpstreamConfig{
+		Tag: "a", Destination: config.DestinationConfig{Host: "127.0.0.1", Port: 443},
+		Measurement: config.UpstreamMeasurementConfig{Port: 9876, KeyFile: "/etc/fbforward/a.key"},
+	})
+	applied := applyTopologyTo(server, base)
+
+	rec := callTestRPC(t, server, "0123456789abcdef", "UpdateUpstream", map[string]any{"tag": "a", "upstream": map[string]any{"measurement": map[string]any{"port": 9877}}})
+	if up := applied.Upstreams[0]; rec.Code != http.StatusOK || up.Measurement.KeyFile != "/etc/fbforward/a.key" || up.Measurement.Port != 9877 {
+		t.Fatalf("update dropped the key file: %d %s %+v", rec.Code, rec.Body.String(), up.Measurement)
+	}
+	rec = callTestRPC(t, server, "0123456789abcdef", "UpdateUpstream", map[string]any{"tag": "a", "upstream": map[string]any{"measurement": map[string]any{"key_file": "/etc/fbforward/b.key"}}})
+	if up := applied.Upstreams[0]; rec.Code != http.StatusOK || up.Measurement.KeyFile != "/etc/fbforward/b.key" {
+		t.Fatalf("update did not set the key file: %d %s %+v", rec.Code, rec.Body.String(), up.Measurement)
+	}
+	rec = callTestRPC(t, server, "0123456789abcdef", "UpdateUpstream", map[string]any{"tag": "a", "upstream": map[string]any{"measurement": map[string]any{"type": "tcp_connect"}}})
+	if up := applied.Upstreams[0]; rec.Code != http.StatusOK || up.Measurement.KeyFile != "" || up.Measurement.Type != config.ProbeTCPConnect {
+		t.Fatalf("switch to tcp_connect: %d %s %+v", rec.Code, rec.Body.String(), up.Measurement)
+	}
+}
@@ -27,6 +27,7 @@ type statusResponse struct {
 	ActiveUpstream string                      `json:"active_upstream"`
 	Upstreams      []upstream.UpstreamSnapshot `json:"upstreams"`
 	Routes         []upstream.RouteStatus      `json:"routes,omitempty"`
+	Drains         []drainProgress             `json:"drains,omitempty"`
 }
 
 func (c *ControlServer) rpcSetUpstream(ctx *rpcContext, raw json.RawMessage) (any, *rpcFault) {
@@ -81,6 +82,7 @@ func (c *ControlServer) rpcGetStatus(_ *rpcContext, raw json.RawMessage) (any, *
 	if c.routes != nil {
 		response.Routes = c.routes.RouteStatus()
 	}
+	response.Drains = c.drainProgress()
 	return rpcOK(response)
 }
 
@@ -104,8 +106,8 @@ func (c *ControlServer) rpcRunMeasurement(ctx *rpcContext, raw json.RawMessage)
 	}
 	tag := strings.TrimSpace(params.Tag)
 	protocol := strings.ToLower(strings.TrimSpace(params.Protocol))
-	if protocol != "tcp" && protocol != "udp" {
-		return rpcError(http.StatusBadRequest, "protocol must be tcp or udp")
+	if protocol != "tcp" && protocol != "udp" && protocol != "throughput" {
+		return rpcError(http.StatusBadRequest, "protocol must be tcp, udp or throughput")
 	}
 	up := c.manager.Get(tag)
 	if up == nil {
@@ -202,6 +202,23 @@ func (r *Registry) withControl(id ID, pick func(Controls) func() bool) bool {
 	return callback()
 }
 
+// ActiveByUpstream counts open Flows per upstream tag. An empty route counts
+// Flows across all routes.
+func (r *Registry) ActiveByUpstream(route string) map[string]int {
+	counts := make(map[string]int)
+	if r == nil {
+		return counts
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, entry := range r.entries {
+		if route == "" || entry.meta.Route == route {
+			counts[entry.meta.Upstream]++
+		}
+	}
+	return counts
+}
+
 func (r *Registry) CloseByUpstream(upstream string) {
 	if r == nil {
 		return
@@ -132,6 +132,21 @@ func TestRegistryClosesMatchingFlowsOutsideRegistryLock(t *testing.T) {
 	}
 }
 
+func TestRegistryCountsActiveFlowsByUpstream(t *testing.T) {
+	registry := NewRegistry()
+	for _, spec := range []struct{ route, upstream string }{{"web", "primary"}, {"web", "primary"}, {"web", "backup"}, {"dns", "primary"}} {
+		meta := newTestMeta(t, spec.upstream)
+		meta.Route = spec.route
+		registry.Register(meta, nil)
+	}
+	if got := registry.ActiveByUpstream(""); got["primary"] != 3 || got["backup"] != 1 {
+		t.Fatalf("unexpected counts across routes: %v", got)
+	}
+	if got := registry.ActiveByUpstream("web"); got["primary"] != 2 || got["backup"] != 1 {
+		t.Fatalf("unexpected counts for route: %v", got)
+	}
+}
+
 func TestRegistryDispatchesFlowControlsOutsideRegistryLock(t *testing.T) {
 	registry := NewRegistry()
 	meta := newTestMeta(t, "primary")
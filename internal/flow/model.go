@@ -11,14 +11,33 @@ const (
 )
 
 // Meta contains the immutable attributes assigned when a Flow is admitted.
+// UpstreamAddr is the destination endpoint dialed for the Flow; its port can
+// differ from the listener port when a route or upstream maps ports. PeerAddr
+// is set only when a trusted PROXY header replaced the socket peer, in which
+// case ClientAddr is the real client and PeerAddr is the load balancer.
+// SelectionRule names the route selection rule that matched the client.
+// DialAttempts lists the upstreams tried before the Flow connected, ending
+// with the one that succeeded.
 type Meta struct {
-	ID         ID
-	Protocol   string
-	ClientAddr netip.AddrPort
-	Listener   string
-	Route      string
-	Upstream   string
-	StartedAt  time.Time
+	ID            ID
+	Protocol      string
+	ClientAddr    netip.AddrPort
+	PeerAddr      netip.AddrPort
+	Listener      string
+	Route         string
+	Upstream      string
+	UpstreamAddr  netip.AddrPort
+	SelectionRule string
+	DialAttempts  []DialAttempt
+	StartedAt     time.Time
+}
+
+// DialAttempt is one upstream connect attempt made while admitting a Flow. An
+// empty Error means the attempt succeeded.
+type DialAttempt struct {
+	Upstream string
+	Addr     netip.AddrPort
+	Error    string
 }
 
 // BackendTuple identifies the socket created by fbforward to reach an
@@ -50,13 +69,16 @@ type Summary struct {
 	CloseReason  string
 }
 
-// Rejection represents an admission failure before a Flow exists.
+// Rejection represents an admission failure before a Flow exists. For
+// dial_failed rejections DialAttempts lists every upstream that was tried.
 type Rejection struct {
 	Protocol         string
 	ClientAddr       netip.AddrPort
+	PeerAddr         netip.AddrPort
 	Listener         string
 	Reason           string
 	MatchedRuleType  string
 	MatchedRuleValue string
+	DialAttempts     []DialAttempt
 	RecordedAt       time.Time
 }
@@ -0,0 +1,188 @@
+package forwarding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/flow"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// dialFailover bounds how many distinct upstreams one new Flow may try and
+// how long connecting may take in total. The zero value tries one upstream
+// with no budget beyond the per-dial timeouts.
+type dialFailover struct {
+	maxAttempts int
+	budget      time.Duration
+}
+
+func newDialFailover(cfg config.DialFailoverConfig) dialFailover {
+	return dialFailover{maxAttempts: cfg.MaxAttempts, budget: cfg.Budget.Duration()}
+}
+
+func (f dialFailover) enabled() bool {
+	return f.maxAttempts > 1
+}
+
+var errFailoverSelection = errors.New("upstream selection failed")
+var errFailoverDial = errors.New("upstream dial failed")
+
+// failoverError carries the attempts made before connect gave up so the
+// rejection records which upstreams were tried.
+type failoverError struct {
+	err      error
+	attempts []flow.DialAttempt
+}
+
+func (e *failoverError) Error() string {
+	return e.err.Error()
+}
+
+func (e *failoverError) Unwrap() error {
+	return e.err
+}
+
+func dialAttemptsFrom(err error) []flow.DialAttempt {
+	var failed *failoverError
+	if errors.As(err, &failed) {
+		return failed.attempts
+	}
+	return nil
+}
+
+type upstreamDialer func(ctx context.Context, addr netip.AddrPort, tag string) (net.Conn, error)
+
+// dialRequest describes how one new Flow reaches an upstream. hedge is nil
+// unless the listener races connects; it replaces pick for the first choice.
+type dialRequest struct {
+	picker      UpstreamPicker
+	pick        func() (Upstream, error)
+	hedge       func() (Upstream, Upstream, time.Duration, error)
+	dial        upstreamDialer
+	listenPort  int
+	cooldown    time.Duration
+	perUpstream time.Duration
+	pinned      bool
+	recorder    HedgeRecorder
+	route       string
+	logger      util.Logger
+}
+
+type dialOutcome struct {
+	upstream Upstream
+	addr     netip.AddrPort
+	conn     net.Conn
+	attempts []flow.DialAttempt
+}
+
+func (r dialRequest) markFailure(selected Upstream) {
+	if feedback, ok := r.picker.(DialFeedback); ok {
+		feedback.MarkDialFailure(selected, r.cooldown)
+	}
+	if feedback, ok := r.picker.(HealthFeedback); ok {
+		feedback.RecordFlowOutcome(selected.Tag, "dial_error")
+	}
+}
+
+func (r dialRequest) clearFailure(selected Upstream) {
+	if feedback, ok := r.picker.(DialFeedback); ok {
+		feedback.ClearDialFailure(selected)
+	}
+}
+
+// connect picks and dials upstreams until one connects. A failed upstream is
+// put in dial cooldown before the next pick, so the picker's own health and
+// cooldown rules choose the next candidate. Connecting stops when the picker
+// repeats an upstream, the attempt limit is reached, or the budget runs out.
+// A firewall upstream override is never replaced by another upstream.
+func (f dialFailover) connect(ctx context.Context, req dialRequest) (dialOutcome, error) {
+	limit := f.maxAttempts
+	if limit < 1 || req.pinned {
+		limit = 1
+	}
+	budgetCtx := ctx
+	if f.budget > 0 {
+		var cancel context.CancelFunc
+		budgetCtx, cancel = context.WithTimeout(ctx, f.budget)
+		defer cancel()
+	}
+	var attempts []flow.DialAttempt
+	tried := make(map[string]struct{}, limit)
+	for len(attempts) < limit {
+		var selected, hedge Upstream
+		var delay time.Duration
+		var err error
+		if len(attempts) == 0 && req.hedge != nil && !req.pinned {
+			selected, hedge, delay, err = req.hedge()
+		} else {
+			selected, err = req.pick()
+		}
+		if err == nil && !selected.Addr.IsValid() {
+			err = fmt.Errorf("upstream %q has no resolved IP", selected.Tag)
+		}
+		if err != nil {
+			if len(attempts) == 0 {
+				return dialOutcome{}, &failoverError{err: errors.Join(errFailoverSelection, err)}
+			}
+			break
+		}
+		if _, ok := tried[selected.Tag]; ok {
+			break
+		}
+		tried[selected.Tag] = struct{}{}
+		if hedge.Tag != "" && hedge.Tag != selected.Tag && hedge.Addr.IsValid() {
+			tried[hedge.Tag] = struct{}{}
+			outcome, raced := req.race(ctx, budgetCtx, selected, hedge, delay)
+			attempts = append(attempts, raced...)
+			if outcome.conn != nil {
+				outcome.attempts = attempts
+				return outcome, nil
+			}
+			if ctx.Err() != nil {
+				return dialOutcome{}, ctx.Err()
+			}
+			if budgetCtx.Err() != nil {
+				break
+			}
+			continue
+		}
+		dialCtx := budgetCtx
+		cancel := context.CancelFunc(func() {})
+		if f.enabled() && req.perUpstream > 0 {
+			dialCtx, cancel = context.WithTimeout(budgetCtx, req.perUpstream)
+		}
+		conn, addr, err := req.dialUpstream(dialCtx, selected)
+		cancel()
+		if err == nil {
+			attempts = append(attempts, flow.DialAttempt{Upstream: selected.Tag, Addr: addr})
+			req.clearFailure(selected)
+			return dialOutcome{upstream: selected, addr: addr, conn: conn, attempts: attempts}, nil
+		}
+		if ctx.Err() != nil {
+			return dialOutcome{}, ctx.Err()
+		}
+		attempts = append(attempts, flow.DialAttempt{Upstream: selected.Tag, Addr: addr, Error: err.Error()})
+		req.markFailure(selected)
+		if budgetCtx.Err() != nil {
+			break
+		}
+		if len(attempts) < limit {
+			util.Event(req.logger, slog.LevelDebug, "forward.dial_failover",
+				"upstream", selected.Tag,
+				"attempt", len(attempts),
+				"error", err,
+			)
+		}
+	}
+	last := attempts[len(attempts)-1]
+	return dialOutcome{}, &failoverError{
+		err:      fmt.Errorf("%w: %d upstream(s) tried, last %s: %s", errFailoverDial, len(attempts), last.Upstream, last.Error),
+		attempts: attempts,
+	}
+}
@@ -0,0 +1,215 @@
+package forwarding
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/flow"
+)
+
+// candidatePicker returns the first candidate not in dial cooldown, like the
+// route selector does for adaptive routes.
+type candidatePicker struct {
+	mu         sync.Mutex
+	candidates []Upstream
+	failed     map[string]bool
+}
+
+func (p *candidatePicker) Pick(flow.Meta) (Upstream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, candidate := range p.candidates {
+		if !p.failed[candidate.Tag] {
+			return candidate, nil
+		}
+	}
+	return p.candidates[0], nil
+}
+
+func (p *candidatePicker) MarkDialFailure(selected Upstream, _ time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed == nil {
+		p.failed = make(map[string]bool)
+	}
+	p.failed[selected.Tag] = true
+}
+
+func (p *candidatePicker) ClearDialFailure(selected Upstream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.failed, selected.Tag)
+}
+
+// pinnedPicker counts ordinary and override picks separately.
+type pinnedPicker struct {
+	candidatePicker
+	override      Upstream
+	pickCalls     int
+	overrideCalls int
+}
+
+func (p *pinnedPicker) Pick(meta flow.Meta) (Upstream, error) {
+	p.pickCalls++
+	return p.candidatePicker.Pick(meta)
+}
+
+func (p *pinnedPicker) PickOverride(flow.Meta, string) (Upstream, error) {
+	p.overrideCalls++
+	return p.override, nil
+}
+
+func failoverCandidate(tag string, port int) Upstream {
+	upstream := selectedUpstream()
+	upstream.Tag = tag
+	upstream.Port = port
+	return upstream
+}
+
+func TestTCPDialFailoverConnectsToNextCandidate(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		if conn, err := backend.Accept(); err == nil {
+			_ = conn.Close()
+		}
+	}()
+	picker := &candidatePicker{candidates: []Upstream{
+		failoverCandidate("refused", freeTCPPort(t)),
+		failoverCandidate("healthy", backend.Addr().(*net.TCPAddr).Port),
+	}}
+	observer := &recordingObserver{}
+	listener := &TCPListener{
+		cfg:      config.ListenerConfig{BindAddr: "127.0.0.1", BindPort: 9000},
+		picker:   picker,
+		policy:   allowedPolicy(),
+		timeout:  time.Second,
+		observer: observer,
+		sem:      make(chan struct{}, 1),
+	}
+	listener.SetDialFailover(config.DialFailoverConfig{MaxAttempts: 3, Budget: config.Duration(5 * time.Second)})
+	listener.sem <- struct{}{}
+	client := &stubConn{local: stubAddr("127.0.0.1:9000"), remote: stubAddr("192.0.2.1:12345")}
+
+	listener.handleConn(context.Background(), client)
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if len(observer.rejections) != 0 || len(observer.opens) != 1 {
+		t.Fatalf("expected one Flow and no rejection, opens=%+v rejections=%+v", observer.opens, observer.rejections)
+	}
+	opened := observer.opens[0]
+	if opened.Upstream != "healthy" || len(opened.DialAttempts) != 2 {
+		t.Fatalf("expected Flow on healthy after two attempts, got %+v", opened)
+	}
+	if opened.DialAttempts[0].Upstream != "refused" || opened.DialAttempts[0].Error == "" {
+		t.Fatalf("expected failed first attempt, got %+v", opened.DialAttempts[0])
+	}
+	if opened.DialAttempts[1].Upstream != "healthy" || opened.DialAttempts[1].Error != "" || opened.DialAttempts[1].Addr != opened.UpstreamAddr {
+		t.Fatalf("expected successful final attempt, got %+v", opened.DialAttempts[1])
+	}
+}
+
+func TestTCPDialFailoverRejectionListsEveryAttempt(t *testing.T) {
+	picker := &candidatePicker{candidates: []Upstream{
+		failoverCandidate("first", freeTCPPort(t)),
+		failoverCandidate("second", freeTCPPort(t)),
+		failoverCandidate("third", freeTCPPort(t)),
+	}}
+	observer := &recordingObserver{}
+	conn := &stubConn{local: stubAddr("127.0.0.1:9000"), remote: stubAddr("192.0.2.1:12345")}
+	listener := &TCPListener{
+		cfg:      config.ListenerConfig{BindPort: 9000},
+		picker:   picker,
+		policy:   allowedPolicy(),
+		observer: observer,
+		sem:      make(chan struct{}, 1),
+	}
+	listener.SetDialFailover(config.DialFailoverConfig{MaxAttempts: 2, Budget: config.Duration(5 * time.Second)})
+	listener.sem <- struct{}{}
+
+	listener.handleConn(context.Background(), conn)
+
+	if !conn.closed {
+		t.Fatal("expected exhausted failover to close TCP connection")
+	}
+	rejection := observer.firstRejection()
+	if observer.rejectionCount() != 1 || rejection.Reason != "dial_failed" {
+		t.Fatalf("unexpected rejection: %+v", observer.rejections)
+	}
+	if len(rejection.DialAttempts) != 2 || rejection.DialAttempts[0].Upstream != "first" || rejection.DialAttempts[1].Upstream != "second" {
+		t.Fatalf("expected attempts bounded by max_attempts, got %+v", rejection.DialAttempts)
+	}
+}
+
+func TestTCPDialFailoverKeepsFirewallOverride(t *testing.T) {
+	picker := &pinnedPicker{
+		candidatePicker: candidatePicker{candidates: []Upstream{failoverCandidate("other", freeTCPPort(t))}},
+		override:        failoverCandidate("pinned", freeTCPPort(t)),
+	}
+	observer := &recordingObserver{}
+	conn := &stubConn{local: stubAddr("127.0.0.1:9000"), remote: stubAddr("192.0.2.1:12345")}
+	listener := &TCPListener{
+		cfg:      config.ListenerConfig{BindPort: 9000},
+		picker:   picker,
+		policy:   &fakePolicy{decision: Decision{Allowed: true, UpstreamOverride: "pinned"}},
+		observer: observer,
+		sem:      make(chan struct{}, 1),
+	}
+	listener.SetDialFailover(config.DialFailoverConfig{MaxAttempts: 3, Budget: config.Duration(5 * time.Second)})
+	listener.sem <- struct{}{}
+
+	listener.handleConn(context.Background(), conn)
+
+	if picker.pickCalls != 0 || picker.overrideCalls != 1 {
+		t.Fatalf("expected one override pick and no fallback, pick=%d override=%d", picker.pickCalls, picker.overrideCalls)
+	}
+	if rejection := observer.firstRejection(); rejection.Reason != "dial_failed" || len(rejection.DialAttempts) != 1 {
+		t.Fatalf("unexpected override rejection: %+v", observer.rejections)
+	}
+}
+
+func TestUDPMappingFailsOverToNextCandidate(t *testing.T) {
+	backend, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	picker := &candidatePicker{candidates: []Upstream{
+		failoverCandidate("broken", 70000),
+		failoverCandidate("healthy", backend.LocalAddr().(*net.UDPAddr).Port),
+	}}
+	observer := &recordingObserver{}
+	listener := &UDPListener{
+		cfg:      config.ListenerConfig{BindAddr: "127.0.0.1", BindPort: 9000},
+		picker:   picker,
+		timeout:  time.Second,
+		observer: observer,
+		sem:      make(chan struct{}, 1),
+	}
+	listener.sem <- struct{}{}
+	listener.SetDialFailover(config.DialFailoverConfig{MaxAttempts: 3, Budget: config.Duration(5 * time.Second)})
+	clientAddr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 12345}
+	candidate, err := newCandidateMeta(flow.ProtocolUDP, clientAddr.String(), listener.listenAddr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapping, err := listener.buildMapping(clientAddr, candidate, Decision{})
+	if err != nil {
+		t.Fatalf("buildMapping error: %v", err)
+	}
+	defer mapping.closeWithReason("test")
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if len(observer.opens) != 1 || observer.opens[0].Upstream != "healthy" || len(observer.opens[0].DialAttempts) != 2 {
+		t.Fatalf("expected UDP Flow on healthy after two attempts, got %+v", observer.opens)
+	}
+}
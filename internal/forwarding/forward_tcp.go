@@ -15,15 +15,18 @@ import (
 )
 
 type TCPListener struct {
-	cfg      config.ListenerConfig
-	picker   UpstreamPicker
-	policy   AdmissionPolicy
-	timeout  time.Duration
-	observer FlowObserver
-	registry *flow.Registry
-	binder   BackendBinder
-	sem      chan struct{}
-	logger   util.Logger
+	cfg            config.ListenerConfig
+	picker         UpstreamPicker
+	policy         AdmissionPolicy
+	timeout        time.Duration
+	observer       FlowObserver
+	registry       *flow.Registry
+	binder         BackendBinder
+	trustedProxies []netip.Prefix
+	failover       dialFailover
+	hedgeRecorder  HedgeRecorder
+	sem            chan struct{}
+	logger         util.Logger
 
 	listener net.Listener
 }
@@ -31,6 +34,7 @@ type TCPListener struct {
 const (
 	tcpDialTimeout         = 5 * time.Second
 	tcpDialFailureCooldown = 5 * time.Second
+	tcpProxyHeaderTimeout  = 5 * time.Second
 	tcpBufferSize          = 32 * 1024
 )
 
@@ -43,18 +47,29 @@ var tcpBufPool = sync.Pool{
 
 func NewTCPListener(cfg config.ListenerConfig, limits config.ForwardingLimitsConfig, timeout time.Duration, picker UpstreamPicker, policy AdmissionPolicy, observer FlowObserver, registry *flow.Registry, binder BackendBinder, logger util.Logger) *TCPListener {
 	return &TCPListener{
-		cfg:      cfg,
-		picker:   picker,
-		policy:   policy,
-		timeout:  timeout,
-		observer: observer,
-		registry: registry,
-		binder:   binder,
-		sem:      make(chan struct{}, limits.MaxTCPConnections),
-		logger:   util.ComponentLogger(logger, util.CompForwardTCP),
+		cfg:            cfg,
+		picker:         picker,
+		policy:         policy,
+		timeout:        timeout,
+		observer:       observer,
+		registry:       registry,
+		binder:         binder,
+		trustedProxies: cfg.ProxyProtocol.Prefixes(),
+		sem:            make(chan struct{}, limits.MaxTCPConnections),
+		logger:         util.ComponentLogger(logger, util.CompForwardTCP),
 	}
 }
 
+// SetDialFailover enables trying further route candidates when the selected
+// upstream refuses or times out. It must be called before Start.
+func (l *TCPListener) SetDialFailover(cfg config.DialFailoverConfig) {
+	l.failover = newDialFailover(cfg)
+}
+
+func (l *TCPListener) SetHedgeRecorder(recorder HedgeRecorder) {
+	l.hedgeRecorder = recorder
+}
+
 func (l *TCPListener) Start(ctx context.Context, wg *sync.WaitGroup) error {
 	addr := net.JoinHostPort(l.cfg.BindAddr, util.FormatPort(l.cfg.BindPort))
 	ln, err := net.Listen("tcp", addr)
@@ -117,88 +132,112 @@ func (l *TCPListener) handleConn(ctx context.Context, client net.Conn) {
 	if tcpConn, ok := client.(*net.TCPConn); ok {
 		applyTCPOptions(tcpConn)
 	}
+	client, peer, err := l.acceptProxyHeader(client)
+	if err != nil {
+		emitRejection(l.observer, flow.ProtocolTCP, l.listenAddr(), client.RemoteAddr().String(), "proxy_header_invalid", Decision{})
+		util.Event(l.logger, slog.LevelWarn, "forward.tcp.proxy_header_invalid",
+			"peer.addr", client.RemoteAddr().String(),
+			"error", err,
+		)
+		_ = client.Close()
+		return
+	}
 	clientAddr := client.RemoteAddr().String()
 	candidate, err := newCandidateMeta(flow.ProtocolTCP, clientAddr, l.listenAddr(), l.cfg.Route)
 	if err != nil {
 		_ = client.Close()
 		return
 	}
+	candidate.PeerAddr = peer
 	decision := Decision{Allowed: true}
 	if l.policy != nil {
 		decision = l.policy.Decide(candidate)
 		if !decision.Allowed {
-			emitRejection(l.observer, flow.ProtocolTCP, l.listenAddr(), clientAddr, "firewall_deny", decision)
+			emitRejectionFrom(l.observer, flow.ProtocolTCP, l.listenAddr(), clientAddr, peer, "firewall_deny", decision)
 			_ = client.Close()
 			return
 		}
 	}
 	if l.picker == nil {
-		emitRejection(l.observer, flow.ProtocolTCP, l.listenAddr(), clientAddr, "upstream_unusable", Decision{})
-		_ = client.Close()
-		return
-	}
-	selected, err := l.pickUpstream(candidate, decision)
-	if err != nil {
-		emitRejection(l.observer, flow.ProtocolTCP, l.listenAddr(), clientAddr, "upstream_unusable", Decision{})
-		util.Event(l.logger, slog.LevelWarn, "forward.tcp.upstream_selection_failed", "error", err)
+		emitRejectionFrom(l.observer, flow.ProtocolTCP, l.listenAddr(), clientAddr, peer, "upstream_unusable", Decision{})
 		_ = client.Close()
 		return
 	}
-	if !selected.Addr.IsValid() {
-		emitRejection(l.observer, flow.ProtocolTCP, l.listenAddr(), clientAddr, "upstream_unusable", Decision{})
-		util.Event(l.logger, slog.LevelWarn, "forward.tcp.dial_failed",
-			"upstream", selected.Tag,
-			"result", "failed",
-		)
-		_ = client.Close()
-		return
+	req := dialRequest{
+		picker: l.picker,
+		pick: func() (Upstream, error) {
+			return l.pickUpstream(candidate, decision)
+		},
+		dial: func(dialCtx context.Context, addr netip.AddrPort, tag string) (net.Conn, error) {
+			return dialTCPWithRetry(dialCtx, addr.String(), 2, 150*time.Millisecond, l.logger, tag)
+		},
+		listenPort:  l.cfg.BindPort,
+		cooldown:    tcpDialFailureCooldown,
+		perUpstream: tcpDialTimeout,
+		pinned:      decision.UpstreamOverride != "",
+		recorder:    l.hedgeRecorder,
+		route:       l.cfg.Route,
+		logger:      l.logger,
+	}
+	if picker, ok := l.picker.(HedgePicker); ok {
+		req.hedge = func() (Upstream, Upstream, time.Duration, error) {
+			return picker.PickHedged(candidate)
+		}
 	}
-	upstreamIP := selected.Addr.String()
-	util.Event(l.logger, slog.LevelDebug, "forward.tcp.upstream_selected",
-		"upstream", selected.Tag,
-		"upstream.ip", upstreamIP,
-	)
-	remoteAddr := net.JoinHostPort(selected.Addr.String(), util.FormatPort(l.cfg.BindPort))
-	upConn, err := dialTCPWithRetry(ctx, remoteAddr, 2, 150*time.Millisecond, l.logger, selected.Tag)
+	dialed, err := l.failover.connect(ctx, req)
 	if err != nil {
 		if ctx.Err() != nil {
 			_ = client.Close()
 			return
 		}
-		emitRejection(l.observer, flow.ProtocolTCP, l.listenAddr(), clientAddr, "dial_failed", Decision{})
+		if errors.Is(err, errFailoverSelection) {
+			emitRejectionFrom(l.observer, flow.ProtocolTCP, l.listenAddr(), clientAddr, peer, "upstream_unusable", Decision{})
+			util.Event(l.logger, slog.LevelWarn, "forward.tcp.upstream_selection_failed", "error", err)
+			_ = client.Close()
+			return
+		}
+		attempts := dialAttemptsFrom(err)
+		emitDialRejection(l.observer, flow.ProtocolTCP, l.listenAddr(), clientAddr, peer, "dial_failed", Decision{}, attempts)
 		util.Event(l.logger, slog.LevelWarn, "forward.tcp.dial_failed",
-			"upstream", selected.Tag,
-			"upstream.ip", upstreamIP,
+			"upstream", attempts[len(attempts)-1].Upstream,
+			"dial.attempts", len(attempts),
 			"error", err,
 			"result", "failed",
 		)
-		if feedback, ok := l.picker.(DialFeedback); ok {
-			feedback.MarkDialFailure(selected, tcpDialFailureCooldown)
-		}
 		_ = client.Close()
 		return
 	}
-	if feedback, ok := l.picker.(DialFeedback); ok {
-		feedback.ClearDialFailure(selected)
-	}
+	selected := dialed.upstream
+	upstreamIP := dialed.addr.Addr().String()
+	util.Event(l.logger, slog.LevelDebug, "forward.tcp.upstream_selected",
+		"upstream", selected.Tag,
+		"upstream.ip", upstreamIP,
+		"dial.attempts", len(dialed.attempts),
+	)
 
 	conn := &tcpConn{
-		client:       client,
-		upstream:     upConn,
-		upstreamTag:  selected.Tag,
-		listenPort:   l.cfg.BindPort,
-		timeout:      l.timeout,
-		logger:       l.logger,
-		observer:     l.observer,
-		registry:     l.registry,
-		binder:       l.binder,
-		rateLimiter:  newByteRateLimiter(decision.RateLimitBPS),
-		upstreamIP:   upstreamIP,
-		upstreamAddr: remoteAddr,
-		listenAddr:   net.JoinHostPort(l.cfg.BindAddr, util.FormatPort(l.cfg.BindPort)),
-		route:        l.cfg.Route,
-		created:      candidate.StartedAt,
-	}
+		client:        client,
+		upstream:      dialed.conn,
+		upstreamTag:   selected.Tag,
+		selectionRule: selected.SelectionRule,
+		listenPort:    l.cfg.BindPort,
+		timeout:       l.timeout,
+		logger:        l.logger,
+		observer:      l.observer,
+		registry:      l.registry,
+		binder:        l.binder,
+		rateLimiter:   newByteRateLimiter(decision.RateLimitBPS),
+		upstreamIP:    upstreamIP,
+		upstreamAddr:  dialed.addr.String(),
+		upstreamEnd:   dialed.addr,
+		dialAttempts:  dialed.attempts,
+		peerAddr:      peer,
+		proxyVersion:  selected.ProxyProtocol,
+		listenAddr:    net.JoinHostPort(l.cfg.BindAddr, util.FormatPort(l.cfg.BindPort)),
+		route:         l.cfg.Route,
+		created:       candidate.StartedAt,
+	}
+	conn.feedback, _ = l.picker.(HealthFeedback)
 	conn.start(ctx)
 }
 
@@ -217,22 +256,28 @@ func (l *TCPListener) pickUpstream(candidate flow.Meta, decision Decision) (Upst
 }
 
 type tcpConn struct {
-	client       net.Conn
-	upstream     net.Conn
-	upstreamTag  string
-	listenPort   int
-	timeout      time.Duration
-	logger       util.Logger
-	observer     FlowObserver
-	registry     *flow.Registry
-	binder       BackendBinder
-	rateLimiter  *byteRateLimiter
-	upstreamIP   string
-	upstreamAddr string
-	listenAddr   string
-	route        string
-	clientAddr   string
-	clientIP     string
+	client        net.Conn
+	upstream      net.Conn
+	upstreamTag   string
+	selectionRule string
+	listenPort    int
+	timeout       time.Duration
+	logger        util.Logger
+	observer      FlowObserver
+	registry      *flow.Registry
+	binder        BackendBinder
+	rateLimiter   *byteRateLimiter
+	upstreamIP    string
+	upstreamAddr  string
+	upstreamEnd   netip.AddrPort
+	dialAttempts  []flow.DialAttempt
+	peerAddr      netip.AddrPort
+	proxyVersion  string
+	listenAddr    string
+	route         string
+	clientAddr    string
+	clientIP      string
+	feedback      HealthFeedback
 
 	id         flow.ID
 	controlMu  sync.Mutex
@@ -241,6 +286,10 @@ type tcpConn struct {
 	activityCh chan struct{}
 	created    time.Time
 	lifecycle  *flow.Lifecycle
+
+	// upstreamSignal is the passive health signal seen on the upstream
+	// socket before the Flow closed. It is guarded by controlMu.
+	upstreamSignal string
 }
 
 func (c *tcpConn) start(ctx context.Context) {
@@ -273,13 +322,17 @@ func (c *tcpConn) start(ctx context.Context) {
 		return
 	}
 	c.lifecycle = flow.NewLifecycle(flow.Meta{
-		ID:         c.id,
-		Protocol:   flow.ProtocolTCP,
-		ClientAddr: clientEndpoint,
-		Listener:   c.listenAddr,
-		Route:      c.route,
-		Upstream:   c.upstreamTag,
-		StartedAt:  c.created,
+		ID:            c.id,
+		Protocol:      flow.ProtocolTCP,
+		ClientAddr:    clientEndpoint,
+		PeerAddr:      c.peerAddr,
+		Listener:      c.listenAddr,
+		Route:         c.route,
+		Upstream:      c.upstreamTag,
+		UpstreamAddr:  c.upstreamEnd,
+		SelectionRule: c.selectionRule,
+		DialAttempts:  c.dialAttempts,
+		StartedAt:     c.created,
 	}, c.observer, c.registry, c.close)
 	c.lifecycle.Open()
 	if c.registry != nil {
@@ -296,6 +349,15 @@ func (c *tcpConn) start(ctx context.Context) {
 			util.Event(c.logger, slog.LevelWarn, "forward.tcp.backend_bind_failed", "flow.id", c.id, "error", bindErr)
 		}
 	}
+	if err := c.writeProxyHeader(clientEndpoint); err != nil {
+		util.Event(c.logger, slog.LevelWarn, "forward.tcp.proxy_header_failed",
+			"flow.id", c.id,
+			"upstream", c.upstreamTag,
+			"error", err,
+		)
+		c.closeWithReason("write_error")
+		return
+	}
 	util.Event(c.logger, slog.LevelInfo, "forward.tcp.connection_opened",
 		"flow.id", c.id,
 		"request.protocol", "tcp",
@@ -312,6 +374,19 @@ func (c *tcpConn) start(ctx context.Context) {
 	c.serve(flowCtx)
 }
 
+// writeProxyHeader sends the PROXY header before any client bytes so it is
+// never counted as Flow traffic.
+func (c *tcpConn) writeProxyHeader(client netip.AddrPort) error {
+	header, err := proxyHeader(c.proxyVersion, flow.ProtocolTCP, c.id, client, localEndpoint(c.client.LocalAddr(), c.listenAddr), c.listenAddr, c.route)
+	if err != nil || header == nil {
+		return err
+	}
+	_ = c.upstream.SetWriteDeadline(time.Now().Add(tcpDialTimeout))
+	defer c.upstream.SetWriteDeadline(time.Time{})
+	_, err = c.upstream.Write(header)
+	return err
+}
+
 type tcpCopyDirection struct {
 	result tcpCopyResult
 	up     bool
@@ -329,6 +404,7 @@ func (c *tcpConn) serve(ctx context.Context) {
 		select {
 		case direction := <-results:
 			remaining--
+			c.noteUpstreamEnd(direction, remaining)
 			if direction.result.end == tcpCopyEOF {
 				destination := c.client
 				if direction.up {
@@ -375,6 +451,32 @@ func (c *tcpConn) copyDirection(ctx context.Context, dst, src net.Conn, up bool,
 	results <- tcpCopyDirection{result: result, up: up}
 }
 
+// noteUpstreamEnd records how the upstream-to-client direction ended while
+// the Flow is still open: a read error, or the upstream closing first without
+// having sent a byte.
+func (c *tcpConn) noteUpstreamEnd(direction tcpCopyDirection, remaining int) {
+	if direction.up || c.feedback == nil {
+		return
+	}
+	signal := ""
+	switch direction.result.end {
+	case tcpCopyReadError:
+		signal = "read_error"
+	case tcpCopyEOF:
+		if remaining == 1 && c.lifecycle != nil && c.lifecycle.Snapshot().BytesDown == 0 {
+			signal = "upstream_close"
+		}
+	}
+	if signal == "" {
+		return
+	}
+	c.controlMu.Lock()
+	if !c.closed && c.upstreamSignal == "" {
+		c.upstreamSignal = signal
+	}
+	c.controlMu.Unlock()
+}
+
 func tcpCopyCloseReason(result tcpCopyResult) string {
 	switch result.end {
 	case tcpCopyReadError:
@@ -499,6 +601,7 @@ func (c *tcpConn) closeWithReason(reason string) bool {
 	}
 	c.closed = true
 	cancel := c.cancel
+	upstreamSignal := c.upstreamSignal
 	c.controlMu.Unlock()
 	if cancel != nil {
 		cancel()
@@ -513,6 +616,9 @@ func (c *tcpConn) closeWithReason(reason string) bool {
 	if c.lifecycle != nil {
 		counters = c.lifecycle.Snapshot()
 		c.lifecycle.Close(reason)
+		if c.feedback != nil {
+			c.feedback.RecordFlowOutcome(c.upstreamTag, flowOutcome(flow.ProtocolTCP, upstreamSignal, reason, counters))
+		}
 	}
 	util.Event(c.logger, slog.LevelInfo, "forward.tcp.connection_closed",
 		"flow.id", c.id,
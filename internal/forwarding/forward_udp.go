@@ -25,6 +25,7 @@ type UDPListener struct {
 	registry     *flow.Registry
 	binder       BackendBinder
 	dropRecorder RateLimitDropRecorder
+	failover     dialFailover
 	sem          chan struct{}
 	logger       util.Logger
 
@@ -82,6 +83,12 @@ func (l *UDPListener) SetRateLimitDropRecorder(recorder RateLimitDropRecorder) {
 	l.dropRecorder = recorder
 }
 
+// SetDialFailover enables trying further route candidates when a mapping's
+// upstream socket cannot be created. It must be called before Start.
+func (l *UDPListener) SetDialFailover(cfg config.DialFailoverConfig) {
+	l.failover = newDialFailover(cfg)
+}
+
 func (l *UDPListener) Start(ctx context.Context, wg *sync.WaitGroup) error {
 	addr := net.JoinHostPort(l.cfg.BindAddr, util.FormatPort(l.cfg.BindPort))
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
@@ -252,44 +259,49 @@ func (l *UDPListener) buildMapping(clientAddr *net.UDPAddr, candidate flow.Meta,
 	if l.picker == nil {
 		return nil, errors.Join(errUDPUpstreamSelection, errors.New("upstream picker is unavailable"))
 	}
-	var selected Upstream
-	var err error
-	if decision.UpstreamOverride != "" {
-		picker, ok := l.picker.(OverridePicker)
-		if !ok {
-			return nil, errors.Join(errUDPUpstreamSelection, errors.New("upstream override is not supported"))
-		}
-		selected, err = picker.PickOverride(candidate, decision.UpstreamOverride)
-	} else {
-		selected, err = l.picker.Pick(candidate)
-	}
-	if err != nil {
-		return nil, errors.Join(errUDPUpstreamSelection, err)
-	}
-	if !selected.Addr.IsValid() {
-		return nil, errors.Join(errUDPUpstreamSelection, errors.New("upstream has no resolved IP"))
-	}
-	upstreamIP := selected.Addr.String()
-	util.Event(l.logger, slog.LevelDebug, "forward.udp.upstream_selected",
-		"upstream", selected.Tag,
-		"upstream.ip", upstreamIP,
-	)
-	upAddr := &net.UDPAddr{IP: net.IP(selected.Addr.AsSlice()), Port: l.cfg.BindPort, Zone: selected.Addr.Zone()}
-	upConn, err := net.DialUDP("udp", nil, upAddr)
+	// UDP sockets connect without a handshake, so only local errors such as a
+	// missing route fail here and the budget rarely matters.
+	dialed, err := l.failover.connect(context.Background(), dialRequest{
+		picker: l.picker,
+		pick: func() (Upstream, error) {
+			if decision.UpstreamOverride != "" {
+				picker, ok := l.picker.(OverridePicker)
+				if !ok {
+					return Upstream{}, errors.New("upstream override is not supported")
+				}
+				return picker.PickOverride(candidate, decision.UpstreamOverride)
+			}
+			return l.picker.Pick(candidate)
+		},
+		dial: func(dialCtx context.Context, addr netip.AddrPort, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(dialCtx, "udp", addr.String())
+		},
+		listenPort: l.cfg.BindPort,
+		cooldown:   udpDialFailureCooldown,
+		pinned:     decision.UpstreamOverride != "",
+		route:      l.cfg.Route,
+		logger:     l.logger,
+	})
 	if err != nil {
+		if errors.Is(err, errFailoverSelection) {
+			return nil, errors.Join(errUDPUpstreamSelection, err)
+		}
 		util.Event(l.logger, slog.LevelWarn, "forward.udp.dial_failed",
-			"upstream", selected.Tag,
+			"dial.attempts", len(dialAttemptsFrom(err)),
 			"error", err,
 			"result", "failed",
 		)
-		if feedback, ok := l.picker.(DialFeedback); ok {
-			feedback.MarkDialFailure(selected, udpDialFailureCooldown)
-		}
 		return nil, errors.Join(errUDPUpstreamDial, err)
 	}
-	if feedback, ok := l.picker.(DialFeedback); ok {
-		feedback.ClearDialFailure(selected)
-	}
+	selected := dialed.upstream
+	upConn := dialed.conn.(*net.UDPConn)
+	upstreamIP := dialed.addr.Addr().String()
+	util.Event(l.logger, slog.LevelDebug, "forward.udp.upstream_selected",
+		"upstream", selected.Tag,
+		"upstream.ip", upstreamIP,
+		"dial.attempts", len(dialed.attempts),
+	)
 	clientAddrStr := clientAddr.String()
 	listenAddr := net.JoinHostPort(l.cfg.BindAddr, util.FormatPort(l.cfg.BindPort))
 	mapping := &udpMapping{
@@ -306,10 +318,11 @@ func (l *UDPListener) buildMapping(clientAddr *net.UDPAddr, candidate flow.Meta,
 		done:          make(chan struct{}),
 		created:       candidate.StartedAt,
 		upstreamIP:    upstreamIP,
-		upstreamAddr:  upAddr.String(),
+		upstreamAddr:  dialed.addr.String(),
 		listenAddr:    listenAddr,
 		route:         l.cfg.Route,
 	}
+	mapping.feedback, _ = l.picker.(HealthFeedback)
 	clientEndpoint, err := netip.ParseAddrPort(clientAddrStr)
 	if err != nil {
 		_ = upConn.Close()
@@ -320,14 +333,22 @@ func (l *UDPListener) buildMapping(clientAddr *net.UDPAddr, candidate flow.Meta,
 		_ = upConn.Close()
 		return nil, err
 	}
+	mapping.proxyHeader, err = proxyHeader(selected.ProxyProtocol, flow.ProtocolUDP, mapping.id, clientEndpoint, l.localAddrPort(), listenAddr, mapping.route)
+	if err != nil {
+		_ = upConn.Close()
+		return nil, errors.Join(errUDPUpstreamDial, err)
+	}
 	mapping.lifecycle = flow.NewLifecycle(flow.Meta{
-		ID:         mapping.id,
-		Protocol:   flow.ProtocolUDP,
-		ClientAddr: clientEndpoint,
-		Listener:   listenAddr,
-		Route:      mapping.route,
-		Upstream:   selected.Tag,
-		StartedAt:  candidate.StartedAt,
+		ID:            mapping.id,
+		Protocol:      flow.ProtocolUDP,
+		ClientAddr:    clientEndpoint,
+		Listener:      listenAddr,
+		Route:         mapping.route,
+		Upstream:      selected.Tag,
+		UpstreamAddr:  dialed.addr,
+		SelectionRule: selected.SelectionRule,
+		DialAttempts:  dialed.attempts,
+		StartedAt:     candidate.StartedAt,
 	}, l.observer, l.registry, mapping.close)
 	mapping.lifecycle.Open()
 	if l.registry != nil {
@@ -347,13 +368,21 @@ func (l *UDPListener) buildMapping(clientAddr *net.UDPAddr, candidate flow.Meta,
 	return mapping, nil
 }
 
+func (l *UDPListener) localAddrPort() netip.AddrPort {
+	var local net.Addr
+	if l.conn != nil {
+		local = l.conn.LocalAddr()
+	}
+	return localEndpoint(local, l.listenAddr())
+}
+
 func (l *UDPListener) observeMappingFailure(clientAddress string, err error) {
 	switch {
 	case errors.Is(err, errUDPUpstreamSelection):
 		emitRejection(l.observer, flow.ProtocolUDP, l.listenAddr(), clientAddress, "upstream_unusable", Decision{})
 		util.Event(l.logger, slog.LevelWarn, "forward.udp.upstream_selection_failed", "error", err)
 	case errors.Is(err, errUDPUpstreamDial):
-		emitRejection(l.observer, flow.ProtocolUDP, l.listenAddr(), clientAddress, "dial_failed", Decision{})
+		emitDialRejection(l.observer, flow.ProtocolUDP, l.listenAddr(), clientAddress, netip.AddrPort{}, "dial_failed", Decision{}, dialAttemptsFrom(err))
 	}
 }
 
@@ -414,6 +443,8 @@ type udpMapping struct {
 	upstreamAddr  string
 	listenAddr    string
 	route         string
+	proxyHeader   []byte
+	feedback      HealthFeedback
 
 	id         flow.ID
 	controlMu  sync.Mutex
@@ -433,7 +464,14 @@ func (m *udpMapping) forwardToUpstream(payload []byte) error {
 	if !m.allowPacket(len(payload)) {
 		return errUDPRateLimited
 	}
-	if _, err := m.upstreamConn.Write(payload); err != nil {
+	datagram := payload
+	if m.proxyHeader != nil {
+		// Each datagram carries its own header because UDP has no stream
+		// start; Flow counters still reflect client payload only.
+		datagram = make([]byte, 0, len(m.proxyHeader)+len(payload))
+		datagram = append(append(datagram, m.proxyHeader...), payload...)
+	}
+	if _, err := m.upstreamConn.Write(datagram); err != nil {
 		return err
 	}
 	n := uint64(len(payload))
@@ -577,6 +615,13 @@ func (m *udpMapping) closeWithReason(reason string) bool {
 	if m.lifecycle != nil {
 		counters = m.lifecycle.Snapshot()
 		m.lifecycle.Close(reason)
+		if m.feedback != nil {
+			upstreamSignal := ""
+			if reason == "upstream_read_error" {
+				upstreamSignal = "read_error"
+			}
+			m.feedback.RecordFlowOutcome(m.upstreamTag, flowOutcome(flow.ProtocolUDP, upstreamSignal, reason, counters))
+		}
 	}
 	util.Event(m.logger, slog.LevelInfo, "forward.udp.mapping_closed",
 		"flow.id", m.id,
@@ -5,12 +5,14 @@ import (
 	"io"
 	"net"
 	"net/netip"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/NodePath81/fbforward/internal/config"
 	"github.com/NodePath81/fbforward/internal/flow"
+	"github.com/NodePath81/fbforward/internal/proxyproto"
 	"github.com/NodePath81/fbforward/internal/util"
 )
 
@@ -381,6 +383,268 @@ func TestUDPMappingBindsUpstreamSocketTuple(t *testing.T) {
 	observer.mu.Unlock()
 }
 
+func TestUDPMappingDialsMappedUpstreamPort(t *testing.T) {
+	selected := selectedUpstream()
+	selected.Port = freeTCPPort(t)
+	selected.SelectionRule = "cn-to-hk"
+	observer := &recordingObserver{}
+	listener := &UDPListener{
+		cfg:      config.ListenerConfig{BindAddr: "127.0.0.1", BindPort: freeTCPPort(t), Route: "web"},
+		picker:   &fakePicker{selected: selected},
+		observer: observer,
+		sem:      make(chan struct{}, 1),
+		mappings: make(map[string]*udpMapping),
+		pending:  make(map[string]*udpMappingReservation),
+		ipCounts: make(map[string]int),
+	}
+	listener.sem <- struct{}{}
+	clientAddr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 12345}
+	candidate, err := newCandidateMeta(flow.ProtocolUDP, clientAddr.String(), listener.listenAddr(), listener.cfg.Route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := listener.buildMapping(clientAddr, candidate, Decision{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapping.closeWithReason("test")
+	if got := mapping.upstreamConn.RemoteAddr().(*net.UDPAddr).Port; got != selected.Port {
+		t.Fatalf("UDP mapping dialed port %d, want %d", got, selected.Port)
+	}
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if len(observer.opens) != 1 || int(observer.opens[0].UpstreamAddr.Port()) != selected.Port || observer.opens[0].SelectionRule != "cn-to-hk" {
+		t.Fatalf("unexpected UDP upstream address or selection rule: %+v", observer.opens)
+	}
+}
+
+func TestTCPDialUsesMappedUpstreamPort(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		if conn, err := backend.Accept(); err == nil {
+			_ = conn.Close()
+		}
+	}()
+	backendPort := backend.Addr().(*net.TCPAddr).Port
+	selected := selectedUpstream()
+	selected.Port = backendPort
+	selected.SelectionRule = "cn-to-hk"
+	observer := &recordingObserver{}
+	binder := &recordingBinder{}
+	listener := &TCPListener{
+		cfg:      config.ListenerConfig{BindAddr: "127.0.0.1", BindPort: freeTCPPort(t), Route: "web"},
+		picker:   &fakePicker{selected: selected},
+		policy:   allowedPolicy(),
+		timeout:  time.Second,
+		observer: observer,
+		binder:   binder,
+		sem:      make(chan struct{}, 1),
+	}
+	listener.sem <- struct{}{}
+	client := &stubConn{local: stubAddr("127.0.0.1:9000"), remote: stubAddr("192.0.2.1:12345")}
+
+	listener.handleConn(context.Background(), client)
+
+	want := netip.AddrPortFrom(selected.Addr, uint16(backendPort))
+	observer.mu.Lock()
+	if len(observer.opens) != 1 || observer.opens[0].UpstreamAddr != want || observer.opens[0].SelectionRule != "cn-to-hk" {
+		t.Fatalf("expected Flow upstream address %s and selection rule, got %+v", want, observer.opens)
+	}
+	observer.mu.Unlock()
+	binder.mu.Lock()
+	defer binder.mu.Unlock()
+	if len(binder.tuples) != 1 || binder.tuples[0].BackendKey != "primary@"+want.String() {
+		t.Fatalf("expected backend key for mapped port, got %+v", binder.tuples)
+	}
+}
+
+func TestTCPWritesProxyHeaderBeforePayload(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+	selected := selectedUpstream()
+	selected.Port = backend.Addr().(*net.TCPAddr).Port
+	selected.ProxyProtocol = "v2"
+	observer := &recordingObserver{}
+	listener := &TCPListener{
+		cfg:      config.ListenerConfig{BindAddr: "127.0.0.1", BindPort: 9000, Route: "web"},
+		picker:   &fakePicker{selected: selected},
+		policy:   allowedPolicy(),
+		timeout:  time.Second,
+		observer: observer,
+		sem:      make(chan struct{}, 1),
+	}
+	listener.sem <- struct{}{}
+	client := &stubConn{local: stubAddr("127.0.0.1:9000"), remote: stubAddr("192.0.2.1:12345")}
+
+	listener.handleConn(context.Background(), client)
+
+	data := <-received
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if len(observer.opens) != 1 || len(observer.closes) != 1 {
+		t.Fatalf("expected one opened and closed Flow, opens=%d closes=%d", len(observer.opens), len(observer.closes))
+	}
+	if !strings.HasPrefix(string(data), "\r\n\r\n\x00\r\nQUIT\n") {
+		t.Fatalf("upstream did not receive a v2 header first: %q", data)
+	}
+	for _, want := range []string{observer.opens[0].ID.String(), "127.0.0.1:9000", "web"} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("PROXY header missing %q: %q", want, data)
+		}
+	}
+	if observer.closes[0].BytesUp != 0 {
+		t.Fatalf("PROXY header was counted as Flow traffic: %d", observer.closes[0].BytesUp)
+	}
+}
+
+// headerConn replays an inbound PROXY header ahead of EOF.
+type headerConn struct {
+	stubConn
+	data io.Reader
+}
+
+func (c *headerConn) Read(b []byte) (int, error) { return c.data.Read(b) }
+
+func TestTCPAcceptsProxyHeaderOnlyFromTrustedPeers(t *testing.T) {
+	v2, err := proxyproto.Header{
+		Version:     proxyproto.Version2,
+		Protocol:    proxyproto.ProtocolTCP,
+		Source:      netip.MustParseAddrPort("198.51.100.7:40000"),
+		Destination: netip.MustParseAddrPort("127.0.0.1:9000"),
+	}.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name       string
+		peer       string
+		header     string
+		wantClient string
+		wantPeer   string
+		wantReason string
+	}{
+		{name: "trusted v1", peer: "10.0.0.5:50000", header: "PROXY TCP4 198.51.100.7 127.0.0.1 40000 9000\r\n", wantClient: "198.51.100.7:40000", wantPeer: "10.0.0.5:50000", wantReason: "firewall_deny"},
+		{name: "trusted v2", peer: "10.0.0.5:50000", header: string(v2), wantClient: "198.51.100.7:40000", wantPeer: "10.0.0.5:50000", wantReason: "firewall_deny"},
+		{name: "trusted local", peer: "10.0.0.5:50000", header: "PROXY UNKNOWN\r\n", wantClient: "10.0.0.5:50000", wantReason: "firewall_deny"},
+		{name: "untrusted", peer: "192.0.2.9:50000", header: "PROXY TCP4 198.51.100.7 127.0.0.1 40000 9000\r\n", wantClient: "192.0.2.9:50000", wantReason: "firewall_deny"},
+		{name: "trusted invalid", peer: "10.0.0.5:50000", header: "GET / HTTP/1.1\r\n", wantClient: "10.0.0.5:50000", wantReason: "proxy_header_invalid"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			policy := &fakePolicy{decision: Decision{Allowed: false, RuleType: "cidr", RuleValue: "0.0.0.0/0"}}
+			observer := &recordingObserver{}
+			conn := &headerConn{
+				stubConn: stubConn{local: stubAddr("127.0.0.1:9000"), remote: stubAddr(tc.peer)},
+				data:     strings.NewReader(tc.header),
+			}
+			listener := &TCPListener{
+				cfg:            config.ListenerConfig{BindPort: 9000},
+				picker:         &fakePicker{selected: selectedUpstream()},
+				policy:         policy,
+				observer:       observer,
+				sem:            make(chan struct{}, 1),
+				trustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+			}
+			listener.sem <- struct{}{}
+
+			listener.handleConn(context.Background(), conn)
+
+			if !conn.closed {
+				t.Fatal("expected rejected connection to close")
+			}
+			rejection := observer.firstRejection()
+			if rejection.Reason != tc.wantReason {
+				t.Fatalf("rejection reason = %q, want %q", rejection.Reason, tc.wantReason)
+			}
+			if got := rejection.ClientAddr.String(); got != tc.wantClient {
+				t.Fatalf("client = %s, want %s", got, tc.wantClient)
+			}
+			if got := addrPortOrEmpty(rejection.PeerAddr); got != tc.wantPeer {
+				t.Fatalf("peer = %q, want %q", got, tc.wantPeer)
+			}
+			if tc.wantReason != "firewall_deny" {
+				return
+			}
+			policy.mu.Lock()
+			candidate := policy.metas[0]
+			policy.mu.Unlock()
+			if candidate.ClientAddr.String() != tc.wantClient {
+				t.Fatalf("policy saw client %s, want %s", candidate.ClientAddr, tc.wantClient)
+			}
+		})
+	}
+}
+
+func addrPortOrEmpty(addr netip.AddrPort) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	return addr.String()
+}
+
+func TestUDPMappingPrefixesProxyHeaderPerDatagram(t *testing.T) {
+	backend, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	selected := selectedUpstream()
+	selected.Port = backend.LocalAddr().(*net.UDPAddr).Port
+	selected.ProxyProtocol = "v2"
+	listener := &UDPListener{
+		cfg:      config.ListenerConfig{BindAddr: "127.0.0.1", BindPort: 5353, Route: "dns"},
+		picker:   &fakePicker{selected: selected},
+		sem:      make(chan struct{}, 1),
+		mappings: make(map[string]*udpMapping),
+		pending:  make(map[string]*udpMappingReservation),
+		ipCounts: make(map[string]int),
+	}
+	listener.sem <- struct{}{}
+	clientAddr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 12345}
+	candidate, err := newCandidateMeta(flow.ProtocolUDP, clientAddr.String(), listener.listenAddr(), listener.cfg.Route)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := listener.buildMapping(clientAddr, candidate, Decision{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapping.closeWithReason("test")
+	for i := 0; i < 2; i++ {
+		if err := mapping.forwardToUpstream([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 1500)
+		_ = backend.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := backend.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		datagram := string(buf[:n])
+		if !strings.HasPrefix(datagram, "\r\n\r\n\x00\r\nQUIT\n") || !strings.HasSuffix(datagram, "ping") || !strings.Contains(datagram, mapping.id.String()) {
+			t.Fatalf("datagram %d lacks PROXY v2 prefix: %q", i, datagram)
+		}
+	}
+}
+
 func TestCandidateMetaCarriesRoute(t *testing.T) {
 	candidate, err := newCandidateMeta(flow.ProtocolTCP, "127.0.0.1:40000", "127.0.0.1:5201", "iperf3")
 	if err != nil {
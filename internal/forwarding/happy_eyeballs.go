@@ -0,0 +1,123 @@
+package forwarding
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// happyEyeballsAttemptDelay is the RFC 8305 Connection Attempt Delay: how
+// long one address may stall before the next address is dialed alongside it.
+const happyEyeballsAttemptDelay = 250 * time.Millisecond
+
+// addrs returns the destinations of selected in dial order.
+func (r dialRequest) addrs(selected Upstream) ([]netip.AddrPort, error) {
+	port := selected.destinationPort(r.listenPort)
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid destination port %d", port)
+	}
+	addrs := selected.Addrs
+	if len(addrs) == 0 {
+		addrs = []netip.Addr{selected.Addr}
+	}
+	out := make([]netip.AddrPort, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr.IsValid() {
+			out = append(out, netip.AddrPortFrom(addr, uint16(port)))
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("upstream %q has no resolved IP", selected.Tag)
+	}
+	return out, nil
+}
+
+type addressResult struct {
+	addr netip.AddrPort
+	conn net.Conn
+	err  error
+}
+
+// dialUpstream connects to one of selected's addresses (RFC 8305). Addresses
+// are tried in order; the next one starts when the previous fails or after
+// the attempt delay, and the first connection wins. Each definite address
+// failure is reported through AddressFeedback. The returned address is the
+// connected one, or the first address when every address failed.
+func (r dialRequest) dialUpstream(ctx context.Context, selected Upstream) (net.Conn, netip.AddrPort, error) {
+	addrs, err := r.addrs(selected)
+	if err != nil {
+		return nil, netip.AddrPort{}, err
+	}
+	dialCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan addressResult, len(addrs))
+	next, pending := 0, 0
+	start := func() {
+		addr := addrs[next]
+		next++
+		pending++
+		go func() {
+			conn, err := r.dial(dialCtx, addr, selected.Tag)
+			results <- addressResult{addr: addr, conn: conn, err: err}
+		}()
+	}
+	start()
+	timer := time.NewTimer(happyEyeballsAttemptDelay)
+	defer timer.Stop()
+	var failures int
+	var lastErr error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if next < len(addrs) {
+				start()
+				timer.Reset(happyEyeballsAttemptDelay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				r.clearAddress(selected, res.addr.Addr())
+				if pending > 0 {
+					go closeLateConns(results, pending)
+				}
+				return res.conn, res.addr, nil
+			}
+			failures++
+			lastErr = res.err
+			if ctx.Err() == nil {
+				r.markAddress(selected, res.addr.Addr(), res.err)
+			}
+			if next < len(addrs) {
+				start()
+				timer.Reset(happyEyeballsAttemptDelay)
+			}
+		}
+	}
+	if failures > 1 {
+		lastErr = fmt.Errorf("%d addresses failed, last: %w", failures, lastErr)
+	}
+	return nil, addrs[0], lastErr
+}
+
+// closeLateConns closes connections that completed after another address won.
+func closeLateConns(results <-chan addressResult, pending int) {
+	for ; pending > 0; pending-- {
+		if res := <-results; res.conn != nil {
+			_ = res.conn.Close()
+		}
+	}
+}
+
+func (r dialRequest) markAddress(selected Upstream, addr netip.Addr, err error) {
+	if feedback, ok := r.picker.(AddressFeedback); ok {
+		feedback.MarkAddressFailure(selected, addr, r.cooldown, err)
+	}
+}
+
+func (r dialRequest) clearAddress(selected Upstream, addr netip.Addr) {
+	if feedback, ok := r.picker.(AddressFeedback); ok {
+		feedback.ClearAddressFailure(selected, addr)
+	}
+}
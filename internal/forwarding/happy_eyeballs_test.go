@@ -0,0 +1,102 @@
+package forwarding
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// addressPicker records per-address dial feedback.
+type addressPicker struct {
+	candidatePicker
+	mu      sync.Mutex
+	failed  []netip.Addr
+	cleared []netip.Addr
+}
+
+func (p *addressPicker) MarkAddressFailure(_ Upstream, addr netip.Addr, _ time.Duration, _ error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failed = append(p.failed, addr)
+}
+
+func (p *addressPicker) ClearAddressFailure(_ Upstream, addr netip.Addr) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cleared = append(p.cleared, addr)
+}
+
+// addressDialer refuses, stalls, or connects per address.
+func addressDialer(refused, stalled map[string]bool) upstreamDialer {
+	return func(ctx context.Context, addr netip.AddrPort, _ string) (net.Conn, error) {
+		switch {
+		case refused[addr.Addr().String()]:
+			return nil, errors.New("connection refused")
+		case stalled[addr.Addr().String()]:
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &stubConn{}, nil
+	}
+}
+
+func multiAddressUpstream(addrs ...string) Upstream {
+	upstream := Upstream{Tag: "dual", Port: 443}
+	for _, addr := range addrs {
+		upstream.Addrs = append(upstream.Addrs, netip.MustParseAddr(addr))
+	}
+	upstream.Addr = upstream.Addrs[0]
+	return upstream
+}
+
+func TestDialUpstreamSkipsRefusedAddressAtOnce(t *testing.T) {
+	picker := &addressPicker{}
+	req := dialRequest{picker: picker, dial: addressDialer(map[string]bool{"2001:db8::1": true}, nil), cooldown: time.Second}
+
+	start := time.Now()
+	conn, addr, err := req.dialUpstream(context.Background(), multiAddressUpstream("2001:db8::1", "192.0.2.1"))
+	if err != nil || conn == nil || addr.String() != "192.0.2.1:443" {
+		t.Fatalf("expected IPv4 fallback, addr=%s err=%v", addr, err)
+	}
+	if elapsed := time.Since(start); elapsed >= happyEyeballsAttemptDelay {
+		t.Fatalf("expected a refused address to start the next one at once, took %s", elapsed)
+	}
+	if len(picker.failed) != 1 || picker.failed[0].String() != "2001:db8::1" || len(picker.cleared) != 1 || picker.cleared[0].String() != "192.0.2.1" {
+		t.Fatalf("unexpected address feedback failed=%v cleared=%v", picker.failed, picker.cleared)
+	}
+}
+
+func TestDialUpstreamStartsNextAddressAfterAttemptDelay(t *testing.T) {
+	picker := &addressPicker{}
+	req := dialRequest{picker: picker, dial: addressDialer(nil, map[string]bool{"2001:db8::1": true})}
+
+	start := time.Now()
+	_, addr, err := req.dialUpstream(context.Background(), multiAddressUpstream("2001:db8::1", "192.0.2.1"))
+	if err != nil || addr.Addr().String() != "192.0.2.1" {
+		t.Fatalf("expected IPv4 to win over a stalled IPv6 address, addr=%s err=%v", addr, err)
+	}
+	if elapsed := time.Since(start); elapsed < happyEyeballsAttemptDelay {
+		t.Fatalf("expected the second address to wait for the attempt delay, took %s", elapsed)
+	}
+	if len(picker.failed) != 0 {
+		t.Fatalf("a stalled address that lost the race is not a failure, got %v", picker.failed)
+	}
+}
+
+func TestDialUpstreamReportsEveryAddressFailing(t *testing.T) {
+	picker := &addressPicker{}
+	req := dialRequest{picker: picker, dial: addressDialer(map[string]bool{"2001:db8::1": true, "192.0.2.1": true}, nil)}
+
+	conn, addr, err := req.dialUpstream(context.Background(), multiAddressUpstream("2001:db8::1", "192.0.2.1"))
+	if conn != nil || err == nil || !strings.Contains(err.Error(), "2 addresses failed") {
+		t.Fatalf("expected both addresses to fail, err=%v", err)
+	}
+	if addr.Addr().String() != "2001:db8::1" || len(picker.failed) != 2 {
+		t.Fatalf("expected first address and two failures, addr=%s failed=%v", addr, picker.failed)
+	}
+}
@@ -0,0 +1,22 @@
+package forwarding
+
+import "github.com/NodePath81/fbforward/internal/flow"
+
+// flowOutcome classifies an ended Flow for HealthFeedback. upstreamSignal is
+// a failure already seen on the upstream socket. Closes that fbforward made
+// itself never count against the upstream; otherwise a TCP Flow whose client
+// sent bytes that were never answered is a zero_response. UDP is often
+// one-way, so an unanswered UDP mapping is not a failure.
+func flowOutcome(protocol, upstreamSignal, reason string, counters flow.Counters) string {
+	if upstreamSignal != "" {
+		return upstreamSignal
+	}
+	switch reason {
+	case "upstream_unusable", "backend_blocked", "context_done":
+		return ""
+	}
+	if protocol == flow.ProtocolTCP && counters.BytesUp > 0 && counters.BytesDown == 0 {
+		return "zero_response"
+	}
+	return ""
+}
@@ -0,0 +1,195 @@
+package forwarding
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/flow"
+)
+
+// outcomePicker records the passive health outcomes reported by the data
+// plane.
+type outcomePicker struct {
+	fakePicker
+	outcomes chan string
+}
+
+func (p *outcomePicker) RecordFlowOutcome(tag, signal string) {
+	p.outcomes <- tag + ":" + signal
+}
+
+func TestFlowOutcomeClassification(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		signal   string
+		reason   string
+		counters flow.Counters
+		want     string
+	}{
+		{"answered", flow.ProtocolTCP, "", "eof", flow.Counters{BytesUp: 10, BytesDown: 20}, ""},
+		{"unanswered", flow.ProtocolTCP, "", "idle_timeout", flow.Counters{BytesUp: 10}, "zero_response"},
+		{"one-way udp", flow.ProtocolUDP, "", "idle_timeout", flow.Counters{BytesUp: 10}, ""},
+		{"silent", flow.ProtocolTCP, "", "eof", flow.Counters{}, ""},
+		{"upstream signal", flow.ProtocolUDP, "read_error", "read_error", flow.Counters{BytesUp: 10}, "read_error"},
+		{"closed by fbforward", flow.ProtocolTCP, "", "upstream_unusable", flow.Counters{BytesUp: 10}, ""},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := flowOutcome(testCase.protocol, testCase.signal, testCase.reason, testCase.counters); got != testCase.want {
+				t.Fatalf("flowOutcome() = %q, want %q", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestTCPReportsPassiveHealthOutcomes(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	backendConns := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			backendConns <- conn
+		}
+	}()
+	front, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer front.Close()
+
+	selected := selectedUpstream()
+	selected.Port = backend.Addr().(*net.TCPAddr).Port
+	picker := &outcomePicker{fakePicker: fakePicker{selected: selected}, outcomes: make(chan string, 4)}
+	listener := &TCPListener{
+		cfg:      config.ListenerConfig{BindAddr: "127.0.0.1", BindPort: freeTCPPort(t)},
+		picker:   picker,
+		timeout:  5 * time.Second,
+		observer: &recordingObserver{},
+		sem:      make(chan struct{}, 4),
+	}
+	// open connects a client and hands the accepted side to the listener.
+	open := func() (net.Conn, net.Conn, *sync.WaitGroup) {
+		client, err := net.Dial("tcp", front.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		accepted, err := front.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		wg.Add(1)
+		listener.sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			listener.handleConn(context.Background(), accepted)
+		}()
+		return client, <-backendConns, &wg
+	}
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-picker.outcomes:
+			if got != want {
+				t.Fatalf("outcome = %q, want %q", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no outcome reported, want %q", want)
+		}
+	}
+
+	client, upstream, wg := open()
+	_ = upstream.Close()
+	_, _ = io.Copy(io.Discard, client)
+	_ = client.Close()
+	wg.Wait()
+	expect("primary:upstream_close")
+
+	client, upstream, wg = open()
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	_ = client.(*net.TCPConn).CloseWrite()
+	_, _ = io.Copy(io.Discard, upstream)
+	_ = upstream.Close()
+	wg.Wait()
+	_ = client.Close()
+	expect("primary:zero_response")
+
+	client, upstream, wg = open()
+	_, _ = upstream.Write([]byte("welcome"))
+	_ = upstream.Close()
+	_, _ = io.Copy(io.Discard, client)
+	_ = client.Close()
+	wg.Wait()
+	expect("primary:")
+}
+
+func TestUDPOneWayFlowIsNotZeroResponse(t *testing.T) {
+	backend, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	selected := selectedUpstream()
+	selected.Port = backend.LocalAddr().(*net.UDPAddr).Port
+	picker := &outcomePicker{fakePicker: fakePicker{selected: selected}, outcomes: make(chan string, 1)}
+	listener := &UDPListener{
+		cfg:      config.ListenerConfig{BindAddr: "127.0.0.1", BindPort: freeTCPPort(t)},
+		picker:   picker,
+		timeout:  time.Second,
+		observer: &recordingObserver{},
+		sem:      make(chan struct{}, 1),
+		mappings: make(map[string]*udpMapping),
+		pending:  make(map[string]*udpMappingReservation),
+		ipCounts: make(map[string]int),
+	}
+	listener.sem <- struct{}{}
+	clientAddr := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 12345}
+	candidate, err := newCandidateMeta(flow.ProtocolUDP, clientAddr.String(), listener.listenAddr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := listener.buildMapping(clientAddr, candidate, Decision{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The backend receives the datagram but never answers.
+	if err := mapping.forwardToUpstream([]byte("telemetry")); err != nil {
+		t.Fatal(err)
+	}
+	mapping.closeWithReason("idle_timeout")
+	if got := <-picker.outcomes; got != "primary:" {
+		t.Fatalf("outcome = %q, want primary:", got)
+	}
+}
+
+func TestDialFailureReportsPassiveHealthOutcome(t *testing.T) {
+	picker := &outcomePicker{fakePicker: fakePicker{selected: selectedUpstream()}, outcomes: make(chan string, 1)}
+	picker.selected.Port = freeTCPPort(t)
+	listener := &TCPListener{
+		cfg:      config.ListenerConfig{BindPort: freeTCPPort(t)},
+		picker:   picker,
+		policy:   allowedPolicy(),
+		observer: &recordingObserver{},
+		sem:      make(chan struct{}, 1),
+	}
+	listener.sem <- struct{}{}
+	listener.handleConn(context.Background(), &stubConn{local: stubAddr("127.0.0.1:9000"), remote: stubAddr("192.0.2.1:12345")})
+	if got := <-picker.outcomes; got != "primary:dial_error" {
+		t.Fatalf("outcome = %q, want primary:dial_error", got)
+	}
+}
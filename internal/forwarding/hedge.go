@@ -0,0 +1,123 @@
+package forwarding
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/flow"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+type hedgeResult struct {
+	upstream Upstream
+	addr     netip.AddrPort
+	conn     net.Conn
+	err      error
+	hedge    bool
+	at       time.Duration
+}
+
+// race dials primary and, after delay, hedge. The first connection wins. The
+// loser keeps dialing in the background so the winning margin can be
+// measured, and is closed as soon as it connects. A primary that fails before
+// the delay starts the hedge at once. Attempts list failures in completion
+// order followed by the winner.
+func (r dialRequest) race(ctx, budgetCtx context.Context, primary, hedge Upstream, delay time.Duration) (dialOutcome, []flow.DialAttempt) {
+	start := time.Now()
+	raceCtx, cancelRace := context.WithCancel(ctx)
+	results := make(chan hedgeResult, 2)
+	launch := func(selected Upstream, isHedge bool) {
+		go func() {
+			dialCtx, cancel := raceCtx, context.CancelFunc(func() {})
+			if r.perUpstream > 0 {
+				dialCtx, cancel = context.WithTimeout(raceCtx, r.perUpstream)
+			}
+			defer cancel()
+			conn, addr, err := r.dialUpstream(dialCtx, selected)
+			results <- hedgeResult{upstream: selected, addr: addr, conn: conn, err: err, hedge: isHedge, at: time.Since(start)}
+		}()
+	}
+	pending, hedged := 1, false
+	startHedge := func() {
+		if !hedged && budgetCtx.Err() == nil {
+			hedged = true
+			pending++
+			launch(hedge, true)
+		}
+	}
+	launch(primary, false)
+	var fire <-chan time.Time
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		fire = timer.C
+	} else {
+		startHedge()
+	}
+	budgetDone := budgetCtx.Done()
+	var attempts []flow.DialAttempt
+	for pending > 0 {
+		select {
+		case <-fire:
+			fire = nil
+			startHedge()
+		case <-budgetDone:
+			budgetDone = nil
+			cancelRace()
+		case res := <-results:
+			pending--
+			if res.err != nil {
+				attempts = append(attempts, flow.DialAttempt{Upstream: res.upstream.Tag, Addr: res.addr, Error: res.err.Error()})
+				if ctx.Err() == nil {
+					r.markFailure(res.upstream)
+				}
+				startHedge()
+				continue
+			}
+			attempts = append(attempts, flow.DialAttempt{Upstream: res.upstream.Tag, Addr: res.addr})
+			r.clearFailure(res.upstream)
+			if pending > 0 {
+				go r.finishRace(ctx, cancelRace, results, res)
+			} else {
+				cancelRace()
+				if hedged {
+					r.recordHedge(res, 0)
+				}
+			}
+			return dialOutcome{upstream: res.upstream, addr: res.addr, conn: res.conn}, attempts
+		}
+	}
+	cancelRace()
+	return dialOutcome{}, attempts
+}
+
+// finishRace waits for the losing dial, closes its connection, and records
+// how much sooner the winner connected.
+func (r dialRequest) finishRace(ctx context.Context, cancelRace context.CancelFunc, results <-chan hedgeResult, winner hedgeResult) {
+	defer cancelRace()
+	loser := <-results
+	var margin time.Duration
+	if loser.err == nil {
+		_ = loser.conn.Close()
+		r.clearFailure(loser.upstream)
+		margin = loser.at - winner.at
+	} else if ctx.Err() == nil {
+		r.markFailure(loser.upstream)
+	}
+	r.recordHedge(winner, margin)
+}
+
+func (r dialRequest) recordHedge(winner hedgeResult, margin time.Duration) {
+	util.Event(r.logger, slog.LevelDebug, "forward.tcp.hedge_finished",
+		"route", r.route,
+		"upstream", winner.upstream.Tag,
+		"hedge.won", winner.hedge,
+		"hedge.margin_ms", margin.Milliseconds(),
+	)
+	if r.recorder != nil {
+		r.recorder.RecordHedge(r.route, winner.hedge, margin)
+	}
+}
@@ -0,0 +1,212 @@
+package forwarding
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/flow"
+)
+
+// hedgedPicker always offers the same primary and hedge.
+type hedgedPicker struct {
+	candidatePicker
+	primary Upstream
+	hedge   Upstream
+	delay   time.Duration
+}
+
+func (p *hedgedPicker) PickHedged(flow.Meta) (Upstream, Upstream, time.Duration, error) {
+	return p.primary, p.hedge, p.delay, nil
+}
+
+type hedgeRecord struct {
+	route    string
+	hedgeWon bool
+	margin   time.Duration
+}
+
+type recordingHedgeRecorder struct {
+	records chan hedgeRecord
+}
+
+func (r *recordingHedgeRecorder) RecordHedge(route string, hedgeWon bool, margin time.Duration) {
+	r.records <- hedgeRecord{route: route, hedgeWon: hedgeWon, margin: margin}
+}
+
+type closeTrackingConn struct {
+	stubConn
+	closedFlag atomic.Bool
+}
+
+func (c *closeTrackingConn) Close() error {
+	c.closedFlag.Store(true)
+	return nil
+}
+
+// scriptedDialer answers dials per upstream tag after an optional delay.
+type scriptedDialer struct {
+	mu     sync.Mutex
+	delays map[string]time.Duration
+	fail   map[string]bool
+	dialed []string
+	conns  map[string]*closeTrackingConn
+}
+
+func (d *scriptedDialer) dial(ctx context.Context, _ netip.AddrPort, tag string) (net.Conn, error) {
+	d.mu.Lock()
+	d.dialed = append(d.dialed, tag)
+	delay := d.delays[tag]
+	d.mu.Unlock()
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if d.fail[tag] {
+		return nil, errors.New("connection refused")
+	}
+	conn := &closeTrackingConn{}
+	d.mu.Lock()
+	d.conns[tag] = conn
+	d.mu.Unlock()
+	return conn, nil
+}
+
+func (d *scriptedDialer) dialedTags() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.dialed...)
+}
+
+func newHedgeRequest(picker *hedgedPicker, dialer *scriptedDialer, recorder HedgeRecorder) dialRequest {
+	return dialRequest{
+		picker:      picker,
+		pick:        func() (Upstream, error) { return picker.Pick(flow.Meta{}) },
+		hedge:       func() (Upstream, Upstream, time.Duration, error) { return picker.PickHedged(flow.Meta{}) },
+		dial:        dialer.dial,
+		listenPort:  9000,
+		perUpstream: time.Second,
+		recorder:    recorder,
+		route:       "web",
+	}
+}
+
+func TestHedgedConnectSlowPrimaryLosesToHedge(t *testing.T) {
+	picker := &hedgedPicker{primary: failoverCandidate("primary", 443), hedge: failoverCandidate("backup", 443), delay: 10 * time.Millisecond}
+	dialer := &scriptedDialer{delays: map[string]time.Duration{"primary": 200 * time.Millisecond}, conns: map[string]*closeTrackingConn{}}
+	recorder := &recordingHedgeRecorder{records: make(chan hedgeRecord, 1)}
+
+	outcome, err := dialFailover{maxAttempts: 1}.connect(context.Background(), newHedgeRequest(picker, dialer, recorder))
+	if err != nil {
+		t.Fatalf("connect error: %v", err)
+	}
+	if outcome.upstream.Tag != "backup" || len(outcome.attempts) != 1 || outcome.attempts[0].Upstream != "backup" {
+		t.Fatalf("expected the hedge to win, got %+v", outcome)
+	}
+
+	select {
+	case record := <-recorder.records:
+		if record.route != "web" || !record.hedgeWon || record.margin <= 0 {
+			t.Fatalf("unexpected hedge record: %+v", record)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected hedge outcome to be recorded")
+	}
+	dialer.mu.Lock()
+	loser := dialer.conns["primary"]
+	dialer.mu.Unlock()
+	if loser == nil || !loser.closedFlag.Load() {
+		t.Fatal("expected the losing primary connection to be closed")
+	}
+}
+
+func TestHedgedConnectFastPrimarySkipsHedge(t *testing.T) {
+	picker := &hedgedPicker{primary: failoverCandidate("primary", 443), hedge: failoverCandidate("backup", 443), delay: time.Second}
+	dialer := &scriptedDialer{conns: map[string]*closeTrackingConn{}}
+	recorder := &recordingHedgeRecorder{records: make(chan hedgeRecord, 1)}
+
+	outcome, err := dialFailover{maxAttempts: 1}.connect(context.Background(), newHedgeRequest(picker, dialer, recorder))
+	if err != nil || outcome.upstream.Tag != "primary" {
+		t.Fatalf("expected primary, got %+v err=%v", outcome, err)
+	}
+	if tags := dialer.dialedTags(); len(tags) != 1 {
+		t.Fatalf("expected the hedge never to be dialed, dialed=%v", tags)
+	}
+	select {
+	case record := <-recorder.records:
+		t.Fatalf("expected no hedge record without a second dial, got %+v", record)
+	default:
+	}
+}
+
+func TestHedgedConnectFailedPrimaryStartsHedgeAtOnce(t *testing.T) {
+	picker := &hedgedPicker{primary: failoverCandidate("primary", 443), hedge: failoverCandidate("backup", 443), delay: time.Minute}
+	dialer := &scriptedDialer{fail: map[string]bool{"primary": true}, conns: map[string]*closeTrackingConn{}}
+	recorder := &recordingHedgeRecorder{records: make(chan hedgeRecord, 1)}
+
+	start := time.Now()
+	outcome, err := dialFailover{maxAttempts: 1}.connect(context.Background(), newHedgeRequest(picker, dialer, recorder))
+	if err != nil || outcome.upstream.Tag != "backup" {
+		t.Fatalf("expected hedge after primary failure, got %+v err=%v", outcome, err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("expected the hedge to start without waiting for the delay")
+	}
+	if len(outcome.attempts) != 2 || outcome.attempts[0].Upstream != "primary" || outcome.attempts[0].Error == "" {
+		t.Fatalf("expected failed primary then hedge, got %+v", outcome.attempts)
+	}
+	if !picker.failed["primary"] {
+		t.Fatal("expected the failed primary to enter dial cooldown")
+	}
+	if record := <-recorder.records; !record.hedgeWon || record.margin != 0 {
+		t.Fatalf("unexpected hedge record: %+v", record)
+	}
+}
+
+func TestTCPListenerHedgesWithPicker(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		if conn, err := backend.Accept(); err == nil {
+			_ = conn.Close()
+		}
+	}()
+	picker := &hedgedPicker{
+		primary: failoverCandidate("refused", freeTCPPort(t)),
+		hedge:   failoverCandidate("healthy", backend.Addr().(*net.TCPAddr).Port),
+	}
+	observer := &recordingObserver{}
+	recorder := &recordingHedgeRecorder{records: make(chan hedgeRecord, 1)}
+	listener := &TCPListener{
+		cfg:      config.ListenerConfig{BindAddr: "127.0.0.1", BindPort: 9000, Route: "web"},
+		picker:   picker,
+		policy:   allowedPolicy(),
+		timeout:  time.Second,
+		observer: observer,
+		sem:      make(chan struct{}, 1),
+	}
+	listener.SetHedgeRecorder(recorder)
+	listener.sem <- struct{}{}
+	client := &stubConn{local: stubAddr("127.0.0.1:9000"), remote: stubAddr("192.0.2.1:12345")}
+
+	listener.handleConn(context.Background(), client)
+
+	observer.mu.Lock()
+	defer observer.mu.Unlock()
+	if len(observer.opens) != 1 || observer.opens[0].Upstream != "healthy" {
+		t.Fatalf("expected Flow pinned to the hedge, opens=%+v rejections=%+v", observer.opens, observer.rejections)
+	}
+	if record := <-recorder.records; record.route != "web" || !record.hedgeWon {
+		t.Fatalf("unexpected hedge record: %+v", record)
+	}
+}
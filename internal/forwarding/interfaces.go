@@ -27,11 +27,25 @@ type AdmissionPolicy interface {
 }
 
 // Upstream is the minimal value needed by the data plane to dial a selected
-// upstream. The listener's port remains the destination port for compatibility
-// with the existing forwarding configuration.
+// upstream. A zero Port keeps the listener's port as the destination port for
+// compatibility with configurations that predate port mapping. ProxyProtocol
+// is empty, "v1", or "v2" and selects the header written before payload.
+// Addrs lists every resolved address in dial order; when it is empty Addr is
+// the only address. Addr is always the first address to try.
 type Upstream struct {
-	Tag  string
-	Addr netip.Addr
+	Tag           string
+	Addr          netip.Addr
+	Addrs         []netip.Addr
+	Port          int
+	ProxyProtocol string
+	SelectionRule string
+}
+
+func (u Upstream) destinationPort(listenPort int) int {
+	if u.Port > 0 {
+		return u.Port
+	}
+	return listenPort
 }
 
 // UpstreamPicker selects one upstream for a new Flow.
@@ -45,6 +59,13 @@ type OverridePicker interface {
 	PickOverride(flow.Meta, string) (Upstream, error)
 }
 
+// HedgePicker is optional. For routes that hedge TCP connects it returns a
+// second upstream to race against the first and how long to wait before
+// dialing it. A zero hedge Tag means the Flow dials one upstream.
+type HedgePicker interface {
+	PickHedged(flow.Meta) (primary Upstream, hedge Upstream, delay time.Duration, err error)
+}
+
 // DialFeedback is optional. Pickers that implement it retain the existing
 // dial-failure cooldown behavior without making it part of the selection API.
 type DialFeedback interface {
@@ -52,6 +73,22 @@ type DialFeedback interface {
 	ClearDialFailure(Upstream)
 }
 
+// AddressFeedback is optional. It reports dial results for single addresses
+// of a multi-address upstream so one bad address is skipped without putting
+// the whole upstream in cooldown.
+type AddressFeedback interface {
+	MarkAddressFailure(Upstream, netip.Addr, time.Duration, error)
+	ClearAddressFailure(Upstream, netip.Addr)
+}
+
+// HealthFeedback is optional. It reports data-plane outcomes so upstream
+// health also follows real traffic. Every failed dial and every ended Flow is
+// one outcome; signal is empty for a Flow without an upstream failure, or one
+// of dial_error, upstream_close, zero_response and read_error.
+type HealthFeedback interface {
+	RecordFlowOutcome(tag, signal string)
+}
+
 // FlowObserver is intentionally declared in forwarding. Implementations from
 // flow, control, metrics, and iplog satisfy it structurally without making the
 // data plane depend on those packages.
@@ -74,3 +111,10 @@ type BackendBinder interface {
 type RateLimitDropRecorder interface {
 	RecordRateLimitDrop(protocol string, bytes uint64)
 }
+
+// HedgeRecorder is optional telemetry for hedged TCP connects. It is called
+// once per race in which the second dial started. margin is how much sooner
+// the winner connected than the loser, or zero when the loser never did.
+type HedgeRecorder interface {
+	RecordHedge(route string, hedgeWon bool, margin time.Duration)
+}
@@ -0,0 +1,86 @@
+package forwarding
+
+import (
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/flow"
+	"github.com/NodePath81/fbforward/internal/proxyproto"
+)
+
+// proxyHeader builds the PROXY header written toward an upstream. The FlowID
+// TLV carries the same ID the Flow Context registry stores, so a backend that
+// reads the header can still tag the Flow through the RPC endpoint. v1 has no
+// datagram form; UDP mappings only emit v2 and return a nil header otherwise.
+func proxyHeader(version, protocol string, id flow.ID, client, local netip.AddrPort, listener, route string) ([]byte, error) {
+	if version == "" || (version == proxyproto.Version1 && protocol == flow.ProtocolUDP) {
+		return nil, nil
+	}
+	header := proxyproto.Header{Version: version, Protocol: protocol, Source: client, Destination: local}
+	if version == proxyproto.Version2 {
+		header.TLVs = []proxyproto.TLV{
+			{Type: proxyproto.TypeFlowID, Value: []byte(id.String())},
+			{Type: proxyproto.TypeListener, Value: []byte(listener)},
+			{Type: proxyproto.TypeRoute, Value: []byte(route)},
+		}
+	}
+	return header.Marshal()
+}
+
+// localEndpoint returns the address a client connected to. Wildcard listener
+// addresses are kept as-is because they still identify the listener port.
+func localEndpoint(address net.Addr, fallback string) netip.AddrPort {
+	if address != nil {
+		if parsed, err := netAddrPort(address); err == nil {
+			return parsed
+		}
+	}
+	parsed, _ := netip.ParseAddrPort(fallback)
+	return parsed
+}
+
+// acceptProxyHeader reads an inbound PROXY header from a trusted peer. It
+// returns the connection to use for the Flow and the immediate peer when the
+// header replaced it. Untrusted peers are never parsed so they cannot spoof a
+// client address.
+func (l *TCPListener) acceptProxyHeader(client net.Conn) (net.Conn, netip.AddrPort, error) {
+	if len(l.trustedProxies) == 0 {
+		return client, netip.AddrPort{}, nil
+	}
+	peer, err := netAddrPort(client.RemoteAddr())
+	if err != nil || !prefixesContain(l.trustedProxies, peer.Addr().Unmap()) {
+		return client, netip.AddrPort{}, nil
+	}
+	_ = client.SetReadDeadline(time.Now().Add(tcpProxyHeaderTimeout))
+	header, err := proxyproto.Read(client)
+	_ = client.SetReadDeadline(time.Time{})
+	if err != nil {
+		return client, peer, err
+	}
+	if !header.Source.IsValid() {
+		// LOCAL and UNKNOWN headers describe the proxy's own connection.
+		return client, netip.AddrPort{}, nil
+	}
+	return &proxiedConn{Conn: client, remote: net.TCPAddrFromAddrPort(header.Source)}, peer, nil
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxiedConn reports the client address from an accepted PROXY header while
+// keeping the accepted socket for I/O and half-close.
+type proxiedConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *proxiedConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *proxiedConn) CloseWrite() error { return closeWrite(c.Conn) }
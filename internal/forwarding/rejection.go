@@ -9,6 +9,18 @@ import (
 )
 
 func emitRejection(observer FlowObserver, protocol, listener, clientAddress, reason string, decision Decision) {
+	emitRejectionFrom(observer, protocol, listener, clientAddress, netip.AddrPort{}, reason, decision)
+}
+
+// emitRejectionFrom records a rejection for a client reached through a
+// trusted proxy peer. A zero peer means the client connected directly.
+func emitRejectionFrom(observer FlowObserver, protocol, listener, clientAddress string, peer netip.AddrPort, reason string, decision Decision) {
+	emitDialRejection(observer, protocol, listener, clientAddress, peer, reason, decision, nil)
+}
+
+// emitDialRejection records a rejection together with the upstream dial
+// attempts made before admission gave up.
+func emitDialRejection(observer FlowObserver, protocol, listener, clientAddress string, peer netip.AddrPort, reason string, decision Decision, attempts []flow.DialAttempt) {
 	if observer == nil || clientAddress == "" {
 		return
 	}
@@ -19,10 +31,12 @@ func emitRejection(observer FlowObserver, protocol, listener, clientAddress, rea
 	observer.Reject(flow.Rejection{
 		Protocol:         protocol,
 		ClientAddr:       clientAddr,
+		PeerAddr:         peer,
 		Listener:         listener,
 		Reason:           reason,
 		MatchedRuleType:  decision.RuleType,
 		MatchedRuleValue: decision.RuleValue,
+		DialAttempts:     attempts,
 		RecordedAt:       time.Now().UTC(),
 	})
 }
@@ -2,6 +2,7 @@ package measure
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -56,7 +57,19 @@ func NewCollector(cfg config.MeasurementConfig, manager *upstream.UpstreamManage
 	}
 }
 
+// RunLoop runs scheduled probes until ctx ends. Throughput measurements run
+// on their own goroutine, so a bulk transfer never holds up a health probe;
+// RunLoop returns once an in-flight transfer has stopped as well.
 func (c *Collector) RunLoop(ctx context.Context) {
+	if c.cfg.Throughput.Enabled {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.throughputLoop(ctx)
+		}()
+		defer wg.Wait()
+	}
 	c.scheduler.Schedule()
 	c.syncUpstreamMetrics()
 	c.runReady(ctx)
@@ -75,17 +88,36 @@ func (c *Collector) RunLoop(ctx context.Context) {
 	}
 }
 
+func (c *Collector) throughputLoop(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.runNext(ctx, c.scheduler.NextThroughput, c.RunProtocol)
+		}
+	}
+}
+
 func (c *Collector) runReady(ctx context.Context) {
 	c.runReadyWith(ctx, c.RunProtocol)
 }
 
 func (c *Collector) runReadyWith(ctx context.Context, run func(context.Context, *upstream.Upstream, string) error) {
-	next, ok := c.scheduler.NextReady()
+	c.runNext(ctx, c.scheduler.NextReady, run)
+}
+
+func (c *Collector) runNext(ctx context.Context, take func() (*scheduledMeasurement, bool), run func(context.Context, *upstream.Upstream, string) error) {
+	next, ok := take()
 	if !ok {
 		return
 	}
 	measurement := *next
-	if err := run(ctx, measurement.upstream, measurement.protocol); err != nil {
+	// A failed throughput measurement waits for its next interval rather
+	// than retrying a bulk transfer.
+	if err := run(ctx, measurement.upstream, measurement.protocol); err != nil && measurement.protocol != ProtocolThroughput {
 		c.scheduler.Requeue(measurement, retryDelay)
 	} else {
 		c.scheduler.MarkRun(measurement)
@@ -105,9 +137,15 @@ func (c *Collector) syncUpstreamMetrics() {
 }
 
 func (c *Collector) RunProtocol(ctx context.Context, up *upstream.Upstream, network string) error {
+	if network == ProtocolThroughput {
+		return c.runThroughput(ctx, up)
+	}
 	if _, err := c.protocolConfig(network); err != nil {
 		return err
 	}
+	if nativeProbe(up) && network != "tcp" {
+		return fmt.Errorf("upstream %s uses a %s probe, which only runs over tcp", up.Tag, up.ProbeType)
+	}
 	probeTimeout := c.cfg.ProbeTimeout.Duration()
 	if probeTimeout <= 0 {
 		probeTimeout = defaultProbeTimeout
@@ -124,7 +162,7 @@ func (c *Collector) RunProtocol(ctx context.Context, up *upstream.Upstream, netw
 }
 
 func (c *Collector) handleMeasurementFailure(tag, protocol string, err error) error {
-	stats := c.manager.RecordProbeFailure(tag, time.Now())
+	stats := c.manager.RecordProbe(tag, upstream.ProbeObservation{Protocol: protocol, ObservedAt: time.Now()})
 	if c.metrics != nil {
 		c.metrics.RecordProbe(tag, protocol, false)
 		c.metrics.SetUpstreamMetrics(tag, stats)
@@ -134,6 +172,7 @@ func (c *Collector) handleMeasurementFailure(tag, protocol string, err error) er
 }
 
 func (c *Collector) handleMeasurementSuccess(tag, protocol string, result upstream.ProbeObservation) {
+	result.Protocol = protocol
 	stats := c.manager.RecordProbe(tag, result)
 	if c.metrics != nil {
 		c.metrics.RecordProbe(tag, protocol, true)
@@ -143,16 +182,6 @@ func (c *Collector) handleMeasurementSuccess(tag, protocol string, result upstre
 
 func (c *Collector) runMeasurement(ctx context.Context, up *upstream.Upstream, network string, timeout time.Duration) (upstream.ProbeObservation, error) {
 	var empty upstream.ProbeObservation
-	target := up.MeasureHost
-	if target == "" {
-		target = up.Host
-	}
-	port := up.MeasurePort
-	if port == 0 {
-		port = 9876
-	}
-	addr := net.JoinHostPort(target, strconv.Itoa(port))
-
 	startTime := time.Now()
 	cycleID := c.newCycleID()
 	util.Event(c.logger, slog.LevelInfo, "measure.started",
@@ -177,46 +206,173 @@ func (c *Collector) runMeasurement(ctx context.Context, up *upstream.Upstream, n
 		c.OnTestComplete(up.Tag, network, startTime, time.Since(startTime), success, resultMetrics, errMsg)
 	}()
 
-	client, err := fbmeasure.NewClient(fbmeasure.ClientConfig{Address: addr, Timeout: timeout})
+	var result upstream.ProbeObservation
+	var err error
+	switch up.ProbeType {
+	case config.ProbeTCPConnect:
+		result, err = probeTCPConnect(ctx, up)
+	case config.ProbeHTTP:
+		result, err = probeHTTP(ctx, up)
+	default:
+		protocol, _ := c.protocolConfig(network)
+		result, err = probeFBMeasure(ctx, up, network, timeout, protocol)
+	}
 	if err != nil {
 		errMsg = err.Error()
+		util.Event(c.logger, slog.LevelWarn, "measure.failed",
+			"measure.cycle_id", cycleID,
+			"upstream", up.Tag,
+			"network.protocol", network,
+			"error", err,
+		)
 		return empty, err
 	}
+
+	resultMetrics.RTTMs = float64(result.RTT) / float64(time.Millisecond)
+
+	success = true
+	attrs := []any{
+		"measure.cycle_id", cycleID,
+		"upstream", up.Tag,
+		"network.protocol", network,
+		"measure.duration_ms", time.Since(startTime).Milliseconds(),
+		"measure.rtt_ms", resultMetrics.RTTMs,
+	}
+	if result.Burst {
+		attrs = append(attrs, "measure.loss_ratio", result.Loss, "measure.jitter_ms", float64(result.Jitter)/float64(time.Millisecond))
+	}
+	if result.OneWay {
+		attrs = append(attrs,
+			"measure.upload_delay_ms", float64(result.UploadDelay)/float64(time.Millisecond),
+			"measure.download_delay_ms", float64(result.DownloadDelay)/float64(time.Millisecond),
+			"measure.clock_offset_ms", float64(result.ClockOffset)/float64(time.Millisecond),
+		)
+		if result.ClockSkew != 0 {
+			attrs = append(attrs, "measure.clock_skew_ppm", result.ClockSkew)
+		}
+	}
+	util.Event(c.logger, slog.LevelInfo, "measure.completed", attrs...)
+	return result, nil
+}
+
+// probeFBMeasure runs one TCP or UDP probe against the upstream's fbmeasure
+// server. With burst the UDP probe is a burst of the configured size and
+// pacing that also reports loss and jitter; with one_way the probe also reports the one-way delays.
+func probeFBMeasure(ctx context.Context, up *upstream.Upstream, network string, timeout time.Duration, protocol config.MeasurementProtocolConfig) (upstream.ProbeObservation, error) {
+	burst := network == "udp" && protocol.Burst
+	client, err := fbmeasure.NewClient(fbmeasure.ClientConfig{
+		Address:       fbmeasureAddress(up),
+		Timeout:       timeout,
+		Key:           up.MeasureKey,
+		Timestamps:    protocol.OneWay,
+		BurstFrames:   protocol.BurstFrames,
+		BurstInterval: protocol.BurstInterval.Duration(),
+	})
+	if err != nil {
+		return upstream.ProbeObservation{}, err
+	}
 	defer client.Close()
 
 	var probeResult fbmeasure.Result
-	if network == "tcp" {
+	switch {
+	case network == "tcp":
 		probeResult, err = client.ProbeTCP(ctx)
-	} else {
+	case burst:
+		probeResult, err = client.ProbeUDPBurst(ctx)
+	default:
 		probeResult, err = client.ProbeUDP(ctx)
 	}
 	if err != nil {
-		errMsg = err.Error()
+		return upstream.ProbeObservation{}, err
+	}
+	return upstream.ProbeObservation{
+		Success:       probeResult.Reachable,
+		RTT:           probeResult.RTT,
+		ObservedAt:    probeResult.ObservedAt,
+		Burst:         burst,
+		Loss:          probeResult.Loss,
+		Jitter:        probeResult.Jitter,
+		OneWay:        protocol.OneWay,
+		UploadDelay:   probeResult.ForwardDelay,
+		DownloadDelay: probeResult.ReturnDelay,
+		ClockOffset:   probeResult.ClockOffset,
+		ClockSkew:     probeResult.ClockSkew,
+	}, nil
+}
+
+// runThroughput measures the upload and download throughput of up through
+// its fbmeasure server. The result is recorded apart from probe health; a
+// failed measurement leaves the previous one in place.
+func (c *Collector) runThroughput(ctx context.Context, up *upstream.Upstream) error {
+	if !c.cfg.Throughput.Enabled {
+		return errors.New("throughput measurement is disabled")
+	}
+	if nativeProbe(up) {
+		return fmt.Errorf("upstream %s uses a %s probe, which cannot measure throughput", up.Tag, up.ProbeType)
+	}
+	cycleID := c.newCycleID()
+	startTime := time.Now()
+	util.Event(c.logger, slog.LevelInfo, "measure.started",
+		"measure.cycle_id", cycleID,
+		"upstream", up.Tag,
+		"network.protocol", ProtocolThroughput,
+	)
+	c.setRunning(up.Tag, ProtocolThroughput)
+	defer c.clearRunning(up.Tag, ProtocolThroughput)
+
+	observation, err := probeThroughput(ctx, up, c.cfg.Throughput.Bytes)
+	if err != nil {
 		util.Event(c.logger, slog.LevelWarn, "measure.failed",
 			"measure.cycle_id", cycleID,
 			"upstream", up.Tag,
-			"network.protocol", network,
+			"network.protocol", ProtocolThroughput,
 			"error", err,
 		)
-		return empty, err
+		return err
 	}
-
-	result := upstream.ProbeObservation{
-		Success:    probeResult.Reachable,
-		RTT:        probeResult.RTT,
-		ObservedAt: probeResult.ObservedAt,
+	stats := c.manager.RecordThroughput(up.Tag, observation)
+	if c.metrics != nil {
+		c.metrics.SetUpstreamMetrics(up.Tag, stats)
 	}
-	resultMetrics.RTTMs = float64(result.RTT) / float64(time.Millisecond)
-
-	success = true
 	util.Event(c.logger, slog.LevelInfo, "measure.completed",
 		"measure.cycle_id", cycleID,
 		"upstream", up.Tag,
-		"network.protocol", network,
+		"network.protocol", ProtocolThroughput,
 		"measure.duration_ms", time.Since(startTime).Milliseconds(),
-		"measure.rtt_ms", resultMetrics.RTTMs,
+		"measure.upload_mbps", stats.UploadMbps,
+		"measure.download_mbps", stats.DownloadMbps,
 	)
-	return result, nil
+	return nil
+}
+
+func probeThroughput(ctx context.Context, up *upstream.Upstream, size int64) (upstream.ThroughputObservation, error) {
+	client, err := fbmeasure.NewClient(fbmeasure.ClientConfig{Address: fbmeasureAddress(up), Key: up.MeasureKey})
+	if err != nil {
+		return upstream.ThroughputObservation{}, err
+	}
+	defer client.Close()
+	result, err := client.ProbeThroughput(ctx, size)
+	if err != nil {
+		return upstream.ThroughputObservation{}, err
+	}
+	return upstream.ThroughputObservation{
+		UploadBps:   result.UploadBps,
+		DownloadBps: result.DownloadBps,
+		ObservedAt:  result.ObservedAt,
+	}, nil
+}
+
+// fbmeasureAddress is the address of the fbmeasure server of up.
+func fbmeasureAddress(up *upstream.Upstream) string {
+	target := up.MeasureHost
+	if target == "" {
+		target = up.Host
+	}
+	port := up.MeasurePort
+	if port == 0 {
+		port = 9876
+	}
+	return net.JoinHostPort(target, strconv.Itoa(port))
 }
 
 func (c *Collector) protocolConfig(network string) (config.MeasurementProtocolConfig, error) {
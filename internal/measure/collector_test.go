@@ -106,4 +106,32 @@ func TestCollectorUsesMinimalFBMeasureSDK(t *testing.T) {
 			t.Fatalf("runMeasurement(%s) returned invalid result: %+v", protocol, result)
 		}
 	}
+
+	collector.cfg.Protocols.UDP.Burst = true
+	result, err := collector.runMeasurement(ctx, manager.Get("primary"), "udp", time.Second)
+	if err != nil {
+		t.Fatalf("runMeasurement(udp burst): %v", err)
+	}
+	if !result.Success || !result.Burst || result.Loss != 0 || result.RTT <= 0 {
+		t.Fatalf("runMeasurement(udp burst) returned invalid result: %+v", result)
+	}
+
+	collector.cfg.Protocols.TCP.OneWay = true
+	if err := collector.RunProtocol(ctx, manager.Get("primary"), "tcp"); err != nil {
+		t.Fatalf("RunProtocol(tcp one_way): %v", err)
+	}
+	if stats := manager.StatsSnapshot()["primary"]; !stats.DelayMeasured || stats.UploadDelayMs+stats.DownloadDelayMs <= 0 {
+		t.Fatalf("one-way delay was not recorded: %+v", stats)
+	}
+
+	if err := collector.RunProtocol(ctx, manager.Get("primary"), ProtocolThroughput); err == nil {
+		t.Fatal("throughput ran while disabled")
+	}
+	collector.cfg.Throughput = config.MeasurementThroughputConfig{Enabled: true, Bytes: fbmeasure.MinThroughputBytes}
+	if err := collector.RunProtocol(ctx, manager.Get("primary"), ProtocolThroughput); err != nil {
+		t.Fatalf("RunProtocol(throughput): %v", err)
+	}
+	if stats := manager.StatsSnapshot()["primary"]; stats.UploadMbps <= 0 || stats.DownloadMbps <= 0 || stats.ThroughputAt.IsZero() {
+		t.Fatalf("throughput was not recorded: %+v", stats)
+	}
 }
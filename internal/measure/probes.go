@@ -0,0 +1,157 @@
+package measure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/upstream"
+)
+
+// maxHTTPProbeBody bounds how much of an http probe response is searched for
+// the expected body.
+const maxHTTPProbeBody = 64 << 10
+
+// nativeProbe reports whether up is probed without fbmeasure. Native probes
+// are TCP-only.
+func nativeProbe(up *upstream.Upstream) bool {
+	return up.ProbeType == config.ProbeTCPConnect || up.ProbeType == config.ProbeHTTP
+}
+
+// probeTarget returns the host and port a native probe connects to. A zero
+// port means the destination port is unknown.
+func probeTarget(up *upstream.Upstream) (string, int) {
+	host := up.MeasureHost
+	if host == "" {
+		host = up.Host
+	}
+	port := up.MeasurePort
+	if port == 0 {
+		port = up.Port
+	}
+	return host, port
+}
+
+// probeDialHost returns the host a native probe dials. A probe of the
+// destination host dials the upstream's active IP, so it follows the
+// configured DNS servers and strategy like forwarded flows do; a separate
+// measurement host is dialed by name.
+func probeDialHost(up *upstream.Upstream) string {
+	host, _ := probeTarget(up)
+	if host == up.Host {
+		if ip := up.ActiveIP(); ip != nil {
+			return ip.String()
+		}
+	}
+	return host
+}
+
+// probeTCPConnect times a TCP handshake with the upstream. A host name is
+// resolved first so the RTT covers the handshake only.
+func probeTCPConnect(ctx context.Context, up *upstream.Upstream) (upstream.ProbeObservation, error) {
+	_, port := probeTarget(up)
+	if port == 0 {
+		return upstream.ProbeObservation{}, fmt.Errorf("upstream %s has no port to probe", up.Tag)
+	}
+	host := probeDialHost(up)
+	if net.ParseIP(host) == nil {
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return upstream.ProbeObservation{}, err
+		}
+		host = addrs[0]
+	}
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return upstream.ProbeObservation{}, err
+	}
+	rtt := time.Since(start)
+	_ = conn.Close()
+	return upstream.ProbeObservation{Success: true, RTT: rtt, ObservedAt: time.Now()}, nil
+}
+
+// probeHTTP sends a GET and checks the status and body. The URL names the
+// probe host, but the connection goes to probeDialHost. The RTT is the time
+// from the written request to the first response byte.
+func probeHTTP(ctx context.Context, up *upstream.Upstream) (upstream.ProbeObservation, error) {
+	probe := up.HTTPProbe
+	host, port := probeTarget(up)
+	dialHost := probeDialHost(up)
+	scheme := "http"
+	if probe.TLS {
+		scheme = "https"
+	}
+	if port != 0 {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	path := probe.Path
+	if path == "" {
+		path = "/"
+	}
+	// The transport runs these hooks on its own goroutines.
+	var wrote, firstByte atomic.Int64
+	trace := &httptrace.ClientTrace{
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wrote.Store(time.Now().UnixNano()) },
+		GotFirstResponseByte: func() { firstByte.Store(time.Now().UnixNano()) },
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, scheme+"://"+host+path, nil)
+	if err != nil {
+		return upstream.ProbeObservation{}, err
+	}
+	req.Header.Set("User-Agent", "fbforward-probe")
+	var dialer net.Dialer
+	transport := &http.Transport{
+		DisableKeepAlives: true,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			_, dialPort, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, net.JoinHostPort(dialHost, dialPort))
+		},
+	}
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return upstream.ProbeObservation{}, err
+	}
+	defer resp.Body.Close()
+	expect := probe.ExpectStatus
+	if expect == 0 {
+		expect = http.StatusOK
+	}
+	if resp.StatusCode != expect {
+		return upstream.ProbeObservation{}, fmt.Errorf("http probe status %d, want %d", resp.StatusCode, expect)
+	}
+	if probe.ExpectBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPProbeBody))
+		if err != nil {
+			return upstream.ProbeObservation{}, err
+		}
+		if !strings.Contains(string(body), probe.ExpectBody) {
+			return upstream.ProbeObservation{}, fmt.Errorf("http probe body does not contain %q", probe.ExpectBody)
+		}
+	}
+	var rtt time.Duration
+	if sent, received := wrote.Load(), firstByte.Load(); sent != 0 && received > sent {
+		rtt = time.Duration(received - sent)
+	}
+	return upstream.ProbeObservation{Success: true, RTT: rtt, ObservedAt: time.Now()}, nil
+}
@@ -0,0 +1,103 @@
+package measure
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/upstream"
+)
+
+func TestCollectorNativeProbesUpdateHealth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("status: ok"))
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, portText, _ := net.SplitHostPort(target.Host)
+	port, _ := strconv.Atoi(portText)
+
+	manager := upstream.NewUpstreamManager([]*upstream.Upstream{
+		{Tag: "connect", Host: host, Port: port, ProbeType: config.ProbeTCPConnect},
+		{Tag: "http", Host: host, MeasurePort: port, ProbeType: config.ProbeHTTP, HTTPProbe: config.HTTPProbeConfig{Path: "/healthz", ExpectStatus: 200, ExpectBody: "ok"}},
+		{Tag: "missing", Host: host, MeasurePort: port, ProbeType: config.ProbeHTTP, HTTPProbe: config.HTTPProbeConfig{Path: "/missing", ExpectStatus: 200}},
+		{Tag: "body", Host: host, MeasurePort: port, ProbeType: config.ProbeHTTP, HTTPProbe: config.HTTPProbeConfig{Path: "/healthz", ExpectStatus: 200, ExpectBody: "ready"}},
+	}, nil)
+	collector := NewCollector(config.MeasurementConfig{ProbeTimeout: config.Duration(time.Second)}, manager, nil, nil, nil)
+	ctx := context.Background()
+	for _, tag := range []string{"connect", "http"} {
+		if err := collector.RunProtocol(ctx, manager.Get(tag), "tcp"); err != nil {
+			t.Fatalf("RunProtocol(%s): %v", tag, err)
+		}
+		if health, ok := manager.Health(tag); !ok || health.State != upstream.HealthHealthy || health.RTT <= 0 {
+			t.Fatalf("health of %s after a passing probe = %+v", tag, health)
+		}
+	}
+	for tag, want := range map[string]string{"missing": "status 404", "body": "does not contain"} {
+		if err := collector.RunProtocol(ctx, manager.Get(tag), "tcp"); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("RunProtocol(%s) error = %v, want %q", tag, err, want)
+		}
+		if health, _ := manager.Health(tag); health.ConsecutiveFailures != 1 {
+			t.Fatalf("health of %s after a failing probe = %+v", tag, health)
+		}
+	}
+	if err := collector.RunProtocol(ctx, manager.Get("http"), "udp"); err == nil {
+		t.Fatal("expected an http probe to refuse udp")
+	}
+}
+
+func TestNativeProbesDialActiveIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "" && !strings.HasPrefix(r.Host, "upstream.invalid") {
+			t.Errorf("request Host = %q, want the upstream host", r.Host)
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, portText, _ := net.SplitHostPort(target.Host)
+	port, _ := strconv.Atoi(portText)
+
+	// upstream.invalid never resolves, so the probes must use the active IP.
+	ups := []*upstream.Upstream{
+		{Tag: "connect", Host: "upstream.invalid", Port: port, ProbeType: config.ProbeTCPConnect},
+		{Tag: "http", Host: "upstream.invalid", MeasureHost: "upstream.invalid", MeasurePort: port, ProbeType: config.ProbeHTTP, HTTPProbe: config.HTTPProbeConfig{Path: "/", ExpectStatus: 200}},
+	}
+	for _, up := range ups {
+		up.SetActiveIP(net.ParseIP("127.0.0.1"))
+	}
+	manager := upstream.NewUpstreamManager(ups, nil)
+	collector := NewCollector(config.MeasurementConfig{ProbeTimeout: config.Duration(time.Second)}, manager, nil, nil, nil)
+	for _, up := range ups {
+		if err := collector.RunProtocol(context.Background(), manager.Get(up.Tag), "tcp"); err != nil {
+			t.Fatalf("RunProtocol(%s): %v", up.Tag, err)
+		}
+	}
+}
+
+func TestSchedulerRunsNativeProbesOverTCPOnly(t *testing.T) {
+	up := &upstream.Upstream{Tag: "web", ProbeType: config.ProbeHTTP}
+	scheduler := NewScheduler(SchedulerConfig{MinInterval: time.Minute, MaxInterval: time.Minute, Protocols: []string{"tcp", "udp"}}, []*upstream.Upstream{up}, rand.New(rand.NewSource(1)))
+	scheduler.Schedule()
+	if status := scheduler.Status(); status.QueueLength != 1 || status.Pending[0].Protocol != "tcp" {
+		t.Fatalf("expected a single tcp job, got %+v", status)
+	}
+}
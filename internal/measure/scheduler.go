@@ -2,6 +2,7 @@ package measure
 
 import (
 	"math/rand"
+	"slices"
 	"sort"
 	"sync"
 	"time"
@@ -9,11 +10,50 @@ import (
 	"github.com/NodePath81/fbforward/internal/upstream"
 )
 
+// ProtocolThroughput is the scheduled pseudo-protocol of fbmeasure
+// throughput measurements.
+const ProtocolThroughput = "throughput"
+
+// The first throughput measurements wait throughputStartDelay so probes
+// settle health first, and are spread over up to throughputSpread so a start
+// or reload does not run every bulk transfer back to back.
+const (
+	throughputStartDelay = time.Minute
+	throughputSpread     = 10 * time.Minute
+)
+
+// Probe cadences reported in the scheduler status.
+const (
+	CadenceNormal  = "normal"
+	CadenceFast    = "fast"
+	CadenceBackoff = "backoff"
+)
+
+// SchedulerConfig sets the probe cadence. A positive ThroughputInterval also
+// schedules a throughput measurement of every fbmeasure upstream at that
+// interval, apart from the probe intervals; those jobs are taken with
+// NextThroughput instead of NextReady. With Adaptive set and a Health
+// source, each probe interval follows the upstream's health.
+// UpstreamProtocols replaces Protocols for the upstreams it lists.
 type SchedulerConfig struct {
-	MinInterval      time.Duration
-	MaxInterval      time.Duration
-	InterUpstreamGap time.Duration
-	Protocols        []string
+	MinInterval        time.Duration
+	MaxInterval        time.Duration
+	InterUpstreamGap   time.Duration
+	Protocols          []string
+	UpstreamProtocols  map[string][]string
+	ThroughputInterval time.Duration
+	Adaptive           AdaptiveCadence
+	Health             func(tag string) (upstream.HealthSnapshot, bool)
+}
+
+// AdaptiveCadence probes upstreams that are not settled every FastInterval
+// and doubles the regular interval of healthy ones after every StableAfter
+// consecutive successes, up to MaxInterval. It is off when FastInterval is
+// zero.
+type AdaptiveCadence struct {
+	FastInterval time.Duration
+	StableAfter  int
+	MaxInterval  time.Duration
 }
 
 type Scheduler struct {
@@ -22,6 +62,7 @@ type Scheduler struct {
 	mu            sync.Mutex
 	queue         []scheduledMeasurement
 	lastRun       map[string]time.Time
+	cadence       map[string]CadenceStatus
 	rng           *rand.Rand
 	nextAvailable time.Time
 }
@@ -36,9 +77,17 @@ type SchedulerStatus struct {
 	QueueLength   int
 	NextScheduled time.Time
 	LastRun       map[string]time.Time
+	Cadence       map[string]CadenceStatus
 	Pending       []PendingItem
 }
 
+// CadenceStatus is the cadence and interval last chosen for one upstream
+// and protocol.
+type CadenceStatus struct {
+	Cadence  string
+	Interval time.Duration
+}
+
 type PendingItem struct {
 	Upstream    string
 	Protocol    string
@@ -53,6 +102,7 @@ func NewScheduler(cfg SchedulerConfig, upstreams []*upstream.Upstream, rng *rand
 		cfg:       cfg,
 		upstreams: upstreams,
 		lastRun:   make(map[string]time.Time),
+		cadence:   make(map[string]CadenceStatus),
 		rng:       rng,
 	}
 }
@@ -68,15 +118,29 @@ func (s *Scheduler) Schedule() {
 	}
 
 	for _, up := range s.upstreams {
-		for _, proto := range s.cfg.Protocols {
+		protocols := s.cfg.Protocols
+		if override, ok := s.cfg.UpstreamProtocols[up.Tag]; ok {
+			protocols = override
+		}
+		if s.cfg.ThroughputInterval > 0 {
+			protocols = append(slices.Clip(protocols), ProtocolThroughput)
+		}
+		for _, proto := range protocols {
+			if proto != "tcp" && nativeProbe(up) {
+				continue
+			}
 			key := s.key(up.Tag, proto)
 			if _, ok := queued[key]; ok {
 				continue
 			}
+			dueAt := now
+			if proto == ProtocolThroughput {
+				dueAt = s.firstThroughputLocked(now)
+			}
 			s.queue = append(s.queue, scheduledMeasurement{
 				upstream: up,
 				protocol: proto,
-				dueAt:    now,
+				dueAt:    dueAt,
 			})
 			queued[key] = struct{}{}
 		}
@@ -87,27 +151,45 @@ func (s *Scheduler) Schedule() {
 	})
 }
 
+// NextReady takes the earliest due probe, honoring the inter-upstream gap.
+// Throughput jobs are left for NextThroughput.
 func (s *Scheduler) NextReady() (*scheduledMeasurement, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if len(s.queue) == 0 {
-		return nil, false
-	}
 	now := time.Now()
 	if now.Before(s.nextAvailable) {
 		return nil, false
 	}
-	next := s.queue[0]
-	if now.Before(next.dueAt) {
-		return nil, false
+	next, ok := s.takeReadyLocked(now, false)
+	if ok && s.cfg.InterUpstreamGap > 0 {
+		s.nextAvailable = now.Add(s.cfg.InterUpstreamGap)
 	}
+	return next, ok
+}
 
-	s.queue = s.queue[1:]
-	if s.cfg.InterUpstreamGap > 0 {
-		s.nextAvailable = now.Add(s.cfg.InterUpstreamGap)
+// NextThroughput takes the earliest due throughput job. Throughput runs
+// apart from the probes, so it neither waits for nor delays them.
+func (s *Scheduler) NextThroughput() (*scheduledMeasurement, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.takeReadyLocked(time.Now(), true)
+}
+
+// takeReadyLocked removes and returns the earliest throughput or probe job
+// when it is due.
+func (s *Scheduler) takeReadyLocked(now time.Time, throughput bool) (*scheduledMeasurement, bool) {
+	for i, item := range s.queue {
+		if (item.protocol == ProtocolThroughput) != throughput {
+			continue
+		}
+		if now.Before(item.dueAt) {
+			return nil, false
+		}
+		s.queue = slices.Delete(s.queue, i, i+1)
+		return &item, true
 	}
-	return &next, true
+	return nil, false
 }
 
 func (s *Scheduler) MarkRun(measurement scheduledMeasurement) {
@@ -116,17 +198,25 @@ func (s *Scheduler) MarkRun(measurement scheduledMeasurement) {
 	now := time.Now()
 	key := s.key(measurement.upstream.Tag, measurement.protocol)
 	s.lastRun[key] = now
+	cadence := s.nextCadence(measurement.upstream.Tag, measurement.protocol)
+	s.cadence[key] = cadence
 	s.queue = append(s.queue, scheduledMeasurement{
 		upstream: measurement.upstream,
 		protocol: measurement.protocol,
-		dueAt:    now.Add(s.nextInterval()),
+		dueAt:    now.Add(cadence.Interval),
 	})
 	s.sortQueueLocked()
 }
 
+// Requeue retries a failed measurement after delay, or after the fast
+// interval when adaptive cadence is on and it is shorter.
 func (s *Scheduler) Requeue(measurement scheduledMeasurement, delay time.Duration) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if fast := s.cfg.Adaptive.FastInterval; fast > 0 && fast < delay {
+		delay = fast
+		s.cadence[s.key(measurement.upstream.Tag, measurement.protocol)] = CadenceStatus{Cadence: CadenceFast, Interval: fast}
+	}
 	measurement.dueAt = time.Now().Add(delay)
 	s.queue = append(s.queue, measurement)
 	s.sortQueueLocked()
@@ -155,10 +245,53 @@ func (s *Scheduler) Status() SchedulerStatus {
 			status.LastRun[key] = ts
 		}
 	}
+	if len(s.cadence) > 0 {
+		status.Cadence = make(map[string]CadenceStatus, len(s.cadence))
+		for key, cadence := range s.cadence {
+			status.Cadence[key] = cadence
+		}
+	}
 	return status
 }
 
-func (s *Scheduler) nextInterval() time.Duration {
+// nextCadence chooses the interval until the next probe of tag. Without
+// adaptive cadence it is the regular jittered interval. Otherwise upstreams
+// that are down, unknown, stale, or have failed since their last success are
+// probed every fast interval, which also covers a down upstream working
+// through its recovery threshold.
+func (s *Scheduler) nextCadence(tag, protocol string) CadenceStatus {
+	interval := s.nextInterval(protocol)
+	adaptive := s.cfg.Adaptive
+	if protocol == ProtocolThroughput || adaptive.FastInterval <= 0 || s.cfg.Health == nil {
+		return CadenceStatus{Cadence: CadenceNormal, Interval: interval}
+	}
+	health, ok := s.cfg.Health(tag)
+	if !ok {
+		return CadenceStatus{Cadence: CadenceNormal, Interval: interval}
+	}
+	if health.State != upstream.HealthHealthy || health.ConsecutiveFailures > 0 {
+		return CadenceStatus{Cadence: CadenceFast, Interval: adaptive.FastInterval}
+	}
+	if adaptive.StableAfter <= 0 || health.ConsecutiveSuccesses < adaptive.StableAfter {
+		return CadenceStatus{Cadence: CadenceNormal, Interval: interval}
+	}
+	for n := health.ConsecutiveSuccesses / adaptive.StableAfter; n > 0 && interval < adaptive.MaxInterval; n-- {
+		interval *= 2
+	}
+	return CadenceStatus{Cadence: CadenceBackoff, Interval: min(interval, adaptive.MaxInterval)}
+}
+
+// firstThroughputLocked returns when the first throughput measurement of an
+// upstream is due.
+func (s *Scheduler) firstThroughputLocked(now time.Time) time.Time {
+	spread := min(throughputSpread, s.cfg.ThroughputInterval)
+	return now.Add(throughputStartDelay + time.Duration(s.rng.Int63n(int64(spread))))
+}
+
+func (s *Scheduler) nextInterval(protocol string) time.Duration {
+	if protocol == ProtocolThroughput {
+		return s.cfg.ThroughputInterval
+	}
 	if s.cfg.MaxInterval <= s.cfg.MinInterval {
 		return s.cfg.MinInterval
 	}
@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/NodePath81/fbforward/internal/config"
 	"github.com/NodePath81/fbforward/internal/upstream"
 )
 
@@ -96,3 +97,134 @@ func TestSchedulerHonorsInterUpstreamGap(t *testing.T) {
 		t.Fatal("expected protocol-specific job")
 	}
 }
+
+func TestSchedulerThroughputUsesItsOwnInterval(t *testing.T) {
+	up := &upstream.Upstream{Tag: "primary"}
+	native := &upstream.Upstream{Tag: "web", ProbeType: config.ProbeHTTP}
+	scheduler := NewScheduler(SchedulerConfig{
+		MinInterval:        time.Minute,
+		MaxInterval:        time.Minute,
+		InterUpstreamGap:   time.Hour,
+		Protocols:          []string{"tcp"},
+		ThroughputInterval: 6 * time.Hour,
+	}, []*upstream.Upstream{up, native}, rand.New(rand.NewSource(1)))
+
+	before := time.Now()
+	scheduler.Schedule()
+	for {
+		job, ok := scheduler.NextReady()
+		if !ok {
+			break
+		}
+		if job.protocol == ProtocolThroughput {
+			t.Fatalf("NextReady returned a throughput job for %s", job.upstream.Tag)
+		}
+	}
+	var due []PendingItem
+	for _, item := range scheduler.Status().Pending {
+		if item.Protocol == ProtocolThroughput {
+			due = append(due, item)
+		}
+	}
+	if len(due) != 1 || due[0].Upstream != "primary" {
+		t.Fatalf("expected one throughput job for the fbmeasure upstream, got %+v", due)
+	}
+	if at := due[0].ScheduledAt.Sub(before); at < throughputStartDelay || at > throughputStartDelay+throughputSpread {
+		t.Fatalf("first throughput job not staggered: due in %s", at)
+	}
+	if job, ok := scheduler.NextThroughput(); ok {
+		t.Fatalf("throughput job taken before it was due: %+v", job)
+	}
+
+	// Make the job due: it is taken while the probe gap is still running.
+	scheduler.mu.Lock()
+	for i := range scheduler.queue {
+		if scheduler.queue[i].protocol == ProtocolThroughput {
+			scheduler.queue[i].dueAt = before
+		}
+	}
+	scheduler.sortQueueLocked()
+	scheduler.mu.Unlock()
+	throughput, ok := scheduler.NextThroughput()
+	if !ok || throughput.upstream != up {
+		t.Fatalf("expected the due throughput job, got %+v", throughput)
+	}
+	before = time.Now()
+	scheduler.MarkRun(*throughput)
+	for _, item := range scheduler.Status().Pending {
+		if item.Protocol == ProtocolThroughput && item.ScheduledAt.Before(before.Add(6*time.Hour)) {
+			t.Fatalf("throughput rescheduled too early: %s", item.ScheduledAt.Sub(before))
+		}
+	}
+}
+
+func TestSchedulerAdaptiveCadenceFollowsHealth(t *testing.T) {
+	up := &upstream.Upstream{Tag: "primary"}
+	var health upstream.HealthSnapshot
+	scheduler := NewScheduler(SchedulerConfig{
+		MinInterval: time.Minute,
+		MaxInterval: time.Minute,
+		Protocols:   []string{"tcp"},
+		Adaptive:    AdaptiveCadence{FastInterval: 5 * time.Second, StableAfter: 3, MaxInterval: 3 * time.Minute},
+		Health: func(tag string) (upstream.HealthSnapshot, bool) {
+			return health, tag == "primary"
+		},
+	}, []*upstream.Upstream{up}, rand.New(rand.NewSource(1)))
+
+	tests := []struct {
+		health   upstream.HealthSnapshot
+		cadence  string
+		interval time.Duration
+	}{
+		{upstream.HealthSnapshot{State: upstream.HealthUnknown}, CadenceFast, 5 * time.Second},
+		{upstream.HealthSnapshot{State: upstream.HealthDown, ConsecutiveSuccesses: 1}, CadenceFast, 5 * time.Second},
+		{upstream.HealthSnapshot{State: upstream.HealthHealthy, ConsecutiveFailures: 1}, CadenceFast, 5 * time.Second},
+		{upstream.HealthSnapshot{State: upstream.HealthHealthy, ConsecutiveSuccesses: 2}, CadenceNormal, time.Minute},
+		{upstream.HealthSnapshot{State: upstream.HealthHealthy, ConsecutiveSuccesses: 3}, CadenceBackoff, 2 * time.Minute},
+		{upstream.HealthSnapshot{State: upstream.HealthHealthy, ConsecutiveSuccesses: 30}, CadenceBackoff, 3 * time.Minute},
+	}
+	for _, test := range tests {
+		health = test.health
+		got := scheduler.nextCadence("primary", "tcp")
+		if got.Cadence != test.cadence || got.Interval != test.interval {
+			t.Errorf("nextCadence(%+v) = %+v, want %s %s", test.health, got, test.cadence, test.interval)
+		}
+	}
+	if got := scheduler.nextCadence("primary", ProtocolThroughput); got.Cadence != CadenceNormal {
+		t.Fatalf("throughput cadence = %+v, want normal", got)
+	}
+
+	health = upstream.HealthSnapshot{State: upstream.HealthDown}
+	scheduler.Schedule()
+	job, ok := scheduler.NextReady()
+	if !ok {
+		t.Fatal("expected initial job")
+	}
+	before := time.Now()
+	scheduler.MarkRun(*job)
+	status := scheduler.Status()
+	if cadence := status.Cadence["primary:tcp"]; cadence.Cadence != CadenceFast || status.NextScheduled.After(before.Add(6*time.Second)) {
+		t.Fatalf("down upstream rescheduled at %s with %+v", status.NextScheduled.Sub(before), cadence)
+	}
+}
+
+func TestSchedulerAdaptiveRetryUsesFastInterval(t *testing.T) {
+	up := &upstream.Upstream{Tag: "primary"}
+	scheduler := NewScheduler(SchedulerConfig{
+		MinInterval: time.Hour,
+		MaxInterval: time.Hour,
+		Protocols:   []string{"tcp"},
+		Adaptive:    AdaptiveCadence{FastInterval: 5 * time.Second, StableAfter: 3, MaxInterval: 2 * time.Hour},
+	}, []*upstream.Upstream{up}, rand.New(rand.NewSource(1)))
+
+	scheduler.Schedule()
+	job, ok := scheduler.NextReady()
+	if !ok {
+		t.Fatal("expected initial job")
+	}
+	before := time.Now()
+	scheduler.Requeue(*job, 30*time.Second)
+	if next := scheduler.Status().NextScheduled; next.After(before.Add(6 * time.Second)) {
+		t.Fatalf("retry scheduled after %s, want the fast interval", next.Sub(before))
+	}
+}
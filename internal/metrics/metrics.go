@@ -14,9 +14,15 @@ import (
 
 // UpstreamMetrics is the health snapshot rendered for operations.
 type UpstreamMetrics struct {
-	HealthState string
-	RTTMs       float64
-	LastSuccess time.Time
+	HealthState  string
+	RTTMs        float64
+	LastSuccess  time.Time
+	UploadMbps   float64
+	DownloadMbps float64
+	// The one-way delays are rendered only when DelayMeasured.
+	DelayMeasured   bool
+	UploadDelayMs   float64
+	DownloadDelayMs float64
 }
 
 type trafficCounters struct {
@@ -43,6 +49,19 @@ type probeKey struct {
 	result   string
 }
 
+type hedgeKey struct {
+	route  string
+	winner string
+}
+
+// hedgeCounters counts hedged connects won by one side and sums the margins
+// measured when the loser also connected.
+type hedgeCounters struct {
+	wins         uint64
+	marginSum    float64
+	marginSample uint64
+}
+
 type auditCounters struct {
 	received uint64
 	written  uint64
@@ -68,6 +87,7 @@ type Metrics struct {
 	onlineRuleErrors uint64
 	webhook          map[string]uint64
 	firewallDenied   map[string]uint64
+	hedges           map[hedgeKey]*hedgeCounters
 
 	startedAt time.Time
 }
@@ -89,10 +109,33 @@ func NewMetrics(tags []string) *Metrics {
 		probes:         make(map[probeKey]uint64),
 		webhook:        make(map[string]uint64),
 		firewallDenied: make(map[string]uint64),
+		hedges:         make(map[hedgeKey]*hedgeCounters),
 		startedAt:      time.Now(),
 	}
 }
 
+// SetUpstreams adopts the upstream set after a configuration reload. Existing
+// tags keep their counters; removed tags stop being exported.
+func (m *Metrics) SetUpstreams(tags []string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	next := make(map[string]*upstreamState, len(tags))
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		if state, ok := m.upstreams[tag]; ok {
+			next[tag] = state
+			continue
+		}
+		next[tag] = &upstreamState{metrics: UpstreamMetrics{HealthState: string(upstream.HealthUnknown)}}
+	}
+	m.upstreams = next
+}
+
 func (m *Metrics) SetUpstreamMetrics(tag string, stats upstream.UpstreamStats) {
 	if m == nil {
 		return
@@ -104,9 +147,15 @@ func (m *Metrics) SetUpstreamMetrics(tag string, stats upstream.UpstreamStats) {
 		return
 	}
 	state.metrics = UpstreamMetrics{
-		HealthState: string(stats.HealthState),
-		RTTMs:       stats.RTTMs,
-		LastSuccess: stats.LastReachable,
+		HealthState:  string(stats.HealthState),
+		RTTMs:        stats.RTTMs,
+		LastSuccess:  stats.LastReachable,
+		UploadMbps:   stats.UploadMbps,
+		DownloadMbps: stats.DownloadMbps,
+
+		DelayMeasured:   stats.DelayMeasured,
+		UploadDelayMs:   stats.UploadDelayMs,
+		DownloadDelayMs: stats.DownloadDelayMs,
 	}
 }
 
@@ -236,7 +285,9 @@ func (m *Metrics) AddTraffic(upstreamTag, protocol, direction string, n uint64)
 	if m == nil || n == 0 {
 		return
 	}
+	m.mu.RLock()
 	state, ok := m.upstreams[upstreamTag]
+	m.mu.RUnlock()
 	if !ok || state == nil {
 		return
 	}
@@ -292,6 +343,31 @@ func (m *Metrics) RecordRateLimitDrop(_ string, _ uint64) {
 	m.mu.Unlock()
 }
 
+// RecordHedge counts a hedged TCP connect by its winning side. A positive
+// margin, the time by which the winner beat the loser, feeds the margin
+// summary; a loser that never connected adds to the win count only.
+func (m *Metrics) RecordHedge(route string, hedgeWon bool, margin time.Duration) {
+	if m == nil || route == "" {
+		return
+	}
+	key := hedgeKey{route: route, winner: "primary"}
+	if hedgeWon {
+		key.winner = "hedge"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counters := m.hedges[key]
+	if counters == nil {
+		counters = &hedgeCounters{}
+		m.hedges[key] = counters
+	}
+	counters.wins++
+	if margin > 0 {
+		counters.marginSum += margin.Seconds()
+		counters.marginSample++
+	}
+}
+
 func (m *Metrics) SetOnlineRulesActive(count int) {
 	if m == nil {
 		return
@@ -436,6 +512,10 @@ func (m *Metrics) Render() string {
 	onlineRuleErrors := m.onlineRuleErrors
 	webhook := copyUint64Map(m.webhook)
 	firewallDenied := copyUint64Map(m.firewallDenied)
+	hedges := make(map[hedgeKey]hedgeCounters, len(m.hedges))
+	for key, counters := range m.hedges {
+		hedges[key] = *counters
+	}
 	tcpActive := m.tcpActive.Load()
 	udpActive := m.udpActive.Load()
 	startedAt := m.startedAt
@@ -477,6 +557,21 @@ func (m *Metrics) Render() string {
 		writeSample(&b, "fbforward_upstream_rtt_seconds", []metricLabel{{"upstream", tag}}, formatFloat(upstreams[tag].RTTMs/1000))
 	}
 
+	writeType(&b, "fbforward_upstream_throughput_bits_per_second", "gauge")
+	for _, tag := range tags {
+		writeSample(&b, "fbforward_upstream_throughput_bits_per_second", []metricLabel{{"upstream", tag}, {"direction", "upload"}}, formatFloat(upstreams[tag].UploadMbps*1e6))
+		writeSample(&b, "fbforward_upstream_throughput_bits_per_second", []metricLabel{{"upstream", tag}, {"direction", "download"}}, formatFloat(upstreams[tag].DownloadMbps*1e6))
+	}
+
+	writeType(&b, "fbforward_upstream_one_way_delay_seconds", "gauge")
+	for _, tag := range tags {
+		if !upstreams[tag].DelayMeasured {
+			continue
+		}
+		writeSample(&b, "fbforward_upstream_one_way_delay_seconds", []metricLabel{{"upstream", tag}, {"direction", "upload"}}, formatFloat(upstreams[tag].UploadDelayMs/1000))
+		writeSample(&b, "fbforward_upstream_one_way_delay_seconds", []metricLabel{{"upstream", tag}, {"direction", "download"}}, formatFloat(upstreams[tag].DownloadDelayMs/1000))
+	}
+
 	writeType(&b, "fbforward_upstream_last_success_timestamp_seconds", "gauge")
 	for _, tag := range tags {
 		value := float64(0)
@@ -508,6 +603,18 @@ func (m *Metrics) Render() string {
 	writeType(&b, "fbforward_udp_rate_limit_drops_total", "counter")
 	writeSample(&b, "fbforward_udp_rate_limit_drops_total", nil, strconv.FormatUint(rateLimitDrops, 10))
 
+	hedgeKeys := sortedHedgeKeys(hedges)
+	writeType(&b, "fbforward_tcp_hedge_wins_total", "counter")
+	for _, key := range hedgeKeys {
+		writeSample(&b, "fbforward_tcp_hedge_wins_total", []metricLabel{{"route", key.route}, {"winner", key.winner}}, strconv.FormatUint(hedges[key].wins, 10))
+	}
+	writeType(&b, "fbforward_tcp_hedge_margin_seconds", "summary")
+	for _, key := range hedgeKeys {
+		labels := []metricLabel{{"route", key.route}, {"winner", key.winner}}
+		writeSample(&b, "fbforward_tcp_hedge_margin_seconds_sum", labels, formatFloat(hedges[key].marginSum))
+		writeSample(&b, "fbforward_tcp_hedge_margin_seconds_count", labels, strconv.FormatUint(hedges[key].marginSample, 10))
+	}
+
 	writeType(&b, "fbforward_online_rules_active", "gauge")
 	writeSample(&b, "fbforward_online_rules_active", nil, strconv.Itoa(onlineRules))
 	writeType(&b, "fbforward_online_rule_errors_total", "counter")
@@ -621,3 +728,17 @@ func sortedUint64Keys(values map[string]uint64) []string {
 	sort.Strings(keys)
 	return keys
 }
+
+func sortedHedgeKeys(values map[hedgeKey]hedgeCounters) []hedgeKey {
+	keys := make([]hedgeKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].winner < keys[j].winner
+	})
+	return keys
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestRenderContract(t *testing.T) {
@@ -26,6 +27,8 @@ func TestRenderContract(t *testing.T) {
 	m.IncWebhookDelivery("failed")
 	m.IncWebhookDropped()
 	m.IncFirewallDenied("cidr")
+	m.RecordHedge("web", true, 40*time.Millisecond)
+	m.RecordHedge("web", true, 0)
 
 	rendered := m.Render()
 	for _, needle := range []string{
@@ -41,6 +44,9 @@ func TestRenderContract(t *testing.T) {
 		`fbforward_online_rules_active 2`,
 		`fbforward_webhook_deliveries_total{result="dropped"} 1`,
 		`fbforward_firewall_denied_total{rule_type="cidr"} 1`,
+		`fbforward_tcp_hedge_wins_total{route="web",winner="hedge"} 2`,
+		`fbforward_tcp_hedge_margin_seconds_sum{route="web",winner="hedge"} 0.040000`,
+		`fbforward_tcp_hedge_margin_seconds_count{route="web",winner="hedge"} 1`,
 	} {
 		if !strings.Contains(rendered, needle) {
 			t.Fatalf("expected metrics output to contain %q\n%s", needle, rendered)
@@ -75,11 +81,15 @@ func TestRenderContract(t *testing.T) {
 		"fbforward_route_selected_upstream",
 		"fbforward_upstream_health_state",
 		"fbforward_upstream_rtt_seconds",
+		"fbforward_upstream_throughput_bits_per_second",
+		"fbforward_upstream_one_way_delay_seconds",
 		"fbforward_upstream_last_success_timestamp_seconds",
 		"fbforward_upstream_probes_total",
 		"fbforward_traffic_bytes_total",
 		"fbforward_audit_records_total",
 		"fbforward_udp_rate_limit_drops_total",
+		"fbforward_tcp_hedge_wins_total",
+		"fbforward_tcp_hedge_margin_seconds",
 		"fbforward_online_rules_active",
 		"fbforward_online_rule_errors_total",
 		"fbforward_webhook_deliveries_total",
@@ -1,6 +1,7 @@
 package notify
 
 import (
+	"strings"
 	"sync"
 	"time"
 )
@@ -48,6 +49,9 @@ type Policy struct {
 	closed    bool
 	startTime time.Time
 	unusable  map[string]*unusableAlertState
+	// suppressed holds upstreams in a maintenance window. A suppressed SRV
+	// group tag also covers its member tags.
+	suppressed map[string]struct{}
 }
 
 type unusableAlertState struct {
@@ -91,6 +95,7 @@ func NewPolicy(emitter Emitter, cfg PolicyConfig) *Policy {
 		notifyInterval:     notifyInterval,
 		startTime:          startTime,
 		unusable:           make(map[string]*unusableAlertState),
+		suppressed:         make(map[string]struct{}),
 	}
 }
 
@@ -124,7 +129,7 @@ func (p *Policy) HandleUsabilityChange(tag string, usable bool, reason string) {
 		p.unusable[tag] = state
 	}
 	state.reason = reason
-	if state.timer != nil {
+	if state.timer != nil || p.suppressedLocked(tag) {
 		return
 	}
 	delay := p.initialUnusableDelayLocked()
@@ -133,6 +138,47 @@ func (p *Policy) HandleUsabilityChange(tag string, usable bool, reason string) {
 	})
 }
 
+// SetSuppressed stops or resumes unusable alerts for tag. Usability changes
+// are still tracked while suppressed, so an upstream that is still unusable
+// when suppression ends alerts after the usual unusable interval.
+func (p *Policy) SetSuppressed(tag string, suppressed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	if suppressed {
+		p.suppressed[tag] = struct{}{}
+		for current, state := range p.unusable {
+			if p.suppressedLocked(current) && state.timer != nil {
+				state.timer.Stop()
+				state.timer = nil
+			}
+		}
+		return
+	}
+	delete(p.suppressed, tag)
+	for current, state := range p.unusable {
+		if state.timer == nil && !p.suppressedLocked(current) {
+			current := current
+			state.timer = p.after(p.initialUnusableDelayLocked(), func() {
+				p.fireUnusableAlert(current)
+			})
+		}
+	}
+}
+
+func (p *Policy) suppressedLocked(tag string) bool {
+	if _, ok := p.suppressed[tag]; ok {
+		return true
+	}
+	if group, _, ok := strings.Cut(tag, "/"); ok {
+		_, ok = p.suppressed[group]
+		return ok
+	}
+	return false
+}
+
 func (p *Policy) fireUnusableAlert(tag string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -144,6 +190,9 @@ func (p *Policy) fireUnusableAlert(tag string) {
 		return
 	}
 	state.timer = nil
+	if p.suppressedLocked(tag) {
+		return
+	}
 
 	uptime := p.now().Sub(p.startTime)
 	if uptime < p.startupGracePeriod {
@@ -212,3 +212,38 @@ func TestPolicyRecoveryResetsUpstreamUnusableEpisode(t *testing.T) {
 		t.Fatalf("unexpected reset event attributes %#v", emitter.events[1].attributes)
 	}
 }
+
+func TestPolicySuppressesUnusableAlertsDuringMaintenance(t *testing.T) {
+	now := time.Date(2026, 4, 10, 12, 10, 0, 0, time.UTC)
+	emitter := &recordingEmitter{}
+	factory := &timerFactory{}
+	policy := NewPolicy(emitter, PolicyConfig{
+		StartTime:          now.Add(-10 * time.Minute),
+		StartupGracePeriod: 5 * time.Minute,
+		UnusableInterval:   30 * time.Second,
+		NotifyInterval:     2 * time.Minute,
+		Now:                func() time.Time { return now },
+		AfterFunc:          factory.After,
+	})
+
+	policy.HandleUsabilityChange("app/a:80", false, "probe_failed")
+	pending := factory.Last()
+	policy.SetSuppressed("app", true)
+	if !pending.stopped {
+		t.Fatal("expected suppressing the SRV group to stop its member's pending alert")
+	}
+	policy.HandleUsabilityChange("app/a:80", false, "probe_failed")
+	if factory.Last() != pending {
+		t.Fatal("expected no alert timer while suppressed")
+	}
+
+	policy.SetSuppressed("app", false)
+	resumed := factory.Last()
+	if resumed == pending || resumed.delay != 30*time.Second {
+		t.Fatalf("expected a fresh unusable timer after suppression ends, got %#v", resumed)
+	}
+	resumed.Fire()
+	if len(emitter.events) != 1 || emitter.events[0].attributes["upstream.tag"] != "app/a:80" {
+		t.Fatalf("expected one alert after suppression ends, got %#v", emitter.events)
+	}
+}
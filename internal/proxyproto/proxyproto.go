@@ -0,0 +1,276 @@
+// Package proxyproto encodes and decodes HAProxy PROXY protocol headers. It is
+// kept free of forwarding state so the data plane can prepend or strip a
+// header without knowing how a route, upstream, or listener selected the mode.
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+const (
+	Version1 = "v1"
+	Version2 = "v2"
+)
+
+// TLV types in the PP2_TYPE_MIN_CUSTOM..PP2_TYPE_MAX_CUSTOM range. Values are
+// stable so backends can decode them without fbforward-specific libraries.
+const (
+	TypeFlowID   byte = 0xE0
+	TypeListener byte = 0xE1
+	TypeRoute    byte = 0xE2
+)
+
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+var v2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+const (
+	v2VersionLocal = 0x20
+	v2VersionProxy = 0x21
+	v2FamilyInet   = 0x10
+	v2FamilyInet6  = 0x20
+	v2StreamTCP    = 0x01
+	v2DatagramUDP  = 0x02
+	maxV2Payload   = 0xFFFF
+	maxV1Length    = 107
+)
+
+// ErrInvalidHeader is returned when a peer that must send a header sent
+// something else.
+var ErrInvalidHeader = errors.New("invalid proxy protocol header")
+
+// TLV is one type-length-value extension carried by a v2 header.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Header describes one proxied connection. Source is the original client and
+// Destination is the address the client connected to. A decoded LOCAL or
+// UNKNOWN header has invalid addresses; the caller keeps the peer address.
+type Header struct {
+	Version     string
+	Protocol    string
+	Source      netip.AddrPort
+	Destination netip.AddrPort
+	TLVs        []TLV
+}
+
+// ValidVersion reports whether value names a supported header version.
+func ValidVersion(value string) bool {
+	return value == Version1 || value == Version2
+}
+
+// Marshal encodes the header. Mixed address families are encoded as IPv6 with
+// IPv4-mapped addresses because both versions require a single family.
+func (h Header) Marshal() ([]byte, error) {
+	if !h.Source.IsValid() || !h.Destination.IsValid() {
+		return nil, errors.New("proxy header requires source and destination addresses")
+	}
+	source, destination := normalizeFamilies(h.Source, h.Destination)
+	switch h.Version {
+	case Version1:
+		return marshalV1(h.Protocol, source, destination, len(h.TLVs))
+	case Version2:
+		return marshalV2(h.Protocol, source, destination, h.TLVs)
+	default:
+		return nil, fmt.Errorf("unsupported proxy protocol version %q", h.Version)
+	}
+}
+
+func marshalV1(protocol string, source, destination netip.AddrPort, tlvs int) ([]byte, error) {
+	if protocol != ProtocolTCP {
+		return nil, errors.New("proxy protocol v1 supports tcp only")
+	}
+	if tlvs > 0 {
+		return nil, errors.New("proxy protocol v1 cannot carry TLVs")
+	}
+	family := "TCP4"
+	if source.Addr().Is6() {
+		family = "TCP6"
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, source.Addr(), destination.Addr(), source.Port(), destination.Port())), nil
+}
+
+func marshalV2(protocol string, source, destination netip.AddrPort, tlvs []TLV) ([]byte, error) {
+	var transport byte
+	switch protocol {
+	case ProtocolTCP:
+		transport = v2StreamTCP
+	case ProtocolUDP:
+		transport = v2DatagramUDP
+	default:
+		return nil, fmt.Errorf("unsupported proxy protocol transport %q", protocol)
+	}
+	var payload bytes.Buffer
+	family := byte(v2FamilyInet)
+	if source.Addr().Is6() {
+		family = v2FamilyInet6
+	}
+	src, dst := source.Addr().AsSlice(), destination.Addr().AsSlice()
+	payload.Write(src)
+	payload.Write(dst)
+	_ = binary.Write(&payload, binary.BigEndian, source.Port())
+	_ = binary.Write(&payload, binary.BigEndian, destination.Port())
+	for _, tlv := range tlvs {
+		if len(tlv.Value) > maxV2Payload {
+			return nil, fmt.Errorf("proxy protocol TLV 0x%02x is too large", tlv.Type)
+		}
+		payload.WriteByte(tlv.Type)
+		_ = binary.Write(&payload, binary.BigEndian, uint16(len(tlv.Value)))
+		payload.Write(tlv.Value)
+	}
+	if payload.Len() > maxV2Payload {
+		return nil, errors.New("proxy protocol header is too large")
+	}
+	out := make([]byte, 0, len(v2Signature)+4+payload.Len())
+	out = append(out, v2Signature...)
+	out = append(out, v2VersionProxy, family|transport)
+	out = binary.BigEndian.AppendUint16(out, uint16(payload.Len()))
+	return append(out, payload.Bytes()...), nil
+}
+
+func normalizeFamilies(source, destination netip.AddrPort) (netip.AddrPort, netip.AddrPort) {
+	src, dst := source.Addr().Unmap().WithZone(""), destination.Addr().Unmap().WithZone("")
+	if src.Is4() != dst.Is4() {
+		src = netip.AddrFrom16(src.As16())
+		dst = netip.AddrFrom16(dst.As16())
+	}
+	return netip.AddrPortFrom(src, source.Port()), netip.AddrPortFrom(dst, destination.Port())
+}
+
+// Read consumes exactly one header from r. It never reads past the header, so
+// the remaining stream can be handed to the data plane unchanged.
+func Read(r io.Reader) (Header, error) {
+	prefix := make([]byte, len(v2Signature))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return Header{}, err
+	}
+	if bytes.Equal(prefix, v2Signature) {
+		return readV2(r)
+	}
+	if bytes.HasPrefix(prefix, []byte("PROXY ")) {
+		return readV1(r, prefix)
+	}
+	return Header{}, ErrInvalidHeader
+}
+
+func readV1(r io.Reader, prefix []byte) (Header, error) {
+	line := append([]byte(nil), prefix...)
+	one := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= maxV1Length {
+			return Header{}, ErrInvalidHeader
+		}
+		if _, err := io.ReadFull(r, one); err != nil {
+			return Header{}, err
+		}
+		line = append(line, one[0])
+	}
+	fields := strings.Fields(strings.TrimSuffix(string(line), "\r\n"))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return Header{Version: Version1, Protocol: ProtocolTCP}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return Header{}, ErrInvalidHeader
+	}
+	source, err := parseV1Endpoint(fields[2], fields[4])
+	if err != nil {
+		return Header{}, err
+	}
+	destination, err := parseV1Endpoint(fields[3], fields[5])
+	if err != nil {
+		return Header{}, err
+	}
+	if source.Addr().Is4() != (fields[1] == "TCP4") {
+		return Header{}, ErrInvalidHeader
+	}
+	return Header{Version: Version1, Protocol: ProtocolTCP, Source: source, Destination: destination}, nil
+}
+
+func parseV1Endpoint(host, port string) (netip.AddrPort, error) {
+	addr, err := netip.ParseAddr(host)
+	if err != nil || addr.Zone() != "" {
+		return netip.AddrPort{}, ErrInvalidHeader
+	}
+	value, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return netip.AddrPort{}, ErrInvalidHeader
+	}
+	return netip.AddrPortFrom(addr, uint16(value)), nil
+}
+
+func readV2(r io.Reader) (Header, error) {
+	fixed := make([]byte, 4)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return Header{}, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[2:4]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Header{}, err
+	}
+	header := Header{Version: Version2}
+	switch fixed[0] {
+	case v2VersionLocal:
+		return header, nil
+	case v2VersionProxy:
+	default:
+		return Header{}, ErrInvalidHeader
+	}
+	switch fixed[1] & 0x0F {
+	case v2StreamTCP:
+		header.Protocol = ProtocolTCP
+	case v2DatagramUDP:
+		header.Protocol = ProtocolUDP
+	}
+	var size int
+	switch fixed[1] & 0xF0 {
+	case v2FamilyInet:
+		size = 4
+	case v2FamilyInet6:
+		size = 16
+	default:
+		// AF_UNSPEC and AF_UNIX carry no usable client address.
+		return header, nil
+	}
+	addresses := 2*size + 4
+	if len(payload) < addresses {
+		return Header{}, ErrInvalidHeader
+	}
+	src, _ := netip.AddrFromSlice(payload[:size])
+	dst, _ := netip.AddrFromSlice(payload[size : 2*size])
+	header.Source = netip.AddrPortFrom(src.Unmap(), binary.BigEndian.Uint16(payload[2*size:]))
+	header.Destination = netip.AddrPortFrom(dst.Unmap(), binary.BigEndian.Uint16(payload[2*size+2:]))
+	tlvs, err := parseTLVs(payload[addresses:])
+	if err != nil {
+		return Header{}, err
+	}
+	header.TLVs = tlvs
+	return header, nil
+}
+
+func parseTLVs(raw []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for len(raw) > 0 {
+		if len(raw) < 3 {
+			return nil, ErrInvalidHeader
+		}
+		length := int(binary.BigEndian.Uint16(raw[1:3]))
+		if len(raw) < 3+length {
+			return nil, ErrInvalidHeader
+		}
+		tlvs = append(tlvs, TLV{Type: raw[0], Value: append([]byte(nil), raw[3:3+length]...)})
+		raw = raw[3+length:]
+	}
+	return tlvs, nil
+}
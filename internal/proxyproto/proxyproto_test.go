@@ -0,0 +1,133 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestMarshalV1TCP(t *testing.T) {
+	header := Header{
+		Version:     Version1,
+		Protocol:    ProtocolTCP,
+		Source:      netip.MustParseAddrPort("192.0.2.10:40000"),
+		Destination: netip.MustParseAddrPort("198.51.100.1:443"),
+	}
+	got, err := header.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "PROXY TCP4 192.0.2.10 198.51.100.1 40000 443\r\n"; string(got) != want {
+		t.Fatalf("v1 header = %q, want %q", got, want)
+	}
+	header.Destination = netip.MustParseAddrPort("[2001:db8::1]:443")
+	got, err = header.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(got), "PROXY TCP6 ::ffff:192.0.2.10 2001:db8::1 ") {
+		t.Fatalf("mixed-family v1 header = %q", got)
+	}
+}
+
+func TestMarshalV1RejectsUDPAndTLVs(t *testing.T) {
+	base := Header{Version: Version1, Protocol: ProtocolUDP, Source: netip.MustParseAddrPort("192.0.2.10:1"), Destination: netip.MustParseAddrPort("192.0.2.11:2")}
+	if _, err := base.Marshal(); err == nil {
+		t.Fatal("expected v1 UDP header to be rejected")
+	}
+	base.Protocol = ProtocolTCP
+	base.TLVs = []TLV{{Type: TypeFlowID, Value: []byte("f_x")}}
+	if _, err := base.Marshal(); err == nil {
+		t.Fatal("expected v1 TLVs to be rejected")
+	}
+}
+
+func TestMarshalV2CarriesAddressesAndTLVs(t *testing.T) {
+	header := Header{
+		Version:     Version2,
+		Protocol:    ProtocolUDP,
+		Source:      netip.MustParseAddrPort("192.0.2.10:40000"),
+		Destination: netip.MustParseAddrPort("198.51.100.1:53"),
+		TLVs:        []TLV{{Type: TypeFlowID, Value: []byte("f_abc")}, {Type: TypeRoute, Value: []byte("dns")}},
+	}
+	got, err := header.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(got, v2Signature) {
+		t.Fatalf("missing v2 signature: %x", got)
+	}
+	if got[12] != 0x21 || got[13] != 0x12 {
+		t.Fatalf("version/family bytes = %#x %#x, want 0x21 0x12", got[12], got[13])
+	}
+	length := int(binary.BigEndian.Uint16(got[14:16]))
+	if length != len(got)-16 {
+		t.Fatalf("payload length = %d, want %d", length, len(got)-16)
+	}
+	payload := got[16:]
+	if !bytes.Equal(payload[0:4], []byte{192, 0, 2, 10}) || binary.BigEndian.Uint16(payload[10:12]) != 53 {
+		t.Fatalf("unexpected address block: %x", payload[:12])
+	}
+	tlvs := payload[12:]
+	if tlvs[0] != TypeFlowID || binary.BigEndian.Uint16(tlvs[1:3]) != 5 || string(tlvs[3:8]) != "f_abc" {
+		t.Fatalf("unexpected FlowID TLV: %x", tlvs)
+	}
+	if tlvs[8] != TypeRoute || string(tlvs[11:14]) != "dns" {
+		t.Fatalf("unexpected route TLV: %x", tlvs[8:])
+	}
+}
+
+func TestReadRoundTripsAndStopsAtHeader(t *testing.T) {
+	for _, version := range []string{Version1, Version2} {
+		header := Header{
+			Version:     version,
+			Protocol:    ProtocolTCP,
+			Source:      netip.MustParseAddrPort("[2001:db8::7]:40000"),
+			Destination: netip.MustParseAddrPort("[2001:db8::1]:443"),
+		}
+		if version == Version2 {
+			header.TLVs = []TLV{{Type: TypeRoute, Value: []byte("web")}}
+		}
+		raw, err := header.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream := bytes.NewReader(append(raw, "payload"...))
+		got, err := Read(stream)
+		if err != nil {
+			t.Fatalf("%s read: %v", version, err)
+		}
+		if got.Source != header.Source || got.Destination != header.Destination || got.Version != version {
+			t.Fatalf("%s decoded %+v, want %+v", version, got, header)
+		}
+		if version == Version2 && (len(got.TLVs) != 1 || string(got.TLVs[0].Value) != "web") {
+			t.Fatalf("v2 TLVs = %+v", got.TLVs)
+		}
+		rest := make([]byte, stream.Len())
+		_, _ = stream.Read(rest)
+		if string(rest) != "payload" {
+			t.Fatalf("%s read consumed payload, rest = %q", version, rest)
+		}
+	}
+}
+
+func TestReadLocalAndInvalidHeaders(t *testing.T) {
+	local := append(append([]byte(nil), v2Signature...), v2VersionLocal, 0x00, 0x00, 0x00)
+	got, err := Read(bytes.NewReader(local))
+	if err != nil || got.Source.IsValid() {
+		t.Fatalf("LOCAL header = %+v err=%v, want no source", got, err)
+	}
+	for _, raw := range []string{
+		"GET / HTTP/1.1\r\n",
+		"PROXY TCP4 2001:db8::1 192.0.2.1 1 2\r\n",
+		"PROXY TCP4 192.0.2.1 192.0.2.2 1\r\n",
+		"PROXY TCP4 192.0.2.1 192.0.2.2 1 70000\r\n",
+		"PROXY " + strings.Repeat("A", 120),
+	} {
+		if _, err := Read(strings.NewReader(raw)); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
@@ -86,11 +86,8 @@ func applyResolverStrategy(ips []net.IP, strategy string) []net.IP {
 	case config.DNSStrategyIPv4Only:
 		return filterIPv4(ips)
 	case config.DNSStrategyPreferV6:
-		v6 := filterIPv6(ips)
-		if len(v6) > 0 {
-			return v6
-		}
-		return filterIPv4(ips)
+		// IPv4 addresses stay as dial fallbacks behind IPv6.
+		return append(filterIPv6(ips), filterIPv4(ips)...)
 	default:
 		return ips
 	}
@@ -0,0 +1,276 @@
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SRV is one service record. Target has no trailing dot.
+type SRV struct {
+	Target   string
+	Port     int
+	Priority int
+	Weight   int
+}
+
+const (
+	dnsTypeSRV   = 33
+	dnsClassIN   = 1
+	dnsTimeout   = 2 * time.Second
+	dnsMaxUDPLen = 4096
+	resolvConf   = "/etc/resolv.conf"
+)
+
+// LookupSRV queries name for SRV records and returns them ordered by priority
+// and descending weight, together with the smallest record TTL. The standard
+// library resolver does not expose TTLs, so the query is sent directly to the
+// configured DNS servers, or to the system nameservers when none are set.
+// Records whose target is "." (service not available) are dropped.
+func (r *Resolver) LookupSRV(ctx context.Context, name string) ([]SRV, time.Duration, error) {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	query, id, err := buildQuery(name, dnsTypeSRV)
+	if err != nil {
+		return nil, 0, err
+	}
+	servers := r.servers
+	if len(servers) == 0 {
+		servers = systemNameservers(resolvConf)
+	}
+	var errs []error
+	for _, server := range servers {
+		response, err := exchange(ctx, server, query)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", server, err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		records, ttl, err := parseSRVResponse(response, id)
+		if err != nil {
+			return nil, 0, fmt.Errorf("srv %s: %w", name, err)
+		}
+		return records, ttl, nil
+	}
+	return nil, 0, fmt.Errorf("srv %s: %w", name, errors.Join(errs...))
+}
+
+// systemNameservers reads nameserver lines from a resolv.conf file and falls
+// back to the local resolver.
+func systemNameservers(path string) []string {
+	var servers []string
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" && net.ParseIP(fields[1]) != nil {
+				servers = append(servers, net.JoinHostPort(fields[1], "53"))
+			}
+		}
+		_ = file.Close()
+	}
+	if len(servers) == 0 {
+		servers = []string{"127.0.0.1:53"}
+	}
+	return servers
+}
+
+// exchange sends query over UDP and repeats it over TCP when the answer is
+// truncated.
+func exchange(ctx context.Context, server string, query []byte) ([]byte, error) {
+	response, err := exchangeConn(ctx, "udp", server, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) > 2 && response[2]&0x02 != 0 {
+		return exchangeConn(ctx, "tcp", server, query)
+	}
+	return response, nil
+}
+
+func exchangeConn(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	dialer := net.Dialer{Timeout: dnsTimeout}
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(dnsTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, dnsMaxUDPLen)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// buildQuery encodes a recursive query for one name and type.
+func buildQuery(name string, qtype uint16) ([]byte, uint16, error) {
+	if name == "" || len(name) > 253 {
+		return nil, 0, fmt.Errorf("invalid DNS name %q", name)
+	}
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+	msg := make([]byte, 12, 12+len(name)+6)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // RD
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid DNS name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassIN)
+	return msg, id, nil
+}
+
+var errMalformed = errors.New("malformed DNS response")
+
+func parseSRVResponse(msg []byte, id uint16) ([]SRV, time.Duration, error) {
+	if len(msg) < 12 {
+		return nil, 0, errMalformed
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id || msg[2]&0x80 == 0 {
+		return nil, 0, errors.New("unexpected DNS response")
+	}
+	switch rcode := msg[3] & 0x0f; rcode {
+	case 0:
+	case 3:
+		return nil, 0, errors.New("no such domain")
+	default:
+		return nil, 0, fmt.Errorf("DNS server returned rcode %d", rcode)
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+	off := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := readName(msg, off)
+		if err != nil || next+4 > len(msg) {
+			return nil, 0, errMalformed
+		}
+		off = next + 4
+	}
+	var records []SRV
+	var minTTL uint32
+	seen := false
+	for i := 0; i < answers; i++ {
+		_, next, err := readName(msg, off)
+		if err != nil || next+10 > len(msg) {
+			return nil, 0, errMalformed
+		}
+		rtype := binary.BigEndian.Uint16(msg[next:])
+		ttl := binary.BigEndian.Uint32(msg[next+4:])
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		data := next + 10
+		if data+length > len(msg) {
+			return nil, 0, errMalformed
+		}
+		off = data + length
+		if rtype != dnsTypeSRV {
+			continue
+		}
+		if length < 7 {
+			return nil, 0, errMalformed
+		}
+		target, _, err := readName(msg, data+6)
+		if err != nil {
+			return nil, 0, errMalformed
+		}
+		if !seen || ttl < minTTL {
+			minTTL, seen = ttl, true
+		}
+		if target == "" {
+			continue
+		}
+		records = append(records, SRV{
+			Target:   strings.ToLower(target),
+			Priority: int(binary.BigEndian.Uint16(msg[data:])),
+			Weight:   int(binary.BigEndian.Uint16(msg[data+2:])),
+			Port:     int(binary.BigEndian.Uint16(msg[data+4:])),
+		})
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Priority != records[j].Priority {
+			return records[i].Priority < records[j].Priority
+		}
+		if records[i].Weight != records[j].Weight {
+			return records[i].Weight > records[j].Weight
+		}
+		return records[i].Target < records[j].Target
+	})
+	return records, time.Duration(minTTL) * time.Second, nil
+}
+
+// readName decodes a possibly compressed name at off and returns it without
+// a trailing dot along with the offset after the name in the record.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errMalformed
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, "."), end, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 32 {
+				return "", 0, errMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+)
+
+// standinDNS answers SRV and A queries over UDP from fixed records. Every
+// answer name is a compression pointer to the question.
+type standinDNS struct {
+	conn     net.PacketConn
+	mu       sync.Mutex
+	srv      map[string][]SRV
+	ttl      uint32
+	hosts    map[string]net.IP
+	truncate bool
+}
+
+func newStandinDNS(t *testing.T) *standinDNS {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &standinDNS{conn: conn, srv: map[string][]SRV{}, hosts: map[string]net.IP{}, ttl: 30}
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			truncate := s.truncate
+			s.mu.Unlock()
+			response := s.answer(buf[:n])
+			if truncate {
+				response = append([]byte(nil), response[:12]...)
+				response[2] |= 0x02
+				binary.BigEndian.PutUint16(response[4:], 0)
+				binary.BigEndian.PutUint16(response[6:], 0)
+			}
+			_, _ = conn.WriteTo(response, addr)
+		}
+	}()
+	return s
+}
+
+// serveTCP answers over TCP on the UDP server's port.
+func (s *standinDNS) serveTCP(t *testing.T) {
+	t.Helper()
+	ln, err := net.Listen("tcp", s.conn.LocalAddr().String())
+	if err != nil {
+		t.Skipf("TCP port unavailable: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var length [2]byte
+			if _, err := conn.Read(length[:]); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := conn.Read(query); err == nil {
+					response := s.answer(query)
+					_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+				}
+			}
+			_ = conn.Close()
+		}
+	}()
+}
+
+func (s *standinDNS) answer(query []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name, end, err := readName(query, 12)
+	if err != nil || end+4 > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[end:])
+	response := append([]byte(nil), query[:end+4]...)
+	binary.BigEndian.PutUint16(response[2:], 0x8180)
+	binary.BigEndian.PutUint16(response[8:], 0)
+	binary.BigEndian.PutUint16(response[10:], 0)
+	var answers [][]byte
+	switch qtype {
+	case dnsTypeSRV:
+		records, ok := s.srv[strings.ToLower(name)]
+		if !ok {
+			response[3] |= 3
+		}
+		for _, record := range records {
+			rdata := binary.BigEndian.AppendUint16(nil, uint16(record.Priority))
+			rdata = binary.BigEndian.AppendUint16(rdata, uint16(record.Weight))
+			rdata = binary.BigEndian.AppendUint16(rdata, uint16(record.Port))
+			for _, label := range strings.Split(record.Target, ".") {
+				if label != "" {
+					rdata = append(append(rdata, byte(len(label))), label...)
+				}
+			}
+			answers = append(answers, append(rdata, 0))
+		}
+	case 1:
+		if ip := s.hosts[strings.ToLower(name)].To4(); ip != nil {
+			answers = append(answers, ip)
+		}
+	}
+	binary.BigEndian.PutUint16(response[6:], uint16(len(answers)))
+	for _, rdata := range answers {
+		response = append(response, 0xc0, 12)
+		response = binary.BigEndian.AppendUint16(response, qtype)
+		response = binary.BigEndian.AppendUint16(response, dnsClassIN)
+		response = binary.BigEndian.AppendUint32(response, s.ttl)
+		response = binary.BigEndian.AppendUint16(response, uint16(len(rdata)))
+		response = append(response, rdata...)
+	}
+	return response
+}
+
+// update changes the served records while the server is running.
+func (s *standinDNS) update(change func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change()
+}
+
+func (s *standinDNS) server() string {
+	return s.conn.LocalAddr().String()
+}
+
+func TestLookupSRVOrdersRecordsAndReportsTTL(t *testing.T) {
+	dns := newStandinDNS(t)
+	dns.update(func() {
+		dns.ttl = 42
+		dns.srv["_app._tcp.example.test"] = []SRV{
+			{Target: "b.example.test", Port: 9002, Priority: 10, Weight: 5},
+			{Target: "c.example.test", Port: 9003, Priority: 20, Weight: 1},
+			{Target: "a.example.test", Port: 9001, Priority: 10, Weight: 50},
+		}
+		dns.hosts["a.example.test"] = net.ParseIP("192.0.2.10")
+	})
+	res := NewResolver(config.DNSConfig{Servers: []string{dns.server()}})
+
+	records, ttl, err := res.LookupSRV(context.Background(), "_app._tcp.example.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttl != 42*time.Second || len(records) != 3 {
+		t.Fatalf("unexpected records %+v ttl=%s", records, ttl)
+	}
+	if records[0].Target != "a.example.test" || records[0].Port != 9001 || records[1].Target != "b.example.test" || records[2].Priority != 20 {
+		t.Fatalf("expected priority then weight order, got %+v", records)
+	}
+
+	ips, err := res.ResolveHost(context.Background(), "a.example.test")
+	if err != nil || len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.0.2.10")) {
+		t.Fatalf("expected the SRV target to resolve through the same server, ips=%v err=%v", ips, err)
+	}
+}
+
+func TestLookupSRVRejectsUnknownName(t *testing.T) {
+	dns := newStandinDNS(t)
+	res := NewResolver(config.DNSConfig{Servers: []string{dns.server()}})
+
+	if _, _, err := res.LookupSRV(context.Background(), "_missing._tcp.example.test"); err == nil || !strings.Contains(err.Error(), "no such domain") {
+		t.Fatalf("expected NXDOMAIN error, got %v", err)
+	}
+}
+
+func TestLookupSRVRetriesTruncatedAnswerOverTCP(t *testing.T) {
+	dns := newStandinDNS(t)
+	dns.update(func() {
+		dns.truncate = true
+		dns.srv["_app._tcp.example.test"] = []SRV{{Target: "a.example.test", Port: 9001}}
+	})
+	dns.serveTCP(t)
+	res := NewResolver(config.DNSConfig{Servers: []string{dns.server()}})
+
+	records, _, err := res.LookupSRV(context.Background(), "_app._tcp.example.test")
+	if err != nil || len(records) != 1 || records[0].Port != 9001 {
+		t.Fatalf("expected the TCP answer, records=%+v err=%v", records, err)
+	}
+}
+
+func TestApplyResolverStrategyPreferIPv6KeepsIPv4Fallback(t *testing.T) {
+	ips := []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}
+	got := applyResolverStrategy(ips, config.DNSStrategyPreferV6)
+	if len(got) != 2 || got[0].String() != "2001:db8::1" || got[1].String() != "192.0.2.1" {
+		t.Fatalf("expected IPv6 first with IPv4 kept, got %v", got)
+	}
+}
@@ -0,0 +1,191 @@
+package upstream
+
+import (
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// addressState tracks dial results for one resolved address of an upstream.
+// A failing address is skipped while it cools down; the upstream as a whole
+// stays selectable as long as another address connects.
+type addressState struct {
+	failUntil     time.Time
+	failCount     int
+	lastError     string
+	lastSuccessAt time.Time
+}
+
+// AddressSnapshot is the per-address dial state reported by ListUpstreams.
+type AddressSnapshot struct {
+	IP            string     `json:"ip"`
+	Family        string     `json:"family"`
+	Active        bool       `json:"active"`
+	Usable        bool       `json:"usable"`
+	FailCount     int        `json:"fail_count"`
+	LastError     string     `json:"last_error,omitempty"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+}
+
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "ipv4"
+	}
+	return "ipv6"
+}
+
+func (u *Upstream) addressLocked(ip net.IP) *addressState {
+	if u.addresses == nil {
+		u.addresses = make(map[string]*addressState, len(u.IPs))
+	}
+	key := ip.String()
+	state := u.addresses[key]
+	if state == nil {
+		state = &addressState{}
+		u.addresses[key] = state
+	}
+	return state
+}
+
+func (u *Upstream) coolingLocked(ip net.IP, now time.Time) bool {
+	state := u.addresses[ip.String()]
+	return state != nil && state.failUntil.After(now)
+}
+
+// pruneAddressesLocked drops state for addresses that are no longer resolved.
+func (u *Upstream) pruneAddressesLocked() {
+	for key := range u.addresses {
+		if !containsIP(u.IPs, net.ParseIP(key)) {
+			delete(u.addresses, key)
+		}
+	}
+}
+
+// DialAddresses returns every resolved address of tag in the order a new
+// connection should try them (RFC 8305 section 4). Addresses outside dial
+// cooldown come first, starting with the active address, and address families
+// alternate so a broken family costs at most one attempt delay. Cooling
+// addresses follow as a last resort.
+func (m *UpstreamManager) DialAddresses(tag string) []net.IP {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	up := m.upstreams[tag]
+	if up == nil {
+		return nil
+	}
+	now := time.Now()
+	active := up.ActiveIP()
+	var usable, cooling []net.IP
+	if active != nil && containsIP(up.IPs, active) && !up.coolingLocked(active, now) {
+		usable = append(usable, active)
+	}
+	for _, ip := range up.IPs {
+		switch {
+		case up.coolingLocked(ip, now):
+			cooling = append(cooling, ip)
+		case active == nil || !ip.Equal(active):
+			usable = append(usable, ip)
+		}
+	}
+	return append(interleaveFamilies(usable), interleaveFamilies(cooling)...)
+}
+
+// interleaveFamilies alternates address families, starting with the family of
+// the first address and keeping the relative order within each family.
+func interleaveFamilies(ips []net.IP) []net.IP {
+	if len(ips) < 2 {
+		return ips
+	}
+	first := ipFamily(ips[0])
+	var preferred, other []net.IP
+	for _, ip := range ips {
+		if ipFamily(ip) == first {
+			preferred = append(preferred, ip)
+		} else {
+			other = append(other, ip)
+		}
+	}
+	out := make([]net.IP, 0, len(ips))
+	for i := 0; i < len(preferred) || i < len(other); i++ {
+		if i < len(preferred) {
+			out = append(out, preferred[i])
+		}
+		if i < len(other) {
+			out = append(out, other[i])
+		}
+	}
+	return out
+}
+
+// MarkAddressFailure puts one address of tag in dial cooldown. When it was the
+// active address, the next address outside cooldown becomes active so probes
+// and UDP mappings move off it too.
+func (m *UpstreamManager) MarkAddressFailure(tag string, ip net.IP, cooldown time.Duration, cause error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	up := m.upstreams[tag]
+	if up == nil || ip == nil || !containsIP(up.IPs, ip) {
+		return
+	}
+	now := time.Now()
+	state := up.addressLocked(ip)
+	state.failCount++
+	if cooldown > 0 {
+		state.failUntil = now.Add(cooldown)
+	}
+	if cause != nil {
+		state.lastError = cause.Error()
+	}
+	args := []any{"upstream", tag, "upstream.ip", ip.String(), "dial_fail_count", state.failCount}
+	if active := up.ActiveIP(); active != nil && active.Equal(ip) {
+		for _, next := range up.IPs {
+			if !next.Equal(ip) && !up.coolingLocked(next, now) {
+				up.SetActiveIP(next)
+				args = append(args, "upstream.active_ip", next.String())
+				break
+			}
+		}
+	}
+	util.Event(m.logger, slog.LevelWarn, "upstream.address_failure_marked", args...)
+}
+
+// ClearAddressFailure records a successful connection to ip and makes it the
+// active address of tag.
+func (m *UpstreamManager) ClearAddressFailure(tag string, ip net.IP) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	up := m.upstreams[tag]
+	if up == nil || ip == nil || !containsIP(up.IPs, ip) {
+		return
+	}
+	state := up.addressLocked(ip)
+	state.failUntil, state.failCount, state.lastError = time.Time{}, 0, ""
+	state.lastSuccessAt = time.Now()
+	up.SetActiveIP(ip)
+}
+
+func (u *Upstream) addressSnapshotsLocked(now time.Time) []AddressSnapshot {
+	active := u.ActiveIP()
+	out := make([]AddressSnapshot, 0, len(u.IPs))
+	for _, ip := range u.IPs {
+		snapshot := AddressSnapshot{IP: ip.String(), Family: ipFamily(ip), Active: active != nil && active.Equal(ip), Usable: true}
+		if state := u.addresses[ip.String()]; state != nil {
+			snapshot.FailCount = state.failCount
+			snapshot.LastError = state.lastError
+			if state.failUntil.After(now) {
+				until := state.failUntil
+				snapshot.Usable = false
+				snapshot.CooldownUntil = &until
+			}
+			if !state.lastSuccessAt.IsZero() {
+				success := state.lastSuccessAt
+				snapshot.LastSuccessAt = &success
+			}
+		}
+		out = append(out, snapshot)
+	}
+	return out
+}
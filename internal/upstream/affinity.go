@@ -0,0 +1,201 @@
+package upstream
+
+import (
+	"hash/fnv"
+	"math"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+)
+
+// Affinity modes. Sticky pins a client to whatever the route strategy picks
+// first; consistent_hash keeps no pins and picks by rendezvous hashing over
+// the selectable members of every Flow, so only clients of a member that goes
+// down are remapped and they return to it once it recovers.
+const (
+	AffinitySticky         = "sticky"
+	AffinityConsistentHash = "consistent_hash"
+)
+
+// maxAffinityEntries bounds the table so a scan of many source addresses
+// cannot grow it without limit. Expired entries are pruned first; when the
+// table is still full, the entry closest to expiry is replaced.
+const maxAffinityEntries = 65536
+
+// AffinityEntry is one pinned client prefix as reported by the control API.
+type AffinityEntry struct {
+	Route     string    `json:"route"`
+	Client    string    `json:"client"`
+	Upstream  string    `json:"upstream"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type routeAffinity struct {
+	mode       string
+	ttl        time.Duration
+	ipv4Prefix int
+	ipv6Prefix int
+}
+
+func newRouteAffinity(cfg config.RouteAffinityConfig) routeAffinity {
+	return routeAffinity{mode: cfg.Mode, ttl: cfg.TTL.Duration(), ipv4Prefix: cfg.IPv4Prefix, ipv6Prefix: cfg.IPv6Prefix}
+}
+
+func (a routeAffinity) enabled() bool {
+	return a.mode != ""
+}
+
+// key masks client to the configured prefix. IPv4-mapped IPv6 addresses are
+// keyed as IPv4 so dual-stack sockets do not split one client in two.
+func (a routeAffinity) key(client netip.Addr) (netip.Prefix, bool) {
+	if !client.IsValid() {
+		return netip.Prefix{}, false
+	}
+	client = client.Unmap().WithZone("")
+	bits := a.ipv6Prefix
+	if client.Is4() {
+		bits = a.ipv4Prefix
+	}
+	prefix, err := client.Prefix(bits)
+	return prefix, err == nil
+}
+
+type affinityKey struct {
+	route  string
+	client netip.Prefix
+}
+
+type affinityPin struct {
+	upstream string
+	expires  time.Time
+}
+
+type affinityTable struct {
+	mu      sync.Mutex
+	entries map[affinityKey]affinityPin
+}
+
+func newAffinityTable() *affinityTable {
+	return &affinityTable{entries: make(map[affinityKey]affinityPin)}
+}
+
+func (t *affinityTable) lookup(key affinityKey, now time.Time) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pin, ok := t.entries[key]
+	if !ok {
+		return "", false
+	}
+	if !pin.expires.After(now) {
+		delete(t.entries, key)
+		return "", false
+	}
+	return pin.upstream, true
+}
+
+func (t *affinityTable) store(key affinityKey, upstream string, expires time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.entries[key]; !ok && len(t.entries) >= maxAffinityEntries {
+		t.pruneLocked(time.Now())
+		if len(t.entries) >= maxAffinityEntries {
+			var oldest affinityKey
+			var oldestExpiry time.Time
+			for candidate, pin := range t.entries {
+				if oldestExpiry.IsZero() || pin.expires.Before(oldestExpiry) {
+					oldest, oldestExpiry = candidate, pin.expires
+				}
+			}
+			delete(t.entries, oldest)
+		}
+	}
+	t.entries[key] = affinityPin{upstream: upstream, expires: expires}
+}
+
+func (t *affinityTable) pruneLocked(now time.Time) {
+	for key, pin := range t.entries {
+		if !pin.expires.After(now) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// retain drops entries for which keep returns false.
+func (t *affinityTable) retain(keep func(route, upstream string) bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, pin := range t.entries {
+		if !keep(key.route, pin.upstream) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// clear removes the route's entries that overlap client. An invalid client
+// clears the whole route.
+func (t *affinityTable) clear(route string, client netip.Prefix) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cleared := 0
+	for key := range t.entries {
+		if key.route == route && (!client.IsValid() || client.Overlaps(key.client)) {
+			delete(t.entries, key)
+			cleared++
+		}
+	}
+	return cleared
+}
+
+func (t *affinityTable) list(route string, now time.Time) []AffinityEntry {
+	t.mu.Lock()
+	t.pruneLocked(now)
+	out := make([]AffinityEntry, 0, len(t.entries))
+	for key, pin := range t.entries {
+		if route == "" || key.route == route {
+			out = append(out, AffinityEntry{Route: key.route, Client: key.client.String(), Upstream: pin.upstream, ExpiresAt: pin.expires.UTC()})
+		}
+	}
+	t.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Route != out[j].Route {
+			return out[i].Route < out[j].Route
+		}
+		return out[i].Client < out[j].Client
+	})
+	return out
+}
+
+// rendezvous returns the candidate with the highest weighted rendezvous
+// score for client. Scores depend only on the client and the member tag, so
+// removing a member moves only the clients that member held.
+func rendezvous(route routeDefinition, client netip.Prefix, candidates []*Upstream) *Upstream {
+	var best *Upstream
+	bestScore := math.Inf(-1)
+	for _, up := range candidates {
+		hash := fnv.New64a()
+		hash.Write(client.Addr().AsSlice())
+		hash.Write([]byte{byte(client.Bits())})
+		hash.Write([]byte(up.Tag))
+		// Map the hash into (0,1) and apply the weighted score -w/ln(u).
+		u := (float64(mix64(hash.Sum64())>>11) + 0.5) / (1 << 53)
+		score := -float64(route.weight(up.Tag)) / math.Log(u)
+		if best == nil || score > bestScore {
+			best, bestScore = up, score
+		}
+	}
+	return best
+}
+
+// mix64 is the splitmix64 finalizer. FNV alone leaves the high bits poorly
+// mixed for inputs that differ only in their last bytes.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,105 @@
+package upstream
+
+import "time"
+
+// SRVMember marks an upstream discovered from an SRV record. Group is the
+// configured upstream tag that names the SRV record set.
+type SRVMember struct {
+	Group    string
+	Name     string
+	Target   string
+	Priority int
+	Weight   int
+}
+
+// DiscoveryStatus is the refresh state of one SRV upstream group. Added and
+// Removed list the member tags of the most recent change.
+type DiscoveryStatus struct {
+	SRV           string     `json:"srv"`
+	TTLSeconds    float64    `json:"ttl_seconds"`
+	RefreshedAt   time.Time  `json:"refreshed_at"`
+	NextRefreshAt time.Time  `json:"next_refresh_at"`
+	ChangedAt     *time.Time `json:"changed_at,omitempty"`
+	Added         []string   `json:"added,omitempty"`
+	Removed       []string   `json:"removed,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// UpstreamDiscovery is reported by ListUpstreams for SRV members.
+type UpstreamDiscovery struct {
+	Group    string `json:"group"`
+	Target   string `json:"target"`
+	Port     int    `json:"port"`
+	Priority int    `json:"priority"`
+	Weight   int    `json:"weight"`
+	DiscoveryStatus
+}
+
+// srvTier drops the SRV members of candidates whose group has another
+// candidate with a lower record priority, so a group serves only from its
+// usable targets of the lowest priority, as RFC 2782 orders them. Candidates
+// keep their order.
+func srvTier(candidates []*Upstream) []*Upstream {
+	lowest := make(map[string]int)
+	for _, up := range candidates {
+		if up.SRV == nil {
+			continue
+		}
+		if priority, ok := lowest[up.SRV.Group]; !ok || up.SRV.Priority < priority {
+			lowest[up.SRV.Group] = up.SRV.Priority
+		}
+	}
+	if len(lowest) == 0 {
+		return candidates
+	}
+	out := candidates[:0:0]
+	for _, up := range candidates {
+		if up.SRV == nil || up.SRV.Priority == lowest[up.SRV.Group] {
+			out = append(out, up)
+		}
+	}
+	return out
+}
+
+// SetDiscoveryStatus records the latest refresh of an SRV upstream group.
+func (m *UpstreamManager) SetDiscoveryStatus(group string, status DiscoveryStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.discovery == nil {
+		m.discovery = make(map[string]DiscoveryStatus)
+	}
+	m.discovery[group] = status
+}
+
+// DiscoveryStatus returns the refresh state of an SRV upstream group.
+func (m *UpstreamManager) DiscoveryStatus(group string) (DiscoveryStatus, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status, ok := m.discovery[group]
+	return status, ok
+}
+
+// RetainDiscoveryStatus forgets groups that are no longer configured.
+func (m *UpstreamManager) RetainDiscoveryStatus(groups map[string]struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for group := range m.discovery {
+		if _, ok := groups[group]; !ok {
+			delete(m.discovery, group)
+		}
+	}
+}
+
+func (m *UpstreamManager) discoverySnapshotLocked(up *Upstream) *UpstreamDiscovery {
+	if up.SRV == nil {
+		return nil
+	}
+	return &UpstreamDiscovery{
+		Group:           up.SRV.Group,
+		Target:          up.SRV.Target,
+		Port:            up.Port,
+		Priority:        up.SRV.Priority,
+		Weight:          up.SRV.Weight,
+		DiscoveryStatus: m.discovery[up.SRV.Group],
+	}
+}
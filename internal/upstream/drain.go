@@ -0,0 +1,166 @@
+package upstream
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrUnknownUpstream is returned when a drain names neither an upstream nor
+// an SRV upstream group.
+var ErrUnknownUpstream = errors.New("upstream not found")
+
+// ErrNotDraining is returned when an undrain names an upstream that is not
+// draining.
+var ErrNotDraining = errors.New("upstream is not draining")
+
+// DrainStatus is the maintenance drain of one upstream or SRV upstream group.
+// DrainedAt is set once its last Flow has ended and ClosedAt once the
+// deadline closed the Flows still open.
+type DrainStatus struct {
+	Upstream  string     `json:"upstream"`
+	StartedAt time.Time  `json:"started_at"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+	DrainedAt *time.Time `json:"drained_at,omitempty"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+}
+
+// StartDrain stops new Flows to tag until StopDrain. A zero deadline never
+// closes open Flows. Draining an upstream that already drains replaces the
+// deadline and keeps the start time.
+func (m *UpstreamManager) StartDrain(tag string, deadline time.Time) (DrainStatus, error) {
+	tag = strings.TrimSpace(tag)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.knownLocked(tag) {
+		return DrainStatus{}, fmt.Errorf("upstream %q: %w", tag, ErrUnknownUpstream)
+	}
+	if m.drains == nil {
+		m.drains = make(map[string]*DrainStatus)
+	}
+	status := m.drains[tag]
+	if status == nil {
+		status = &DrainStatus{Upstream: tag, StartedAt: time.Now()}
+		m.drains[tag] = status
+	}
+	status.Deadline = nil
+	if !deadline.IsZero() {
+		status.Deadline = &deadline
+	}
+	return *status, nil
+}
+
+// StopDrain returns tag to selection. It reports whether tag was draining.
+func (m *UpstreamManager) StopDrain(tag string) bool {
+	tag = strings.TrimSpace(tag)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.drains[tag]; !ok {
+		return false
+	}
+	delete(m.drains, tag)
+	return true
+}
+
+// Drain returns the drain state of tag.
+func (m *UpstreamManager) Drain(tag string) (DrainStatus, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status, ok := m.drains[strings.TrimSpace(tag)]
+	if !ok {
+		return DrainStatus{}, false
+	}
+	return *status, true
+}
+
+// Drains lists every drain ordered by upstream tag.
+func (m *UpstreamManager) Drains() []DrainStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]DrainStatus, 0, len(m.drains))
+	for _, status := range m.drains {
+		out = append(out, *status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Upstream < out[j].Upstream })
+	return out
+}
+
+// Draining reports whether tag, or the SRV group it belongs to, is draining.
+func (m *UpstreamManager) Draining(tag string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tag = strings.TrimSpace(tag)
+	if up := m.upstreams[tag]; up != nil {
+		return m.drainingLocked(up)
+	}
+	_, ok := m.drains[tag]
+	return ok
+}
+
+// MarkDrained records that the last Flow of tag has ended.
+func (m *UpstreamManager) MarkDrained(tag string, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if status := m.drains[tag]; status != nil && status.DrainedAt == nil {
+		status.DrainedAt = &at
+	}
+}
+
+// MarkDrainClosed records that the deadline closed the open Flows of tag.
+func (m *UpstreamManager) MarkDrainClosed(tag string, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if status := m.drains[tag]; status != nil && status.ClosedAt == nil {
+		status.ClosedAt = &at
+	}
+}
+
+func (m *UpstreamManager) drainingLocked(up *Upstream) bool {
+	if len(m.drains) == 0 {
+		return false
+	}
+	if _, ok := m.drains[up.Tag]; ok {
+		return true
+	}
+	if up.SRV != nil {
+		_, ok := m.drains[up.SRV.Group]
+		return ok
+	}
+	return false
+}
+
+func (m *UpstreamManager) drainSnapshotLocked(up *Upstream) *DrainStatus {
+	status := m.drains[up.Tag]
+	if status == nil && up.SRV != nil {
+		status = m.drains[up.SRV.Group]
+	}
+	if status == nil {
+		return nil
+	}
+	copied := *status
+	return &copied
+}
+
+// knownLocked reports whether tag names an upstream or an SRV upstream group.
+func (m *UpstreamManager) knownLocked(tag string) bool {
+	if m.upstreams[tag] != nil {
+		return true
+	}
+	for _, up := range m.upstreams {
+		if up.SRV != nil && up.SRV.Group == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// retainDrainsLocked forgets drains of upstreams that were removed.
+func (m *UpstreamManager) retainDrainsLocked() {
+	for tag := range m.drains {
+		if !m.knownLocked(tag) {
+			delete(m.drains, tag)
+		}
+	}
+}
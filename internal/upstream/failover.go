@@ -0,0 +1,210 @@
+package upstream
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// Reasons a failover route changed its active upstream. A failover moves to
+// a later member because the active one became unusable; a failback returns
+// to an earlier one.
+const (
+	SwitchFailover = "failover"
+	SwitchFailback = "failback"
+)
+
+// RouteSwitchHandler observes the failovers and failbacks of failover routes.
+// It is called after selection, outside the selector locks.
+type RouteSwitchHandler func(route string, change RouteSwitch)
+
+// SetSwitchHandler installs the handler told about every failover and
+// failback. The first choice of a route is not reported.
+func (s *RouteSelector) SetSwitchHandler(handler RouteSwitchHandler) {
+	s.mu.Lock()
+	s.onSwitch = handler
+	s.mu.Unlock()
+}
+
+// EvaluateFailover runs failover selection for every failover route without
+// waiting for a new Flow, so failovers are reported when the active upstream
+// becomes unusable and failback delays run out without traffic. It covers
+// the whole route and every member set a selection rule has used.
+func (s *RouteSelector) EvaluateFailover() {
+	s.mu.RLock()
+	routes := make([]routeDefinition, 0, len(s.routes))
+	for _, route := range s.routes {
+		if route.strategy == StrategyFailover {
+			routes = append(routes, route)
+		}
+	}
+	s.mu.RUnlock()
+	for _, route := range routes {
+		sets := [][]string{route.upstreams}
+		s.preferMu.Lock()
+		for key, state := range s.preferences {
+			if state.route == route.name && key != preferenceKey(route.name, route.upstreams) {
+				sets = append(sets, state.members)
+			}
+		}
+		s.preferMu.Unlock()
+		for _, members := range sets {
+			// A set with no usable member is reported by the next pick.
+			_, _ = s.selectFailover(route, members, true)
+		}
+	}
+}
+
+// failoverCandidates returns the selectable members in route order, with
+// their stats in the health view of the route.
+func (s *RouteSelector) failoverCandidates(route routeDefinition, members []string) []adaptiveCandidate {
+	selectable, _ := s.manager.adaptiveCandidates(route.name, members, "")
+	byTag := make(map[string]adaptiveCandidate, len(selectable))
+	for _, c := range selectable {
+		byTag[c.up.Tag] = c
+	}
+	candidates := make([]adaptiveCandidate, 0, len(selectable))
+	for _, tag := range members {
+		if c, ok := byTag[tag]; ok {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates
+}
+
+// failbackReady reports whether c has earned a failback: it is healthy and
+// its latest probes succeeded at least the route's failback probe count.
+func (r routeDefinition) failbackReady(c adaptiveCandidate) bool {
+	return c.stats.HealthState == HealthHealthy && c.stats.ConsecutiveSuccesses >= r.failback.Probes
+}
+
+// selectFailover starts a failover route on its first selectable member and
+// keeps the active upstream while it stays selectable; a lost one is replaced
+// as replaceLost decides. An earlier member takes over again once it is ready for failback and
+// has stayed ready for the failback delay.
+func (s *RouteSelector) selectFailover(route routeDefinition, members []string, commit bool) (*Upstream, error) {
+	candidates := s.failoverCandidates(route, members)
+	if len(candidates) == 0 {
+		return nil, errors.New("no usable upstream in route")
+	}
+	key := preferenceKey(route.name, members)
+	now := time.Now()
+	s.preferMu.Lock()
+	state := s.preferences[key]
+	if state == nil {
+		state = &routePreference{route: route.name, members: members}
+		if commit {
+			s.preferences[key] = state
+		}
+	}
+	current := -1
+	for i, c := range candidates {
+		if c.up.Tag == state.current {
+			current = i
+		}
+	}
+	next := 0
+	var reason string
+	switch {
+	case current < 0 && state.current == "":
+		reason = SwitchInitial
+	case current < 0:
+		next, reason = route.replaceLost(candidates, members, state, now)
+	default:
+		next = current
+		for i := 0; i < current; i++ {
+			if route.failbackReady(candidates[i]) {
+				next = i
+				break
+			}
+		}
+		if next == current {
+			if commit {
+				state.challenger = ""
+			}
+			s.preferMu.Unlock()
+			return candidates[current].up, nil
+		}
+		since := now
+		if state.challenger == candidates[next].up.Tag {
+			since = state.since
+		} else if commit {
+			state.challenger, state.since = candidates[next].up.Tag, now
+		}
+		if now.Sub(since) < route.failback.Delay.Duration() {
+			s.preferMu.Unlock()
+			return candidates[current].up, nil
+		}
+		reason = SwitchFailback
+	}
+	selected := candidates[next].up
+	var change RouteSwitch
+	if commit {
+		change = RouteSwitch{From: state.current, To: selected.Tag, Reason: reason, At: now}
+		state.last = &change
+		state.current, state.challenger = selected.Tag, ""
+	}
+	s.preferMu.Unlock()
+	if commit {
+		level := slog.LevelInfo
+		if reason == SwitchFailover {
+			level = slog.LevelWarn
+		}
+		util.Event(s.manager.logger, level, "upstream.route_active_changed",
+			"flow.route", route.name, "switch.from", change.From, "switch.to", change.To, "switch.reason", reason)
+		if reason != SwitchInitial {
+			s.notifySwitch(route.name, change)
+		}
+	}
+	return selected, nil
+}
+
+// replaceLost picks the successor of a lost active upstream. An earlier
+// member that is ready for failback and has waited out the delay fails back;
+// otherwise the route fails over to the first member after the lost one. Only
+// when no later member is selectable does it move to an earlier one, which is
+// reported as a failover.
+func (r routeDefinition) replaceLost(candidates []adaptiveCandidate, members []string, state *routePreference, now time.Time) (int, string) {
+	lost := indexOf(members, state.current)
+	delay := r.failback.Delay.Duration()
+	for i, c := range candidates {
+		if indexOf(members, c.up.Tag) >= lost {
+			break
+		}
+		waited := delay <= 0 || state.challenger == c.up.Tag && now.Sub(state.since) >= delay
+		if r.failbackReady(c) && waited {
+			return i, SwitchFailback
+		}
+	}
+	for i, c := range candidates {
+		if indexOf(members, c.up.Tag) > lost {
+			return i, SwitchFailover
+		}
+	}
+	for i, c := range candidates {
+		if r.failbackReady(c) {
+			return i, SwitchFailover
+		}
+	}
+	return 0, SwitchFailover
+}
+
+func (s *RouteSelector) notifySwitch(route string, change RouteSwitch) {
+	s.mu.RLock()
+	handler := s.onSwitch
+	s.mu.RUnlock()
+	if handler != nil {
+		handler(route, change)
+	}
+}
+
+func indexOf(tags []string, wanted string) int {
+	for i, tag := range tags {
+		if tag == wanted {
+			return i
+		}
+	}
+	return len(tags)
+}
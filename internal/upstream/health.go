@@ -16,12 +16,31 @@ const (
 	HealthStale   HealthState = "stale"
 )
 
+// ProbeObservation is one probe result. Burst is set when the probe measured
+// Loss and Jitter, and OneWay when it measured the one-way delays and the
+// clock offset of the fbmeasure server. ClockSkew is only logged. Protocol is
+// the probe protocol, tcp or udp; route health views that limit protocols
+// skip observations of other protocols.
 type ProbeObservation struct {
-	Success    bool
-	RTT        time.Duration
-	ObservedAt time.Time
+	Protocol      string
+	Success       bool
+	RTT           time.Duration
+	ObservedAt    time.Time
+	Burst         bool
+	Loss          float64
+	Jitter        time.Duration
+	OneWay        bool
+	UploadDelay   time.Duration
+	DownloadDelay time.Duration
+	ClockOffset   time.Duration
+	ClockSkew     float64
 }
 
+// HealthSnapshot is the shared probe health of an upstream. Loss and Jitter
+// are EWMAs of burst probes and are meaningful only when LossMeasured; the
+// one-way delays and clock offset are EWMAs that are meaningful only when
+// DelayMeasured. The throughput fields hold the latest throughput
+// measurement, if any.
 type HealthSnapshot struct {
 	State                HealthState
 	RTT                  time.Duration
@@ -29,6 +48,24 @@ type HealthSnapshot struct {
 	LastAttemptAt        time.Time
 	ConsecutiveSuccesses int
 	ConsecutiveFailures  int
+	LossMeasured         bool
+	Loss                 float64
+	Jitter               time.Duration
+	DelayMeasured        bool
+	UploadDelay          time.Duration
+	DownloadDelay        time.Duration
+	ClockOffset          time.Duration
+	UploadBps            float64
+	DownloadBps          float64
+	ThroughputAt         time.Time
+}
+
+// ThroughputObservation is one completed throughput measurement in bits per
+// second.
+type ThroughputObservation struct {
+	UploadBps   float64
+	DownloadBps float64
+	ObservedAt  time.Time
 }
 
 // ApplyObservation applies one completed TCP or UDP probe observation.
@@ -69,6 +106,24 @@ func ApplyObservation(previous HealthSnapshot, observation ProbeObservation, cfg
 			next.RTT = time.Duration(float64(next.RTT)*(1-cfg.RTTEWMAAlpha) + float64(observation.RTT)*cfg.RTTEWMAAlpha)
 		}
 	}
+	if observation.Burst {
+		if !next.LossMeasured {
+			next.LossMeasured, next.Loss, next.Jitter = true, observation.Loss, observation.Jitter
+		} else {
+			next.Loss = next.Loss*(1-cfg.RTTEWMAAlpha) + observation.Loss*cfg.RTTEWMAAlpha
+			next.Jitter = time.Duration(float64(next.Jitter)*(1-cfg.RTTEWMAAlpha) + float64(observation.Jitter)*cfg.RTTEWMAAlpha)
+		}
+	}
+	if observation.OneWay {
+		if !next.DelayMeasured {
+			next.DelayMeasured = true
+			next.UploadDelay, next.DownloadDelay, next.ClockOffset = observation.UploadDelay, observation.DownloadDelay, observation.ClockOffset
+		} else {
+			next.UploadDelay = ewmaDuration(next.UploadDelay, observation.UploadDelay, cfg.RTTEWMAAlpha)
+			next.DownloadDelay = ewmaDuration(next.DownloadDelay, observation.DownloadDelay, cfg.RTTEWMAAlpha)
+			next.ClockOffset = ewmaDuration(next.ClockOffset, observation.ClockOffset, cfg.RTTEWMAAlpha)
+		}
+	}
 	if previous.State == HealthDown {
 		if next.ConsecutiveSuccesses >= cfg.RecoveryThreshold {
 			next.State = HealthHealthy
@@ -79,6 +134,10 @@ func ApplyObservation(previous HealthSnapshot, observation ProbeObservation, cfg
 	return next
 }
 
+func ewmaDuration(previous, sample time.Duration, alpha float64) time.Duration {
+	return time.Duration(float64(previous)*(1-alpha) + float64(sample)*alpha)
+}
+
 func EffectiveHealth(snapshot HealthSnapshot, now time.Time, stale time.Duration) HealthState {
 	if snapshot.State == HealthDown {
 		return HealthDown
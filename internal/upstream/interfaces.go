@@ -6,10 +6,14 @@ type ActiveChange struct {
 	Reason string
 }
 
+// UsabilityChange reports a health state change of an upstream. Reason is
+// the new state and From the previous one; while passive health holds the
+// upstream down its state reads passive_<signal>.
 type UsabilityChange struct {
 	Tag    string
 	Usable bool
 	Reason string
+	From   string
 }
 
 // UpstreamStateReader is the minimal control-plane dependency.
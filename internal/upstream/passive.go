@@ -0,0 +1,164 @@
+package upstream
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// HealthSignalProbe is the health signal of a state that comes from probes.
+const HealthSignalProbe = "probe"
+
+// passiveWindow counts the data-plane outcomes of one upstream in one-second
+// buckets that cover the configured window.
+type passiveWindow struct {
+	buckets []passiveBucket
+}
+
+type passiveBucket struct {
+	second   int64
+	outcomes int
+	failures [len(config.PassiveSignals)]int
+}
+
+// PassiveHealthSnapshot is the passive health window reported by
+// ListUpstreams. Failures are keyed by signal.
+type PassiveHealthSnapshot struct {
+	Outcomes int            `json:"outcomes"`
+	Failures map[string]int `json:"failures,omitempty"`
+	Down     bool           `json:"down"`
+}
+
+func (w *passiveWindow) record(now time.Time, window time.Duration, signal int) {
+	size := int(window / time.Second)
+	if len(w.buckets) != size {
+		w.buckets = make([]passiveBucket, size)
+	}
+	second := now.Unix()
+	bucket := &w.buckets[second%int64(size)]
+	if bucket.second != second {
+		*bucket = passiveBucket{second: second}
+	}
+	bucket.outcomes++
+	if signal >= 0 {
+		bucket.failures[signal]++
+	}
+}
+
+func (w *passiveWindow) counts(now time.Time, window time.Duration) (outcomes int, failures [len(config.PassiveSignals)]int) {
+	if len(w.buckets) != int(window/time.Second) {
+		return 0, failures
+	}
+	oldest := now.Unix() - int64(len(w.buckets))
+	for _, bucket := range w.buckets {
+		if bucket.second <= oldest {
+			continue
+		}
+		outcomes += bucket.outcomes
+		for i, count := range bucket.failures {
+			failures[i] += count
+		}
+	}
+	return outcomes, failures
+}
+
+// RecordFlowOutcome adds one data-plane outcome of tag to its passive health
+// window. An empty signal is an outcome without an upstream failure.
+func (m *UpstreamManager) RecordFlowOutcome(tag, signal string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cfg := m.healthConfig.Passive
+	up := m.upstreams[tag]
+	if !cfg.Enabled || up == nil {
+		return
+	}
+	index := -1
+	if signal != "" {
+		if index = slices.Index(config.PassiveSignals[:], signal); index < 0 {
+			return
+		}
+	}
+	if up.passive == nil {
+		up.passive = &passiveWindow{}
+	}
+	up.passive.record(time.Now(), cfg.Window.Duration(), index)
+	m.refreshStatsLocked(up)
+}
+
+// passiveVerdictLocked returns the signal with the most failures when the
+// window of up meets the passive thresholds, or "" when it does not.
+func (m *UpstreamManager) passiveVerdictLocked(up *Upstream, now time.Time) string {
+	cfg := m.healthConfig.Passive
+	if !cfg.Enabled || up.passive == nil {
+		return ""
+	}
+	outcomes, failures := up.passive.counts(now, cfg.Window.Duration())
+	total, worst, worstCount := 0, "", 0
+	for i, signal := range config.PassiveSignals {
+		if !slices.Contains(cfg.Signals, signal) {
+			continue
+		}
+		total += failures[i]
+		if failures[i] > worstCount {
+			worst, worstCount = signal, failures[i]
+		}
+	}
+	if total == 0 || total < cfg.FailureThreshold || float64(total) < cfg.FailureRatio*float64(outcomes) {
+		return ""
+	}
+	return worst
+}
+
+// setPassiveDownLocked records a new passive verdict. The usability callback
+// runs only when the verdict changes whether up is usable, that is when the
+// probes do not hold it down already; notified reports whether it ran.
+func (m *UpstreamManager) setPassiveDownLocked(up *Upstream, signal string, probeState HealthState) (notified bool) {
+	if signal == up.passiveDown {
+		return false
+	}
+	previous := up.passiveDown
+	up.passiveDown = signal
+	if signal != "" {
+		util.Event(m.logger, slog.LevelWarn, "upstream.passive_down", "upstream", up.Tag, "health.signal", signal)
+	} else {
+		util.Event(m.logger, slog.LevelInfo, "upstream.passive_recovered", "upstream", up.Tag)
+	}
+	if probeState == HealthDown || m.onStateChange == nil {
+		return false
+	}
+	if signal != "" {
+		from := string(probeState)
+		if previous != "" {
+			from = "passive_" + previous
+		}
+		m.onStateChange(UsabilityChange{Tag: up.Tag, Usable: false, Reason: "passive_" + signal, From: from})
+	} else {
+		m.onStateChange(UsabilityChange{Tag: up.Tag, Usable: true, Reason: string(probeState), From: "passive_" + previous})
+	}
+	return true
+}
+
+func (m *UpstreamManager) passiveSnapshotLocked(up *Upstream, now time.Time) *PassiveHealthSnapshot {
+	cfg := m.healthConfig.Passive
+	if !cfg.Enabled {
+		return nil
+	}
+	snapshot := &PassiveHealthSnapshot{Down: up.passiveDown != ""}
+	if up.passive == nil {
+		return snapshot
+	}
+	outcomes, failures := up.passive.counts(now, cfg.Window.Duration())
+	snapshot.Outcomes = outcomes
+	for i, signal := range config.PassiveSignals {
+		if failures[i] > 0 {
+			if snapshot.Failures == nil {
+				snapshot.Failures = make(map[string]int)
+			}
+			snapshot.Failures[signal] = failures[i]
+		}
+	}
+	return snapshot
+}
@@ -0,0 +1,168 @@
+package upstream
+
+import (
+	"slices"
+
+	"github.com/NodePath81/fbforward/internal/config"
+)
+
+// RouteHealth installs the health overrides of one route over its members.
+type RouteHealth struct {
+	Route     string
+	Overrides config.RouteHealthConfig
+	Upstreams []string
+}
+
+// RouteHealthStatus reports the health settings a route applies and, for a
+// route with overrides, the health of each member as the route evaluates it.
+// Overridden lists the settings taken from the route rather than the global
+// health configuration.
+type RouteHealthStatus struct {
+	FailureThreshold  int                 `json:"failure_threshold"`
+	RecoveryThreshold int                 `json:"recovery_threshold"`
+	StaleThreshold    string              `json:"stale_threshold"`
+	RTTEWMAAlpha      float64             `json:"rtt_ewma_alpha"`
+	Protocols         []string            `json:"protocols,omitempty"`
+	Overridden        []string            `json:"overridden,omitempty"`
+	Members           []RouteMemberHealth `json:"members,omitempty"`
+}
+
+// RouteMemberHealth is one member's health in a route's own view.
+type RouteMemberHealth struct {
+	Upstream             string      `json:"upstream"`
+	HealthState          HealthState `json:"health_state"`
+	RTTMs                float64     `json:"rtt_ms"`
+	ConsecutiveSuccesses int         `json:"consecutive_successes"`
+	ConsecutiveFailures  int         `json:"consecutive_failures"`
+}
+
+// routeHealthView evaluates the probe observations of a route's members with
+// the route's overrides. Dial cooldowns, drains and passive verdicts stay
+// shared with the manager.
+type routeHealthView struct {
+	overrides config.RouteHealthConfig
+	members   map[string]*routeMember
+}
+
+type routeMember struct {
+	health HealthSnapshot
+	stats  UpstreamStats
+}
+
+func (v *routeHealthView) config(global config.HealthConfig) config.HealthConfig {
+	return v.overrides.Apply(global)
+}
+
+func (v *routeHealthView) counts(protocol string) bool {
+	return len(v.overrides.Protocols) == 0 || protocol == "" || slices.Contains(v.overrides.Protocols, protocol)
+}
+
+// SetRouteHealth replaces the route health views. A route keeps the view of
+// members it still lists; a new member starts from the shared health of the
+// upstream and follows the route's settings from its next probe. Routes
+// without overrides use the shared health.
+func (m *UpstreamManager) SetRouteHealth(routes []RouteHealth) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	next := make(map[string]*routeHealthView, len(routes))
+	for _, route := range routes {
+		if !route.Overrides.Enabled() {
+			continue
+		}
+		view := &routeHealthView{overrides: route.Overrides, members: make(map[string]*routeMember, len(route.Upstreams))}
+		previous := m.routeHealth[route.Route]
+		for _, tag := range route.Upstreams {
+			if previous != nil && previous.members[tag] != nil {
+				view.members[tag] = previous.members[tag]
+				continue
+			}
+			member := &routeMember{}
+			if up := m.upstreams[tag]; up != nil {
+				member.health = up.health
+			}
+			view.members[tag] = member
+		}
+		next[route.Route] = view
+	}
+	m.routeHealth = next
+	for _, up := range m.upstreams {
+		m.refreshStatsLocked(up)
+	}
+}
+
+// RouteHealthStatus returns the health settings of route and, when the route
+// has overrides, its view of tags.
+func (m *UpstreamManager) RouteHealthStatus(route string, tags []string) RouteHealthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cfg := m.healthConfig
+	view := m.routeHealth[route]
+	if view != nil {
+		cfg = view.config(cfg)
+	}
+	status := RouteHealthStatus{
+		FailureThreshold: cfg.FailureThreshold, RecoveryThreshold: cfg.RecoveryThreshold,
+		StaleThreshold: cfg.StaleThreshold.Duration().String(), RTTEWMAAlpha: cfg.RTTEWMAAlpha,
+	}
+	if view == nil {
+		return status
+	}
+	overrides := view.overrides
+	status.Protocols = append([]string(nil), overrides.Protocols...)
+	for _, field := range []struct {
+		name string
+		set  bool
+	}{
+		{"failure_threshold", overrides.FailureThreshold > 0},
+		{"recovery_threshold", overrides.RecoveryThreshold > 0},
+		{"stale_threshold", overrides.StaleThreshold > 0},
+		{"rtt_ewma_alpha", overrides.RTTEWMAAlpha > 0},
+		{"protocols", len(overrides.Protocols) > 0},
+	} {
+		if field.set {
+			status.Overridden = append(status.Overridden, field.name)
+		}
+	}
+	for _, tag := range tags {
+		member := view.members[tag]
+		up := m.upstreams[tag]
+		if member == nil || up == nil {
+			continue
+		}
+		m.refreshStatsLocked(up)
+		status.Members = append(status.Members, RouteMemberHealth{
+			Upstream: tag, HealthState: member.stats.HealthState, RTTMs: member.stats.RTTMs,
+			ConsecutiveSuccesses: member.stats.ConsecutiveSuccesses, ConsecutiveFailures: member.stats.ConsecutiveFailures,
+		})
+	}
+	return status
+}
+
+// statsLocked returns the stats of up in the health view of route, or its
+// shared stats when the route has no view of it.
+func (m *UpstreamManager) statsLocked(route string, up *Upstream) *UpstreamStats {
+	if view := m.routeHealth[route]; view != nil && route != "" {
+		if member := view.members[up.Tag]; member != nil {
+			return &member.stats
+		}
+	}
+	return &up.stats
+}
+
+// applyRouteObservationLocked applies observation to every route view of tag
+// that counts its protocol and returns the previous route health states.
+func (m *UpstreamManager) applyRouteObservationLocked(tag string, observation ProbeObservation) map[string]HealthState {
+	var previous map[string]HealthState
+	for route, view := range m.routeHealth {
+		member := view.members[tag]
+		if member == nil || !view.counts(observation.Protocol) {
+			continue
+		}
+		if previous == nil {
+			previous = make(map[string]HealthState)
+		}
+		previous[route] = member.stats.HealthState
+		member.health = ApplyObservation(member.health, observation, view.config(m.healthConfig))
+	}
+	return previous
+}
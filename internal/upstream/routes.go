@@ -1,10 +1,13 @@
 package upstream
 
 import (
+	"errors"
 	"fmt"
+	"net/netip"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/NodePath81/fbforward/internal/config"
 )
@@ -19,6 +22,29 @@ const (
 	OverrideFallback OverrideState = "fallback"
 )
 
+// Route strategies. Static, adaptive and failover pick a single upstream;
+// the others spread new Flows across every selectable member of the route.
+const (
+	StrategyStatic           = "static"
+	StrategyAdaptive         = "adaptive"
+	StrategyFailover         = "failover"
+	StrategyWeighted         = "weighted"
+	StrategyLeastConnections = "least_connections"
+	StrategyRoundRobin       = "round_robin"
+)
+
+// ClientLookup resolves the country and ASN of a client address. The GeoIP
+// manager satisfies it through an adapter; empty results never match.
+type ClientLookup interface {
+	LookupClient(addr netip.Addr) (country string, asn int)
+}
+
+// FlowCounter reports open Flows per upstream. flow.Registry satisfies it; an
+// empty route counts across all routes.
+type FlowCounter interface {
+	ActiveByUpstream(route string) map[string]int
+}
+
 type RouteStatus struct {
 	Name            string        `json:"route"`
 	Strategy        string        `json:"strategy"`
@@ -27,6 +53,31 @@ type RouteStatus struct {
 	Effective       string        `json:"effective_upstream,omitempty"`
 	Override        string        `json:"override_upstream,omitempty"`
 	OverrideState   OverrideState `json:"override_state"`
+	PortOffset      int           `json:"port_offset,omitempty"`
+	Ports           map[int]int   `json:"ports,omitempty"`
+	ProxyProtocol   string        `json:"proxy_protocol,omitempty"`
+	Affinity        string        `json:"affinity,omitempty"`
+	Prefer          string        `json:"prefer,omitempty"`
+	// Scores breaks down the composite score of each selectable member of a
+	// route with a score; LastSwitch is the last change of an adaptive route's
+	// preferred upstream under a score or hysteresis.
+	Scores     []CandidateScore `json:"scores,omitempty"`
+	LastSwitch *RouteSwitch     `json:"last_switch,omitempty"`
+	// Health reports the health settings of a route that consults health.
+	Health *RouteHealthStatus `json:"health,omitempty"`
+	// SelectionRule is set by PickFor when a client selection rule matched.
+	SelectionRule string       `json:"selection_rule,omitempty"`
+	Shares        []RouteShare `json:"shares,omitempty"`
+}
+
+// RouteShare describes how a route's open Flows are spread over one member.
+// Share is the fraction of the route's open Flows, zero when none are open.
+type RouteShare struct {
+	Upstream    string  `json:"upstream"`
+	Weight      int     `json:"weight,omitempty"`
+	Selectable  bool    `json:"selectable"`
+	ActiveFlows int     `json:"active_flows"`
+	Share       float64 `json:"share"`
 }
 
 type routeDefinition struct {
@@ -34,6 +85,26 @@ type routeDefinition struct {
 	strategy        string
 	upstreams       []string
 	defaultUpstream string
+	weights         map[string]int
+	affinity        routeAffinity
+	hedge           bool
+	hedgeDelay      time.Duration
+	prefer          string
+	score           config.RouteScoreConfig
+	hysteresis      config.RouteHysteresisConfig
+	health          config.RouteHealthConfig
+	failback        config.RouteFailbackConfig
+	rules           []selectionRule
+	portOffset      int
+	ports           map[int]int
+	proxyProtocol   string
+}
+
+// routeBalance is the per-route state of the distribution strategies. It is
+// reset when routes are replaced.
+type routeBalance struct {
+	next    uint64
+	current map[string]int
 }
 
 // RouteSelector owns the route-local operator override state. It deliberately
@@ -44,21 +115,127 @@ type RouteSelector struct {
 	mu        sync.RWMutex
 	routes    map[string]routeDefinition
 	overrides map[string]string
+	flows     FlowCounter
+	clients   ClientLookup
+
+	balanceMu sync.Mutex
+	balance   map[string]*routeBalance
+	affinity  *affinityTable
+
+	preferMu    sync.Mutex
+	preferences map[string]*routePreference
+	onSwitch    RouteSwitchHandler
 }
 
 func NewRouteSelector(manager *UpstreamManager, routes []config.RouteConfig) *RouteSelector {
-	selector := &RouteSelector{manager: manager, routes: make(map[string]routeDefinition, len(routes)), overrides: make(map[string]string)}
+	definitions := routeDefinitions(routes)
+	installRouteHealth(manager, definitions)
+	return &RouteSelector{
+		manager: manager, routes: definitions, overrides: make(map[string]string),
+		balance: make(map[string]*routeBalance), affinity: newAffinityTable(), preferences: make(map[string]*routePreference),
+	}
+}
+
+// installRouteHealth gives every route with health overrides its own health
+// view of its members.
+func installRouteHealth(manager *UpstreamManager, definitions map[string]routeDefinition) {
+	if manager == nil {
+		return
+	}
+	views := make([]RouteHealth, 0, len(definitions))
+	for _, route := range definitions {
+		if route.health.Enabled() {
+			views = append(views, RouteHealth{Route: route.name, Overrides: route.health, Upstreams: route.upstreams})
+		}
+	}
+	manager.SetRouteHealth(views)
+}
+
+// SetFlowCounter supplies the open-Flow counts used by least_connections and
+// reported as route shares.
+func (s *RouteSelector) SetFlowCounter(counter FlowCounter) {
+	s.mu.Lock()
+	s.flows = counter
+	s.mu.Unlock()
+}
+
+// SetClientLookup supplies the country and ASN lookup used by selection
+// rules. Without one, only CIDR matchers can match.
+func (s *RouteSelector) SetClientLookup(lookup ClientLookup) {
+	s.mu.Lock()
+	s.clients = lookup
+	s.mu.Unlock()
+}
+
+func (s *RouteSelector) activeFlows(route string) map[string]int {
+	s.mu.RLock()
+	counter := s.flows
+	s.mu.RUnlock()
+	if counter == nil {
+		return map[string]int{}
+	}
+	return counter.ActiveByUpstream(route)
+}
+
+func routeDefinitions(routes []config.RouteConfig) map[string]routeDefinition {
+	definitions := make(map[string]routeDefinition, len(routes))
 	for _, route := range routes {
 		upstreams := append([]string(nil), route.Upstreams...)
 		defaultUpstream := route.DefaultUpstream
-		if route.Strategy == "static" && defaultUpstream == "" && len(upstreams) == 1 {
+		if route.Strategy == StrategyStatic && defaultUpstream == "" && len(upstreams) == 1 {
 			defaultUpstream = upstreams[0]
 		}
-		selector.routes[route.Name] = routeDefinition{
+		var weights map[string]int
+		if len(route.Weights) > 0 {
+			weights = make(map[string]int, len(route.Weights))
+			for tag, weight := range route.Weights {
+				weights[tag] = weight
+			}
+		}
+		var ports map[int]int
+		if len(route.Ports) > 0 {
+			ports = make(map[int]int, len(route.Ports))
+			for listenPort, upstreamPort := range route.Ports {
+				ports[listenPort] = upstreamPort
+			}
+		}
+		definitions[route.Name] = routeDefinition{
 			name: route.Name, strategy: route.Strategy, upstreams: upstreams, defaultUpstream: defaultUpstream,
+			weights: weights, affinity: newRouteAffinity(route.Affinity), hedge: route.Hedge.Enabled, hedgeDelay: route.Hedge.Delay.Duration(), prefer: route.Prefer, score: route.Score, hysteresis: route.Hysteresis, health: route.Health, failback: route.Failback, rules: newSelectionRules(route.SelectionRules), portOffset: route.PortOffset, ports: ports, proxyProtocol: route.ProxyProtocol,
 		}
 	}
-	return selector
+	return definitions
+}
+
+// Replace installs reloaded route definitions. Operator overrides survive
+// when their route still exists and still lists the overriding upstream;
+// other overrides are dropped because they no longer describe a valid choice.
+// Distribution state starts over so new weights apply immediately. Affinity
+// pins survive while their route still pins clients and still lists the
+// pinned upstream. An adaptive route keeps its preferred upstream while it
+// still ranks candidates and still lists that upstream, and a failover route
+// keeps its active upstream while it still lists it. Route health views
+// keep the state of members their route still lists.
+func (s *RouteSelector) Replace(routes []config.RouteConfig) {
+	definitions := routeDefinitions(routes)
+	installRouteHealth(s.manager, definitions)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, tag := range s.overrides {
+		route, ok := definitions[name]
+		if !ok || !containsTag(route.upstreams, tag) {
+			delete(s.overrides, name)
+		}
+	}
+	s.routes = definitions
+	s.affinity.retain(func(name, tag string) bool {
+		route, ok := definitions[name]
+		return ok && route.affinity.mode == AffinitySticky && containsTag(route.upstreams, tag)
+	})
+	s.balanceMu.Lock()
+	s.balance = make(map[string]*routeBalance)
+	s.balanceMu.Unlock()
+	s.retainPreferences(definitions)
 }
 
 func (s *RouteSelector) route(name string) (routeDefinition, bool) {
@@ -86,6 +263,9 @@ func (s *RouteSelector) SetOverride(routeName, tag string) error {
 	if s.manager == nil || s.manager.Get(tag) == nil {
 		return fmt.Errorf("upstream %q not found", tag)
 	}
+	if s.manager.Draining(tag) {
+		return fmt.Errorf("upstream %q is draining", tag)
+	}
 	s.mu.Lock()
 	s.overrides[route.name] = tag
 	s.mu.Unlock()
@@ -109,21 +289,132 @@ func (s *RouteSelector) override(route string) string {
 	return s.overrides[route]
 }
 
+// DestinationPort returns the upstream port for a Flow accepted on
+// listenPort. An explicit route mapping wins over the upstream's configured
+// port, which in turn wins over the route offset. The port of an SRV record
+// always wins, since the service registry owns it. Zero means the caller
+// should keep the listener port.
+func (s *RouteSelector) DestinationPort(routeName string, selected *Upstream, listenPort int) int {
+	if selected != nil && selected.SRV != nil {
+		return selected.Port
+	}
+	route, _ := s.route(routeName)
+	if port, ok := route.ports[listenPort]; ok && listenPort > 0 {
+		return port
+	}
+	if selected != nil && selected.Port > 0 {
+		return selected.Port
+	}
+	if route.portOffset != 0 && listenPort > 0 {
+		return listenPort + route.portOffset
+	}
+	return 0
+}
+
+// ProxyProtocol returns the PROXY header version to emit toward selected. An
+// upstream setting describes what the backend accepts, so it wins over the
+// route default.
+func (s *RouteSelector) ProxyProtocol(routeName string, selected *Upstream) string {
+	if selected != nil && selected.ProxyProtocol != "" {
+		return selected.ProxyProtocol
+	}
+	route, _ := s.route(routeName)
+	return route.proxyProtocol
+}
+
+// Pick selects the upstream for a new Flow on routeName and advances the
+// route's distribution state.
 func (s *RouteSelector) Pick(routeName string) (*Upstream, RouteStatus, error) {
+	return s.pick(routeName, netip.Addr{}, true)
+}
+
+// PickFor is Pick for a known client. Routes with affinity keep the client's
+// prefix on its pinned upstream while that upstream stays selectable; an
+// operator override still wins.
+func (s *RouteSelector) PickFor(routeName string, client netip.Addr) (*Upstream, RouteStatus, error) {
+	return s.pick(routeName, client, true)
+}
+
+// PickHedged is PickFor for a TCP Flow that may race two upstreams. When the
+// route enables hedging and no operator override is active, hedge is the next
+// adaptive candidate from the same members as primary; otherwise it is nil.
+func (s *RouteSelector) PickHedged(routeName string, client netip.Addr) (*Upstream, *Upstream, RouteStatus, error) {
+	primary, status, err := s.pick(routeName, client, true)
+	if err != nil {
+		return nil, nil, status, err
+	}
+	route, _ := s.route(routeName)
+	if !route.hedge || status.OverrideState == OverrideActive {
+		return primary, nil, status, nil
+	}
+	members := route.upstreams
+	for _, rule := range route.rules {
+		if rule.name == status.SelectionRule && len(s.manager.SelectableInRoute(route.name, rule.upstreams)) > 0 {
+			members = rule.upstreams
+		}
+	}
+	rest := make([]string, 0, len(members))
+	for _, tag := range members {
+		if tag != primary.Tag {
+			rest = append(rest, tag)
+		}
+	}
+	if len(rest) == 0 {
+		return primary, nil, status, nil
+	}
+	if route.ranked() {
+		// The hedge is the best of the rest; hysteresis only holds the primary.
+		candidates, best := s.rankAdaptive(route, rest)
+		if best < 0 {
+			return primary, nil, status, nil
+		}
+		return primary, candidates[best].up, status, nil
+	}
+	hedge, err := s.manager.SelectAdaptiveInRoute(route.name, rest, route.prefer)
+	if err != nil {
+		return primary, nil, status, nil
+	}
+	return primary, hedge, status, nil
+}
+
+// HedgeDelay returns how long a hedged connect waits before dialing the
+// second candidate and whether the route hedges at all.
+func (s *RouteSelector) HedgeDelay(routeName string) (time.Duration, bool) {
+	route, ok := s.route(routeName)
+	return route.hedgeDelay, ok && route.hedge
+}
+
+func (s *RouteSelector) pick(routeName string, client netip.Addr, commit bool) (*Upstream, RouteStatus, error) {
 	route, ok := s.route(routeName)
 	if !ok {
 		return nil, RouteStatus{}, fmt.Errorf("route %q not found", routeName)
 	}
 	override := s.override(route.name)
-	status := RouteStatus{
-		Name: route.name, Strategy: route.strategy, Upstreams: append([]string(nil), route.upstreams...),
-		DefaultUpstream: route.defaultUpstream, Override: override, OverrideState: OverrideNone,
-	}
-	if route.strategy == "static" {
+	status := route.status(override)
+	if route.strategy == StrategyStatic {
+		// An override naming a draining upstream falls back like an unusable
+		// adaptive override; a draining default is replaced by the first
+		// member in route order that is not draining.
 		tag := route.defaultUpstream
 		if override != "" {
-			tag = override
-			status.OverrideState = OverrideActive
+			if s.manager.Draining(override) {
+				status.OverrideState = OverrideFallback
+			} else {
+				tag = override
+				status.OverrideState = OverrideActive
+			}
+		}
+		if s.manager.Draining(tag) {
+			tag = ""
+			for _, member := range route.upstreams {
+				if !s.manager.Draining(member) {
+					tag = member
+					break
+				}
+			}
+			if tag == "" {
+				return nil, status, fmt.Errorf("every upstream of route %q is draining", route.name)
+			}
 		}
 		selected, err := s.manager.SelectStatic(tag)
 		if err != nil {
@@ -133,14 +424,30 @@ func (s *RouteSelector) Pick(routeName string) (*Upstream, RouteStatus, error) {
 		return selected, status, nil
 	}
 	if override != "" {
-		if selected, err := s.manager.SelectOverride(override, true); err == nil {
+		if selected, err := s.manager.SelectOverrideInRoute(route.name, override, true); err == nil {
 			status.Effective = override
 			status.OverrideState = OverrideActive
 			return selected, status, nil
 		}
 		status.OverrideState = OverrideFallback
 	}
-	selected, err := s.manager.SelectAdaptiveFrom(route.upstreams)
+	members := route.upstreams
+	if rule := s.matchRule(route, client); rule != nil {
+		status.SelectionRule = rule.name
+		// An unusable preferred subset falls back to the whole route.
+		if len(s.manager.SelectableInRoute(route.name, rule.upstreams)) > 0 {
+			members = rule.upstreams
+		}
+	}
+	if prefix, ok := route.affinity.key(client); ok && route.affinity.enabled() {
+		selected, err := s.selectAffine(route, members, prefix)
+		if err != nil {
+			return nil, status, err
+		}
+		status.Effective = selected.Tag
+		return selected, status, nil
+	}
+	selected, err := s.selectFor(route, members, commit)
 	if err != nil {
 		return nil, status, err
 	}
@@ -148,6 +455,169 @@ func (s *RouteSelector) Pick(routeName string) (*Upstream, RouteStatus, error) {
 	return selected, status, nil
 }
 
+// selectAffine returns the client's upstream. Consistent hashing computes it
+// from the selectable members on every pick, so clients return to their owner
+// once it recovers. Sticky affinity returns the pinned upstream, or pins a new
+// one when there is no pin or the pinned upstream is down or cooling down;
+// each use extends the pin by the route TTL.
+func (s *RouteSelector) selectAffine(route routeDefinition, members []string, client netip.Prefix) (*Upstream, error) {
+	if route.affinity.mode == AffinityConsistentHash {
+		candidates := s.manager.SelectableInRoute(route.name, members)
+		if len(candidates) == 0 {
+			return nil, errors.New("no usable upstream in route")
+		}
+		return rendezvous(route, client, candidates), nil
+	}
+	key := affinityKey{route: route.name, client: client}
+	now := time.Now()
+	if tag, ok := s.affinity.lookup(key, now); ok {
+		if selected, err := s.manager.SelectOverrideInRoute(route.name, tag, true); err == nil {
+			s.affinity.store(key, tag, now.Add(route.affinity.ttl))
+			return selected, nil
+		}
+	}
+	selected, err := s.selectFor(route, members, true)
+	if err != nil {
+		return nil, err
+	}
+	s.affinity.store(key, selected.Tag, now.Add(route.affinity.ttl))
+	return selected, nil
+}
+
+// Affinity lists unexpired pins, optionally for one route.
+func (s *RouteSelector) Affinity(routeName string) ([]AffinityEntry, error) {
+	name := strings.TrimSpace(routeName)
+	if name != "" {
+		if _, ok := s.route(name); !ok {
+			return nil, fmt.Errorf("route %q not found", routeName)
+		}
+	}
+	return s.affinity.list(name, time.Now()), nil
+}
+
+// ClearAffinity removes the route's pins that overlap client, which may be
+// an address or a prefix. An empty client clears every pin of the route.
+func (s *RouteSelector) ClearAffinity(routeName, client string) (int, error) {
+	route, ok := s.route(routeName)
+	if !ok {
+		return 0, fmt.Errorf("route %q not found", routeName)
+	}
+	var prefix netip.Prefix
+	if client = strings.TrimSpace(client); client != "" {
+		var err error
+		if prefix, err = parseClientPrefix(client); err != nil {
+			return 0, err
+		}
+	}
+	return s.affinity.clear(route.name, prefix), nil
+}
+
+func parseClientPrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid client %q", value)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid client %q", value)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// selectFor applies the route strategy to members, which is the route's
+// upstream list or the subset chosen by a selection rule.
+func (s *RouteSelector) selectFor(route routeDefinition, members []string, commit bool) (*Upstream, error) {
+	if route.strategy == StrategyFailover {
+		return s.selectFailover(route, members, commit)
+	}
+	if route.strategy == StrategyAdaptive {
+		if route.ranked() {
+			return s.selectRanked(route, members, commit)
+		}
+		return s.manager.SelectAdaptiveInRoute(route.name, members, route.prefer)
+	}
+	candidates := s.manager.SelectableInRoute(route.name, members)
+	if len(candidates) == 0 {
+		return nil, errors.New("no usable upstream in route")
+	}
+	var counts map[string]int
+	if route.strategy == StrategyLeastConnections {
+		counts = s.activeFlows("")
+	}
+	s.balanceMu.Lock()
+	defer s.balanceMu.Unlock()
+	state := s.balance[route.name]
+	if state == nil {
+		state = &routeBalance{current: make(map[string]int)}
+		s.balance[route.name] = state
+	}
+	switch route.strategy {
+	case StrategyWeighted:
+		return state.weighted(route, candidates, commit), nil
+	case StrategyLeastConnections:
+		return state.leastConnections(candidates, counts, commit), nil
+	default:
+		// Discovered SRV members carry their record weights.
+		if len(route.weights) > 0 {
+			return state.weighted(route, candidates, commit), nil
+		}
+		return state.roundRobin(candidates, commit), nil
+	}
+}
+
+// weighted is smooth weighted round-robin: every candidate gains its weight,
+// the largest running total wins and pays back the sum. Down or cooling
+// members are simply absent, so their weight is shared by the rest.
+func (b *routeBalance) weighted(route routeDefinition, candidates []*Upstream, commit bool) *Upstream {
+	total := 0
+	var best *Upstream
+	bestCurrent := 0
+	next := make(map[string]int, len(candidates))
+	for _, up := range candidates {
+		weight := route.weight(up.Tag)
+		next[up.Tag] = b.current[up.Tag] + weight
+		total += weight
+		if best == nil || next[up.Tag] > bestCurrent {
+			best, bestCurrent = up, next[up.Tag]
+		}
+	}
+	if commit {
+		next[best.Tag] -= total
+		b.current = next
+	}
+	return best
+}
+
+// leastConnections picks the candidate with the fewest open Flows across all
+// routes. Ties rotate so a burst of new Flows, which are counted only once
+// they open, does not land on the first member.
+func (b *routeBalance) leastConnections(candidates []*Upstream, counts map[string]int, commit bool) *Upstream {
+	start := int(b.next % uint64(len(candidates)))
+	best := candidates[start]
+	for i := 1; i < len(candidates); i++ {
+		up := candidates[(start+i)%len(candidates)]
+		if counts[up.Tag] < counts[best.Tag] {
+			best = up
+		}
+	}
+	if commit {
+		b.next++
+	}
+	return best
+}
+
+func (b *routeBalance) roundRobin(candidates []*Upstream, commit bool) *Upstream {
+	selected := candidates[b.next%uint64(len(candidates))]
+	if commit {
+		b.next++
+	}
+	return selected
+}
+
 func (s *RouteSelector) Status() []RouteStatus {
 	s.mu.RLock()
 	names := make([]string, 0, len(s.routes))
@@ -158,20 +628,68 @@ func (s *RouteSelector) Status() []RouteStatus {
 	sort.Strings(names)
 	result := make([]RouteStatus, 0, len(names))
 	for _, name := range names {
-		_, status, err := s.Pick(name)
+		// Status previews the next choice without consuming a turn.
+		_, status, err := s.pick(name, netip.Addr{}, false)
+		route, _ := s.route(name)
 		if err != nil {
 			// Status remains useful when a configured upstream is unavailable.
-			route, _ := s.route(name)
-			status = RouteStatus{Name: route.name, Strategy: route.strategy, Upstreams: append([]string(nil), route.upstreams...), DefaultUpstream: route.defaultUpstream, Override: s.override(name), OverrideState: OverrideNone}
-			if status.Override != "" && route.strategy == "adaptive" {
+			status = route.status(s.override(name))
+			if status.Override != "" && route.strategy != StrategyStatic {
 				status.OverrideState = OverrideFallback
 			}
 		}
+		status.Shares = s.shares(route)
+		if route.strategy == StrategyAdaptive && route.ranked() || route.strategy == StrategyFailover {
+			status.Scores, status.LastSwitch = s.ranking(route)
+		}
+		if route.strategy != StrategyStatic && s.manager != nil {
+			health := s.manager.RouteHealthStatus(route.name, route.upstreams)
+			status.Health = &health
+		}
 		result = append(result, status)
 	}
 	return result
 }
 
+func (s *RouteSelector) shares(route routeDefinition) []RouteShare {
+	counts := s.activeFlows(route.name)
+	selectable := make(map[string]bool, len(route.upstreams))
+	for _, up := range s.manager.SelectableInRoute(route.name, route.upstreams) {
+		selectable[up.Tag] = true
+	}
+	total := 0
+	for _, tag := range route.upstreams {
+		total += counts[tag]
+	}
+	shares := make([]RouteShare, 0, len(route.upstreams))
+	for _, tag := range route.upstreams {
+		share := RouteShare{Upstream: tag, Selectable: selectable[tag], ActiveFlows: counts[tag]}
+		if route.strategy == StrategyWeighted {
+			share.Weight = route.weight(tag)
+		}
+		if total > 0 {
+			share.Share = float64(counts[tag]) / float64(total)
+		}
+		shares = append(shares, share)
+	}
+	return shares
+}
+
+func (r routeDefinition) weight(tag string) int {
+	if weight, ok := r.weights[tag]; ok {
+		return weight
+	}
+	return 1
+}
+
+func (r routeDefinition) status(override string) RouteStatus {
+	return RouteStatus{
+		Name: r.name, Strategy: r.strategy, Upstreams: append([]string(nil), r.upstreams...),
+		DefaultUpstream: r.defaultUpstream, Override: override, OverrideState: OverrideNone,
+		PortOffset: r.portOffset, Ports: r.ports, ProxyProtocol: r.proxyProtocol, Affinity: r.affinity.mode, Prefer: r.prefer,
+	}
+}
+
 func containsTag(tags []string, wanted string) bool {
 	for _, tag := range tags {
 		if tag == wanted {
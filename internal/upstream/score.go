@@ -0,0 +1,333 @@
+package upstream
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/NodePath81/fbforward/internal/config"
+	"github.com/NodePath81/fbforward/internal/util"
+)
+
+// Reasons an adaptive route changed its preferred upstream.
+const (
+	SwitchInitial     = "initial"
+	SwitchUnavailable = "unavailable"
+	SwitchHealth      = "health"
+	SwitchLoss        = "loss"
+	SwitchThroughput  = "throughput"
+	SwitchLatency     = "latency"
+	SwitchScore       = "score"
+)
+
+// CandidateScore is the composite score of one adaptive candidate. Each
+// component is in [0,1] with higher better; Total is their weighted mean.
+type CandidateScore struct {
+	Upstream string  `json:"upstream"`
+	RTT      float64 `json:"rtt"`
+	Loss     float64 `json:"loss"`
+	Priority float64 `json:"priority"`
+	Load     float64 `json:"load"`
+	Total    float64 `json:"total"`
+}
+
+// RouteSwitch records the last change of an adaptive route's preferred
+// upstream or a failover route's active one. From is empty for the first
+// choice.
+type RouteSwitch struct {
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// adaptiveCandidate is a selectable member with the stats it is ranked on,
+// copied under the manager lock. score is set when the route has one.
+type adaptiveCandidate struct {
+	up    *Upstream
+	stats UpstreamStats
+	score CandidateScore
+}
+
+// routePreference is the hysteresis state of one adaptive route and member
+// set: the preferred upstream and the challenger waiting out its dwell. A
+// failover route keeps its active upstream and failback candidate here.
+type routePreference struct {
+	route      string
+	members    []string
+	current    string
+	challenger string
+	since      time.Time
+	last       *RouteSwitch
+}
+
+// adaptiveCandidates returns the selectable members of tags in configuration
+// order, less SRV targets above their group's lowest usable priority, with
+// their stats in the health view of route, and the index of the one plain
+// adaptive selection would choose, or -1 when none is selectable.
+func (m *UpstreamManager) adaptiveCandidates(route string, tags []string, prefer string) ([]adaptiveCandidate, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, up := range m.upstreams {
+		m.refreshStatsLocked(up)
+	}
+	allowed := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		allowed[strings.TrimSpace(tag)] = struct{}{}
+	}
+	now := time.Now()
+	var selectable []*Upstream
+	for _, tag := range m.order {
+		if up := m.upstreams[tag]; hasTag(allowed, tag) && m.selectableLocked(route, up, now) {
+			selectable = append(selectable, up)
+		}
+	}
+	var candidates []adaptiveCandidate
+	best := -1
+	for _, up := range srvTier(selectable) {
+		if best < 0 || m.betterLocked(route, up, candidates[best].up, prefer) {
+			best = len(candidates)
+		}
+		candidates = append(candidates, adaptiveCandidate{up: up, stats: *m.statsLocked(route, up)})
+	}
+	return candidates, best
+}
+
+// ranked reports whether the route ranks adaptive candidates itself rather
+// than taking the manager's choice for every new Flow.
+func (r routeDefinition) ranked() bool {
+	return r.score.Enabled() || r.hysteresis.Enabled()
+}
+
+// rankAdaptive returns the route's candidates among members and the index of
+// the best one. With a score, the best is the highest total among those in
+// the best health state; priority and then configuration order break ties.
+func (s *RouteSelector) rankAdaptive(route routeDefinition, members []string) ([]adaptiveCandidate, int) {
+	candidates, best := s.manager.adaptiveCandidates(route.name, members, route.prefer)
+	if !route.score.Enabled() || len(candidates) == 0 {
+		return candidates, best
+	}
+	route.scoreCandidates(candidates, s.activeFlows(""))
+	best = 0
+	for i := 1; i < len(candidates); i++ {
+		a, b := candidates[i], candidates[best]
+		ra, rb := healthRank(a.stats.HealthState), healthRank(b.stats.HealthState)
+		switch {
+		case ra != rb:
+			if ra < rb {
+				best = i
+			}
+		case a.score.Total != b.score.Total:
+			if a.score.Total > b.score.Total {
+				best = i
+			}
+		case a.up.Priority > b.up.Priority:
+			best = i
+		}
+	}
+	return candidates, best
+}
+
+// scoreCandidates fills in each candidate's score. RTT scores the fastest
+// measured candidate 1 and the others by their ratio to it; unmeasured
+// candidates score 0 unless none is measured. Priority is scaled between the
+// lowest and highest member, and load is one minus the candidate's share of
+// the busiest candidate's open Flows across all routes.
+func (r routeDefinition) scoreCandidates(candidates []adaptiveCandidate, flows map[string]int) {
+	minRTT, maxFlows := 0.0, 0
+	minPriority, maxPriority := math.Inf(1), math.Inf(-1)
+	for _, c := range candidates {
+		if rtt := c.stats.RTTMs; rtt > 0 && (minRTT == 0 || rtt < minRTT) {
+			minRTT = rtt
+		}
+		maxFlows = max(maxFlows, flows[c.up.Tag])
+		minPriority = math.Min(minPriority, c.up.Priority)
+		maxPriority = math.Max(maxPriority, c.up.Priority)
+	}
+	weights := r.score
+	sum := weights.RTT + weights.Loss + weights.Priority + weights.Load
+	for i := range candidates {
+		c := &candidates[i]
+		score := CandidateScore{Upstream: c.up.Tag, RTT: 1, Loss: 1 - c.stats.LossRatio, Priority: 1, Load: 1}
+		if minRTT > 0 {
+			score.RTT = 0
+			if c.stats.RTTMs > 0 {
+				score.RTT = minRTT / c.stats.RTTMs
+			}
+		}
+		if maxPriority > minPriority {
+			score.Priority = (c.up.Priority - minPriority) / (maxPriority - minPriority)
+		}
+		if maxFlows > 0 {
+			score.Load = 1 - float64(flows[c.up.Tag])/float64(maxFlows)
+		}
+		score.Total = (weights.RTT*score.RTT + weights.Loss*score.Loss + weights.Priority*score.Priority + weights.Load*score.Load) / sum
+		c.score = score
+	}
+}
+
+// selectRanked picks the adaptive upstream for a route with a score or
+// hysteresis. The preferred upstream is kept until it is no longer
+// selectable, a challenger is in a better health state, or a challenger is
+// better by the route margin for the whole dwell. Only a committing pick
+// advances the preference.
+func (s *RouteSelector) selectRanked(route routeDefinition, members []string, commit bool) (*Upstream, error) {
+	candidates, best := s.rankAdaptive(route, members)
+	if best < 0 {
+		return nil, errors.New("no usable upstream in route")
+	}
+	key := preferenceKey(route.name, members)
+	now := time.Now()
+	s.preferMu.Lock()
+	defer s.preferMu.Unlock()
+	state := s.preferences[key]
+	if state == nil {
+		state = &routePreference{route: route.name}
+		if commit {
+			s.preferences[key] = state
+		}
+	}
+	current := -1
+	for i, c := range candidates {
+		if c.up.Tag == state.current {
+			current = i
+		}
+	}
+	var reason string
+	switch {
+	case current < 0 && state.current == "":
+		reason = SwitchInitial
+	case current < 0:
+		reason = SwitchUnavailable
+	case current == best:
+		if commit {
+			state.challenger = ""
+		}
+		return candidates[current].up, nil
+	default:
+		challenger, preferred := candidates[best], candidates[current]
+		if reason = route.outranks(challenger, preferred); reason != "" {
+			break
+		}
+		if route.advantage(challenger, preferred) <= 1+route.hysteresis.Margin {
+			if commit {
+				state.challenger = ""
+			}
+			return preferred.up, nil
+		}
+		since := now
+		if state.challenger == challenger.up.Tag {
+			since = state.since
+		} else if commit {
+			state.challenger, state.since = challenger.up.Tag, now
+		}
+		if now.Sub(since) < route.hysteresis.Dwell.Duration() {
+			return preferred.up, nil
+		}
+		reason = SwitchLatency
+		if route.score.Enabled() {
+			reason = SwitchScore
+		}
+	}
+	selected := candidates[best].up
+	if commit {
+		state.last = &RouteSwitch{From: state.current, To: selected.Tag, Reason: reason, At: now}
+		state.current, state.challenger = selected.Tag, ""
+		util.Event(s.manager.logger, slog.LevelInfo, "upstream.route_preference_changed",
+			"flow.route", route.name, "switch.from", state.last.From, "switch.to", selected.Tag, "switch.reason", reason)
+	}
+	return selected, nil
+}
+
+// outranks returns why a is categorically better than b, or "" when only
+// their RTT or score separate them. With a score, loss and throughput are
+// weighed by the score instead.
+func (r routeDefinition) outranks(a, b adaptiveCandidate) string {
+	if healthRank(a.stats.HealthState) < healthRank(b.stats.HealthState) {
+		return SwitchHealth
+	}
+	if r.score.Enabled() {
+		return ""
+	}
+	if b.stats.Lossy && !a.stats.Lossy {
+		return SwitchLoss
+	}
+	if b.stats.Slow && !a.stats.Slow {
+		return SwitchThroughput
+	}
+	return ""
+}
+
+// advantage is how many times better a is than b: the ratio of their
+// scores, or of b's latency to a's. It is 1 when a is not measurably better.
+func (r routeDefinition) advantage(a, b adaptiveCandidate) float64 {
+	if r.score.Enabled() {
+		if b.score.Total <= 0 {
+			if a.score.Total > 0 {
+				return math.Inf(1)
+			}
+			return 1
+		}
+		return a.score.Total / b.score.Total
+	}
+	la, lb := a.stats.RTTMs, b.stats.RTTMs
+	if a.stats.DelayMeasured && b.stats.DelayMeasured {
+		switch r.prefer {
+		case config.PreferUploadDelay:
+			la, lb = a.stats.UploadDelayMs, b.stats.UploadDelayMs
+		case config.PreferDownloadDelay:
+			la, lb = a.stats.DownloadDelayMs, b.stats.DownloadDelayMs
+		}
+	}
+	switch {
+	case la <= 0:
+		return 1
+	case lb <= 0:
+		return math.Inf(1)
+	}
+	return lb / la
+}
+
+// ranking returns the score breakdown of the route's selectable members, when
+// the route has a score, and the last change of its preferred upstream.
+func (s *RouteSelector) ranking(route routeDefinition) ([]CandidateScore, *RouteSwitch) {
+	var scores []CandidateScore
+	if route.score.Enabled() {
+		candidates, _ := s.rankAdaptive(route, route.upstreams)
+		scores = make([]CandidateScore, 0, len(candidates))
+		for _, c := range candidates {
+			scores = append(scores, c.score)
+		}
+	}
+	s.preferMu.Lock()
+	defer s.preferMu.Unlock()
+	var last *RouteSwitch
+	if state := s.preferences[preferenceKey(route.name, route.upstreams)]; state != nil && state.last != nil {
+		copied := *state.last
+		last = &copied
+	}
+	return scores, last
+}
+
+// retainPreferences keeps the preference of routes that still rank, or still
+// fail over, and still list their preferred upstream. Pending challengers
+// start over.
+func (s *RouteSelector) retainPreferences(definitions map[string]routeDefinition) {
+	s.preferMu.Lock()
+	defer s.preferMu.Unlock()
+	for key, state := range s.preferences {
+		route, ok := definitions[state.route]
+		keeps := route.strategy == StrategyFailover || route.strategy == StrategyAdaptive && route.ranked()
+		if !ok || !keeps || !containsTag(route.upstreams, state.current) {
+			delete(s.preferences, key)
+			continue
+		}
+		state.challenger = ""
+	}
+}
+
+func preferenceKey(route string, members []string) string {
+	return route + "\x00" + strings.Join(members, "\x00")
+}
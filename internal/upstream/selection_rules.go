@@ -0,0 +1,91 @@
+package upstream
+
+import (
+	"net/netip"
+
+	"github.com/NodePath81/fbforward/internal/config"
+)
+
+// selectionRule is the compiled form of config.RouteSelectionRule.
+type selectionRule struct {
+	name      string
+	countries map[string]struct{}
+	asns      map[int]struct{}
+	prefixes  []netip.Prefix
+	upstreams []string
+}
+
+func newSelectionRules(rules []config.RouteSelectionRule) []selectionRule {
+	if len(rules) == 0 {
+		return nil
+	}
+	out := make([]selectionRule, 0, len(rules))
+	for _, rule := range rules {
+		compiled := selectionRule{name: rule.Name, upstreams: append([]string(nil), rule.Upstreams...)}
+		if len(rule.Countries) > 0 {
+			compiled.countries = make(map[string]struct{}, len(rule.Countries))
+			for _, country := range rule.Countries {
+				compiled.countries[country] = struct{}{}
+			}
+		}
+		if len(rule.ASNs) > 0 {
+			compiled.asns = make(map[int]struct{}, len(rule.ASNs))
+			for _, asn := range rule.ASNs {
+				compiled.asns[asn] = struct{}{}
+			}
+		}
+		for _, cidr := range rule.CIDRs {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				compiled.prefixes = append(compiled.prefixes, prefix)
+			}
+		}
+		out = append(out, compiled)
+	}
+	return out
+}
+
+func (r selectionRule) needsLookup() bool {
+	return len(r.countries) > 0 || len(r.asns) > 0
+}
+
+func (r selectionRule) matches(client netip.Addr, country string, asn int) bool {
+	for _, prefix := range r.prefixes {
+		if prefix.Contains(client) {
+			return true
+		}
+	}
+	if _, ok := r.countries[country]; ok && country != "" {
+		return true
+	}
+	if _, ok := r.asns[asn]; ok && asn > 0 {
+		return true
+	}
+	return false
+}
+
+// matchRule returns the route's first rule matching client. The GeoIP lookup
+// runs at most once and only when a rule needs it.
+func (s *RouteSelector) matchRule(route routeDefinition, client netip.Addr) *selectionRule {
+	if len(route.rules) == 0 || !client.IsValid() {
+		return nil
+	}
+	client = client.Unmap()
+	looked := false
+	country, asn := "", 0
+	for i := range route.rules {
+		rule := &route.rules[i]
+		if !looked && rule.needsLookup() {
+			looked = true
+			s.mu.RLock()
+			lookup := s.clients
+			s.mu.RUnlock()
+			if lookup != nil {
+				country, asn = lookup.LookupClient(client)
+			}
+		}
+		if rule.matches(client, country, asn) {
+			return rule
+		}
+	}
+	return nil
+}
@@ -40,21 +40,43 @@ type UpstreamStats struct {
 	Usable               bool        `json:"usable"`
 	ConsecutiveSuccesses int         `json:"consecutive_successes"`
 	ConsecutiveFailures  int         `json:"consecutive_failures"`
+	HealthSignal         string      `json:"health_signal,omitempty"`
+	LossMeasured         bool        `json:"loss_measured,omitempty"`
+	LossRatio            float64     `json:"loss_ratio,omitempty"`
+	JitterMs             float64     `json:"jitter_ms,omitempty"`
+	Lossy                bool        `json:"lossy,omitempty"`
+	DelayMeasured        bool        `json:"delay_measured,omitempty"`
+	UploadDelayMs        float64     `json:"upload_delay_ms,omitempty"`
+	DownloadDelayMs      float64     `json:"download_delay_ms,omitempty"`
+	ClockOffsetMs        float64     `json:"clock_offset_ms,omitempty"`
+	UploadMbps           float64     `json:"upload_mbps,omitempty"`
+	DownloadMbps         float64     `json:"download_mbps,omitempty"`
+	ThroughputAt         time.Time   `json:"throughput_at,omitzero"`
+	Slow                 bool        `json:"slow,omitempty"`
 }
 
 type Upstream struct {
-	Tag         string
-	Host        string
-	MeasureHost string
-	MeasurePort int
-	Priority    float64
-	IPs         []net.IP
-	activeIP    atomic.Value
+	Tag           string
+	Host          string
+	Port          int
+	MeasureHost   string
+	MeasurePort   int
+	ProbeType     string
+	HTTPProbe     config.HTTPProbeConfig
+	MeasureKey    []byte
+	Priority      float64
+	ProxyProtocol string
+	IPs           []net.IP
+	SRV           *SRVMember
+	activeIP      atomic.Value
 
 	stats         UpstreamStats
 	health        HealthSnapshot
 	dialFailUntil time.Time
 	dialFailCount int
+	addresses     map[string]*addressState
+	passive       *passiveWindow
+	passiveDown   string
 }
 
 type UpstreamManager struct {
@@ -67,6 +89,9 @@ type UpstreamManager struct {
 	onSelect      func(change ActiveChange)
 	onStateChange func(change UsabilityChange)
 	healthConfig  config.HealthConfig
+	routeHealth   map[string]*routeHealthView
+	discovery     map[string]DiscoveryStatus
+	drains        map[string]*DrainStatus
 	logger        util.Logger
 }
 
@@ -178,7 +203,7 @@ func (m *UpstreamManager) SetManual(tag string) error {
 	if !ok {
 		return errors.New("unknown upstream tag")
 	}
-	if !m.selectableLocked(up, time.Now()) {
+	if !m.selectableLocked("", up, time.Now()) {
 		return errors.New("selected upstream is unusable")
 	}
 	m.mode, m.manualTag = ModeManual, up.Tag
@@ -187,8 +212,8 @@ func (m *UpstreamManager) SetManual(tag string) error {
 }
 
 // SelectStatic returns the configured upstream without consulting health. A
-// static route is fixed by configuration; only a recent dial cooldown can
-// temporarily make it unavailable.
+// static route is fixed by configuration; only a recent dial cooldown or a
+// drain can temporarily make it unavailable.
 func (m *UpstreamManager) SelectStatic(tag string) (*Upstream, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -199,13 +224,22 @@ func (m *UpstreamManager) SelectStatic(tag string) (*Upstream, error) {
 	if up.dialFailUntil.After(time.Now()) {
 		return nil, fmt.Errorf("upstream %q is in dial cooldown", tag)
 	}
+	if m.drainingLocked(up) {
+		return nil, fmt.Errorf("upstream %q is draining", tag)
+	}
 	return up, nil
 }
 
 // SelectOverride checks an operator-selected upstream. Adaptive overrides
 // additionally require a non-down health state; static routes intentionally
-// do not consult health and only validate address/cooldown here.
+// do not consult health and only validate address/cooldown here. A draining
+// upstream is never accepted.
 func (m *UpstreamManager) SelectOverride(tag string, adaptive bool) (*Upstream, error) {
+	return m.SelectOverrideInRoute("", tag, adaptive)
+}
+
+// SelectOverrideInRoute is SelectOverride with the health view of route.
+func (m *UpstreamManager) SelectOverrideInRoute(route, tag string, adaptive bool) (*Upstream, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	up := m.upstreams[strings.TrimSpace(tag)]
@@ -213,25 +247,29 @@ func (m *UpstreamManager) SelectOverride(tag string, adaptive bool) (*Upstream,
 		return nil, fmt.Errorf("upstream %q is unavailable", tag)
 	}
 	m.refreshStatsLocked(up)
-	if up.ActiveIP() == nil || up.dialFailUntil.After(time.Now()) || (adaptive && up.stats.HealthState == HealthDown) {
+	if up.ActiveIP() == nil || up.dialFailUntil.After(time.Now()) || (adaptive && m.statsLocked(route, up).HealthState == HealthDown) {
 		return nil, fmt.Errorf("upstream %q is unavailable", tag)
 	}
+	if m.drainingLocked(up) {
+		return nil, fmt.Errorf("upstream %q is draining", tag)
+	}
 	return up, nil
 }
 
-// SelectUpstreamFrom enforces route membership and ranks candidates by
-// health, RTT, priority and stable configuration order.
-func (m *UpstreamManager) SelectUpstreamFrom(tags []string) (*Upstream, error) {
-	return m.selectUpstreamFrom(tags, true)
-}
-
 // SelectAdaptiveFrom performs route-local health selection without consulting
 // the deprecated global manual mode.
 func (m *UpstreamManager) SelectAdaptiveFrom(tags []string) (*Upstream, error) {
-	return m.selectUpstreamFrom(tags, false)
+	return m.selectUpstreamFrom("", tags, config.PreferRTT)
 }
 
-func (m *UpstreamManager) selectUpstreamFrom(tags []string, honorGlobalManual bool) (*Upstream, error) {
+// SelectAdaptiveInRoute is SelectAdaptiveFrom with the health view of route
+// and the route preference prefer, which may rank by one-way delay in place
+// of RTT.
+func (m *UpstreamManager) SelectAdaptiveInRoute(route string, tags []string, prefer string) (*Upstream, error) {
+	return m.selectUpstreamFrom(route, tags, prefer)
+}
+
+func (m *UpstreamManager) selectUpstreamFrom(route string, tags []string, prefer string) (*Upstream, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	for _, up := range m.upstreams {
@@ -248,30 +286,46 @@ func (m *UpstreamManager) selectUpstreamFrom(tags []string, honorGlobalManual bo
 			allowed[tag] = struct{}{}
 		}
 	}
-	contains := func(tag string) bool { return len(allowed) == 0 || hasTag(allowed, tag) }
 	now := time.Now()
 	if len(ordered) == 1 {
 		up := m.upstreams[ordered[0]]
 		if up == nil {
 			return nil, fmt.Errorf("upstream %q is unavailable", ordered[0])
 		}
-		if !m.selectableLocked(up, now) {
+		if !m.selectableLocked(route, up, now) {
 			return nil, fmt.Errorf("upstream %q is unavailable", ordered[0])
 		}
 		return up, nil
 	}
-	if honorGlobalManual && m.mode == ModeManual && contains(m.manualTag) {
-		if up := m.upstreams[m.manualTag]; up != nil && m.selectableLocked(up, now) {
-			return up, nil
-		}
-	}
-	best, _ := m.selectBestLocked(ordered)
+	best, _ := m.selectBestLocked(route, ordered, prefer)
 	if best == "" {
 		return nil, errors.New("no usable upstream in route")
 	}
 	return m.upstreams[best], nil
 }
 
+// SelectableInRoute returns the route members that can take a new Flow, in
+// route order, with the health view of route. Health, dial cooldown, drains
+// and SRV priority are applied exactly as for adaptive selection; distribution
+// strategies choose among the result.
+func (m *UpstreamManager) SelectableInRoute(route string, tags []string) []*Upstream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	out := make([]*Upstream, 0, len(tags))
+	for _, tag := range tags {
+		up := m.upstreams[strings.TrimSpace(tag)]
+		if up == nil {
+			continue
+		}
+		m.refreshStatsLocked(up)
+		if m.selectableLocked(route, up, now) {
+			out = append(out, up)
+		}
+	}
+	return srvTier(out)
+}
+
 func hasTag(tags map[string]struct{}, tag string) bool {
 	_, ok := tags[tag]
 	return ok
@@ -281,6 +335,28 @@ func (m *UpstreamManager) RecordProbe(tag string, observation ProbeObservation)
 	return m.applyObservation(tag, observation)
 }
 
+// RecordThroughput stores the latest throughput measurement of tag. It does
+// not change the health state.
+func (m *UpstreamManager) RecordThroughput(tag string, observation ThroughputObservation) UpstreamStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	up := m.upstreams[tag]
+	if up == nil {
+		return UpstreamStats{}
+	}
+	if observation.ObservedAt.IsZero() {
+		observation.ObservedAt = time.Now()
+	}
+	up.health.UploadBps, up.health.DownloadBps, up.health.ThroughputAt = observation.UploadBps, observation.DownloadBps, observation.ObservedAt
+	for _, view := range m.routeHealth {
+		if member := view.members[tag]; member != nil {
+			member.health.UploadBps, member.health.DownloadBps, member.health.ThroughputAt = observation.UploadBps, observation.DownloadBps, observation.ObservedAt
+		}
+	}
+	m.refreshStatsLocked(up)
+	return up.stats
+}
+
 func (m *UpstreamManager) RecordProbeFailure(tag string, observedAt time.Time) UpstreamStats {
 	return m.RecordProbe(tag, ProbeObservation{ObservedAt: observedAt})
 }
@@ -294,26 +370,77 @@ func (m *UpstreamManager) applyObservation(tag string, observation ProbeObservat
 	}
 	previous := up.stats
 	up.health = ApplyObservation(up.health, observation, m.healthConfig)
-	m.refreshStatsLocked(up)
+	routePrevious := m.applyRouteObservationLocked(tag, observation)
+	notified := m.refreshStatsLocked(up)
 	if previous.HealthState != up.stats.HealthState {
 		reason := string(up.stats.HealthState)
 		util.Event(m.logger, slog.LevelInfo, "upstream.health_changed", "upstream", tag, "health.state", reason)
-		if m.onStateChange != nil {
-			m.onStateChange(UsabilityChange{Tag: tag, Usable: up.stats.Usable, Reason: reason})
+		// A passive verdict that changed with this observation has reported
+		// the transition already.
+		if m.onStateChange != nil && !notified {
+			m.onStateChange(UsabilityChange{Tag: tag, Usable: up.stats.Usable, Reason: reason, From: string(previous.HealthState)})
+		}
+	}
+	for route, state := range routePrevious {
+		if current := m.routeHealth[route].members[tag].stats.HealthState; current != state {
+			util.Event(m.logger, slog.LevelInfo, "upstream.route_health_changed", "flow.route", route, "upstream", tag, "health.state", string(current))
 		}
 	}
 	return up.stats
 }
 
-func (m *UpstreamManager) refreshStatsLocked(up *Upstream) {
-	state := EffectiveHealth(up.health, time.Now(), m.healthConfig.StaleThreshold.Duration())
-	up.stats.HealthState = state
-	up.stats.Reachable = state == HealthHealthy || state == HealthStale
-	up.stats.Usable = state != HealthDown
-	up.stats.LastReachable = up.health.LastSuccessAt
-	up.stats.RTTMs = up.health.RTTMs()
-	up.stats.ConsecutiveSuccesses = up.health.ConsecutiveSuccesses
-	up.stats.ConsecutiveFailures = up.health.ConsecutiveFailures
+// refreshStatsLocked derives the health state of up from its probes and its
+// passive window; a passive verdict holds the upstream down on its own. Route
+// health views of up are derived the same way from their own snapshots.
+// notified reports whether a changed passive verdict ran the usability
+// callback.
+func (m *UpstreamManager) refreshStatsLocked(up *Upstream) (notified bool) {
+	now := time.Now()
+	passive := m.passiveVerdictLocked(up, now)
+	notified = m.setPassiveDownLocked(up, passive, EffectiveHealth(up.health, now, m.healthConfig.StaleThreshold.Duration()))
+	up.stats = healthStats(up.health, m.healthConfig, passive, now)
+	for _, view := range m.routeHealth {
+		if member := view.members[up.Tag]; member != nil {
+			member.stats = healthStats(member.health, view.config(m.healthConfig), passive, now)
+		}
+	}
+	return notified
+}
+
+// healthStats derives the selection stats of a health snapshot evaluated
+// with cfg.
+func healthStats(health HealthSnapshot, cfg config.HealthConfig, passive string, now time.Time) UpstreamStats {
+	var stats UpstreamStats
+	state := EffectiveHealth(health, now, cfg.StaleThreshold.Duration())
+	switch {
+	case passive != "":
+		state, stats.HealthSignal = HealthDown, passive
+	case !health.LastAttemptAt.IsZero():
+		stats.HealthSignal = HealthSignalProbe
+	}
+	stats.HealthState = state
+	stats.Reachable = state == HealthHealthy || state == HealthStale
+	stats.Usable = state != HealthDown
+	stats.LastReachable = health.LastSuccessAt
+	stats.RTTMs = health.RTTMs()
+	stats.ConsecutiveSuccesses = health.ConsecutiveSuccesses
+	stats.ConsecutiveFailures = health.ConsecutiveFailures
+	stats.LossMeasured = health.LossMeasured
+	stats.LossRatio = health.Loss
+	stats.JitterMs = float64(health.Jitter) / float64(time.Millisecond)
+	stats.Lossy = health.LossMeasured && cfg.LossThreshold > 0 && health.Loss > cfg.LossThreshold
+	stats.DelayMeasured = health.DelayMeasured
+	stats.UploadDelayMs = float64(health.UploadDelay) / float64(time.Millisecond)
+	stats.DownloadDelayMs = float64(health.DownloadDelay) / float64(time.Millisecond)
+	stats.ClockOffsetMs = float64(health.ClockOffset) / float64(time.Millisecond)
+	stats.UploadMbps = health.UploadBps / 1e6
+	stats.DownloadMbps = health.DownloadBps / 1e6
+	stats.ThroughputAt = health.ThroughputAt
+	// Only a result within ThroughputMaxAge marks the upstream slow.
+	fresh := !health.ThroughputAt.IsZero() && now.Sub(health.ThroughputAt) <= cfg.ThroughputMaxAge.Duration()
+	minimum := cfg.MinThroughputMbps
+	stats.Slow = fresh && minimum > 0 && min(stats.UploadMbps, stats.DownloadMbps) < minimum
+	return stats
 }
 
 func (m *UpstreamManager) MarkDialFailure(tag string, cooldown time.Duration) {
@@ -353,6 +480,7 @@ func (m *UpstreamManager) UpdateResolved(tag string, ips []net.IP) bool {
 	changed := !sameIPs(up.IPs, ips)
 	old := up.ActiveIP()
 	up.IPs = ips
+	up.pruneAddressesLocked()
 	if old == nil || !containsIP(ips, old) {
 		up.SetActiveIP(ips[0])
 		changed = true
@@ -360,6 +488,60 @@ func (m *UpstreamManager) UpdateResolved(tag string, ips []net.IP) bool {
 	return changed
 }
 
+// Reconcile replaces the managed upstream set after a configuration reload.
+// Upstreams that keep their tag inherit health, probe statistics and dial
+// cooldown so an unrelated edit does not reset selection; the replaced object
+// is left untouched for Flows that still hold it. It returns the tags that
+// were added and removed.
+func (m *UpstreamManager) Reconcile(upstreams []*Upstream) (added, removed []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	next := make(map[string]*Upstream, len(upstreams))
+	order := make([]string, 0, len(upstreams))
+	for _, up := range upstreams {
+		if up == nil || up.Tag == "" {
+			continue
+		}
+		if old := m.upstreams[up.Tag]; old != nil {
+			up.stats, up.health = old.stats, old.health
+			up.dialFailUntil, up.dialFailCount = old.dialFailUntil, old.dialFailCount
+			up.passive, up.passiveDown = old.passive, old.passiveDown
+			for key, state := range old.addresses {
+				if ip := net.ParseIP(key); containsIP(up.IPs, ip) {
+					*up.addressLocked(ip) = *state
+				}
+			}
+			if active := old.ActiveIP(); active != nil && containsIP(up.IPs, active) {
+				up.SetActiveIP(active)
+			}
+		} else {
+			added = append(added, up.Tag)
+		}
+		if up.ActiveIP() == nil && len(up.IPs) > 0 {
+			up.SetActiveIP(up.IPs[0])
+		}
+		next[up.Tag] = up
+		order = append(order, up.Tag)
+	}
+	for _, tag := range m.order {
+		if _, ok := next[tag]; !ok {
+			removed = append(removed, tag)
+		}
+	}
+	m.upstreams, m.order = next, order
+	if m.manualTag != "" && next[m.manualTag] == nil {
+		m.mode, m.manualTag = ModeAuto, ""
+	}
+	if m.activeTag != "" && next[m.activeTag] == nil {
+		m.setActiveLocked("", "removed")
+	}
+	m.retainDrainsLocked()
+	for _, up := range m.upstreams {
+		m.refreshStatsLocked(up)
+	}
+	return added, removed
+}
+
 func (m *UpstreamManager) Snapshot() []UpstreamSnapshot {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -367,6 +549,7 @@ func (m *UpstreamManager) Snapshot() []UpstreamSnapshot {
 		m.refreshStatsLocked(up)
 	}
 	out := make([]UpstreamSnapshot, 0, len(m.order))
+	now := time.Now()
 	for _, tag := range m.order {
 		up := m.upstreams[tag]
 		if up == nil {
@@ -380,39 +563,40 @@ func (m *UpstreamManager) Snapshot() []UpstreamSnapshot {
 		if ip := up.ActiveIP(); ip != nil {
 			activeIP = ip.String()
 		}
-		out = append(out, UpstreamSnapshot{Tag: up.Tag, Host: up.Host, IPs: ips, ActiveIP: activeIP, Active: tag == m.activeTag, Usable: up.stats.Usable, Reachable: up.stats.Reachable, HealthState: up.stats.HealthState, RTTMs: up.stats.RTTMs})
+		out = append(out, UpstreamSnapshot{Tag: up.Tag, Host: up.Host, IPs: ips, ActiveIP: activeIP, Active: tag == m.activeTag, Usable: up.stats.Usable, Reachable: up.stats.Reachable, HealthState: up.stats.HealthState, RTTMs: up.stats.RTTMs, HealthSignal: up.stats.HealthSignal, Passive: m.passiveSnapshotLocked(up, now), Loss: up.lossSnapshotLocked(), Delay: up.delaySnapshotLocked(), Throughput: up.throughputSnapshotLocked(), Addresses: up.addressSnapshotsLocked(now), Discovery: m.discoverySnapshotLocked(up), Drain: m.drainSnapshotLocked(up)})
 	}
 	return out
 }
 
-func (m *UpstreamManager) selectBestLocked(tags []string) (string, float64) {
+func (m *UpstreamManager) selectBestLocked(route string, tags []string, prefer string) (string, float64) {
 	allowed := make(map[string]struct{}, len(tags))
 	for _, tag := range tags {
 		allowed[tag] = struct{}{}
 	}
-	var best *Upstream
-	bestTag := ""
 	now := time.Now()
+	var selectable []*Upstream
 	for _, tag := range m.order {
 		if len(allowed) > 0 && !hasTag(allowed, tag) {
 			continue
 		}
-		up := m.upstreams[tag]
-		if !m.selectableLocked(up, now) {
-			continue
+		if up := m.upstreams[tag]; m.selectableLocked(route, up, now) {
+			selectable = append(selectable, up)
 		}
-		if best == nil || m.betterLocked(up, best) {
-			best, bestTag = up, tag
+	}
+	var best *Upstream
+	for _, up := range srvTier(selectable) {
+		if best == nil || m.betterLocked(route, up, best, prefer) {
+			best = up
 		}
 	}
 	if best == nil {
 		return "", 0
 	}
-	return bestTag, best.stats.RTTMs
+	return best.Tag, m.statsLocked(route, best).RTTMs
 }
 
-func (m *UpstreamManager) selectableLocked(up *Upstream, now time.Time) bool {
-	return up != nil && up.stats.HealthState != HealthDown && !up.dialFailUntil.After(now)
+func (m *UpstreamManager) selectableLocked(route string, up *Upstream, now time.Time) bool {
+	return up != nil && m.statsLocked(route, up).HealthState != HealthDown && !up.dialFailUntil.After(now) && !m.drainingLocked(up)
 }
 
 func healthRank(state HealthState) int {
@@ -428,18 +612,37 @@ func healthRank(state HealthState) int {
 	}
 }
 
-func (m *UpstreamManager) betterLocked(a, b *Upstream) bool {
-	ra, rb := healthRank(a.stats.HealthState), healthRank(b.stats.HealthState)
+// betterLocked ranks a before b by health, loss, throughput, then RTT or,
+// when prefer names a direction and both have measured it, one-way delay.
+// Stats come from the health view of route.
+func (m *UpstreamManager) betterLocked(route string, a, b *Upstream, prefer string) bool {
+	as, bs := m.statsLocked(route, a), m.statsLocked(route, b)
+	ra, rb := healthRank(as.HealthState), healthRank(bs.HealthState)
 	if ra != rb {
 		return ra < rb
 	}
-	if a.stats.RTTMs > 0 && b.stats.RTTMs > 0 && a.stats.RTTMs != b.stats.RTTMs {
-		return a.stats.RTTMs < b.stats.RTTMs
+	if as.Lossy != bs.Lossy {
+		return bs.Lossy
 	}
-	if a.stats.RTTMs > 0 && b.stats.RTTMs == 0 {
+	if as.Slow != bs.Slow {
+		return bs.Slow
+	}
+	if as.DelayMeasured && bs.DelayMeasured {
+		da, db := as.UploadDelayMs, bs.UploadDelayMs
+		if prefer == config.PreferDownloadDelay {
+			da, db = as.DownloadDelayMs, bs.DownloadDelayMs
+		}
+		if (prefer == config.PreferUploadDelay || prefer == config.PreferDownloadDelay) && da != db {
+			return da < db
+		}
+	}
+	if as.RTTMs > 0 && bs.RTTMs > 0 && as.RTTMs != bs.RTTMs {
+		return as.RTTMs < bs.RTTMs
+	}
+	if as.RTTMs > 0 && bs.RTTMs == 0 {
 		return true
 	}
-	if a.stats.RTTMs == 0 && b.stats.RTTMs > 0 {
+	if as.RTTMs == 0 && bs.RTTMs > 0 {
 		return false
 	}
 	if a.Priority != b.Priority {
@@ -500,14 +703,70 @@ func containsIP(ips []net.IP, target net.IP) bool {
 	return false
 }
 
+// LossSnapshot is the smoothed UDP burst loss and jitter of an upstream.
+// Lossy is set when the ratio exceeds health.loss_threshold.
+type LossSnapshot struct {
+	Ratio    float64 `json:"ratio"`
+	JitterMs float64 `json:"jitter_ms"`
+	Lossy    bool    `json:"lossy"`
+}
+
+func (u *Upstream) lossSnapshotLocked() *LossSnapshot {
+	if !u.stats.LossMeasured {
+		return nil
+	}
+	return &LossSnapshot{Ratio: u.stats.LossRatio, JitterMs: u.stats.JitterMs, Lossy: u.stats.Lossy}
+}
+
+// DelaySnapshot is the smoothed one-way delay of an upstream's fbmeasure
+// path and the offset of the server clock from the local clock.
+type DelaySnapshot struct {
+	UploadMs      float64 `json:"upload_ms"`
+	DownloadMs    float64 `json:"download_ms"`
+	ClockOffsetMs float64 `json:"clock_offset_ms"`
+}
+
+func (u *Upstream) delaySnapshotLocked() *DelaySnapshot {
+	if !u.stats.DelayMeasured {
+		return nil
+	}
+	return &DelaySnapshot{UploadMs: u.stats.UploadDelayMs, DownloadMs: u.stats.DownloadDelayMs, ClockOffsetMs: u.stats.ClockOffsetMs}
+}
+
+// ThroughputSnapshot is the latest throughput measurement of an upstream.
+// Slow is set when either direction is below health.min_throughput_mbps.
+type ThroughputSnapshot struct {
+	UploadMbps   float64   `json:"upload_mbps"`
+	DownloadMbps float64   `json:"download_mbps"`
+	MeasuredAt   time.Time `json:"measured_at"`
+	Slow         bool      `json:"slow"`
+}
+
+func (u *Upstream) throughputSnapshotLocked() *ThroughputSnapshot {
+	if u.stats.ThroughputAt.IsZero() {
+		return nil
+	}
+	return &ThroughputSnapshot{UploadMbps: u.stats.UploadMbps, DownloadMbps: u.stats.DownloadMbps, MeasuredAt: u.stats.ThroughputAt, Slow: u.stats.Slow}
+}
+
+// UpstreamSnapshot is one upstream as reported by ListUpstreams. HealthSignal
+// names what set HealthState: "probe" or the passive signal holding it down.
 type UpstreamSnapshot struct {
-	Tag         string      `json:"tag"`
-	Host        string      `json:"host"`
-	IPs         []string    `json:"ips"`
-	ActiveIP    string      `json:"active_ip"`
-	Active      bool        `json:"active"`
-	Usable      bool        `json:"usable"`
-	Reachable   bool        `json:"reachable"`
-	HealthState HealthState `json:"health_state"`
-	RTTMs       float64     `json:"rtt_ms"`
+	Tag          string                 `json:"tag"`
+	Host         string                 `json:"host"`
+	IPs          []string               `json:"ips"`
+	ActiveIP     string                 `json:"active_ip"`
+	Active       bool                   `json:"active"`
+	Usable       bool                   `json:"usable"`
+	Reachable    bool                   `json:"reachable"`
+	HealthState  HealthState            `json:"health_state"`
+	RTTMs        float64                `json:"rtt_ms"`
+	HealthSignal string                 `json:"health_signal,omitempty"`
+	Passive      *PassiveHealthSnapshot `json:"passive,omitempty"`
+	Loss         *LossSnapshot          `json:"loss,omitempty"`
+	Delay        *DelaySnapshot         `json:"delay,omitempty"`
+	Throughput   *ThroughputSnapshot    `json:"throughput,omitempty"`
+	Addresses    []AddressSnapshot      `json:"addresses"`
+	Discovery    *UpstreamDiscovery     `json:"discovery,omitempty"`
+	Drain        *DrainStatus           `json:"drain,omitempty"`
 }
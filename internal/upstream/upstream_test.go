@@ -1,7 +1,12 @@
 package upstream
 
 import (
+	"encoding/json"
+	"errors"
 	"net"
+	"net/netip"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -57,17 +62,93 @@ func TestStatsSnapshotRefreshesStaleState(t *testing.T) {
 	}
 }
 
+func TestPassiveSignalsMarkUpstreamDown(t *testing.T) {
+	m := NewUpstreamManager([]*Upstream{{Tag: "primary"}}, nil)
+	health := config.HealthConfig{
+		RTTEWMAAlpha:      0.25,
+		FailureThreshold:  3,
+		RecoveryThreshold: 2,
+		StaleThreshold:    config.Duration(time.Minute),
+		Passive: config.PassiveHealthConfig{
+			Enabled:          true,
+			Window:           config.Duration(time.Minute),
+			FailureThreshold: 3,
+			FailureRatio:     0.5,
+			Signals:          config.PassiveSignals[:],
+		},
+	}
+	m.SetHealthConfig(health)
+	m.RecordProbe("primary", ProbeObservation{Success: true, RTT: 5 * time.Millisecond, ObservedAt: time.Now()})
+	var changes []UsabilityChange
+	m.SetCallbacks(nil, func(change UsabilityChange) { changes = append(changes, change) })
+
+	for range 4 {
+		m.RecordFlowOutcome("primary", "")
+	}
+	for range 3 {
+		m.RecordFlowOutcome("primary", config.PassiveZeroResponse)
+	}
+	if stats := m.StatsSnapshot()["primary"]; !stats.Usable {
+		t.Fatalf("expected successes to keep the failure ratio below threshold, got %+v", stats)
+	}
+	m.RecordFlowOutcome("primary", config.PassiveZeroResponse)
+	m.RecordFlowOutcome("primary", "unknown_signal")
+
+	stats := m.StatsSnapshot()["primary"]
+	if stats.Usable || stats.HealthState != HealthDown || stats.HealthSignal != config.PassiveZeroResponse {
+		t.Fatalf("expected passive down from zero_response, got %+v", stats)
+	}
+	snapshot := m.Snapshot()[0]
+	if snapshot.HealthSignal != config.PassiveZeroResponse || snapshot.Passive == nil || !snapshot.Passive.Down {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+	if snapshot.Passive.Outcomes != 8 || snapshot.Passive.Failures[config.PassiveZeroResponse] != 4 {
+		t.Fatalf("unexpected passive window %+v", snapshot.Passive)
+	}
+	if len(changes) != 1 || changes[0].Usable || changes[0].Reason != "passive_zero_response" {
+		t.Fatalf("unexpected usability changes %+v", changes)
+	}
+
+	// The window ages out and the next probe refreshes the verdict: the
+	// recovery is reported once.
+	m.mu.Lock()
+	for i := range m.upstreams["primary"].passive.buckets {
+		m.upstreams["primary"].passive.buckets[i].second -= 120
+	}
+	m.mu.Unlock()
+	m.RecordProbe("primary", ProbeObservation{Success: true, RTT: 5 * time.Millisecond, ObservedAt: time.Now()})
+	if stats := m.StatsSnapshot()["primary"]; !stats.Usable || len(changes) != 2 || !changes[1].Usable {
+		t.Fatalf("expected one recovery callback, got %+v (stats %+v)", changes, stats)
+	}
+	for range 4 {
+		m.RecordFlowOutcome("primary", config.PassiveZeroResponse)
+	}
+	if len(changes) != 3 || changes[2].Usable {
+		t.Fatalf("expected passive down again, got %+v", changes)
+	}
+
+	health.Passive.Enabled = false
+	m.SetHealthConfig(health)
+	stats = m.StatsSnapshot()["primary"]
+	if !stats.Usable || stats.HealthSignal != HealthSignalProbe {
+		t.Fatalf("expected probe health after disabling passive signals, got %+v", stats)
+	}
+	if len(changes) != 4 || !changes[3].Usable {
+		t.Fatalf("expected recovery callback, got %+v", changes)
+	}
+}
+
 func TestRouteSelectionUsesHealthRTTPriorityAndOrder(t *testing.T) {
 	m := NewUpstreamManager([]*Upstream{
 		testUpstream("slow", HealthHealthy, 100*time.Millisecond, 1),
 		testUpstream("fast", HealthHealthy, 20*time.Millisecond, 0),
 		testUpstream("down", HealthDown, 1*time.Millisecond, 100),
 	}, nil)
-	up, err := m.SelectUpstreamFrom([]string{"slow", "fast", "down"})
+	up, err := m.SelectAdaptiveFrom([]string{"slow", "fast", "down"})
 	if err != nil || up.Tag != "fast" {
 		t.Fatalf("expected fast healthy upstream, got %v, %v", up, err)
 	}
-	up, err = m.SelectUpstreamFrom([]string{"slow"})
+	up, err = m.SelectAdaptiveFrom([]string{"slow"})
 	if err != nil || up.Tag != "slow" {
 		t.Fatalf("expected static route pinning, got %v, %v", up, err)
 	}
@@ -78,12 +159,416 @@ func TestRouteSelectionPrefersHealthyOverLowerRTTStale(t *testing.T) {
 		testUpstream("healthy", HealthHealthy, 100*time.Millisecond, 0),
 		testUpstream("stale", HealthStale, 1*time.Millisecond, 100),
 	}, nil)
-	up, err := m.SelectUpstreamFrom([]string{"healthy", "stale"})
+	up, err := m.SelectAdaptiveFrom([]string{"healthy", "stale"})
 	if err != nil || up.Tag != "healthy" {
 		t.Fatalf("expected healthy upstream to win over stale RTT, got %v, %v", up, err)
 	}
 }
 
+func TestBurstLossEWMAAndLossThresholdRanking(t *testing.T) {
+	cfg := config.HealthConfig{RTTEWMAAlpha: 0.5, FailureThreshold: 2, RecoveryThreshold: 2, StaleThreshold: config.Duration(time.Minute)}
+	var state HealthSnapshot
+	state = ApplyObservation(state, ProbeObservation{Success: true, RTT: 10 * time.Millisecond, ObservedAt: time.Unix(1, 0)}, cfg)
+	if state.LossMeasured {
+		t.Fatalf("single probe must not measure loss: %+v", state)
+	}
+	state = ApplyObservation(state, ProbeObservation{Success: true, RTT: 10 * time.Millisecond, ObservedAt: time.Unix(2, 0), Burst: true, Loss: 0.2, Jitter: 4 * time.Millisecond}, cfg)
+	state = ApplyObservation(state, ProbeObservation{Success: true, RTT: 10 * time.Millisecond, ObservedAt: time.Unix(3, 0), Burst: true, Loss: 0.4}, cfg)
+	if !state.LossMeasured || state.Loss < 0.299 || state.Loss > 0.301 || state.Jitter != 2*time.Millisecond {
+		t.Fatalf("unexpected loss EWMA: %+v", state)
+	}
+
+	m := NewUpstreamManager([]*Upstream{{Tag: "fast"}, {Tag: "slow"}}, nil)
+	cfg.LossThreshold = 0.1
+	m.SetHealthConfig(cfg)
+	now := time.Now()
+	m.RecordProbe("fast", ProbeObservation{Success: true, RTT: 5 * time.Millisecond, ObservedAt: now, Burst: true, Loss: 0.3})
+	m.RecordProbe("slow", ProbeObservation{Success: true, RTT: 50 * time.Millisecond, ObservedAt: now, Burst: true, Loss: 0.05})
+	up, err := m.SelectAdaptiveFrom([]string{"fast", "slow"})
+	if err != nil || up.Tag != "slow" {
+		t.Fatalf("expected the upstream below the loss threshold, got %v, %v", up, err)
+	}
+	snapshot := m.Snapshot()
+	if snapshot[0].Loss == nil || !snapshot[0].Loss.Lossy || snapshot[1].Loss == nil || snapshot[1].Loss.Lossy {
+		t.Fatalf("unexpected loss snapshots %+v %+v", snapshot[0].Loss, snapshot[1].Loss)
+	}
+
+	cfg.LossThreshold = 0
+	m.SetHealthConfig(cfg)
+	up, err = m.SelectAdaptiveFrom([]string{"fast", "slow"})
+	if err != nil || up.Tag != "fast" {
+		t.Fatalf("expected RTT ordering without a loss threshold, got %v, %v", up, err)
+	}
+}
+
+func TestMinThroughputRanksSlowUpstreamsLast(t *testing.T) {
+	m := NewUpstreamManager([]*Upstream{{Tag: "fast"}, {Tag: "wide"}}, nil)
+	cfg := config.HealthConfig{RTTEWMAAlpha: 0.5, FailureThreshold: 2, RecoveryThreshold: 2, StaleThreshold: config.Duration(time.Minute), MinThroughputMbps: 10, ThroughputMaxAge: config.Duration(time.Hour)}
+	m.SetHealthConfig(cfg)
+	now := time.Now()
+	m.RecordProbe("fast", ProbeObservation{Success: true, RTT: 20 * time.Millisecond, ObservedAt: now})
+	m.RecordProbe("wide", ProbeObservation{Success: true, RTT: 60 * time.Millisecond, ObservedAt: now})
+	up, err := m.SelectAdaptiveFrom([]string{"fast", "wide"})
+	if err != nil || up.Tag != "fast" {
+		t.Fatalf("expected RTT ordering before throughput is measured, got %v, %v", up, err)
+	}
+
+	m.RecordThroughput("fast", ThroughputObservation{UploadBps: 50e6, DownloadBps: 2e6, ObservedAt: now})
+	stats := m.RecordThroughput("wide", ThroughputObservation{UploadBps: 100e6, DownloadBps: 400e6, ObservedAt: now})
+	if stats.UploadMbps != 100 || stats.DownloadMbps != 400 || stats.Slow || stats.HealthState != HealthHealthy {
+		t.Fatalf("unexpected throughput stats: %+v", stats)
+	}
+	up, err = m.SelectAdaptiveFrom([]string{"fast", "wide"})
+	if err != nil || up.Tag != "wide" {
+		t.Fatalf("expected the upstream above the throughput minimum, got %v, %v", up, err)
+	}
+	if snapshot := m.Snapshot()[0]; snapshot.Throughput == nil || !snapshot.Throughput.Slow || snapshot.Throughput.DownloadMbps != 2 {
+		t.Fatalf("unexpected throughput snapshot %+v", snapshot.Throughput)
+	}
+
+	// An expired result no longer holds the upstream back.
+	if stats := m.RecordThroughput("fast", ThroughputObservation{UploadBps: 50e6, DownloadBps: 2e6, ObservedAt: now.Add(-2 * time.Hour)}); stats.Slow {
+		t.Fatalf("expired throughput result still marks the upstream slow: %+v", stats)
+	}
+	up, err = m.SelectAdaptiveFrom([]string{"fast", "wide"})
+	if err != nil || up.Tag != "fast" {
+		t.Fatalf("expected RTT ordering after the result expired, got %v, %v", up, err)
+	}
+	if encoded, err := json.Marshal(m.StatsSnapshot()["wide"]); err != nil || !strings.Contains(string(encoded), "throughput_at") {
+		t.Fatalf("measured stats lack throughput_at: %s %v", encoded, err)
+	}
+	if encoded, err := json.Marshal(UpstreamStats{}); err != nil || strings.Contains(string(encoded), "throughput_at") {
+		t.Fatalf("unmeasured stats report throughput_at: %s %v", encoded, err)
+	}
+}
+
+func TestOneWayDelayEWMAAndRoutePreference(t *testing.T) {
+	cfg := config.HealthConfig{RTTEWMAAlpha: 0.5, FailureThreshold: 2, RecoveryThreshold: 2, StaleThreshold: config.Duration(time.Minute)}
+	var state HealthSnapshot
+	state = ApplyObservation(state, ProbeObservation{Success: true, RTT: 10 * time.Millisecond, ObservedAt: time.Unix(1, 0), OneWay: true, UploadDelay: 8 * time.Millisecond, DownloadDelay: 2 * time.Millisecond, ClockOffset: time.Millisecond}, cfg)
+	state = ApplyObservation(state, ProbeObservation{Success: true, RTT: 10 * time.Millisecond, ObservedAt: time.Unix(2, 0), OneWay: true, UploadDelay: 4 * time.Millisecond, DownloadDelay: 6 * time.Millisecond, ClockOffset: 3 * time.Millisecond}, cfg)
+	if !state.DelayMeasured || state.UploadDelay != 6*time.Millisecond || state.DownloadDelay != 4*time.Millisecond || state.ClockOffset != 2*time.Millisecond {
+		t.Fatalf("unexpected delay EWMA: %+v", state)
+	}
+
+	m := NewUpstreamManager([]*Upstream{{Tag: "near"}, {Tag: "uplink"}}, nil)
+	m.SetHealthConfig(cfg)
+	now := time.Now()
+	m.RecordProbe("near", ProbeObservation{Success: true, RTT: 20 * time.Millisecond, ObservedAt: now, OneWay: true, UploadDelay: 15 * time.Millisecond, DownloadDelay: 5 * time.Millisecond})
+	m.RecordProbe("uplink", ProbeObservation{Success: true, RTT: 30 * time.Millisecond, ObservedAt: now, OneWay: true, UploadDelay: 5 * time.Millisecond, DownloadDelay: 25 * time.Millisecond})
+	selector := NewRouteSelector(m, []config.RouteConfig{
+		{Name: "rtt", Strategy: "adaptive", Upstreams: []string{"near", "uplink"}},
+		{Name: "upload", Strategy: "adaptive", Upstreams: []string{"near", "uplink"}, Prefer: config.PreferUploadDelay},
+		{Name: "download", Strategy: "adaptive", Upstreams: []string{"near", "uplink"}, Prefer: config.PreferDownloadDelay},
+	})
+	for route, want := range map[string]string{"rtt": "near", "upload": "uplink", "download": "near"} {
+		up, status, err := selector.Pick(route)
+		if err != nil || up.Tag != want {
+			t.Fatalf("route %s picked %v, %v; want %s", route, up, err, want)
+		}
+		if route == "upload" && status.Prefer != config.PreferUploadDelay {
+			t.Fatalf("route status prefer = %q", status.Prefer)
+		}
+	}
+	if snapshot := m.Snapshot()[1]; snapshot.Delay == nil || snapshot.Delay.UploadMs != 5 || snapshot.Delay.DownloadMs != 25 {
+		t.Fatalf("unexpected delay snapshot %+v", snapshot.Delay)
+	}
+
+	// Without a one-way measurement on both candidates the route ranks by RTT.
+	fresh := NewUpstreamManager([]*Upstream{{Tag: "near"}, {Tag: "uplink"}}, nil)
+	fresh.SetHealthConfig(cfg)
+	fresh.RecordProbe("near", ProbeObservation{Success: true, RTT: 20 * time.Millisecond, ObservedAt: now})
+	fresh.RecordProbe("uplink", ProbeObservation{Success: true, RTT: 30 * time.Millisecond, ObservedAt: now, OneWay: true, UploadDelay: 5 * time.Millisecond, DownloadDelay: 25 * time.Millisecond})
+	if up, err := fresh.SelectAdaptiveInRoute("", []string{"near", "uplink"}, config.PreferUploadDelay); err != nil || up.Tag != "near" {
+		t.Fatalf("expected RTT fallback, got %v, %v", up, err)
+	}
+}
+
+func TestRouteSelectorHysteresisHoldsPreferredUpstream(t *testing.T) {
+	a := testUpstream("a", HealthHealthy, 20*time.Millisecond, 0)
+	b := testUpstream("b", HealthHealthy, 21*time.Millisecond, 0)
+	m := NewUpstreamManager([]*Upstream{a, b}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{{Name: "web", Strategy: StrategyAdaptive, Upstreams: []string{"a", "b"},
+		Hysteresis: config.RouteHysteresisConfig{Margin: 0.1, Dwell: config.Duration(time.Minute)}}})
+	setRTT := func(up *Upstream, rtt time.Duration) {
+		m.mu.Lock()
+		up.health.RTT = rtt
+		m.mu.Unlock()
+	}
+	pick := func(want string) {
+		t.Helper()
+		if up, _, err := selector.Pick("web"); err != nil || up.Tag != want {
+			t.Fatalf("picked %v, %v; want %s", up, err, want)
+		}
+	}
+	pick("a")
+	if last := selector.Status()[0].LastSwitch; last == nil || last.To != "a" || last.Reason != SwitchInitial {
+		t.Fatalf("unexpected initial switch %+v", last)
+	}
+
+	// A wobble inside the margin does not move new Flows.
+	setRTT(b, 19*time.Millisecond)
+	pick("a")
+	// A challenger beyond the margin must stay ahead for the dwell.
+	setRTT(b, 10*time.Millisecond)
+	pick("a")
+	pick("a")
+	selector.preferMu.Lock()
+	state := selector.preferences[preferenceKey("web", []string{"a", "b"})]
+	if state.challenger != "b" {
+		selector.preferMu.Unlock()
+		t.Fatalf("expected b to be the pending challenger, got %+v", state)
+	}
+	since := state.since
+	selector.preferMu.Unlock()
+	// Status previews the choice without touching the dwell.
+	if status := selector.Status()[0]; status.Effective != "a" || status.LastSwitch.Reason != SwitchInitial {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	selector.preferMu.Lock()
+	defer selector.preferMu.Unlock()
+	if state.challenger != "b" || !state.since.Equal(since) {
+		t.Fatalf("preview changed the pending challenger: %+v", state)
+	}
+}
+
+func TestRouteSelectorHysteresisSwitchesAfterDwellAndOnFailure(t *testing.T) {
+	a := testUpstream("a", HealthHealthy, 20*time.Millisecond, 0)
+	b := testUpstream("b", HealthHealthy, 30*time.Millisecond, 0)
+	m := NewUpstreamManager([]*Upstream{a, b}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{{Name: "web", Strategy: StrategyAdaptive, Upstreams: []string{"a", "b"},
+		Hysteresis: config.RouteHysteresisConfig{Margin: 0.1, Dwell: config.Duration(time.Minute)}}})
+	if up, _, err := selector.Pick("web"); err != nil || up.Tag != "a" {
+		t.Fatalf("picked %v, %v; want a", up, err)
+	}
+	m.mu.Lock()
+	b.health.RTT = 10 * time.Millisecond
+	m.mu.Unlock()
+	if up, _, _ := selector.Pick("web"); up.Tag != "a" {
+		t.Fatalf("switched to %s before the dwell", up.Tag)
+	}
+	selector.preferMu.Lock()
+	state := selector.preferences[preferenceKey("web", []string{"a", "b"})]
+	state.since = state.since.Add(-2 * time.Minute)
+	selector.preferMu.Unlock()
+	if up, _, _ := selector.Pick("web"); up.Tag != "b" {
+		t.Fatalf("expected b after the dwell, got %s", up.Tag)
+	}
+	if last := selector.Status()[0].LastSwitch; last == nil || last.From != "a" || last.To != "b" || last.Reason != SwitchLatency {
+		t.Fatalf("unexpected switch %+v", last)
+	}
+
+	// Losing the preferred upstream switches at once.
+	m.MarkDialFailure("b", time.Minute)
+	if up, _, _ := selector.Pick("web"); up.Tag != "a" {
+		t.Fatalf("expected a after b failed, got %s", up.Tag)
+	}
+	if last := selector.Status()[0].LastSwitch; last.Reason != SwitchUnavailable {
+		t.Fatalf("unexpected switch reason %q", last.Reason)
+	}
+
+	// A reload that keeps the route keeps its preference.
+	m.ClearDialFailure("b")
+	selector.Replace([]config.RouteConfig{{Name: "web", Strategy: StrategyAdaptive, Upstreams: []string{"a", "b"},
+		Hysteresis: config.RouteHysteresisConfig{Margin: 0.1, Dwell: config.Duration(time.Minute)}}})
+	if up, _, _ := selector.Pick("web"); up.Tag != "a" {
+		t.Fatalf("reload dropped the preference, picked %s", up.Tag)
+	}
+}
+
+func TestRouteSelectorFailoverKeepsOrderAndFailsBack(t *testing.T) {
+	dc := testUpstream("dc", HealthHealthy, 90*time.Millisecond, 0)
+	dr := testUpstream("dr", HealthHealthy, 10*time.Millisecond, 0)
+	m := NewUpstreamManager([]*Upstream{dc, dr}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{{Name: "web", Strategy: StrategyFailover, Upstreams: []string{"dc", "dr"},
+		Failback: config.RouteFailbackConfig{Delay: config.Duration(time.Minute), Probes: 3}}})
+	var switches []RouteSwitch
+	selector.SetSwitchHandler(func(route string, change RouteSwitch) {
+		if route != "web" {
+			t.Errorf("switch reported for route %q", route)
+		}
+		switches = append(switches, change)
+	})
+	setHealth := func(state HealthState, successes int) {
+		m.mu.Lock()
+		dc.health.State, dc.health.ConsecutiveSuccesses = state, successes
+		m.mu.Unlock()
+	}
+	pick := func(want string) {
+		t.Helper()
+		if up, _, err := selector.Pick("web"); err != nil || up.Tag != want {
+			t.Fatalf("picked %v, %v; want %s", up, err, want)
+		}
+	}
+
+	// The first member wins even though the backup is faster.
+	pick("dc")
+	if len(switches) != 0 {
+		t.Fatalf("initial choice was reported: %+v", switches)
+	}
+	setHealth(HealthDown, 0)
+	pick("dr")
+	if len(switches) != 1 || switches[0].From != "dc" || switches[0].To != "dr" || switches[0].Reason != SwitchFailover {
+		t.Fatalf("unexpected failover %+v", switches)
+	}
+
+	// Failback waits for the probe count, then for the delay.
+	setHealth(HealthHealthy, 2)
+	pick("dr")
+	setHealth(HealthHealthy, 3)
+	pick("dr")
+	if status := selector.Status()[0]; status.Effective != "dr" || status.LastSwitch == nil || status.LastSwitch.Reason != SwitchFailover {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	selector.preferMu.Lock()
+	state := selector.preferences[preferenceKey("web", []string{"dc", "dr"})]
+	if state.challenger != "dc" {
+		selector.preferMu.Unlock()
+		t.Fatalf("expected dc to wait out the failback delay, got %+v", state)
+	}
+	state.since = state.since.Add(-2 * time.Minute)
+	selector.preferMu.Unlock()
+	pick("dc")
+	if len(switches) != 2 || switches[1].From != "dr" || switches[1].To != "dc" || switches[1].Reason != SwitchFailback {
+		t.Fatalf("unexpected failback %+v", switches)
+	}
+
+	// A backup that fails while the primary is down leaves nothing to pick.
+	setHealth(HealthDown, 0)
+	m.MarkDialFailure("dr", time.Minute)
+	if _, _, err := selector.Pick("web"); err == nil {
+		t.Fatal("expected an error with every member unusable")
+	}
+}
+
+func TestRouteSelectorFailoverSkipsUnreadyEarlierMember(t *testing.T) {
+	a := testUpstream("a", HealthHealthy, 10*time.Millisecond, 0)
+	b := testUpstream("b", HealthHealthy, 10*time.Millisecond, 0)
+	c := testUpstream("c", HealthHealthy, 10*time.Millisecond, 0)
+	m := NewUpstreamManager([]*Upstream{a, b, c}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{{Name: "web", Strategy: StrategyFailover, Upstreams: []string{"a", "b", "c"},
+		Failback: config.RouteFailbackConfig{Delay: config.Duration(time.Minute), Probes: 3}}})
+	var switches []RouteSwitch
+	selector.SetSwitchHandler(func(route string, change RouteSwitch) {
+		switches = append(switches, change)
+	})
+	setHealth := func(up *Upstream, state HealthState, successes int) {
+		m.mu.Lock()
+		up.health.State, up.health.ConsecutiveSuccesses = state, successes
+		m.mu.Unlock()
+	}
+	pick := func(want string) {
+		t.Helper()
+		if up, _, err := selector.Pick("web"); err != nil || up.Tag != want {
+			t.Fatalf("picked %v, %v; want %s", up, err, want)
+		}
+	}
+
+	pick("a")
+	setHealth(a, HealthDown, 0)
+	pick("b")
+
+	// a is selectable again but short of its failback probes when b fails.
+	setHealth(a, HealthHealthy, 1)
+	setHealth(b, HealthDown, 0)
+	pick("c")
+	if len(switches) != 2 || switches[1].From != "b" || switches[1].To != "c" || switches[1].Reason != SwitchFailover {
+		t.Fatalf("unexpected switches %+v", switches)
+	}
+
+	// With nothing after the lost member, the unready earlier one is a
+	// failover, not a failback.
+	setHealth(c, HealthDown, 0)
+	pick("a")
+	if len(switches) != 3 || switches[2].From != "c" || switches[2].To != "a" || switches[2].Reason != SwitchFailover {
+		t.Fatalf("unexpected switches %+v", switches)
+	}
+}
+
+func TestRouteSelectorEvaluateFailoverWithoutTraffic(t *testing.T) {
+	dc := testUpstream("dc", HealthHealthy, 10*time.Millisecond, 0)
+	dr := testUpstream("dr", HealthHealthy, 10*time.Millisecond, 0)
+	m := NewUpstreamManager([]*Upstream{dc, dr}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{{Name: "web", Strategy: StrategyFailover, Upstreams: []string{"dc", "dr"},
+		Failback: config.RouteFailbackConfig{Delay: config.Duration(time.Minute), Probes: 1}}})
+	var switches []RouteSwitch
+	selector.SetSwitchHandler(func(route string, change RouteSwitch) {
+		switches = append(switches, change)
+	})
+	setHealth := func(state HealthState, successes int) {
+		m.mu.Lock()
+		dc.health.State, dc.health.ConsecutiveSuccesses = state, successes
+		m.mu.Unlock()
+	}
+
+	selector.EvaluateFailover()
+	setHealth(HealthDown, 0)
+	before := time.Now()
+	selector.EvaluateFailover()
+	if len(switches) != 1 || switches[0].To != "dr" || switches[0].Reason != SwitchFailover || switches[0].At.Before(before) {
+		t.Fatalf("unexpected failover %+v", switches)
+	}
+
+	// The failback delay starts and runs out with no Flow picking the route.
+	setHealth(HealthHealthy, 1)
+	selector.EvaluateFailover()
+	if len(switches) != 1 {
+		t.Fatalf("failed back before the delay: %+v", switches)
+	}
+	selector.preferMu.Lock()
+	state := selector.preferences[preferenceKey("web", []string{"dc", "dr"})]
+	state.since = state.since.Add(-2 * time.Minute)
+	selector.preferMu.Unlock()
+	selector.EvaluateFailover()
+	if len(switches) != 2 || switches[1].To != "dc" || switches[1].Reason != SwitchFailback {
+		t.Fatalf("unexpected failback %+v", switches)
+	}
+	if up, _, err := selector.Pick("web"); err != nil || up.Tag != "dc" || len(switches) != 2 {
+		t.Fatalf("picked %v, %v after failback; switches %+v", up, err, switches)
+	}
+}
+
+func TestRouteSelectorCompositeScore(t *testing.T) {
+	fast := testUpstream("fast", HealthHealthy, 10*time.Millisecond, 0)
+	preferred := testUpstream("preferred", HealthHealthy, 20*time.Millisecond, 10)
+	m := NewUpstreamManager([]*Upstream{fast, preferred}, nil)
+	route := config.RouteConfig{Name: "web", Strategy: StrategyAdaptive, Upstreams: []string{"fast", "preferred"},
+		Score: config.RouteScoreConfig{RTT: 1, Priority: 1}}
+	selector := NewRouteSelector(m, []config.RouteConfig{route})
+	if up, _, err := selector.Pick("web"); err != nil || up.Tag != "preferred" {
+		t.Fatalf("picked %v, %v; want preferred", up, err)
+	}
+	status := selector.Status()[0]
+	if len(status.Scores) != 2 {
+		t.Fatalf("unexpected scores %+v", status.Scores)
+	}
+	if s := status.Scores[0]; s.Upstream != "fast" || s.RTT != 1 || s.Priority != 0 || s.Total != 0.5 {
+		t.Fatalf("unexpected fast score %+v", s)
+	}
+	if s := status.Scores[1]; s.Upstream != "preferred" || s.RTT != 0.5 || s.Priority != 1 || s.Total != 0.75 {
+		t.Fatalf("unexpected preferred score %+v", s)
+	}
+
+	// Load counts open Flows across routes; a busy upstream scores lower.
+	route.Score.Load = 1
+	loaded := NewRouteSelector(m, []config.RouteConfig{route})
+	loaded.SetFlowCounter(fakeFlowCounter{"preferred": 3})
+	if up, _, err := loaded.Pick("web"); err != nil || up.Tag != "fast" {
+		t.Fatalf("picked %v, %v; want fast", up, err)
+	}
+
+	// Health stays a tier above the score.
+	m.mu.Lock()
+	fast.health.LastSuccessAt = time.Now().Add(-2 * time.Minute)
+	m.mu.Unlock()
+	m.SetHealthConfig(config.HealthConfig{StaleThreshold: config.Duration(time.Minute)})
+	fresh := NewRouteSelector(m, []config.RouteConfig{route})
+	fresh.SetFlowCounter(fakeFlowCounter{"preferred": 3})
+	if up, _, err := fresh.Pick("web"); err != nil || up.Tag != "preferred" {
+		t.Fatalf("picked %v, %v; want the healthy preferred", up, err)
+	}
+}
+
 func TestRouteSelectorStaticOverrideDoesNotFallback(t *testing.T) {
 	a := testUpstream("a", HealthDown, time.Millisecond, 0)
 	b := testUpstream("b", HealthHealthy, time.Millisecond, 0)
@@ -139,6 +624,391 @@ func TestRouteSelectorAdaptiveOverrideFallsBackAndRecovers(t *testing.T) {
 	}
 }
 
+func TestRouteSelectorSkipsDrainingUpstreams(t *testing.T) {
+	a := testUpstream("a", HealthHealthy, time.Millisecond, 0)
+	b := testUpstream("b", HealthHealthy, 5*time.Millisecond, 0)
+	a.SetActiveIP(net.ParseIP("192.0.2.1"))
+	b.SetActiveIP(net.ParseIP("192.0.2.2"))
+	m := NewUpstreamManager([]*Upstream{a, b}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{
+		{Name: "proxy", Strategy: "adaptive", Upstreams: []string{"a", "b"}},
+		{Name: "web", Strategy: "static", Upstreams: []string{"a", "b"}, DefaultUpstream: "a"},
+	})
+	if err := selector.SetOverride("proxy", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := selector.SetOverride("web", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.StartDrain("a", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range []string{"proxy", "web"} {
+		selected, status, err := selector.Pick(route)
+		if err != nil || selected.Tag != "b" || status.OverrideState != OverrideFallback {
+			t.Fatalf("%s: expected draining override to fall back to b: selected=%v status=%+v err=%v", route, selected, status, err)
+		}
+	}
+	if err := selector.SetOverride("proxy", "a"); err == nil || !strings.Contains(err.Error(), "draining") {
+		t.Fatalf("expected override onto a draining upstream to be rejected, got %v", err)
+	}
+	if snapshot := m.Snapshot(); snapshot[0].Drain == nil || snapshot[1].Drain != nil {
+		t.Fatalf("expected only a to report a drain: %+v", snapshot)
+	}
+
+	if _, err := m.StartDrain("b", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := selector.Pick("web"); err == nil || !strings.Contains(err.Error(), "draining") {
+		t.Fatalf("expected static route to fail when every member drains, got %v", err)
+	}
+	m.StopDrain("a")
+	selected, status, err := selector.Pick("web")
+	if err != nil || selected.Tag != "a" || status.OverrideState != OverrideActive {
+		t.Fatalf("expected override to resume after undrain: selected=%v status=%+v err=%v", selected, status, err)
+	}
+}
+
+func TestRouteSelectorServesLowestSRVPriority(t *testing.T) {
+	primary := testUpstream("svc/a:80", HealthHealthy, 90*time.Millisecond, 0)
+	primary.SRV = &SRVMember{Group: "svc", Priority: 10, Weight: 1}
+	heavy := testUpstream("svc/b:80", HealthHealthy, 50*time.Millisecond, 0)
+	heavy.SRV = &SRVMember{Group: "svc", Priority: 10, Weight: 3}
+	backup := testUpstream("svc/c:80", HealthHealthy, 10*time.Millisecond, 0)
+	backup.SRV = &SRVMember{Group: "svc", Priority: 20, Weight: 1}
+	members := []string{"svc/a:80", "svc/b:80", "svc/c:80"}
+	m := NewUpstreamManager([]*Upstream{primary, heavy, backup}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{
+		{Name: "adaptive", Strategy: StrategyAdaptive, Upstreams: members},
+		{Name: "weighted", Strategy: StrategyWeighted, Upstreams: members, Weights: map[string]int{"svc/a:80": 1, "svc/b:80": 3, "svc/c:80": 1}},
+	})
+
+	// The faster backup waits while a priority-10 target is usable.
+	if up, _, err := selector.Pick("adaptive"); err != nil || up.Tag != "svc/b:80" {
+		t.Fatalf("picked %v, %v; want svc/b:80", up, err)
+	}
+	counts := make(map[string]int)
+	for range 8 {
+		up, _, err := selector.Pick("weighted")
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[up.Tag]++
+	}
+	if counts["svc/a:80"] != 2 || counts["svc/b:80"] != 6 || counts["svc/c:80"] != 0 {
+		t.Fatalf("weighted picks = %v, want 2:6 within priority 10", counts)
+	}
+
+	m.MarkDialFailure("svc/a:80", time.Minute)
+	m.MarkDialFailure("svc/b:80", time.Minute)
+	if up, _, err := selector.Pick("adaptive"); err != nil || up.Tag != "svc/c:80" {
+		t.Fatalf("picked %v, %v; want the priority-20 backup", up, err)
+	}
+}
+
+func TestDrainCoversSRVMembersAndEndsWithRemoval(t *testing.T) {
+	a := &Upstream{Tag: "svc/a:80", SRV: &SRVMember{Group: "svc"}}
+	b := &Upstream{Tag: "plain"}
+	m := NewUpstreamManager([]*Upstream{a, b}, nil)
+	if _, err := m.StartDrain("missing", time.Time{}); !errors.Is(err, ErrUnknownUpstream) {
+		t.Fatalf("expected unknown upstream, got %v", err)
+	}
+	deadline := time.Now().Add(time.Minute)
+	status, err := m.StartDrain("svc", deadline)
+	if err != nil || status.Deadline == nil || !status.Deadline.Equal(deadline) {
+		t.Fatalf("unexpected drain status %+v err=%v", status, err)
+	}
+	if !m.Draining("svc/a:80") || m.Draining("plain") {
+		t.Fatal("expected the group drain to cover only its members")
+	}
+	if got := m.SelectableInRoute("", []string{"svc/a:80", "plain"}); len(got) != 1 || got[0].Tag != "plain" {
+		t.Fatalf("expected only plain to be selectable, got %v", got)
+	}
+	m.Reconcile([]*Upstream{{Tag: "plain"}})
+	if drains := m.Drains(); len(drains) != 0 {
+		t.Fatalf("expected the drain of a removed group to be dropped, got %+v", drains)
+	}
+}
+
+type fakeFlowCounter map[string]int
+
+func (f fakeFlowCounter) ActiveByUpstream(string) map[string]int { return f }
+
+func TestRouteSelectorDistributionStrategies(t *testing.T) {
+	a := testUpstream("a", HealthHealthy, time.Millisecond, 0)
+	b := testUpstream("b", HealthHealthy, time.Millisecond, 0)
+	c := testUpstream("c", HealthDown, time.Millisecond, 0)
+	m := NewUpstreamManager([]*Upstream{a, b, c}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{
+		{Name: "rr", Strategy: StrategyRoundRobin, Upstreams: []string{"a", "b", "c"}},
+		{Name: "weighted", Strategy: StrategyWeighted, Upstreams: []string{"a", "b", "c"}, Weights: map[string]int{"a": 3, "c": 5}},
+		{Name: "least", Strategy: StrategyLeastConnections, Upstreams: []string{"a", "b"}},
+	})
+	picks := func(route string, n int) string {
+		var out []string
+		for i := 0; i < n; i++ {
+			selected, _, err := selector.Pick(route)
+			if err != nil {
+				t.Fatalf("%s pick %d: %v", route, i, err)
+			}
+			out = append(out, selected.Tag)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := picks("rr", 4); got != "a,b,a,b" {
+		t.Fatalf("round_robin must skip down members, got %s", got)
+	}
+	if got := picks("weighted", 8); got != "a,a,b,a,a,a,b,a" {
+		t.Fatalf("weighted must interleave 3:1 without the down member, got %s", got)
+	}
+	selector.SetFlowCounter(fakeFlowCounter{"a": 4, "b": 1})
+	if got := picks("least", 2); got != "b,b" {
+		t.Fatalf("least_connections must prefer the idle member, got %s", got)
+	}
+
+	m.MarkDialFailure("b", time.Minute)
+	if got := picks("rr", 2); got != "a,a" {
+		t.Fatalf("round_robin must skip cooling members, got %s", got)
+	}
+	if err := selector.SetOverride("least", "b"); err != nil {
+		t.Fatal(err)
+	}
+	selected, status, err := selector.Pick("least")
+	if err != nil || selected.Tag != "a" || status.OverrideState != OverrideFallback {
+		t.Fatalf("expected override fallback: selected=%v status=%+v err=%v", selected, status, err)
+	}
+}
+
+func TestRouteStatusReportsSharesWithoutAdvancing(t *testing.T) {
+	m := NewUpstreamManager([]*Upstream{
+		testUpstream("a", HealthHealthy, time.Millisecond, 0),
+		testUpstream("b", HealthDown, time.Millisecond, 0),
+	}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{{Name: "web", Strategy: StrategyWeighted, Upstreams: []string{"a", "b"}, Weights: map[string]int{"a": 2}}})
+	selector.SetFlowCounter(fakeFlowCounter{"a": 3, "b": 1})
+	for i := 0; i < 2; i++ {
+		status := selector.Status()
+		if len(status) != 1 || status[0].Effective != "a" {
+			t.Fatalf("unexpected status: %+v", status)
+		}
+	}
+	shares := selector.Status()[0].Shares
+	want := []RouteShare{
+		{Upstream: "a", Weight: 2, Selectable: true, ActiveFlows: 3, Share: 0.75},
+		{Upstream: "b", Weight: 1, Selectable: false, ActiveFlows: 1, Share: 0.25},
+	}
+	if !reflect.DeepEqual(shares, want) {
+		t.Fatalf("unexpected shares: %+v", shares)
+	}
+}
+
+func TestRouteSelectorStickyAffinityYieldsWhenDown(t *testing.T) {
+	a := testUpstream("a", HealthHealthy, 10*time.Millisecond, 0)
+	b := testUpstream("b", HealthHealthy, 20*time.Millisecond, 0)
+	a.SetActiveIP(net.ParseIP("192.0.2.1"))
+	b.SetActiveIP(net.ParseIP("192.0.2.2"))
+	m := NewUpstreamManager([]*Upstream{a, b}, nil)
+	m.SetHealthConfig(config.HealthConfig{RTTEWMAAlpha: 1, FailureThreshold: 1, RecoveryThreshold: 1, StaleThreshold: config.Duration(time.Minute)})
+	selector := NewRouteSelector(m, []config.RouteConfig{{
+		Name: "game", Strategy: StrategyAdaptive, Upstreams: []string{"a", "b"},
+		Affinity: config.RouteAffinityConfig{Mode: AffinitySticky, TTL: config.Duration(time.Minute), IPv4Prefix: 24, IPv6Prefix: 64},
+	}})
+	client := netip.MustParseAddr("198.51.100.7")
+	neighbour := netip.MustParseAddr("198.51.100.8")
+
+	first, _, err := selector.PickFor("game", client)
+	if err != nil || first.Tag != "a" {
+		t.Fatalf("expected initial adaptive choice a, got %v %v", first, err)
+	}
+	// b becomes the better upstream, but the pinned prefix stays on a.
+	m.RecordProbe("b", ProbeObservation{Success: true, RTT: time.Millisecond, ObservedAt: time.Now()})
+	if selected, _, err := selector.PickFor("game", neighbour); err != nil || selected.Tag != "a" {
+		t.Fatalf("expected prefix pin to hold, got %v %v", selected, err)
+	}
+	if selected, _, err := selector.Pick("game"); err != nil || selected.Tag != "b" {
+		t.Fatalf("expected clients without a pin to use adaptive choice, got %v %v", selected, err)
+	}
+	m.RecordProbeFailure("a", time.Now())
+	if selected, _, err := selector.PickFor("game", client); err != nil || selected.Tag != "b" {
+		t.Fatalf("expected pin to yield to b once a is down, got %v %v", selected, err)
+	}
+	entries, err := selector.Affinity("game")
+	if err != nil || len(entries) != 1 || entries[0].Upstream != "b" || entries[0].Client != "198.51.100.0/24" {
+		t.Fatalf("unexpected affinity table: %+v %v", entries, err)
+	}
+	if cleared, err := selector.ClearAffinity("game", ""); err != nil || cleared != 1 {
+		t.Fatalf("unexpected clear result: %d %v", cleared, err)
+	}
+}
+
+func TestRouteSelectorConsistentHashRemapsOnlyLostClientsUntilRecovery(t *testing.T) {
+	ups := []*Upstream{
+		testUpstream("a", HealthHealthy, time.Millisecond, 0),
+		testUpstream("b", HealthHealthy, time.Millisecond, 0),
+		testUpstream("c", HealthHealthy, time.Millisecond, 0),
+	}
+	for i, up := range ups {
+		up.SetActiveIP(net.IPv4(192, 0, 2, byte(i+1)))
+	}
+	m := NewUpstreamManager(ups, nil)
+	route := config.RouteConfig{
+		Name: "vpn", Strategy: StrategyWeighted, Upstreams: []string{"a", "b", "c"},
+		Affinity: config.RouteAffinityConfig{Mode: AffinityConsistentHash, TTL: config.Duration(time.Minute), IPv4Prefix: 32, IPv6Prefix: 64},
+	}
+	before := make(map[netip.Addr]string)
+	selector := NewRouteSelector(m, []config.RouteConfig{route})
+	counts := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		client := netip.AddrFrom4([4]byte{198, 51, byte(i >> 8), byte(i)})
+		selected, _, err := selector.PickFor("vpn", client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[client] = selected.Tag
+		counts[selected.Tag]++
+	}
+	for _, tag := range []string{"a", "b", "c"} {
+		if counts[tag] < 50 {
+			t.Fatalf("hash spread is too uneven: %v", counts)
+		}
+	}
+
+	m.MarkDialFailure("b", time.Minute)
+	for client, previous := range before {
+		selected, _, err := selector.PickFor("vpn", client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if previous != "b" && selected.Tag != previous {
+			t.Fatalf("client %s moved from %s to %s although %s stayed selectable", client, previous, selected.Tag, previous)
+		}
+		if selected.Tag == "b" {
+			t.Fatalf("client %s hashed to cooling upstream b", client)
+		}
+	}
+
+	// Once b recovers its clients hash back to it.
+	m.ClearDialFailure("b")
+	for client, previous := range before {
+		selected, _, err := selector.PickFor("vpn", client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if selected.Tag != previous {
+			t.Fatalf("client %s stayed on %s after %s recovered", client, selected.Tag, previous)
+		}
+	}
+	if entries, _ := selector.Affinity("vpn"); len(entries) != 0 {
+		t.Fatalf("consistent hashing recorded pins: %+v", entries)
+	}
+}
+
+type fakeClientLookup map[netip.Addr]string
+
+func (f fakeClientLookup) LookupClient(addr netip.Addr) (string, int) {
+	if addr == netip.MustParseAddr("203.0.113.50") {
+		return "", 64500
+	}
+	return f[addr], 0
+}
+
+func TestRouteSelectorSelectionRulesPreferSubsetAndFallBack(t *testing.T) {
+	hk := testUpstream("hk-edge", HealthHealthy, 80*time.Millisecond, 0)
+	us := testUpstream("us-a", HealthHealthy, 10*time.Millisecond, 0)
+	office := testUpstream("office", HealthHealthy, 50*time.Millisecond, 0)
+	m := NewUpstreamManager([]*Upstream{hk, us, office}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{{
+		Name: "web", Strategy: StrategyAdaptive, Upstreams: []string{"hk-edge", "us-a", "office"},
+		SelectionRules: []config.RouteSelectionRule{
+			{Name: "office", CIDRs: []string{"10.0.0.0/8"}, Upstreams: []string{"office"}},
+			{Name: "cn-to-hk", Countries: []string{"CN"}, ASNs: []int{64500}, Upstreams: []string{"hk-edge"}},
+		},
+	}})
+	selector.SetClientLookup(fakeClientLookup{netip.MustParseAddr("198.51.100.7"): "CN"})
+
+	for _, test := range []struct {
+		client       string
+		wantUpstream string
+		wantRule     string
+	}{
+		{"198.51.100.7", "hk-edge", "cn-to-hk"},
+		{"203.0.113.50", "hk-edge", "cn-to-hk"},
+		{"10.1.2.3", "office", "office"},
+		{"192.0.2.1", "us-a", ""},
+	} {
+		selected, status, err := selector.PickFor("web", netip.MustParseAddr(test.client))
+		if err != nil || selected.Tag != test.wantUpstream || status.SelectionRule != test.wantRule {
+			t.Fatalf("client %s: selected=%v rule=%q err=%v", test.client, selected, status.SelectionRule, err)
+		}
+	}
+
+	m.MarkDialFailure("hk-edge", time.Minute)
+	selected, status, err := selector.PickFor("web", netip.MustParseAddr("198.51.100.7"))
+	if err != nil || selected.Tag != "us-a" || status.SelectionRule != "cn-to-hk" {
+		t.Fatalf("expected fallback to the full route: selected=%v rule=%q err=%v", selected, status.SelectionRule, err)
+	}
+}
+
+func TestReconcileKeepsHealthForRetainedTags(t *testing.T) {
+	a := &Upstream{Tag: "a", Port: 443, IPs: []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.9")}}
+	a.SetActiveIP(net.ParseIP("192.0.2.9"))
+	b := &Upstream{Tag: "b", IPs: []net.IP{net.ParseIP("192.0.2.2")}}
+	m := NewUpstreamManager([]*Upstream{a, b}, nil)
+	m.RecordProbe("a", ProbeObservation{Success: true, RTT: 5 * time.Millisecond, ObservedAt: time.Now()})
+	m.MarkDialFailure("a", time.Minute)
+
+	next := &Upstream{Tag: "a", Port: 8443, IPs: []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.9")}}
+	c := &Upstream{Tag: "c", IPs: []net.IP{net.ParseIP("192.0.2.3")}}
+	added, removed := m.Reconcile([]*Upstream{next, c})
+	if len(added) != 1 || added[0] != "c" || len(removed) != 1 || removed[0] != "b" {
+		t.Fatalf("added=%v removed=%v", added, removed)
+	}
+	if m.Get("b") != nil || m.Get("a") != next || m.Get("a").Port != 8443 {
+		t.Fatal("reconcile did not install the reloaded upstream set")
+	}
+	if health, _ := m.Health("a"); health.RTT != 5*time.Millisecond {
+		t.Fatalf("retained upstream lost health: %+v", health)
+	}
+	if !next.ActiveIP().Equal(net.ParseIP("192.0.2.9")) {
+		t.Fatalf("retained upstream changed active IP to %s", next.ActiveIP())
+	}
+	if _, err := m.SelectStatic("a"); err == nil {
+		t.Fatal("retained upstream lost its dial cooldown")
+	}
+	if !c.ActiveIP().Equal(net.ParseIP("192.0.2.3")) {
+		t.Fatalf("added upstream active IP = %s", c.ActiveIP())
+	}
+}
+
+func TestRouteSelectorReplaceDropsInvalidOverrides(t *testing.T) {
+	a := &Upstream{Tag: "a"}
+	b := &Upstream{Tag: "b"}
+	m := NewUpstreamManager([]*Upstream{a, b}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{
+		{Name: "web", Strategy: "static", Upstreams: []string{"a", "b"}, DefaultUpstream: "a"},
+		{Name: "api", Strategy: "static", Upstreams: []string{"a", "b"}, DefaultUpstream: "a"},
+	})
+	if err := selector.SetOverride("web", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := selector.SetOverride("api", "b"); err != nil {
+		t.Fatal(err)
+	}
+	selector.Replace([]config.RouteConfig{
+		{Name: "web", Strategy: "static", Upstreams: []string{"a", "b"}, DefaultUpstream: "a", PortOffset: 1},
+		{Name: "api", Strategy: "static", Upstreams: []string{"a"}},
+	})
+	if got := selector.override("web"); got != "b" {
+		t.Fatalf("valid override was dropped: %q", got)
+	}
+	if got := selector.override("api"); got != "" {
+		t.Fatalf("override outside the reloaded route was kept: %q", got)
+	}
+	if got := selector.DestinationPort("web", a, 443); got != 444 {
+		t.Fatalf("reloaded route port = %d, want 444", got)
+	}
+}
+
 func testUpstream(tag string, state HealthState, rtt time.Duration, priority float64) *Upstream {
 	health := HealthSnapshot{State: state, RTT: rtt}
 	if state == HealthHealthy || state == HealthStale {
@@ -149,3 +1019,144 @@ func testUpstream(tag string, state HealthState, rtt time.Duration, priority flo
 	}
 	return &Upstream{Tag: tag, Priority: priority, health: health, stats: UpstreamStats{HealthState: state, Usable: state != HealthDown, Reachable: state == HealthHealthy, RTTMs: float64(rtt) / float64(time.Millisecond)}}
 }
+
+func TestRouteSelectorPickHedgedOffersNextAdaptiveCandidate(t *testing.T) {
+	fast := testUpstream("fast", HealthHealthy, 10*time.Millisecond, 0)
+	mid := testUpstream("mid", HealthHealthy, 30*time.Millisecond, 0)
+	slow := testUpstream("slow", HealthHealthy, 90*time.Millisecond, 0)
+	m := NewUpstreamManager([]*Upstream{fast, mid, slow}, nil)
+	selector := NewRouteSelector(m, []config.RouteConfig{
+		{Name: "web", Strategy: StrategyAdaptive, Upstreams: []string{"fast", "mid", "slow"}, Hedge: config.RouteHedgeConfig{Enabled: true, Delay: config.Duration(25 * time.Millisecond)}},
+		{Name: "api", Strategy: StrategyAdaptive, Upstreams: []string{"fast", "mid", "slow"}},
+	})
+	client := netip.MustParseAddr("192.0.2.1")
+
+	primary, hedge, _, err := selector.PickHedged("web", client)
+	if err != nil || primary.Tag != "fast" || hedge == nil || hedge.Tag != "mid" {
+		t.Fatalf("expected fast with mid as hedge, primary=%v hedge=%v err=%v", primary, hedge, err)
+	}
+	if delay, ok := selector.HedgeDelay("web"); !ok || delay != 25*time.Millisecond {
+		t.Fatalf("unexpected hedge delay %s ok=%v", delay, ok)
+	}
+	if _, hedge, _, err := selector.PickHedged("api", client); err != nil || hedge != nil {
+		t.Fatalf("expected no hedge on a route without hedging, hedge=%v err=%v", hedge, err)
+	}
+
+	slow.SetActiveIP(net.ParseIP("192.0.2.3"))
+	if err := selector.SetOverride("web", "slow"); err != nil {
+		t.Fatal(err)
+	}
+	primary, hedge, _, err = selector.PickHedged("web", client)
+	if err != nil || primary.Tag != "slow" || hedge != nil {
+		t.Fatalf("expected override without hedge, primary=%v hedge=%v err=%v", primary, hedge, err)
+	}
+}
+
+func TestDialAddressesInterleaveFamiliesAndSkipFailedAddress(t *testing.T) {
+	up := &Upstream{Tag: "dual", IPs: []net.IP{
+		net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"),
+	}}
+	up.SetActiveIP(up.IPs[0])
+	m := NewUpstreamManager([]*Upstream{up}, nil)
+
+	if got := ipStrings(m.DialAddresses("dual")); strings.Join(got, ",") != "2001:db8::1,192.0.2.1,2001:db8::2,192.0.2.2" {
+		t.Fatalf("unexpected dial order %v", got)
+	}
+
+	m.MarkAddressFailure("dual", net.ParseIP("2001:db8::1"), time.Minute, errors.New("connection refused"))
+	if active := up.ActiveIP(); !active.Equal(net.ParseIP("2001:db8::2")) {
+		t.Fatalf("expected the active address to move off the failed one, got %s", active)
+	}
+	if got := ipStrings(m.DialAddresses("dual")); strings.Join(got, ",") != "2001:db8::2,192.0.2.1,192.0.2.2,2001:db8::1" {
+		t.Fatalf("expected the failed address last, got %v", got)
+	}
+	if selected := m.SelectableInRoute("", []string{"dual"}); len(selected) != 1 {
+		t.Fatal("one failed address must not make the upstream unselectable")
+	}
+
+	snapshot := m.Snapshot()[0].Addresses
+	if len(snapshot) != 4 || snapshot[0].Usable || snapshot[0].FailCount != 1 || snapshot[0].LastError != "connection refused" || snapshot[0].CooldownUntil == nil {
+		t.Fatalf("unexpected failed address snapshot %+v", snapshot)
+	}
+	if !snapshot[1].Active || !snapshot[1].Usable || snapshot[2].Family != "ipv4" {
+		t.Fatalf("unexpected address snapshot %+v", snapshot)
+	}
+
+	m.ClearAddressFailure("dual", net.ParseIP("192.0.2.1"))
+	if active := up.ActiveIP(); !active.Equal(net.ParseIP("192.0.2.1")) {
+		t.Fatalf("expected the connected address to become active, got %s", active)
+	}
+	if snapshot := m.Snapshot()[0].Addresses[2]; snapshot.LastSuccessAt == nil || !snapshot.Active {
+		t.Fatalf("expected a recorded success, got %+v", snapshot)
+	}
+
+	m.UpdateResolved("dual", []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.3")})
+	if _, ok := up.addresses["2001:db8::1"]; ok {
+		t.Fatal("expected state for unresolved addresses to be dropped")
+	}
+}
+
+func ipStrings(ips []net.IP) []string {
+	out := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		out = append(out, ip.String())
+	}
+	return out
+}
+
+func TestRouteHealthOverridesEvaluateSharedProbes(t *testing.T) {
+	a := testUpstream("a", HealthHealthy, 10*time.Millisecond, 0)
+	b := testUpstream("b", HealthHealthy, 20*time.Millisecond, 0)
+	m := NewUpstreamManager([]*Upstream{a, b}, nil)
+	m.SetHealthConfig(config.HealthConfig{FailureThreshold: 3, RecoveryThreshold: 2, StaleThreshold: config.Duration(time.Minute)})
+	selector := NewRouteSelector(m, []config.RouteConfig{
+		{Name: "voice", Strategy: StrategyAdaptive, Upstreams: []string{"a", "b"}, Health: config.RouteHealthConfig{FailureThreshold: 1, RecoveryThreshold: 1}},
+		{Name: "bulk", Strategy: StrategyAdaptive, Upstreams: []string{"a", "b"}},
+		{Name: "udp", Strategy: StrategyAdaptive, Upstreams: []string{"a", "b"}, Health: config.RouteHealthConfig{FailureThreshold: 1, Protocols: []string{"udp"}}},
+	})
+	pick := func(route, want string) {
+		t.Helper()
+		if up, _, err := selector.Pick(route); err != nil || up.Tag != want {
+			t.Fatalf("%s picked %v, %v; want %s", route, up, err, want)
+		}
+	}
+
+	// One TCP failure is enough for voice; bulk keeps the global threshold
+	// and udp does not count TCP probes.
+	m.RecordProbe("a", ProbeObservation{Protocol: "tcp", ObservedAt: time.Now()})
+	pick("voice", "b")
+	pick("bulk", "a")
+	pick("udp", "a")
+	if stats := m.StatsSnapshot()["a"]; stats.HealthState != HealthHealthy {
+		t.Fatalf("shared health = %s, want healthy", stats.HealthState)
+	}
+
+	m.RecordProbe("a", ProbeObservation{Protocol: "udp", ObservedAt: time.Now()})
+	pick("udp", "b")
+	m.RecordProbe("a", ProbeObservation{Protocol: "tcp", Success: true, RTT: 10 * time.Millisecond, ObservedAt: time.Now()})
+	pick("voice", "a")
+	pick("udp", "b")
+
+	var voice, bulk RouteStatus
+	for _, status := range selector.Status() {
+		switch status.Name {
+		case "voice":
+			voice = status
+		case "bulk":
+			bulk = status
+		}
+	}
+	if voice.Health == nil || voice.Health.FailureThreshold != 1 || voice.Health.RecoveryThreshold != 1 || voice.Health.StaleThreshold != "1m0s" ||
+		!reflect.DeepEqual(voice.Health.Overridden, []string{"failure_threshold", "recovery_threshold"}) || len(voice.Health.Members) != 2 {
+		t.Fatalf("voice health = %+v", voice.Health)
+	}
+	if bulk.Health == nil || bulk.Health.FailureThreshold != 3 || len(bulk.Health.Overridden) != 0 || len(bulk.Health.Members) != 0 {
+		t.Fatalf("bulk health = %+v", bulk.Health)
+	}
+
+	// A reload keeps the view of members the route still lists.
+	selector.Replace([]config.RouteConfig{
+		{Name: "udp", Strategy: StrategyAdaptive, Upstreams: []string{"a", "b"}, Health: config.RouteHealthConfig{FailureThreshold: 1, Protocols: []string{"udp"}}},
+	})
+	pick("udp", "b")
+}
@@ -0,0 +1,156 @@
+package fbmeasure
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// frameVersionAuth is the wire version of authenticated frames: the
+	// 32-byte frame, a timestamp, and a truncated HMAC-SHA256 over both.
+	frameVersionAuth = 2
+	authFrameSize    = 64
+	authMACOffset    = 40
+	// authReplyFlag marks a server reply so a captured reply cannot be sent
+	// back to the server as a request.
+	authReplyFlag = 1
+	// AuthWindow is how far the timestamp of an authenticated frame may be
+	// from the receiver's clock.
+	AuthWindow = 30 * time.Second
+	// MinKeySize is the shortest accepted shared key.
+	MinKeySize = 16
+	// maxReplayEntries bounds the replay cache of a server.
+	maxReplayEntries = 1 << 16
+)
+
+var (
+	errUnauthenticated = errors.New("fbmeasure frame failed authentication")
+	errReplayed        = errors.New("fbmeasure frame is outside the replay window")
+)
+
+// LoadKeyFile reads a shared key. Surrounding whitespace is ignored; the rest
+// of the file is the key.
+func LoadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) < MinKeySize {
+		return nil, fmt.Errorf("fbmeasure key in %s must be at least %d bytes", path, MinKeySize)
+	}
+	return key, nil
+}
+
+func validateKey(key []byte) error {
+	if key != nil && len(key) < MinKeySize {
+		return fmt.Errorf("fbmeasure key must be at least %d bytes", MinKeySize)
+	}
+	return nil
+}
+
+// codec converts frames to and from their wire form. Without a key frames
+// travel as they are; with one only authenticated frames are accepted.
+type codec struct {
+	key    []byte
+	replay *replayCache
+}
+
+func (c codec) size() int {
+	if c.key == nil {
+		return frameSize
+	}
+	return authFrameSize
+}
+
+func (c codec) encode(f frame, reply bool, now time.Time) []byte {
+	if c.key == nil {
+		return append([]byte(nil), f[:]...)
+	}
+	wire := make([]byte, authFrameSize)
+	copy(wire, f[:])
+	wire[4] = frameVersionAuth
+	if reply {
+		wire[6] = authReplyFlag
+	}
+	binary.BigEndian.PutUint64(wire[frameSize:authMACOffset], uint64(now.UnixNano()))
+	copy(wire[authMACOffset:], c.mac(wire[:authMACOffset]))
+	return wire
+}
+
+// decode verifies data and returns its frame. reply selects whether a server
+// reply or a client request is expected. Authentication failures return
+// errUnauthenticated or errReplayed.
+func (c codec) decode(data []byte, reply bool, now time.Time) (frame, error) {
+	if c.key == nil {
+		return parseFrame(data)
+	}
+	if len(data) != authFrameSize || data[4] != frameVersionAuth {
+		return frame{}, errUnauthenticated
+	}
+	if !hmac.Equal(data[authMACOffset:], c.mac(data[:authMACOffset])) {
+		return frame{}, errUnauthenticated
+	}
+	if (data[6] == authReplyFlag) != reply {
+		return frame{}, errUnauthenticated
+	}
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64(data[frameSize:authMACOffset])))
+	if sent.Before(now.Add(-AuthWindow)) || sent.After(now.Add(AuthWindow)) {
+		return frame{}, errReplayed
+	}
+	if c.replay != nil {
+		var id [authFrameSize - authMACOffset]byte
+		copy(id[:], data[authMACOffset:])
+		if !c.replay.add(id, now) {
+			return frame{}, errReplayed
+		}
+	}
+	var plain [frameSize]byte
+	copy(plain[:], data)
+	plain[4], plain[6] = frameVersion, 0
+	return parseFrame(plain[:])
+}
+
+func (c codec) mac(data []byte) []byte {
+	h := hmac.New(sha256.New, c.key)
+	h.Write(data)
+	return h.Sum(nil)[:authFrameSize-authMACOffset]
+}
+
+// replayCache remembers the authenticated requests of the last two
+// AuthWindows. When full of live entries it refuses new ones.
+type replayCache struct {
+	mu   sync.Mutex
+	seen map[[authFrameSize - authMACOffset]byte]time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{seen: make(map[[authFrameSize - authMACOffset]byte]time.Time)}
+}
+
+func (r *replayCache) add(id [authFrameSize - authMACOffset]byte, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.seen[id]; ok {
+		return false
+	}
+	if len(r.seen) >= maxReplayEntries {
+		for key, expires := range r.seen {
+			if now.After(expires) {
+				delete(r.seen, key)
+			}
+		}
+		if len(r.seen) >= maxReplayEntries {
+			return false
+		}
+	}
+	r.seen[id] = now.Add(2 * AuthWindow)
+	return true
+}
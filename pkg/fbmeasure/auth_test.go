@@ -0,0 +1,197 @@
+package fbmeasure
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestCodecAuthenticatesFrames(t *testing.T) {
+	now := time.Now()
+	client := codec{key: testKey}
+	server := codec{key: testKey, replay: newReplayCache()}
+	probe, err := newProbeFrame(42)
+	if err != nil {
+		t.Fatalf("newProbeFrame: %v", err)
+	}
+	wire := client.encode(probe, false, now)
+	if len(wire) != authFrameSize {
+		t.Fatalf("wire size=%d", len(wire))
+	}
+	got, err := server.decode(wire, false, now)
+	if err != nil || got != probe {
+		t.Fatalf("decode=%v, %v", got == probe, err)
+	}
+	if _, err := server.decode(wire, false, now); !errors.Is(err, errReplayed) {
+		t.Fatalf("replayed frame err=%v", err)
+	}
+	reply := server.encode(probe, true, now)
+	if got, err := client.decode(reply, true, now); err != nil || got != probe {
+		t.Fatalf("reply decode=%v, %v", got == probe, err)
+	}
+	if _, err := server.decode(reply, false, now); !errors.Is(err, errUnauthenticated) {
+		t.Fatalf("reflected reply err=%v", err)
+	}
+}
+
+func TestCodecRejectsForgedAndStaleFrames(t *testing.T) {
+	now := time.Now()
+	server := codec{key: testKey, replay: newReplayCache()}
+	probe, err := newProbeFrame(7)
+	if err != nil {
+		t.Fatalf("newProbeFrame: %v", err)
+	}
+	tampered := codec{key: testKey}.encode(probe, false, now)
+	tampered[8] ^= 1
+	cases := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"v1 frame", probe[:], errUnauthenticated},
+		{"wrong key", codec{key: []byte("fedcba9876543210fedcba9876543210")}.encode(probe, false, now), errUnauthenticated},
+		{"tampered", tampered, errUnauthenticated},
+		{"stale", codec{key: testKey}.encode(probe, false, now.Add(-2*AuthWindow)), errReplayed},
+		{"future", codec{key: testKey}.encode(probe, false, now.Add(2*AuthWindow)), errReplayed},
+	}
+	for _, tc := range cases {
+		if _, err := server.decode(tc.data, false, now); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err=%v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "key")
+	if err := os.WriteFile(path, append(append([]byte(nil), testKey...), '\n'), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadKeyFile(path)
+	if err != nil || string(key) != string(testKey) {
+		t.Fatalf("LoadKeyFile=%q, %v", key, err)
+	}
+	short := filepath.Join(dir, "short")
+	if err := os.WriteFile(short, []byte("short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKeyFile(short); err == nil {
+		t.Fatal("short key was accepted")
+	}
+}
+
+func TestKeyedClientServerRoundTrip(t *testing.T) {
+	server, _, _ := startTestServerWith(t, ServerConfig{ListenAddress: "127.0.0.1:0", Key: testKey})
+	client, err := NewClient(ClientConfig{Address: server.Addr().String(), Key: testKey})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	if result, err := client.ProbeTCP(context.Background()); err != nil || !result.Reachable {
+		t.Fatalf("ProbeTCP=%+v, %v", result, err)
+	}
+	if result, err := client.ProbeUDP(context.Background()); err != nil || !result.Reachable {
+		t.Fatalf("ProbeUDP=%+v, %v", result, err)
+	}
+	if result, err := client.ProbeUDPBurst(context.Background()); err != nil || result.Received != DefaultBurstFrames {
+		t.Fatalf("ProbeUDPBurst=%+v, %v", result, err)
+	}
+	if result, err := client.ProbeThroughput(context.Background(), MinThroughputBytes); err != nil || result.UploadBps <= 0 {
+		t.Fatalf("ProbeThroughput=%+v, %v", result, err)
+	}
+	if stats := server.Stats(); stats != (ServerStats{}) {
+		t.Fatalf("stats=%+v", stats)
+	}
+}
+
+func TestKeyedServerDropsUnauthenticatedFrames(t *testing.T) {
+	server, _, _ := startTestServerWith(t, ServerConfig{ListenAddress: "127.0.0.1:0", Key: testKey})
+	client, err := NewClient(ClientConfig{Address: server.Addr().String(), Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.ProbeUDP(context.Background()); err == nil {
+		t.Fatal("unauthenticated UDP probe was answered")
+	}
+
+	conn, err := net.DialTimeout("tcp", server.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("TCP dial: %v", err)
+	}
+	defer conn.Close()
+	probe, err := newProbeFrame(1)
+	if err != nil {
+		t.Fatalf("newProbeFrame: %v", err)
+	}
+	if err := writeFull(conn, probe[:]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var response [authFrameSize]byte
+	if n, err := conn.Read(response[:]); err == nil {
+		t.Fatalf("unauthenticated TCP frame was answered: %d bytes", n)
+	}
+	if stats := server.Stats(); stats.Unauthenticated < 2 {
+		t.Fatalf("stats=%+v", stats)
+	}
+}
+
+func TestNewServerRejectsShortKey(t *testing.T) {
+	if _, err := NewServer(ServerConfig{ListenAddress: "127.0.0.1:0", Key: []byte("short")}); err == nil {
+		t.Fatal("short key was accepted")
+	}
+	if _, err := NewClient(ClientConfig{Address: "127.0.0.1:9876", Key: []byte("short")}); err == nil {
+		t.Fatal("short client key was accepted")
+	}
+}
+
+func TestKeyedClientRejectsReplayedStampedReply(t *testing.T) {
+	// The responder answers the first probe honestly and replays those
+	// authenticated, stamped replies to every later probe.
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("ListenUDP: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		server := codec{key: testKey}
+		var captured [][]byte
+		var buf [64 * 1024]byte
+		for received := 0; ; received++ {
+			n, addr, err := listener.ReadFromUDP(buf[:])
+			if err != nil {
+				return
+			}
+			if received >= sampleCount {
+				_, _ = listener.WriteToUDP(captured[received%sampleCount], addr)
+				continue
+			}
+			request, err := server.decode(buf[:n], false, time.Now())
+			if err != nil {
+				continue
+			}
+			wire := server.encode(reply(request, time.Now()), true, time.Now())
+			captured = append(captured, wire)
+			_, _ = listener.WriteToUDP(wire, addr)
+		}
+	}()
+
+	client, err := NewClient(ClientConfig{Address: listener.LocalAddr().String(), Key: testKey, Timestamps: true, Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	if result, err := client.ProbeUDP(context.Background()); err != nil || !result.Reachable {
+		t.Fatalf("first ProbeUDP=%+v, %v", result, err)
+	}
+	if result, err := client.ProbeUDP(context.Background()); err == nil || result.Reachable {
+		t.Fatalf("replayed replies were accepted: %+v", result)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 )
@@ -17,14 +18,46 @@ const (
 	sampleCount    = 3
 )
 
+const (
+	// DefaultBurstFrames is the number of frames ProbeUDPBurst sends unless
+	// ClientConfig sets BurstFrames.
+	DefaultBurstFrames = 20
+	// MaxBurstFrames bounds ClientConfig.BurstFrames.
+	MaxBurstFrames = 100
+	// DefaultBurstInterval is the pacing between burst frames unless
+	// ClientConfig sets BurstInterval.
+	DefaultBurstInterval = 10 * time.Millisecond
+	// MinBurstInterval keeps a burst within the burst frame rate a server
+	// admits from one source.
+	MinBurstInterval = time.Second / udpBurstFramesPerSecond
+	// MaxBurstInterval bounds ClientConfig.BurstInterval.
+	MaxBurstInterval = 100 * time.Millisecond
+	// burstDrain is the least time echoes are awaited after the last frame.
+	burstDrain = 250 * time.Millisecond
+)
+
+// ClientConfig configures a Client. With a Key every frame is authenticated
+// and the server must use the same key. Timestamps asks the server for its
+// receive and send times on every probe and burst frame so the RTT can be
+// split into one-way delays; servers without timestamp support drop such
+// frames. BurstFrames and BurstInterval size and pace ProbeUDPBurst; zero
+// selects DefaultBurstFrames and DefaultBurstInterval.
 type ClientConfig struct {
-	Address string
-	Timeout time.Duration
+	Address       string
+	Timeout       time.Duration
+	Key           []byte
+	Timestamps    bool
+	BurstFrames   int
+	BurstInterval time.Duration
 }
 
 type Client struct {
-	address string
-	timeout time.Duration
+	address       string
+	timeout       time.Duration
+	codec         codec
+	timestamps    bool
+	burstFrames   int
+	burstInterval time.Duration
 
 	mu     sync.Mutex
 	closed bool
@@ -40,7 +73,49 @@ func NewClient(config ClientConfig) (*Client, error) {
 	if config.Timeout < minTimeout || config.Timeout > maxTimeout {
 		return nil, fmt.Errorf("fbmeasure timeout must be between %s and %s", minTimeout, maxTimeout)
 	}
-	return &Client{address: config.Address, timeout: config.Timeout}, nil
+	if config.BurstFrames == 0 {
+		config.BurstFrames = DefaultBurstFrames
+	}
+	if config.BurstFrames < 1 || config.BurstFrames > MaxBurstFrames {
+		return nil, fmt.Errorf("fbmeasure burst frames must be between 1 and %d", MaxBurstFrames)
+	}
+	if config.BurstInterval == 0 {
+		config.BurstInterval = DefaultBurstInterval
+	}
+	if config.BurstInterval < MinBurstInterval || config.BurstInterval > MaxBurstInterval {
+		return nil, fmt.Errorf("fbmeasure burst interval must be between %s and %s", MinBurstInterval, MaxBurstInterval)
+	}
+	if err := validateKey(config.Key); err != nil {
+		return nil, err
+	}
+	return &Client{
+		address:       config.Address,
+		timeout:       config.Timeout,
+		codec:         codec{key: config.Key},
+		timestamps:    config.Timestamps,
+		burstFrames:   config.BurstFrames,
+		burstInterval: config.BurstInterval,
+	}, nil
+}
+
+// newRequest returns a probe or burst frame, asking for timestamps when the
+// client is configured to.
+func (c *Client) newRequest(kind byte, sequence uint64) (frame, error) {
+	request, err := newFrame(kind, sequence)
+	if c.timestamps {
+		request[7] = frameFlagTimestamps
+	}
+	return request, err
+}
+
+// echoed reports whether reply answers request. A stamped reply carries the
+// server times in place of the nonce, so only its header must match; the
+// random sequence base of each probe keeps that header unpredictable.
+func (c *Client) echoed(request, reply frame) bool {
+	if request.timestamps() {
+		return [16]byte(reply[:16]) == [16]byte(request[:16])
+	}
+	return reply == request
 }
 
 func (c *Client) Close() error {
@@ -88,10 +163,15 @@ func (c *Client) ProbeTCP(ctx context.Context) (Result, error) {
 	}
 	defer conn.Close()
 
+	base, err := newSequenceBase()
+	if err != nil {
+		return result, err
+	}
 	var minRTT time.Duration
 	var lastErr error
-	for sequence := uint64(0); sequence < sampleCount; sequence++ {
-		probe, frameErr := newProbeFrame(sequence)
+	var samples []delaySample
+	for i := uint64(0); i < sampleCount; i++ {
+		probe, frameErr := c.newRequest(frameKind, base+i)
 		if frameErr != nil {
 			return result, frameErr
 		}
@@ -101,21 +181,21 @@ func (c *Client) ProbeTCP(ctx context.Context) (Result, error) {
 			}
 		}
 		started := time.Now()
-		if err := writeFull(conn, probe[:]); err != nil {
+		if err := writeFull(conn, c.codec.encode(probe, false, started)); err != nil {
 			lastErr = err
 			break
 		}
-		var response [frameSize]byte
-		if _, err := io.ReadFull(conn, response[:]); err != nil {
+		response := make([]byte, c.codec.size())
+		if _, err := io.ReadFull(conn, response); err != nil {
 			lastErr = err
 			break
 		}
-		decoded, err := parseFrame(response[:])
+		decoded, err := c.codec.decode(response, true, time.Now())
 		if err != nil {
 			lastErr = err
 			break
 		}
-		if decoded != probe {
+		if !c.echoed(probe, decoded) {
 			lastErr = errors.New("fbmeasure TCP echo mismatch")
 			break
 		}
@@ -123,8 +203,12 @@ func (c *Client) ProbeTCP(ctx context.Context) (Result, error) {
 		if minRTT == 0 || rtt < minRTT {
 			minRTT = rtt
 		}
+		if probe.timestamps() {
+			samples = append(samples, newDelaySample(started, rtt, decoded))
+		}
 	}
 	if minRTT > 0 {
+		summarizeDelays(&result, samples)
 		result.Reachable = true
 		result.RTT = minRTT
 		result.ObservedAt = time.Now().UTC()
@@ -156,15 +240,20 @@ func (c *Client) ProbeUDP(ctx context.Context) (Result, error) {
 		}
 	}
 
+	base, err := newSequenceBase()
+	if err != nil {
+		return result, err
+	}
 	var minRTT time.Duration
 	var lastErr error
-	for sequence := uint64(0); sequence < sampleCount; sequence++ {
-		probe, frameErr := newProbeFrame(sequence)
+	var samples []delaySample
+	for i := uint64(0); i < sampleCount; i++ {
+		probe, frameErr := c.newRequest(frameKind, base+i)
 		if frameErr != nil {
 			return result, frameErr
 		}
 		started := time.Now()
-		if err := writeFull(conn, probe[:]); err != nil {
+		if err := writeFull(conn, c.codec.encode(probe, false, started)); err != nil {
 			lastErr = err
 			break
 		}
@@ -175,8 +264,8 @@ func (c *Client) ProbeUDP(ctx context.Context) (Result, error) {
 				lastErr = err
 				break
 			}
-			decoded, err := parseFrame(response[:n])
-			if err != nil || decoded != probe {
+			decoded, err := c.codec.decode(response[:n], true, time.Now())
+			if err != nil || !c.echoed(probe, decoded) {
 				if err != nil {
 					lastErr = err
 				} else {
@@ -188,6 +277,9 @@ func (c *Client) ProbeUDP(ctx context.Context) (Result, error) {
 			if minRTT == 0 || rtt < minRTT {
 				minRTT = rtt
 			}
+			if probe.timestamps() {
+				samples = append(samples, newDelaySample(started, rtt, decoded))
+			}
 			break
 		}
 		if opCtx.Err() != nil {
@@ -195,6 +287,7 @@ func (c *Client) ProbeUDP(ctx context.Context) (Result, error) {
 		}
 	}
 	if minRTT > 0 {
+		summarizeDelays(&result, samples)
 		result.Reachable = true
 		result.RTT = minRTT
 		result.ObservedAt = time.Now().UTC()
@@ -206,6 +299,257 @@ func (c *Client) ProbeUDP(ctx context.Context) (Result, error) {
 	return result, lastErr
 }
 
+// ProbeUDPBurst sends the configured number of sequenced frames, one burst
+// interval apart, over one connected UDP socket and reports loss, jitter,
+// reordering and the RTT spread of the echoes. RTT is the minimum. Frames not sent before the
+// timeout are not counted as lost. The burst is reachable when any frame is
+// echoed.
+func (c *Client) ProbeUDPBurst(ctx context.Context) (Result, error) {
+	result := Result{Protocol: ProtocolUDP, ObservedAt: time.Now().UTC()}
+	opCtx, cancel, err := c.operationContext(ctx)
+	if err != nil {
+		return result, err
+	}
+	defer cancel()
+	deadline, _ := opCtx.Deadline()
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(opCtx, "udp", c.address)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+	base, err := newSequenceBase()
+	if err != nil {
+		return result, err
+	}
+
+	var (
+		frames    = make([]frame, c.burstFrames)
+		sentAt    = make([]time.Time, c.burstFrames)
+		rtts      = make([]time.Duration, c.burstFrames)
+		sent      int
+		received  int
+		reordered int
+		highest   = -1
+		maxRTT    time.Duration
+		lastErr   error
+		response  [64 * 1024]byte
+		samples   []delaySample
+	)
+	next := time.Now()
+	var drainUntil time.Time
+	for opCtx.Err() == nil {
+		now := time.Now()
+		if sent < c.burstFrames && !now.Before(next) {
+			probe, frameErr := c.newRequest(frameKindBurst, base+uint64(sent))
+			if frameErr != nil {
+				return result, frameErr
+			}
+			if err := writeFull(conn, c.codec.encode(probe, false, now)); err != nil {
+				lastErr = err
+				break
+			}
+			frames[sent], sentAt[sent] = probe, now
+			sent++
+			next = next.Add(c.burstInterval)
+			if sent == c.burstFrames {
+				drainUntil = now.Add(max(burstDrain, 2*maxRTT))
+			}
+			continue
+		}
+		if sent == c.burstFrames && (received == sent || !now.Before(drainUntil)) {
+			break
+		}
+		wait := next
+		if sent == c.burstFrames {
+			wait = drainUntil
+		}
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		if err := conn.SetReadDeadline(wait); err != nil {
+			return result, err
+		}
+		n, err := conn.Read(response[:])
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) && time.Now().Before(deadline) {
+				continue
+			}
+			lastErr = err
+			break
+		}
+		decoded, err := c.codec.decode(response[:n], true, time.Now())
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		offset := decoded.sequence() - base
+		if offset >= uint64(sent) || !c.echoed(frames[offset], decoded) || rtts[offset] != 0 {
+			lastErr = errors.New("fbmeasure UDP burst echo mismatch")
+			continue
+		}
+		index := int(offset)
+		rtts[index] = max(time.Since(sentAt[index]), time.Nanosecond)
+		maxRTT = max(maxRTT, rtts[index])
+		if decoded.timestamps() {
+			samples = append(samples, newDelaySample(sentAt[index], rtts[index], decoded))
+		}
+		received++
+		if index < highest {
+			reordered++
+		} else {
+			highest = index
+		}
+	}
+	if received == 0 {
+		if lastErr == nil {
+			lastErr = opCtx.Err()
+		}
+		if lastErr == nil {
+			lastErr = errors.New("fbmeasure UDP burst got no echo")
+		}
+		return result, lastErr
+	}
+	summarizeBurst(&result, rtts[:sent])
+	summarizeDelays(&result, samples)
+	result.Reordered = reordered
+	result.Reachable = true
+	result.ObservedAt = time.Now().UTC()
+	return result, nil
+}
+
+// ProbeThroughput transfers size bytes to the server and then size bytes
+// back, each on its own TCP connection bounded by MaxThroughputDuration, and
+// reports both rates. size is clamped to MinThroughputBytes and
+// MaxThroughputBytes, and cancelling ctx aborts a transfer. The server
+// refuses transfers beyond its rate limit by closing the connection.
+func (c *Client) ProbeThroughput(ctx context.Context, size int64) (Result, error) {
+	result := Result{Protocol: ProtocolTCP, ObservedAt: time.Now().UTC()}
+	if c == nil || c.isClosed() {
+		return result, errors.New("fbmeasure client is closed")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	size = min(max(size, MinThroughputBytes), MaxThroughputBytes)
+	upload, err := c.transfer(ctx, throughputUpload, size)
+	if err != nil {
+		return result, fmt.Errorf("fbmeasure upload: %w", err)
+	}
+	download, err := c.transfer(ctx, throughputDownload, size)
+	if err != nil {
+		return result, fmt.Errorf("fbmeasure download: %w", err)
+	}
+	result.Reachable = true
+	result.TransferBytes = size
+	result.UploadBps = float64(size*8) / upload.Seconds()
+	result.DownloadBps = float64(size*8) / download.Seconds()
+	result.ObservedAt = time.Now().UTC()
+	return result, nil
+}
+
+// transfer runs one throughput transfer and returns how long the payload
+// took: for an upload from the first byte written to the acknowledgement, for
+// a download from the acknowledgement to the last byte read.
+func (c *Client) transfer(ctx context.Context, direction byte, size int64) (time.Duration, error) {
+	opCtx, cancel := context.WithTimeout(ctx, MaxThroughputDuration)
+	defer cancel()
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(opCtx, "tcp", c.address)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := opCtx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return 0, err
+		}
+	}
+	// Cancelling ctx aborts the transfer instead of waiting for its deadline.
+	stop := context.AfterFunc(opCtx, func() { _ = conn.Close() })
+	defer stop()
+	request, err := newThroughputFrame(direction, uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	if err := writeFull(conn, c.codec.encode(request, false, time.Now())); err != nil {
+		return 0, err
+	}
+	readAck := func() error {
+		response := make([]byte, c.codec.size())
+		if _, err := io.ReadFull(conn, response); err != nil {
+			return err
+		}
+		if decoded, err := c.codec.decode(response, true, time.Now()); err != nil || decoded != request {
+			return errors.New("fbmeasure throughput acknowledgement mismatch")
+		}
+		return nil
+	}
+	if direction == throughputUpload {
+		var chunk [32 << 10]byte
+		started := time.Now()
+		for remaining := size; remaining > 0; {
+			n := min(remaining, int64(len(chunk)))
+			if err := writeFull(conn, chunk[:n]); err != nil {
+				return 0, err
+			}
+			remaining -= n
+		}
+		if err := readAck(); err != nil {
+			return 0, err
+		}
+		return max(time.Since(started), time.Nanosecond), nil
+	}
+	if err := readAck(); err != nil {
+		return 0, err
+	}
+	started := time.Now()
+	if _, err := io.CopyN(io.Discard, conn, size); err != nil {
+		return 0, err
+	}
+	return max(time.Since(started), time.Nanosecond), nil
+}
+
+// summarizeBurst fills the burst statistics of result from the RTT of each
+// sent frame, zero for a frame without an echo.
+func summarizeBurst(result *Result, rtts []time.Duration) {
+	var total, jitter time.Duration
+	var previous time.Duration
+	pairs := 0
+	result.Sent = len(rtts)
+	for _, rtt := range rtts {
+		if rtt == 0 {
+			continue
+		}
+		result.Received++
+		total += rtt
+		if result.RTTMin == 0 || rtt < result.RTTMin {
+			result.RTTMin = rtt
+		}
+		result.RTTMax = max(result.RTTMax, rtt)
+		if previous != 0 {
+			diff := rtt - previous
+			if diff < 0 {
+				diff = -diff
+			}
+			jitter += diff
+			pairs++
+		}
+		previous = rtt
+	}
+	if result.Sent > 0 {
+		result.Loss = float64(result.Sent-result.Received) / float64(result.Sent)
+	}
+	if result.Received > 0 {
+		result.RTTAvg = total / time.Duration(result.Received)
+	}
+	if pairs > 0 {
+		result.Jitter = jitter / time.Duration(pairs)
+	}
+	result.RTT = result.RTTMin
+}
+
 func writeFull(w io.Writer, data []byte) error {
 	for len(data) > 0 {
 		n, err := w.Write(data)
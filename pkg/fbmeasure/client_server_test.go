@@ -4,13 +4,19 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/netip"
 	"testing"
 	"time"
 )
 
 func startTestServer(t *testing.T) (*Server, context.CancelFunc, <-chan error) {
 	t.Helper()
-	server, err := NewServer(ServerConfig{ListenAddress: "127.0.0.1:0"})
+	return startTestServerWith(t, ServerConfig{ListenAddress: "127.0.0.1:0"})
+}
+
+func startTestServerWith(t *testing.T, config ServerConfig) (*Server, context.CancelFunc, <-chan error) {
+	t.Helper()
+	server, err := NewServer(config)
 	if err != nil {
 		t.Fatalf("NewServer: %v", err)
 	}
@@ -111,3 +117,237 @@ func TestClientRejectsOversizedUDPEcho(t *testing.T) {
 		t.Fatalf("oversized UDP echo was accepted: result=%+v err=%v", result, err)
 	}
 }
+
+func TestClientServerUDPBurst(t *testing.T) {
+	server, _, _ := startTestServer(t)
+	client, err := NewClient(ClientConfig{Address: server.Addr().String()})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	result, err := client.ProbeUDPBurst(context.Background())
+	if err != nil {
+		t.Fatalf("ProbeUDPBurst: %v", err)
+	}
+	if !result.Reachable || result.Sent != DefaultBurstFrames || result.Received != DefaultBurstFrames || result.Loss != 0 {
+		t.Fatalf("unexpected burst result: %+v", result)
+	}
+	if result.RTT != result.RTTMin || result.RTTMin <= 0 || result.RTTMin > result.RTTAvg || result.RTTAvg > result.RTTMax {
+		t.Fatalf("inconsistent burst RTTs: %+v", result)
+	}
+}
+
+func TestUDPBurstReportsLossAndReordering(t *testing.T) {
+	listener, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
+	if err != nil {
+		t.Fatalf("ListenUDP: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		var buf [64 * 1024]byte
+		var held []byte
+		var base uint64
+		for received := 0; ; received++ {
+			n, addr, readErr := listener.ReadFromUDP(buf[:])
+			if readErr != nil {
+				return
+			}
+			probe, err := parseFrame(buf[:n])
+			if err != nil {
+				continue
+			}
+			// Burst sequences start at a random base.
+			if received == 0 {
+				base = probe.sequence()
+			}
+			switch sequence := probe.sequence() - base; {
+			case sequence%4 == 0:
+				// Every fourth frame is lost.
+			case sequence == 1:
+				held = append([]byte(nil), probe[:]...)
+			default:
+				_, _ = listener.WriteToUDP(probe[:], addr)
+				if held != nil {
+					_, _ = listener.WriteToUDP(held, addr)
+					held = nil
+				}
+			}
+		}
+	}()
+
+	client, err := NewClient(ClientConfig{Address: listener.LocalAddr().String()})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	result, err := client.ProbeUDPBurst(context.Background())
+	if err != nil {
+		t.Fatalf("ProbeUDPBurst: %v", err)
+	}
+	if result.Sent != DefaultBurstFrames || result.Received != DefaultBurstFrames-5 || result.Loss != 0.25 || result.Reordered != 1 {
+		t.Fatalf("unexpected burst result: %+v", result)
+	}
+	if result.Jitter <= 0 {
+		t.Fatalf("expected jitter from the held frame, got %+v", result)
+	}
+}
+
+func TestServerRejectsTCPBurstFrames(t *testing.T) {
+	server, _, _ := startTestServer(t)
+	conn, err := net.DialTimeout("tcp", server.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("TCP dial: %v", err)
+	}
+	defer conn.Close()
+	probe, err := newBurstFrame(0)
+	if err != nil {
+		t.Fatalf("newBurstFrame: %v", err)
+	}
+	if err := writeFull(conn, probe[:]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var response [frameSize]byte
+	if n, err := conn.Read(response[:]); err == nil {
+		t.Fatalf("burst frame was echoed over TCP: %d bytes", n)
+	}
+}
+
+func TestClientUDPBurstUsesConfiguredSize(t *testing.T) {
+	server, _, _ := startTestServer(t)
+	client, err := NewClient(ClientConfig{Address: server.Addr().String(), BurstFrames: 8, BurstInterval: 2 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	result, err := client.ProbeUDPBurst(context.Background())
+	if err != nil || result.Sent != 8 || result.Received != 8 {
+		t.Fatalf("ProbeUDPBurst = %+v, %v", result, err)
+	}
+	if _, err := NewClient(ClientConfig{Address: server.Addr().String(), BurstFrames: MaxBurstFrames + 1}); err == nil {
+		t.Fatal("expected an oversized burst to be refused")
+	}
+	if _, err := NewClient(ClientConfig{Address: server.Addr().String(), BurstInterval: time.Millisecond}); err == nil {
+		t.Fatal("expected a burst faster than the server admits to be refused")
+	}
+}
+
+func TestServerLimitsUDPRatePerSource(t *testing.T) {
+	server := &Server{udpSources: make(map[netip.Addr]*udpSourceWindow)}
+	now := time.Now()
+	busy, quiet := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")
+	for range udpPacketsPerSecond {
+		if !server.allowUDPPacket(busy, false, now) {
+			t.Fatal("probe within the source rate was dropped")
+		}
+	}
+	if server.allowUDPPacket(busy, false, now) {
+		t.Fatal("probe beyond the source rate was admitted")
+	}
+	if !server.allowUDPPacket(busy, true, now) {
+		t.Fatal("burst frame was counted against the probe rate")
+	}
+	if !server.allowUDPPacket(quiet, false, now) {
+		t.Fatal("another source was limited by the busy one")
+	}
+	if !server.allowUDPPacket(busy, false, now.Add(time.Second)) {
+		t.Fatal("probe in the next window was dropped")
+	}
+}
+
+func TestClientServerThroughput(t *testing.T) {
+	server, _, _ := startTestServer(t)
+	client, err := NewClient(ClientConfig{Address: server.Addr().String()})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+
+	result, err := client.ProbeThroughput(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("ProbeThroughput: %v", err)
+	}
+	if !result.Reachable || result.TransferBytes != MinThroughputBytes || result.UploadBps <= 0 || result.DownloadBps <= 0 {
+		t.Fatalf("unexpected throughput result: %+v", result)
+	}
+}
+
+func TestClientThroughputStopsOnCancel(t *testing.T) {
+	// The listener accepts but never acknowledges, so only cancellation
+	// ends the transfer before MaxThroughputDuration.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	client, err := NewClient(ClientConfig{Address: ln.Addr().String()})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(100*time.Millisecond, cancel)
+	started := time.Now()
+	if _, err := client.ProbeThroughput(ctx, MinThroughputBytes); err == nil {
+		t.Fatal("expected a cancelled transfer to fail")
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Fatalf("cancelled transfer took %s", elapsed)
+	}
+}
+
+func TestServerRefusesOversizedThroughput(t *testing.T) {
+	server, _, _ := startTestServer(t)
+	conn, err := net.DialTimeout("tcp", server.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatalf("TCP dial: %v", err)
+	}
+	defer conn.Close()
+	request, err := newThroughputFrame(throughputDownload, MaxThroughputBytes+1)
+	if err != nil {
+		t.Fatalf("newThroughputFrame: %v", err)
+	}
+	if err := writeFull(conn, request[:]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	var response [frameSize]byte
+	if n, err := conn.Read(response[:]); err == nil {
+		t.Fatalf("oversized throughput request was answered: %d bytes", n)
+	}
+}
+
+func TestThroughputLimiterBoundsRateAndConcurrency(t *testing.T) {
+	var limiter throughputLimiter
+	now := time.Unix(100, 0)
+	for i := 0; i < maxThroughputTransfers; i++ {
+		if !limiter.acquire(now) {
+			t.Fatalf("transfer %d refused", i)
+		}
+	}
+	if limiter.acquire(now) {
+		t.Fatal("transfer beyond the concurrency limit was admitted")
+	}
+	for i := maxThroughputTransfers; i < throughputPerMinute; i++ {
+		limiter.release()
+		if !limiter.acquire(now) {
+			t.Fatalf("transfer %d refused", i)
+		}
+	}
+	limiter.release()
+	if limiter.acquire(now.Add(time.Second)) {
+		t.Fatal("transfer beyond the per-minute limit was admitted")
+	}
+	if !limiter.acquire(now.Add(time.Minute)) {
+		t.Fatal("transfer refused in a new window")
+	}
+}
@@ -0,0 +1,96 @@
+package fbmeasure
+
+import (
+	"time"
+)
+
+// minSkewSpan is the shortest run of samples a clock skew is estimated from.
+// Over a single probe the offset noise outweighs any drift.
+const minSkewSpan = 100 * time.Millisecond
+
+// delaySample is one echo of a frame that requested timestamps. forward is
+// the server receive time minus the client send time and back the client
+// receive time minus the server send time; both include the clock offset
+// between the hosts with opposite signs.
+type delaySample struct {
+	sent    time.Time
+	forward time.Duration
+	back    time.Duration
+}
+
+func newDelaySample(sent time.Time, rtt time.Duration, reply frame) delaySample {
+	serverReceived, serverSent := reply.serverTimes()
+	return delaySample{
+		sent:    sent,
+		forward: serverReceived.Sub(sent),
+		back:    sent.Add(rtt).Sub(serverSent),
+	}
+}
+
+// summarizeDelays splits the RTT of result into forward and return delay
+// the way NTP does: the sample with the least network delay (forward plus
+// back, which excludes the server's processing time) gives the clock offset,
+// and each sample's one-way delays are corrected by it. A constant path
+// asymmetry cannot be told apart from a clock offset, so the least delay is
+// split evenly; delay above it is counted on the leg where it occurred. The
+// clock skew is the least-squares drift of the per-sample offsets, in parts
+// per million, once the samples span minSkewSpan.
+func summarizeDelays(result *Result, samples []delaySample) {
+	if len(samples) == 0 {
+		return
+	}
+	best := samples[0]
+	for _, sample := range samples[1:] {
+		if sample.forward+sample.back < best.forward+best.back {
+			best = sample
+		}
+	}
+	offset := (best.forward - best.back) / 2
+	var forward, back time.Duration
+	for _, sample := range samples {
+		forward += sample.forward - offset
+		back += sample.back + offset
+	}
+	count := time.Duration(len(samples))
+	result.ForwardDelay = max(forward/count, 0)
+	result.ReturnDelay = max(back/count, 0)
+	result.ClockOffset = offset
+
+	first, last := samples[0].sent, samples[0].sent
+	for _, sample := range samples {
+		first, last = minTime(first, sample.sent), maxTime(last, sample.sent)
+	}
+	if last.Sub(first) < minSkewSpan {
+		return
+	}
+	var meanX, meanY float64
+	for _, sample := range samples {
+		meanX += sample.sent.Sub(first).Seconds()
+		meanY += ((sample.forward - sample.back) / 2).Seconds()
+	}
+	meanX /= float64(len(samples))
+	meanY /= float64(len(samples))
+	var covariance, variance float64
+	for _, sample := range samples {
+		x := sample.sent.Sub(first).Seconds() - meanX
+		covariance += x * (((sample.forward - sample.back) / 2).Seconds() - meanY)
+		variance += x * x
+	}
+	if variance > 0 {
+		result.ClockSkew = covariance / variance * 1e6
+	}
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,76 @@
+package fbmeasure
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSummarizeDelaysSplitsRTT(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	offset := 40 * time.Millisecond
+	// Every sample has a 5ms path each way; two also queue 10ms on the way
+	// back.
+	sample := func(at time.Duration, forward, back time.Duration) delaySample {
+		return delaySample{sent: start.Add(at), forward: forward + offset, back: back - offset}
+	}
+	samples := []delaySample{
+		sample(0, 5*time.Millisecond, 15*time.Millisecond),
+		sample(10*time.Millisecond, 5*time.Millisecond, 5*time.Millisecond),
+		sample(20*time.Millisecond, 5*time.Millisecond, 15*time.Millisecond),
+	}
+	var result Result
+	summarizeDelays(&result, samples)
+	if result.ClockOffset != offset {
+		t.Fatalf("ClockOffset=%s, want %s", result.ClockOffset, offset)
+	}
+	if result.ForwardDelay != 5*time.Millisecond {
+		t.Fatalf("ForwardDelay=%s", result.ForwardDelay)
+	}
+	if want := 35 * time.Millisecond / 3; result.ReturnDelay != want {
+		t.Fatalf("ReturnDelay=%s, want %s", result.ReturnDelay, want)
+	}
+	if result.ClockSkew != 0 {
+		t.Fatalf("ClockSkew=%f over a short span", result.ClockSkew)
+	}
+}
+
+func TestSummarizeDelaysEstimatesSkew(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	var samples []delaySample
+	for i := range 20 {
+		at := time.Duration(i) * 10 * time.Millisecond
+		// The server clock gains 100µs per second.
+		drift := time.Duration(float64(at) * 100e-6)
+		samples = append(samples, delaySample{sent: start.Add(at), forward: 5*time.Millisecond + drift, back: 5*time.Millisecond - drift})
+	}
+	var result Result
+	summarizeDelays(&result, samples)
+	if math.Abs(result.ClockSkew-100) > 1 {
+		t.Fatalf("ClockSkew=%f, want about 100 ppm", result.ClockSkew)
+	}
+}
+
+func TestClientServerTimestamps(t *testing.T) {
+	server, _, _ := startTestServer(t)
+	client, err := NewClient(ClientConfig{Address: server.Addr().String(), Timestamps: true})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	for name, probe := range map[string]func(context.Context) (Result, error){
+		"tcp":   client.ProbeTCP,
+		"udp":   client.ProbeUDP,
+		"burst": client.ProbeUDPBurst,
+	} {
+		result, err := probe(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// Both ends share one clock, so the offset is at most the delay.
+		if result.ForwardDelay+result.ReturnDelay <= 0 || result.ClockOffset.Abs() > 100*time.Millisecond {
+			t.Fatalf("%s: unexpected delays: %+v", name, result)
+		}
+	}
+}
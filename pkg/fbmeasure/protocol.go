@@ -5,12 +5,30 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"time"
 )
 
 const (
 	frameSize    = 32
 	frameVersion = 1
 	frameKind    = 1
+	// frameKindBurst marks the sequenced frames of a UDP burst. The server
+	// echoes them like probe frames but admits them under a separate rate.
+	frameKindBurst = 2
+	// frameKindThroughput opens a bounded bulk transfer on a TCP
+	// connection. Bytes 16..24 carry the transfer size and byte 24 the
+	// direction.
+	frameKindThroughput = 3
+	// frameFlagTimestamps in byte 7 of a probe or burst frame asks the
+	// server to replace bytes 16..32 of its reply with its receive and send
+	// times in Unix nanoseconds.
+	frameFlagTimestamps = 1
+)
+
+// Throughput directions, seen from the client.
+const (
+	throughputUpload   = 1
+	throughputDownload = 2
 )
 
 var frameMagic = [4]byte{'F', 'B', 'M', '1'}
@@ -25,10 +43,28 @@ const (
 type frame [frameSize]byte
 
 func newProbeFrame(sequence uint64) (frame, error) {
+	return newFrame(frameKind, sequence)
+}
+
+func newBurstFrame(sequence uint64) (frame, error) {
+	return newFrame(frameKindBurst, sequence)
+}
+
+func newThroughputFrame(direction byte, size uint64) (frame, error) {
+	result, err := newFrame(frameKindThroughput, 0)
+	if err != nil {
+		return frame{}, err
+	}
+	binary.BigEndian.PutUint64(result[16:24], size)
+	result[24] = direction
+	return result, nil
+}
+
+func newFrame(kind byte, sequence uint64) (frame, error) {
 	var result frame
 	copy(result[0:4], frameMagic[:])
 	result[4] = frameVersion
-	result[5] = frameKind
+	result[5] = kind
 	binary.BigEndian.PutUint64(result[8:16], sequence)
 	if _, err := rand.Read(result[16:]); err != nil {
 		return frame{}, err
@@ -36,6 +72,17 @@ func newProbeFrame(sequence uint64) (frame, error) {
 	return result, nil
 }
 
+// newSequenceBase returns a random first sequence number. A stamped reply
+// echoes only the header and sequence of its request, so a fresh base per
+// probe keeps a reply to an earlier probe from matching a later one.
+func newSequenceBase() (uint64, error) {
+	var base [8]byte
+	if _, err := rand.Read(base[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(base[:]), nil
+}
+
 func parseFrame(data []byte) (frame, error) {
 	if len(data) != frameSize {
 		return frame{}, fmt.Errorf("invalid frame size: %d", len(data))
@@ -48,15 +95,47 @@ func parseFrame(data []byte) (frame, error) {
 	if result[4] != frameVersion {
 		return frame{}, fmt.Errorf("unsupported frame version: %d", result[4])
 	}
-	if result[5] != frameKind {
+	if result[5] != frameKind && result[5] != frameKindBurst && result[5] != frameKindThroughput {
 		return frame{}, fmt.Errorf("unsupported frame kind: %d", result[5])
 	}
-	if result[6] != 0 || result[7] != 0 {
+	if result[6] != 0 || result[7]&^frameFlagTimestamps != 0 {
 		return frame{}, errors.New("reserved frame fields must be zero")
 	}
+	if result[7] != 0 && result[5] == frameKindThroughput {
+		return frame{}, errors.New("throughput frames cannot request timestamps")
+	}
 	return result, nil
 }
 
 func (f frame) sequence() uint64 {
 	return binary.BigEndian.Uint64(f[8:16])
 }
+
+func (f frame) burst() bool {
+	return f[5] == frameKindBurst
+}
+
+func (f frame) timestamps() bool {
+	return f[7] == frameFlagTimestamps
+}
+
+// stamped returns the reply to a frame that requested timestamps.
+func (f frame) stamped(received, sent time.Time) frame {
+	binary.BigEndian.PutUint64(f[16:24], uint64(received.UnixNano()))
+	binary.BigEndian.PutUint64(f[24:32], uint64(sent.UnixNano()))
+	return f
+}
+
+// serverTimes returns the receive and send times of a stamped reply.
+func (f frame) serverTimes() (received, sent time.Time) {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(f[16:24]))), time.Unix(0, int64(binary.BigEndian.Uint64(f[24:32])))
+}
+
+// throughput returns the direction and size of a throughput frame; ok is
+// false for other frames.
+func (f frame) throughput() (direction byte, size uint64, ok bool) {
+	if f[5] != frameKindThroughput {
+		return 0, 0, false
+	}
+	return f[24], binary.BigEndian.Uint64(f[16:24]), true
+}
@@ -3,6 +3,7 @@ package fbmeasure
 import (
 	"bytes"
 	"testing"
+	"time"
 )
 
 func TestFrameRoundTrip(t *testing.T) {
@@ -40,7 +41,7 @@ func TestParseFrameRejectsMalformedInput(t *testing.T) {
 		{name: "long", data: append(copyFrame(), 0)},
 		{name: "magic", data: func() []byte { data := copyFrame(); copy(data[0:4], []byte("BAD!")); return data }()},
 		{name: "version", data: func() []byte { data := copyFrame(); data[4] = 2; return data }()},
-		{name: "kind", data: func() []byte { data := copyFrame(); data[5] = 2; return data }()},
+		{name: "kind", data: func() []byte { data := copyFrame(); data[5] = 9; return data }()},
 		{name: "reserved", data: func() []byte { data := copyFrame(); data[6] = 1; return data }()},
 	}
 	for _, tt := range tests {
@@ -52,6 +53,20 @@ func TestParseFrameRejectsMalformedInput(t *testing.T) {
 	}
 }
 
+func TestBurstFrameRoundTrip(t *testing.T) {
+	want, err := newBurstFrame(7)
+	if err != nil {
+		t.Fatalf("newBurstFrame: %v", err)
+	}
+	got, err := parseFrame(want[:])
+	if err != nil {
+		t.Fatalf("parseFrame: %v", err)
+	}
+	if got != want || !got.burst() || got.sequence() != 7 {
+		t.Fatalf("burst frame changed during round trip")
+	}
+}
+
 func TestFrameEchoIsByteExact(t *testing.T) {
 	frame, err := newProbeFrame(3)
 	if err != nil {
@@ -62,3 +77,28 @@ func TestFrameEchoIsByteExact(t *testing.T) {
 		t.Fatalf("frame was not byte exact")
 	}
 }
+
+func TestTimestampFrames(t *testing.T) {
+	request, err := newProbeFrame(3)
+	if err != nil {
+		t.Fatalf("newProbeFrame: %v", err)
+	}
+	request[7] = frameFlagTimestamps
+	if _, err := parseFrame(request[:]); err != nil || !request.timestamps() {
+		t.Fatalf("timestamp request rejected: %v", err)
+	}
+	received := time.Unix(1_700_000_000, 123)
+	reply := request.stamped(received, received.Add(time.Microsecond))
+	gotReceived, gotSent := reply.serverTimes()
+	if !gotReceived.Equal(received) || gotSent.Sub(gotReceived) != time.Microsecond || reply.sequence() != 3 {
+		t.Fatalf("serverTimes=%s, %s", gotReceived, gotSent)
+	}
+	throughput, err := newThroughputFrame(throughputUpload, MinThroughputBytes)
+	if err != nil {
+		t.Fatalf("newThroughputFrame: %v", err)
+	}
+	throughput[7] = frameFlagTimestamps
+	if _, err := parseFrame(throughput[:]); err == nil {
+		t.Fatal("throughput frame with timestamps was accepted")
+	}
+}
@@ -9,4 +9,33 @@ type Result struct {
 	Reachable  bool
 	RTT        time.Duration
 	ObservedAt time.Time
+
+	// The remaining fields are set by ProbeUDPBurst only. Loss is the share
+	// of sent frames without an echo, Jitter the mean RTT difference between
+	// consecutive echoed frames, and Reordered the echoes that arrived after
+	// a later frame's echo.
+	Sent      int
+	Received  int
+	Loss      float64
+	Jitter    time.Duration
+	Reordered int
+	RTTMin    time.Duration
+	RTTAvg    time.Duration
+	RTTMax    time.Duration
+
+	// UploadBps and DownloadBps are set by ProbeThroughput, in bits per
+	// second over TransferBytes in each direction.
+	UploadBps     float64
+	DownloadBps   float64
+	TransferBytes int64
+
+	// The remaining fields are set when ClientConfig.Timestamps is enabled.
+	// ForwardDelay is the client-to-server delay and ReturnDelay the
+	// server-to-client delay, both averaged over the echoed frames.
+	// ClockOffset is the server clock minus the client clock, and ClockSkew
+	// their drift in parts per million, estimated over bursts only.
+	ForwardDelay time.Duration
+	ReturnDelay  time.Duration
+	ClockOffset  time.Duration
+	ClockSkew    float64
 }
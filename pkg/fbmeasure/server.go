@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,35 +17,83 @@ const (
 	maxTCPConnections    = 64
 	maxTCPFrames         = 3
 	tcpIdleTimeout       = 5 * time.Second
-	udpPacketsPerSecond  = 100
+	// The UDP rates apply per source address. udpBurstFramesPerSecond admits
+	// burst frames apart from single probes, so a burst neither starves
+	// probes nor loses frames to their limit.
+	udpPacketsPerSecond     = 100
+	udpBurstFramesPerSecond = 500
+	// maxUDPSources bounds the source addresses whose rate is tracked; frames
+	// of a new source are dropped while every tracked source is active.
+	maxUDPSources = 4096
+	// Throughput transfers are limited in number, concurrency, size and
+	// duration so the server cannot be used as a bulk traffic source.
+	throughputPerMinute    = 12
+	maxThroughputTransfers = 2
 )
 
+const (
+	// MaxThroughputBytes is the largest transfer in one direction.
+	MaxThroughputBytes = 16 << 20
+	// MinThroughputBytes is the smallest transfer in one direction.
+	MinThroughputBytes = 64 << 10
+	// MaxThroughputDuration bounds one transfer.
+	MaxThroughputDuration = 10 * time.Second
+)
+
+// ServerConfig configures a Server. With a Key only authenticated frames are
+// answered; every other frame is dropped without a reply and counted.
 type ServerConfig struct {
 	ListenAddress string
+	Key           []byte
+}
+
+// ServerStats counts the frames a keyed server dropped.
+type ServerStats struct {
+	Unauthenticated uint64
+	Replayed        uint64
 }
 
 type Server struct {
 	tcpLn   *net.TCPListener
 	udpConn *net.UDPConn
 	addr    netip.AddrPort
+	codec   codec
+
+	unauthenticated atomic.Uint64
+	replayed        atomic.Uint64
 
 	connSem chan struct{}
 	conns   map[net.Conn]struct{}
 	done    chan struct{}
 
-	mu             sync.Mutex
-	closed         bool
-	serveStarted   bool
-	udpWindowStart time.Time
-	udpWindowCount int
-	closeOnce      sync.Once
-	serveWait      sync.WaitGroup
+	mu           sync.Mutex
+	closed       bool
+	serveStarted bool
+	udpSources   map[netip.Addr]*udpSourceWindow
+	throughput   throughputLimiter
+	closeOnce    sync.Once
+	serveWait    sync.WaitGroup
+}
+
+// udpSourceWindow counts the UDP frames of one source address in its current
+// one-second window.
+type udpSourceWindow struct {
+	start  time.Time
+	probes int
+	bursts int
 }
 
 func NewServer(config ServerConfig) (*Server, error) {
 	if config.ListenAddress == "" {
 		config.ListenAddress = defaultListenAddress
 	}
+	if err := validateKey(config.Key); err != nil {
+		return nil, err
+	}
+	serverCodec := codec{key: config.Key}
+	if config.Key != nil {
+		serverCodec.replay = newReplayCache()
+	}
 	tcpAddr, err := net.ResolveTCPAddr("tcp", config.ListenAddress)
 	if err != nil {
 		return nil, fmt.Errorf("resolve fbmeasure listen address: %w", err)
@@ -71,12 +120,14 @@ func NewServer(config ServerConfig) (*Server, error) {
 		return nil, fmt.Errorf("invalid bound address %q", boundTCP.IP)
 	}
 	return &Server{
-		tcpLn:   tcpLn,
-		udpConn: udpConn,
-		addr:    netip.AddrPortFrom(ip, uint16(boundTCP.Port)),
-		connSem: make(chan struct{}, maxTCPConnections),
-		conns:   make(map[net.Conn]struct{}),
-		done:    make(chan struct{}),
+		tcpLn:      tcpLn,
+		udpConn:    udpConn,
+		addr:       netip.AddrPortFrom(ip, uint16(boundTCP.Port)),
+		codec:      serverCodec,
+		connSem:    make(chan struct{}, maxTCPConnections),
+		conns:      make(map[net.Conn]struct{}),
+		done:       make(chan struct{}),
+		udpSources: make(map[netip.Addr]*udpSourceWindow),
 	}, nil
 }
 
@@ -89,6 +140,23 @@ func (s *Server) Addr() netip.AddrPort {
 	return s.addr
 }
 
+// Stats returns the number of frames dropped for failing authentication.
+func (s *Server) Stats() ServerStats {
+	return ServerStats{Unauthenticated: s.unauthenticated.Load(), Replayed: s.replayed.Load()}
+}
+
+// decode parses a request and counts authentication failures.
+func (s *Server) decode(data []byte) (frame, error) {
+	decoded, err := s.codec.decode(data, false, time.Now())
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		s.unauthenticated.Add(1)
+	case errors.Is(err, errReplayed):
+		s.replayed.Add(1)
+	}
+	return decoded, err
+}
+
 func (s *Server) Serve(ctx context.Context) error {
 	if s == nil {
 		return errors.New("fbmeasure server is nil")
@@ -200,27 +268,116 @@ func (s *Server) handleTCP(ctx context.Context, conn net.Conn) {
 			return
 		}
 		_ = conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
-		var raw [frameSize]byte
-		if _, err := io.ReadFull(conn, raw[:]); err != nil {
+		raw := make([]byte, s.codec.size())
+		if _, err := io.ReadFull(conn, raw[:frameSize]); err != nil {
 			return
 		}
-		decoded, err := parseFrame(raw[:])
-		if err != nil {
+		received := time.Now()
+		// A frame of another version is rejected without waiting for the
+		// rest of an authenticated frame.
+		if len(raw) > frameSize {
+			if raw[4] != frameVersionAuth {
+				raw = raw[:frameSize]
+			} else if _, err := io.ReadFull(conn, raw[frameSize:]); err != nil {
+				return
+			}
+		}
+		decoded, err := s.decode(raw)
+		if err != nil || decoded.burst() {
+			return
+		}
+		if _, _, ok := decoded.throughput(); ok {
+			if i == 0 {
+				s.handleThroughput(conn, decoded)
+			}
+			return
+		}
+		if err := writeFull(conn, s.codec.encode(reply(decoded, received), true, time.Now())); err != nil {
+			return
+		}
+	}
+}
+
+// reply is the answer to a probe or burst frame received at received: the
+// frame itself, or the stamped frame when it requested timestamps.
+func reply(request frame, received time.Time) frame {
+	if !request.timestamps() {
+		return request
+	}
+	return request.stamped(received, time.Now())
+}
+
+// handleThroughput runs the transfer requested by the opening frame of conn.
+// An upload is acknowledged by echoing the frame once every byte arrived; a
+// download echoes the frame before sending. A refused transfer closes the
+// connection.
+func (s *Server) handleThroughput(conn net.Conn, request frame) {
+	direction, size, _ := request.throughput()
+	if size < MinThroughputBytes || size > MaxThroughputBytes || direction != throughputUpload && direction != throughputDownload {
+		return
+	}
+	if !s.throughput.acquire(time.Now()) {
+		return
+	}
+	defer s.throughput.release()
+	_ = conn.SetDeadline(time.Now().Add(MaxThroughputDuration))
+	if direction == throughputUpload {
+		if _, err := io.CopyN(io.Discard, conn, int64(size)); err != nil {
 			return
 		}
-		if err := writeFull(conn, decoded[:]); err != nil {
+		_ = writeFull(conn, s.codec.encode(request, true, time.Now()))
+		return
+	}
+	if err := writeFull(conn, s.codec.encode(request, true, time.Now())); err != nil {
+		return
+	}
+	var chunk [32 << 10]byte
+	for remaining := int64(size); remaining > 0; {
+		n := min(remaining, int64(len(chunk)))
+		if err := writeFull(conn, chunk[:n]); err != nil {
 			return
 		}
+		remaining -= n
+	}
+}
+
+// throughputLimiter admits at most throughputPerMinute transfers per minute
+// and maxThroughputTransfers at a time.
+type throughputLimiter struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	started     int
+	active      int
+}
+
+func (l *throughputLimiter) acquire(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.windowStart.IsZero() || now.Sub(l.windowStart) >= time.Minute {
+		l.windowStart, l.started = now, 0
 	}
+	if l.started >= throughputPerMinute || l.active >= maxThroughputTransfers {
+		return false
+	}
+	l.started++
+	l.active++
+	return true
+}
+
+func (l *throughputLimiter) release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
 }
 
 func (s *Server) serveUDP(ctx context.Context) {
-	var buf [frameSize + 1]byte
+	var buf [authFrameSize + 1]byte
 	for {
 		if err := s.udpConn.SetReadDeadline(time.Now().Add(500 * time.Millisecond)); err != nil {
 			return
 		}
 		n, addr, err := s.udpConn.ReadFromUDP(buf[:])
+		received := time.Now()
 		if err != nil {
 			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
 				return
@@ -230,25 +387,43 @@ func (s *Server) serveUDP(ctx context.Context) {
 			}
 			continue
 		}
-		decoded, err := parseFrame(buf[:n])
-		if err != nil || !s.allowUDPPacket() {
+		decoded, err := s.decode(buf[:n])
+		if err != nil || !s.allowUDPPacket(addr.AddrPort().Addr().Unmap(), decoded.burst(), received) {
 			continue
 		}
-		_, _ = s.udpConn.WriteToUDP(decoded[:], addr)
+		_, _ = s.udpConn.WriteToUDP(s.codec.encode(reply(decoded, received), true, time.Now()), addr)
 	}
 }
 
-func (s *Server) allowUDPPacket() bool {
+// allowUDPPacket applies the UDP rate limits of source.
+func (s *Server) allowUDPPacket(source netip.Addr, burst bool, now time.Time) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	now := time.Now()
-	if s.udpWindowStart.IsZero() || now.Sub(s.udpWindowStart) >= time.Second {
-		s.udpWindowStart = now
-		s.udpWindowCount = 0
+	window := s.udpSources[source]
+	if window == nil {
+		if len(s.udpSources) >= maxUDPSources {
+			for addr, other := range s.udpSources {
+				if now.Sub(other.start) >= time.Second {
+					delete(s.udpSources, addr)
+				}
+			}
+			if len(s.udpSources) >= maxUDPSources {
+				return false
+			}
+		}
+		window = &udpSourceWindow{}
+		s.udpSources[source] = window
+	}
+	if window.start.IsZero() || now.Sub(window.start) >= time.Second {
+		*window = udpSourceWindow{start: now}
+	}
+	count, limit := &window.probes, udpPacketsPerSecond
+	if burst {
+		count, limit = &window.bursts, udpBurstFramesPerSecond
 	}
-	if s.udpWindowCount >= udpPacketsPerSecond {
+	if *count >= limit {
 		return false
 	}
-	s.udpWindowCount++
+	*count++
 	return true
 }
@@ -33,8 +33,10 @@ async function requestJSON(path, options = {}) {
 function renderStatus(data) {
   state.status = data;
   const rows = document.querySelector('#upstream-rows'); rows.replaceChildren();
-  for (const up of data.upstreams || []) { const row = document.createElement('tr'); cell(row, up.tag); cell(row, up.health_state); cell(row, up.rtt_ms); rows.append(row); }
+  const drains = new Map((data.drains || []).map((drain) => [drain.upstream, drain]));
+  for (const up of data.upstreams || []) { const row = document.createElement('tr'); cell(row, up.tag); cell(row, up.health_signal && up.health_signal !== 'probe' ? `${up.health_state} (${up.health_signal})` : up.health_state); cell(row, [String(up.rtt_ms), up.loss ? `(loss ${(up.loss.ratio * 100).toFixed(1)}%)` : '', up.delay ? `(up ${up.delay.upload_ms.toFixed(1)} / down ${up.delay.download_ms.toFixed(1)})` : ''].filter(Boolean).join(' ')); cell(row, up.drain ? drainState(drains.get(up.drain.upstream) || up.drain) : ''); rows.append(row); }
 }
+function drainState(drain) { if (drain.drained_at) return drain.closed_at ? 'drained (closed)' : 'drained'; return `draining · ${drain.tcp_flows || 0} tcp / ${drain.udp_flows || 0} udp · ${drain.bytes_up || 0}/${drain.bytes_down || 0} B`; }
 function renderIdentity(data) {
   state.identity = data;
   const values = [data.hostname, data.version, ...(Array.isArray(data.ips) ? data.ips : [])].filter(Boolean);
@@ -47,7 +49,7 @@ async function loadIdentity() {
   catch (error) { if (error.message !== 'unauthorized') document.querySelector('#instance-summary').textContent = 'identity unavailable'; }
 }
 function currentRoute() { return state.routes.find((route) => route.route === document.querySelector('#route-name').value) || state.routes[0]; }
-function routeState(route) { if (route.override_state === 'active') return 'overridden'; if (route.override_state === 'fallback') return 'fallback'; return route.strategy === 'adaptive' ? 'automatic' : 'configured'; }
+function routeState(route) { if (route.override_state === 'active') return 'overridden'; if (route.override_state === 'fallback') return 'fallback'; return route.strategy === 'static' ? 'configured' : 'automatic'; }
 function renderRoutes(data) {
   state.routes = Array.isArray(data) ? data : (data && Array.isArray(data.routes) ? data.routes : []);
   const routeSelect = document.querySelector('#route-name'); const upstreamSelect = document.querySelector('#route-upstream');
@@ -152,13 +154,13 @@ function saveAuditURL() {
 }
 function renderAudit(data) {
   state.audit = data;
-  const count = data && data.result && !Array.isArray(data.result) ? data.result.total : (data && Array.isArray(data.result) ? data.result.length : 0);
+  const count = data && data.source === 'measurements' ? data.result.buckets.length : data && data.result && !Array.isArray(data.result) ? data.result.total : (data && Array.isArray(data.result) ? data.result.length : 0);
   document.querySelector('#audit-count').textContent = data ? `${count} rows · ${data.source}${state.auditDuration == null ? '' : ` · ${state.auditDuration.toFixed(0)} ms`}` : 'enter a query and press RUN';
   const head = document.querySelector('#audit-head'); const rows = document.querySelector('#audit-rows'); head.replaceChildren(); rows.replaceChildren();
   const raw = document.querySelector('#audit-raw'); raw.textContent = data ? JSON.stringify(data, null, 2) : ''; raw.hidden = state.auditView !== 'raw'; document.querySelector('#audit-table-view').hidden = state.auditView !== 'table'; document.querySelector('#audit-view-toggle').textContent = state.auditView === 'table' ? 'RAW' : 'TABLE';
   if (!data) return;
-  const result = data.result; const records = Array.isArray(result) ? result : (result.records || []);
-  const columns = Array.isArray(result) ? (data.source === 'top asns' ? ['asn', 'as_org', 'country', 'bytes_up', 'bytes_down', 'bytes_total', 'flow_count'] : data.source === 'top tags' ? ['tag', 'bytes_up', 'bytes_down', 'bytes_total', 'flow_count'] : ['client_ip', 'bytes_up', 'bytes_down', 'bytes_total', 'flow_count']) : ['entry_type', 'ip', 'protocol', 'port', 'recorded_at', 'upstream', 'reason', 'close_reason', ...(data.source === 'flows' || data.source === 'events' ? ['tags'] : []), 'bytes_up', 'bytes_down', 'flow_id'];
+  const result = data.result; const records = Array.isArray(result) ? result : (result.records || result.buckets || []);
+  const columns = data.source === 'measurements' ? ['start', 'upstream', 'protocol', 'count', 'failures', 'rtt_min_ms', 'rtt_avg_ms', 'rtt_p95_ms', 'last_error'] : Array.isArray(result) ? (data.source === 'top asns' ? ['asn', 'as_org', 'country', 'bytes_up', 'bytes_down', 'bytes_total', 'flow_count'] : data.source === 'top tags' ? ['tag', 'bytes_up', 'bytes_down', 'bytes_total', 'flow_count'] : ['client_ip', 'bytes_up', 'bytes_down', 'bytes_total', 'flow_count']) : ['entry_type', 'ip', 'protocol', 'port', 'recorded_at', 'upstream', 'reason', 'close_reason', ...(data.source === 'flows' || data.source === 'events' ? ['tags'] : []), 'bytes_up', 'bytes_down', 'flow_id'];
   const header = document.createElement('tr'); for (const column of columns) cell(header, column); head.append(header);
   for (const record of records) { const row = document.createElement('tr'); for (const column of columns) cell(row, record[column]); rows.append(row); }
 }